@@ -0,0 +1,450 @@
+// Package api serves the lights over HTTP as a REST API of JSON documents,
+// for dashboards and buttons to drive them. Every request but the one for
+// the OpenAPI document at /openapi.json needs the token of the API, as in
+//
+//	curl -X POST -H "Authorization: Bearer $TOKEN" localhost:8080/api/lights/1/toggle
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// openApi describes the API, as served at /openapi.json.
+//
+//go:embed openapi.json
+var openApi []byte
+
+const (
+	readHeaderTimeout = 10 * time.Second
+	shutdownTimeout   = 10 * time.Second
+	// maxBody is the largest request body read.
+	maxBody = 64 << 10
+)
+
+// Config tells where the API listens, none when Listen is empty, and the
+// token that requests must bear.
+type Config struct {
+	Listen string `yaml:"listen"`
+	Token  string `yaml:"token" envconfig:"API_TOKEN"`
+}
+
+// Check tells whether the API can be served as configured.
+func (c Config) Check() error {
+	if c.Token == "" {
+		return errors.New("api: a token is required, set api.token or API_TOKEN")
+	}
+	return nil
+}
+
+type Server struct {
+	Config Config
+	Client client.Functions
+}
+
+// Light is a light as the API shows it. IsOn is null for a light that did
+// not answer.
+type Light struct {
+	Id         string     `json:"id"`
+	Name       string     `json:"name"`
+	Kind       wiz.Kind   `json:"kind"`
+	Model      string     `json:"model,omitempty"`
+	IpAddress  string     `json:"ipAddress"`
+	MacAddress string     `json:"macAddress"`
+	IsOn       *bool      `json:"isOn"`
+	Dimming    int        `json:"dimming,omitempty"`
+	Watts      *float64   `json:"watts,omitempty"`
+	Room       string     `json:"room,omitempty"`
+	Groups     []string   `json:"groups"`
+	Tags       []string   `json:"tags"`
+	LastSeen   *time.Time `json:"lastSeen,omitempty"`
+}
+
+type Brightness struct {
+	Brightness int `json:"brightness"`
+}
+
+// Color is either an RGB color or a white temperature in kelvins.
+type Color struct {
+	R           *int `json:"r"`
+	G           *int `json:"g"`
+	B           *int `json:"b"`
+	Temperature int  `json:"temperature"`
+}
+
+// Scene is a scene by name, as the WiZ app shows them.
+type Scene struct {
+	Scene string `json:"scene"`
+}
+
+type Tags struct {
+	Tags []string `json:"tags"`
+}
+
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Serve serves the API until stop is closed, then waits for the requests
+// under way to finish.
+func (s Server) Serve(stop <-chan struct{}) error {
+	if err := s.Config.Check(); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", s.Config.Listen)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: readHeaderTimeout}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	select {
+	case err := <-served:
+		return err
+	case <-stop:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(ctx)
+}
+
+// Handler routes the requests of the API, recorded as coming from it.
+func (s Server) Handler() http.Handler {
+	h := handler{client: s.Client.WithSource(db.SourceAPI)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openApi)
+	})
+
+	api := http.NewServeMux()
+	for _, route := range h.routes() {
+		api.HandleFunc(route.pattern, route.handle)
+	}
+	mux.Handle("/api/", s.authorized(api))
+	return mux
+}
+
+// authorized lets through the requests bearing the token.
+func (s Server) authorized(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.Config.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Config.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gowizcli"`)
+			writeError(w, http.StatusUnauthorized, errors.New("a valid bearer token is required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type handler struct {
+	client commands
+}
+
+// commands is what the handlers need of the client: to command the lights,
+// over a transition, and to tag them.
+type commands interface {
+	client.Lights
+	client.Rooms
+	WithTransition(d time.Duration) client.Functions
+}
+
+type route struct {
+	pattern string
+	handle  http.HandlerFunc
+}
+
+// routes are the operations of the API, each described in openapi.json.
+func (h handler) routes() []route {
+	return []route{
+		{"GET /api/lights", h.lights},
+		{"GET /api/lights/{id}", h.light},
+		{"POST /api/lights/{id}/on", h.command(client.Lights.TurnOn)},
+		{"POST /api/lights/{id}/off", h.command(client.Lights.TurnOff)},
+		{"POST /api/lights/{id}/toggle", h.toggle},
+		{"PUT /api/lights/{id}/brightness", h.brightness},
+		{"PUT /api/lights/{id}/color", h.color},
+		{"PUT /api/lights/{id}/scene", h.scene},
+		{"PUT /api/lights/{id}/tags", h.tags},
+		{"POST /api/discover", h.discover},
+	}
+}
+
+// lights lists the lights with their status, those matching the room, group
+// and tag query given as parameters, or all of them.
+func (h handler) lights(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	selector := client.Selector{Room: query.Get("room"), Group: query.Get("group"), Tags: query.Get("tag")}
+
+	var lights []wiz.Light
+	var err error
+	if selector.IsEmpty() {
+		lights, err = h.client.ShowAll()
+	} else {
+		lights, err = h.selected(selector)
+	}
+	if err != nil {
+		writeError(w, statusOf(err, http.StatusBadRequest), err)
+		return
+	}
+
+	result := make([]Light, len(lights))
+	for i, l := range lights {
+		result[i] = lightOf(l)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (h handler) selected(selector client.Selector) ([]wiz.Light, error) {
+	selected, err := h.client.Select(selector)
+	if err != nil {
+		return nil, err
+	}
+	lights := make([]wiz.Light, len(selected))
+	for i, l := range selected {
+		light, err := h.client.Status(l.Id)
+		if err != nil {
+			return nil, err
+		}
+		lights[i] = *light
+	}
+	return lights, nil
+}
+
+func (h handler) light(w http.ResponseWriter, r *http.Request) {
+	light, err := h.client.Status(r.PathValue("id"))
+	h.respond(w, light, err)
+}
+
+// command runs a command on the light of the path, with the transition given
+// as a parameter, if any.
+func (h handler) command(run func(f client.Lights, lightId string) (*wiz.Light, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		functions, err := h.withTransition(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		light, err := run(functions, r.PathValue("id"))
+		h.respond(w, light, err)
+	}
+}
+
+func (h handler) toggle(w http.ResponseWriter, r *http.Request) {
+	functions, err := h.withTransition(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	light, err := h.client.Status(r.PathValue("id"))
+	if err != nil {
+		h.respond(w, nil, err)
+		return
+	}
+	if light.IsOn == nil {
+		writeError(w, http.StatusBadGateway, fmt.Errorf("light %s did not answer", light.Id))
+		return
+	}
+
+	if *light.IsOn {
+		light, err = functions.TurnOff(light.Id)
+	} else {
+		light, err = functions.TurnOn(light.Id)
+	}
+	h.respond(w, light, err)
+}
+
+func (h handler) brightness(w http.ResponseWriter, r *http.Request) {
+	var body Brightness
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Brightness < wiz.MinDimming || body.Brightness > 100 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("brightness must be from %d to 100", wiz.MinDimming))
+		return
+	}
+	h.setPilot(w, r, wiz.Pilot{IsOn: true, Dimming: body.Brightness})
+}
+
+func (h handler) color(w http.ResponseWriter, r *http.Request) {
+	var body Color
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	rgb := body.R != nil || body.G != nil || body.B != nil
+	switch {
+	case rgb && body.Temperature != 0:
+		writeError(w, http.StatusBadRequest, errors.New("give either r, g and b or a temperature"))
+	case rgb:
+		if !slices.ContainsFunc([]*int{body.R, body.G, body.B}, func(c *int) bool { return c == nil || *c < 0 || *c > 255 }) {
+			h.setPilot(w, r, wiz.Pilot{IsOn: true, Color: &wiz.Rgb{R: *body.R, G: *body.G, B: *body.B}})
+			return
+		}
+		writeError(w, http.StatusBadRequest, errors.New("r, g and b must all be from 0 to 255"))
+	case body.Temperature < wiz.MinTemperatureK || body.Temperature > wiz.MaxTemperatureK:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("temperature must be from %d to %d", wiz.MinTemperatureK, wiz.MaxTemperatureK))
+	default:
+		h.setPilot(w, r, wiz.Pilot{IsOn: true, Temp: body.Temperature})
+	}
+}
+
+func (h handler) scene(w http.ResponseWriter, r *http.Request) {
+	var body Scene
+	if !readJSON(w, r, &body) {
+		return
+	}
+	scene, err := wiz.ParseScene(body.Scene)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	h.setPilot(w, r, wiz.Pilot{IsOn: true, Scene: scene})
+}
+
+func (h handler) setPilot(w http.ResponseWriter, r *http.Request, pilot wiz.Pilot) {
+	h.command(func(f client.Lights, lightId string) (*wiz.Light, error) {
+		return f.SetPilot(lightId, pilot)
+	})(w, r)
+}
+
+// tags sets the tags of a light to those given, removing the others.
+func (h handler) tags(w http.ResponseWriter, r *http.Request) {
+	var body Tags
+	if !readJSON(w, r, &body) {
+		return
+	}
+	selector := client.Selector{Ids: []string{r.PathValue("id")}}
+	lights, err := h.client.Select(selector)
+	if err != nil {
+		writeError(w, statusOf(err, http.StatusBadRequest), err)
+		return
+	}
+
+	var removed []string
+	for _, t := range lights[0].Tags {
+		if !slices.Contains(body.Tags, t) {
+			removed = append(removed, t)
+		}
+	}
+	if len(body.Tags) > 0 {
+		lights, err = h.client.AddTags(selector, body.Tags)
+	}
+	if err == nil && len(removed) > 0 {
+		lights, err = h.client.RemoveTags(selector, removed)
+	}
+	if err != nil {
+		writeError(w, statusOf(err, http.StatusBadRequest), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lightOf(lights[0]))
+}
+
+func (h handler) discover(w http.ResponseWriter, r *http.Request) {
+	lights, err := h.client.Discover()
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	result := make([]Light, len(lights))
+	for i, l := range lights {
+		result[i] = lightOf(l)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// respond writes the light a command left, or its error: the light being
+// unknown, or else failing to answer.
+func (h handler) respond(w http.ResponseWriter, light *wiz.Light, err error) {
+	if err != nil {
+		writeError(w, statusOf(err, http.StatusBadGateway), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lightOf(*light))
+}
+
+func (h handler) withTransition(r *http.Request) (client.Lights, error) {
+	value := r.URL.Query().Get("transition")
+	if value == "" {
+		return h.client, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return nil, fmt.Errorf("invalid transition %q", value)
+	}
+	return h.client.WithTransition(d), nil
+}
+
+func lightOf(l wiz.Light) Light {
+	light := Light{
+		Id:         l.Id,
+		Name:       l.Name,
+		Kind:       l.Kind(),
+		Model:      l.Model,
+		IpAddress:  l.IpAddress,
+		MacAddress: l.MacAddress,
+		IsOn:       l.IsOn,
+		Dimming:    l.Dimming,
+		Watts:      l.Watts,
+		Room:       l.Room,
+		Groups:     l.Groups,
+		Tags:       l.Tags,
+	}
+	if light.Groups == nil {
+		light.Groups = []string{}
+	}
+	if light.Tags == nil {
+		light.Tags = []string{}
+	}
+	if !l.LastSeen.IsZero() {
+		light.LastSeen = &l.LastSeen
+	}
+	return light
+}
+
+// statusOf is the status of an error, fallback but for what is not found.
+func statusOf(err error, fallback int) int {
+	if errors.Is(err, db.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return fallback
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, into any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(into); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("the body is empty")
+		}
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, Error{Error: err.Error()})
+}
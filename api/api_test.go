@@ -0,0 +1,261 @@
+package api
+
+import (
+	"encoding/json"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"gowizcli/wiz/wiztest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testToken = "secret"
+
+func TestServer_RequiresTheToken(t *testing.T) {
+	server, _, _ := newTestServer(t)
+
+	for _, authorization := range []string{"", "Bearer wrong", "secret", "Basic c2VjcmV0"} {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+"/api/lights", nil)
+		if authorization != "" {
+			request.Header.Set("Authorization", authorization)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusUnauthorized || response.Header.Get("WWW-Authenticate") == "" {
+			t.Fatalf("got %d for %q; expected %d", response.StatusCode, authorization, http.StatusUnauthorized)
+		}
+	}
+
+	response, err := http.Get(server.URL + "/openapi.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("got %d; expected the OpenAPI document without a token", response.StatusCode)
+	}
+}
+
+func TestServer_Lights(t *testing.T) {
+	server, storage, wizClient := newTestServer(t)
+	storage.AddTags([]wiz.Light{{Id: "2"}}, []string{"lamp"})
+	wizClient.Unreachable["10.0.0.3"] = true
+
+	var lights []Light
+	if status := do(t, server, "GET", "/api/lights", "", &lights); status != http.StatusOK {
+		t.Fatalf("got %d; expected %d", status, http.StatusOK)
+	}
+	if len(lights) != 3 || *lights[0].IsOn || lights[2].IsOn != nil || lights[0].Tags == nil {
+		t.Fatalf("got %+v; expected three lights, the last unreachable", lights)
+	}
+
+	if status := do(t, server, "GET", "/api/lights?tag=lamp", "", &lights); status != http.StatusOK {
+		t.Fatalf("got %d; expected %d", status, http.StatusOK)
+	}
+	if len(lights) != 1 || lights[0].Id != "2" || lights[0].IsOn == nil {
+		t.Fatalf("got %+v; expected the lamp with its status", lights)
+	}
+
+	var light Light
+	if status := do(t, server, "GET", "/api/lights/1", "", &light); status != http.StatusOK || light.Id != "1" || light.Kind != wiz.KindBulb {
+		t.Fatalf("got %d, %+v; expected light 1", status, light)
+	}
+	if status := do(t, server, "GET", "/api/lights/9", "", nil); status != http.StatusNotFound {
+		t.Fatalf("got %d; expected %d", status, http.StatusNotFound)
+	}
+	if status := do(t, server, "GET", "/api/lights?room=attic", "", nil); status != http.StatusNotFound {
+		t.Fatalf("got %d; expected %d", status, http.StatusNotFound)
+	}
+}
+
+func TestServer_Commands(t *testing.T) {
+	tests := []struct {
+		method, path, body string
+		status             int
+		pilot              wiz.Pilot
+	}{
+		{"POST", "/api/lights/1/on", "", http.StatusOK, wiz.Pilot{IsOn: true, Dimming: 50}},
+		{"POST", "/api/lights/1/toggle", "", http.StatusOK, wiz.Pilot{IsOn: true, Dimming: 50}},
+		{"POST", "/api/lights/2/off", "", http.StatusOK, wiz.Pilot{IsOn: false, Dimming: 50}},
+		{"POST", "/api/lights/2/toggle", "", http.StatusOK, wiz.Pilot{IsOn: false, Dimming: 50}},
+		{"PUT", "/api/lights/1/brightness", `{"brightness": 60}`, http.StatusOK, wiz.Pilot{IsOn: true, Dimming: 60}},
+		{"PUT", "/api/lights/1/color", `{"r": 255, "g": 0, "b": 64}`, http.StatusOK, wiz.Pilot{IsOn: true, Dimming: 50, Color: &wiz.Rgb{R: 255, B: 64}}},
+		{"PUT", "/api/lights/1/color", `{"temperature": 2700}`, http.StatusOK, wiz.Pilot{IsOn: true, Dimming: 50, Temp: 2700}},
+		{"PUT", "/api/lights/1/scene", `{"scene": "tv time"}`, http.StatusOK, wiz.Pilot{IsOn: true, Dimming: 50, Scene: wiz.TVTime}},
+		{"PUT", "/api/lights/1/brightness", `{"brightness": 5}`, http.StatusBadRequest, wiz.Pilot{Dimming: 50}},
+		{"PUT", "/api/lights/1/brightness", `{"level": 60}`, http.StatusBadRequest, wiz.Pilot{Dimming: 50}},
+		{"PUT", "/api/lights/1/brightness", ``, http.StatusBadRequest, wiz.Pilot{Dimming: 50}},
+		{"PUT", "/api/lights/1/color", `{"r": 255}`, http.StatusBadRequest, wiz.Pilot{Dimming: 50}},
+		{"PUT", "/api/lights/1/color", `{"r": 1, "g": 2, "b": 3, "temperature": 2700}`, http.StatusBadRequest, wiz.Pilot{Dimming: 50}},
+		{"PUT", "/api/lights/1/color", `{}`, http.StatusBadRequest, wiz.Pilot{Dimming: 50}},
+		{"PUT", "/api/lights/1/scene", `{"scene": "disco"}`, http.StatusBadRequest, wiz.Pilot{Dimming: 50}},
+		{"POST", "/api/lights/1/on?transition=soon", "", http.StatusBadRequest, wiz.Pilot{Dimming: 50}},
+		{"POST", "/api/lights/9/on", "", http.StatusNotFound, wiz.Pilot{}},
+		{"GET", "/api/lights/1/on", "", http.StatusMethodNotAllowed, wiz.Pilot{Dimming: 50}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.method+" "+test.path+" "+test.body, func(t *testing.T) {
+			server, _, wizClient := newTestServer(t)
+			wizClient.Pilots["10.0.0.1"] = wiz.Pilot{Dimming: 50}
+			wizClient.Pilots["10.0.0.2"] = wiz.Pilot{IsOn: true, Dimming: 50}
+
+			var light Light
+			status := do(t, server, test.method, test.path, test.body, &light)
+			if status != test.status {
+				t.Fatalf("got %d; expected %d", status, test.status)
+			}
+
+			ip := "10.0.0.1"
+			if strings.Contains(test.path, "/2/") {
+				ip = "10.0.0.2"
+			}
+			if got := wizClient.Pilot(ip); !got.Equal(test.pilot) && test.status != http.StatusNotFound {
+				t.Fatalf("got %+v; expected %+v", got, test.pilot)
+			}
+			if status == http.StatusOK && (light.IsOn == nil || *light.IsOn != test.pilot.IsOn) {
+				t.Fatalf("got %+v; expected the light as the command left it", light)
+			}
+		})
+	}
+}
+
+func TestServer_UnreachableLight(t *testing.T) {
+	server, _, wizClient := newTestServer(t)
+	wizClient.Unreachable["10.0.0.1"] = true
+
+	for _, path := range []string{"/api/lights/1/on", "/api/lights/1/toggle"} {
+		var failure Error
+		if status := do(t, server, "POST", path, "", &failure); status != http.StatusBadGateway || failure.Error == "" {
+			t.Fatalf("got %d, %+v for %s; expected %d with the error", status, failure, path, http.StatusBadGateway)
+		}
+	}
+}
+
+func TestServer_Tags(t *testing.T) {
+	server, storage, _ := newTestServer(t)
+	storage.AddTags([]wiz.Light{{Id: "1"}}, []string{"old", "kept"})
+
+	var light Light
+	if status := do(t, server, "PUT", "/api/lights/1/tags", `{"tags": ["kept", "lamp"]}`, &light); status != http.StatusOK {
+		t.Fatalf("got %d; expected %d", status, http.StatusOK)
+	}
+	if !slices.Equal(light.Tags, []string{"kept", "lamp"}) {
+		t.Fatalf("got %v; expected [kept lamp]", light.Tags)
+	}
+
+	if status := do(t, server, "PUT", "/api/lights/1/tags", `{"tags": []}`, &light); status != http.StatusOK || len(light.Tags) != 0 {
+		t.Fatalf("got %d, %v; expected the tags cleared", status, light.Tags)
+	}
+	if status := do(t, server, "PUT", "/api/lights/1/tags", `{"tags": ["a|b"]}`, nil); status != http.StatusBadRequest {
+		t.Fatalf("got %d; expected %d", status, http.StatusBadRequest)
+	}
+	if status := do(t, server, "PUT", "/api/lights/9/tags", `{"tags": ["lamp"]}`, nil); status != http.StatusNotFound {
+		t.Fatalf("got %d; expected %d", status, http.StatusNotFound)
+	}
+}
+
+func TestServer_Discover(t *testing.T) {
+	server, storage, wizClient := newTestServer(t)
+	wizClient.Discovered = []wiz.Light{{Id: "fresh", MacAddress: "dd", IpAddress: "10.0.0.4"}}
+
+	var lights []Light
+	if status := do(t, server, "POST", "/api/discover", "", &lights); status != http.StatusOK {
+		t.Fatalf("got %d; expected %d", status, http.StatusOK)
+	}
+	if len(lights) != 1 || lights[0].MacAddress != "dd" {
+		t.Fatalf("got %+v; expected the discovered light", lights)
+	}
+	if stored, _ := storage.FindAll(); len(stored) != 4 {
+		t.Fatalf("got %d lights; expected the discovered light stored", len(stored))
+	}
+}
+
+func TestServer_RecordsTheApiAsSource(t *testing.T) {
+	server, storage, _ := newTestServer(t)
+
+	do(t, server, "POST", "/api/lights/1/on", "", nil)
+
+	events, _ := storage.FindEvents(db.EventFilter{LightId: "1"})
+	if !slices.ContainsFunc(events, func(e db.Event) bool { return e.Command == client.CommandOn && e.Source == db.SourceAPI }) {
+		t.Fatalf("got %+v; expected the command recorded from the API", events)
+	}
+}
+
+func TestOpenApiDescribesTheRoutes(t *testing.T) {
+	var document struct {
+		Paths map[string]map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(openApi, &document); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	routes := handler{}.routes()
+	operations := 0
+	for _, path := range document.Paths {
+		operations += len(path)
+	}
+	if operations != len(routes) {
+		t.Fatalf("got %d operations; expected the %d routes", operations, len(routes))
+	}
+	for _, r := range routes {
+		method, path, _ := strings.Cut(r.pattern, " ")
+		if _, ok := document.Paths[path][strings.ToLower(method)]; !ok {
+			t.Fatalf("%s is not described", r.pattern)
+		}
+	}
+}
+
+func TestConfig_Check(t *testing.T) {
+	if err := (Config{Listen: ":8080"}).Check(); err == nil {
+		t.Fatalf("expected an error without a token")
+	}
+	if err := (Config{Listen: ":8080", Token: testToken}).Check(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// newTestServer serves three lights, 1 and 3 off and 2 on.
+func newTestServer(t *testing.T) (*httptest.Server, *db.MemoryDB, *wiztest.Client) {
+	storage := wiztest.Inventory(3)
+	wizClient := wiztest.NewClient()
+	wizClient.Pilots["10.0.0.2"] = wiz.Pilot{IsOn: true}
+	s := Server{
+		Config: Config{Token: testToken},
+		Client: client.Client{LightsDb: storage, WizClient: wizClient},
+	}
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+	return server, storage, wizClient
+}
+
+// do sends a request bearing the token and decodes its response into into,
+// when given.
+func do(t *testing.T, server *httptest.Server, method, path, body string, into any) int {
+	request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	request.Header.Set("Authorization", "Bearer "+testToken)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer response.Body.Close()
+
+	data, _ := io.ReadAll(response.Body)
+	if into != nil && response.StatusCode != http.StatusMethodNotAllowed {
+		if err := json.Unmarshal(data, into); err != nil {
+			t.Fatalf("unexpected error: %v in %s", err, data)
+		}
+	}
+	return response.StatusCode
+}
@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"text/tabwriter"
+	"time"
+)
+
+func (c Cli) alarmAdd(args []string) error {
+	flags := flag.NewFlagSet("alarm add", flag.ContinueOnError)
+	selectorFlags := addSelectorFlags(flags)
+	at := flags.String("time", "", "time of day the alarm rings, as 07:30")
+	days := flags.String("days", "daily", "daily, weekdays, weekends or days such as mon,wed,fri")
+	ramp := flags.Duration("ramp", 30*time.Minute, "how long the lights take to come up")
+	wakeUp := flags.Bool("wakeup-scene", false, "finish with the Wake up scene")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("alarm add needs a NAME")
+	}
+
+	ringAt, err := time.Parse("15:04", *at)
+	if err != nil {
+		return fmt.Errorf("invalid -time %q, expected HH:MM", *at)
+	}
+	weekdays, err := client.ParseDays(*days)
+	if err != nil {
+		return err
+	}
+
+	alarm, err := c.Client.CreateAlarm(db.Alarm{
+		Name:        flags.Arg(0),
+		Hour:        ringAt.Hour(),
+		Minute:      ringAt.Minute(),
+		Days:        weekdays,
+		Ramp:        *ramp,
+		Lights:      selectorFlags.selector().Selection(),
+		WakeUpScene: *wakeUp,
+		Enabled:     true,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Alarm %s next rings %s\n", alarm.Name, client.NextRing(*alarm, time.Now()).Format(time.DateTime))
+	return nil
+}
+
+func (c Cli) alarmList(args []string) error {
+	alarms, err := c.Client.ListAlarms()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTIME\tDAYS\tRAMP\tLIGHTS\tWAKE UP SCENE\tNEXT RING")
+	for _, a := range alarms {
+		next := "disabled"
+		if a.Enabled {
+			next = client.NextRing(a, now).Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%02d:%02d\t%s\t%s\t%s\t%t\t%s\n", a.Name, a.Hour, a.Minute, client.FormatDays(a.Days), a.Ramp, selectionString(a.Lights), a.WakeUpScene, next)
+	}
+	return w.Flush()
+}
+
+func selectionString(s db.LightSelection) string {
+	switch {
+	case s.All:
+		return "all"
+	case len(s.Ids) > 0:
+		return fmt.Sprintf("%d lights", len(s.Ids))
+	case s.Room != "":
+		return "room " + s.Room
+	case s.Group != "":
+		return "group " + s.Group
+	}
+	return "tags " + s.Tags
+}
+
+func (c Cli) alarmRemove(args []string) error {
+	if len(args) != 1 {
+		return errors.New("alarm rm needs an ALARM")
+	}
+	return c.Client.DeleteAlarm(args[0])
+}
+
+func (c Cli) alarmEnable(args []string) error {
+	return c.setAlarmEnabled("enable", args, true)
+}
+
+func (c Cli) alarmDisable(args []string) error {
+	return c.setAlarmEnabled("disable", args, false)
+}
+
+func (c Cli) setAlarmEnabled(name string, args []string, enabled bool) error {
+	if len(args) != 1 {
+		return fmt.Errorf("alarm %s needs an ALARM", name)
+	}
+	_, err := c.Client.SetAlarmEnabled(args[0], enabled)
+	return err
+}
+
+func (c Cli) alarmRing(args []string) error {
+	if len(args) != 1 {
+		return errors.New("alarm ring needs an ALARM")
+	}
+	lights, err := c.Client.RingAlarm(args[0])
+	for _, l := range lights {
+		fmt.Fprintf(c.Out, "%s (%s): %s\n", l.Id, l.IpAddress, status(l))
+	}
+	return err
+}
+
+// alarmRun rings the alarms until interrupted.
+func (c Cli) alarmRun(args []string) error {
+	stop, release := interrupted()
+	defer release()
+
+	fmt.Fprintln(c.Out, "Running the alarms, interrupt to stop")
+	return c.Client.RunAlarms(stop, func(alarm db.Alarm, lights []wiz.Light, err error) {
+		at := time.Now().Format(time.DateTime)
+		fmt.Fprintf(c.Out, "%s %s: rang %d lights\n", at, alarm.Name, len(lights))
+		if err != nil {
+			fmt.Fprintf(c.Out, "%s %s: %v\n", at, alarm.Name, err)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"gowizcli/luminance"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (c Cli) calibrate(args []string) error {
+	flags := flag.NewFlagSet("calibrate", flag.ContinueOnError)
+	csvFile := flags.String("csv", "", "CSV file with timestamp,lux[,cloud_cover] rows")
+	latitude := flags.Float64("latitude", c.Location.Latitude, "latitude of the sensor")
+	longitude := flags.Float64("longitude", c.Location.Longitude, "longitude of the sensor")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *csvFile == "" {
+		return errors.New("calibrate needs a -csv file")
+	}
+	if c.CalibrationFile == "" {
+		return errors.New("no calibration file configured")
+	}
+
+	file, err := os.Open(*csvFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	measurements, err := readLuxMeasurements(file)
+	if err != nil {
+		return err
+	}
+
+	profile, err := c.Calibrator.Calibrate(*latitude, *longitude, measurements)
+	if err != nil {
+		return err
+	}
+
+	profiles, err := luminance.LoadCalibrationProfiles(c.CalibrationFile)
+	if err != nil {
+		return err
+	}
+	err = profiles.With(*profile).Save(c.CalibrationFile)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.Out, "Calibrated %v,%v with %d samples (RMSE %.1f lux)\n", profile.Latitude, profile.Longitude, profile.Samples, profile.RmseLux)
+	fmt.Fprintf(c.Out, "  cloud loss coefficient: %.4f\n", profile.CloudLossCoefficient)
+	fmt.Fprintf(c.Out, "  cloud exponent:         %.4f\n", profile.CloudExponent)
+	fmt.Fprintf(c.Out, "  efficacy scale:         %.4f\n", profile.EfficacyScale)
+	fmt.Fprintf(c.Out, "Saved to %s\n", c.CalibrationFile)
+	return nil
+}
+
+// readLuxMeasurements reads timestamp,lux[,cloud_cover] rows. Timestamps are
+// RFC 3339 and an optional header row is skipped.
+func readLuxMeasurements(r io.Reader) ([]luminance.LuxMeasurement, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]luminance.LuxMeasurement, 0, len(records))
+	for i, record := range records {
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected at least timestamp and lux", i+1)
+		}
+
+		timestamp, err := time.Parse(time.RFC3339, strings.TrimSpace(record[0]))
+		if err != nil && i == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		lux, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		measurement := luminance.LuxMeasurement{Time: timestamp, Lux: lux}
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			cloudCover, err := strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			measurement.CloudCover = &cloudCover
+		}
+		result = append(result, measurement)
+	}
+
+	return result, nil
+}
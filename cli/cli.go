@@ -0,0 +1,164 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/daemon"
+	"gowizcli/luminance"
+	"gowizcli/rules"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type Cli struct {
+	Client          client.Functions
+	Calibrator      luminance.Calibrator
+	CalibrationFile string
+	Location        client.Location
+	Rules           rules.Engine
+	RulesFile       string
+	Daemon          daemon.Daemon
+	Out             io.Writer
+
+	// transition is the -transition given to the command, -1 when none, as
+	// kept by the jobs it creates.
+	transition time.Duration
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(c Cli, args []string) error
+}
+
+var commands = []command{
+	{name: "calibrate", usage: "calibrate -csv FILE [-latitude LAT -longitude LON]", run: Cli.calibrate},
+	{name: "lights", usage: "lights [SELECTOR]", run: Cli.lights},
+	{name: "on", usage: "on SELECTOR", run: Cli.on},
+	{name: "off", usage: "off SELECTOR", run: Cli.off},
+	{name: "daylight", usage: "daylight SELECTOR", run: Cli.daylight},
+	{name: "fan", usage: "fan SELECTOR [-power on|off] [-speed N] [-mode normal|breeze] [-direction forward|reverse]", run: Cli.fan},
+	{name: "rename", usage: "rename ID NAME", run: Cli.rename},
+	{name: "delete", usage: "delete ID", run: Cli.delete},
+	{name: "prune", usage: "prune -older-than AGE [-dry-run]", run: Cli.prune},
+	{name: "room add", usage: "room add [-floor N] [-zone ZONE] NAME", run: Cli.roomAdd},
+	{name: "room list", usage: "room list", run: Cli.roomList},
+	{name: "room update", usage: "room update [-name NAME] [-floor N] [-zone ZONE] ROOM", run: Cli.roomUpdate},
+	{name: "room rm", usage: "room rm ROOM", run: Cli.roomRemove},
+	{name: "room assign", usage: "room assign SELECTOR ROOM", run: Cli.roomAssign},
+	{name: "room unassign", usage: "room unassign SELECTOR", run: Cli.roomUnassign},
+	{name: "group add", usage: "group add NAME", run: Cli.groupAdd},
+	{name: "group list", usage: "group list", run: Cli.groupList},
+	{name: "group rename", usage: "group rename GROUP NAME", run: Cli.groupRename},
+	{name: "group rm", usage: "group rm GROUP", run: Cli.groupRemove},
+	{name: "group add-lights", usage: "group add-lights SELECTOR GROUP", run: Cli.groupAddLights},
+	{name: "group remove-lights", usage: "group remove-lights SELECTOR GROUP", run: Cli.groupRemoveLights},
+	{name: "tag add", usage: "tag add SELECTOR TAG...", run: Cli.tagAdd},
+	{name: "tag rm", usage: "tag rm SELECTOR TAG...", run: Cli.tagRemove},
+	{name: "export", usage: "export [-format json|yaml] [-o FILE]", run: Cli.export},
+	{name: "import", usage: "import [-format json|yaml] [-mode merge|replace] FILE", run: Cli.importInventory},
+	{name: "backup list", usage: "backup list", run: Cli.backupList},
+	{name: "backup restore", usage: "backup restore [ID]", run: Cli.backupRestore},
+	{name: "snapshot save", usage: "snapshot save [SELECTOR] NAME", run: Cli.snapshotSave},
+	{name: "snapshot apply", usage: "snapshot apply NAME", run: Cli.snapshotApply},
+	{name: "snapshot list", usage: "snapshot list", run: Cli.snapshotList},
+	{name: "snapshot diff", usage: "snapshot diff NAME [OTHER]", run: Cli.snapshotDiff},
+	{name: "snapshot rm", usage: "snapshot rm NAME", run: Cli.snapshotRemove},
+	{name: "alarm add", usage: "alarm add -time HH:MM [-days daily|weekdays|weekends|mon,...] [-ramp DURATION] [-wakeup-scene] SELECTOR NAME", run: Cli.alarmAdd},
+	{name: "alarm list", usage: "alarm list", run: Cli.alarmList},
+	{name: "alarm rm", usage: "alarm rm ALARM", run: Cli.alarmRemove},
+	{name: "alarm enable", usage: "alarm enable ALARM", run: Cli.alarmEnable},
+	{name: "alarm disable", usage: "alarm disable ALARM", run: Cli.alarmDisable},
+	{name: "alarm ring", usage: "alarm ring ALARM", run: Cli.alarmRing},
+	{name: "alarm run", usage: "alarm run", run: Cli.alarmRun},
+	{name: "job add", usage: "job add -schedule SCHEDULE -command on|off|daylight|snapshot|dimming|temperature|color|scene [-arg ARG] [-tz ZONE] [-catch-up] [SELECTOR] NAME", run: Cli.jobAdd},
+	{name: "job list", usage: "job list", run: Cli.jobList},
+	{name: "job rm", usage: "job rm JOB", run: Cli.jobRemove},
+	{name: "job enable", usage: "job enable JOB", run: Cli.jobEnable},
+	{name: "job disable", usage: "job disable JOB", run: Cli.jobDisable},
+	{name: "job trigger", usage: "job trigger JOB", run: Cli.jobTrigger},
+	{name: "job run", usage: "job run", run: Cli.jobRun},
+	{name: "rules explain", usage: "rules explain [-file FILE]", run: Cli.rulesExplain},
+	{name: "rules run", usage: "rules run [-file FILE] [-dry-run]", run: Cli.rulesRun},
+	{name: "daemon", usage: "daemon", run: Cli.daemon},
+	{name: "history", usage: "history [-light ID] [-since AGE] [-until AGE] [-limit N]", run: Cli.history},
+	{name: "energy", usage: "energy [-since AGE] [-until AGE] [-by light|room|tag]", run: Cli.energy},
+	{name: "power", usage: "power -light ID [-since AGE] [-until AGE] [-format table|csv]", run: Cli.power},
+}
+
+func (c Cli) Run(args []string) error {
+	transition, args, err := extractTransition(args)
+	if err != nil {
+		return err
+	}
+	c.transition = transition
+	if transition >= 0 {
+		c.Client = c.Client.WithTransition(transition)
+	}
+	if len(args) == 0 {
+		return errors.New(c.usage())
+	}
+
+	for _, cmd := range commands {
+		words := len(strings.Fields(cmd.name))
+		if len(args) >= words && strings.Join(args[:words], " ") == cmd.name {
+			return cmd.run(c, args[words:])
+		}
+	}
+
+	return fmt.Errorf("unknown command %q\n%s", args[0], c.usage())
+}
+
+// extractTransition takes the -transition option out of the arguments, given
+// anywhere as -transition D, --transition D or with =D. The transition is -1
+// when not given.
+func extractTransition(args []string) (time.Duration, []string, error) {
+	transition := time.Duration(-1)
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || name != "transition" {
+			rest = append(rest, args[i])
+			continue
+		}
+		if !hasValue {
+			if i+1 == len(args) {
+				return 0, nil, errors.New("-transition needs a duration")
+			}
+			i++
+			value = args[i]
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return 0, nil, fmt.Errorf("invalid transition %q", value)
+		}
+		transition = d
+	}
+	return transition, rest, nil
+}
+
+// interrupted returns a channel closed once the process is interrupted or
+// terminated. release stops catching the signals.
+func interrupted() (stop <-chan struct{}, release func()) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	return ctx.Done(), cancel
+}
+
+func (c Cli) usage() string {
+	var b strings.Builder
+	b.WriteString("usage:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&b, "  gowizcli %s\n", cmd.usage)
+	}
+	b.WriteString("SELECTOR is any of -all, -id ID[,ID], -room ROOM, -group GROUP, -tag QUERY\n")
+	b.WriteString("Any command takes -transition DURATION, as in -transition 5s, to fade the lights it changes\n")
+	b.WriteString("SCHEDULE is a cron expression as '0 7 * * 1-5', 'every weekday 07:00' or a solar event as '30 min before sunset' or 'at civil dusk +10m'\n")
+	b.WriteString("QUERY combines tags with & (and), | or , (or), ! (not) and parentheses; * matches anything, as in 'floor:* & !outdoor'\n")
+	return b.String()
+}
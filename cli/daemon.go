@@ -0,0 +1,8 @@
+package cli
+
+// daemon runs the daemon until interrupted or terminated.
+func (c Cli) daemon(args []string) error {
+	stop, release := interrupted()
+	defer release()
+	return c.Daemon.Run(stop)
+}
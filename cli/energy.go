@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gowizcli/client"
+	"text/tabwriter"
+	"time"
+)
+
+func (c Cli) energy(args []string) error {
+	flags := flag.NewFlagSet("energy", flag.ContinueOnError)
+	since := flags.String("since", "30d", "report from this age on, such as 7d")
+	until := flags.String("until", "", "report up to this age, now when not given")
+	by := flags.String("by", "light", "light, room or tag")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	sinceAge, err := client.ParseAge(*since)
+	if err != nil {
+		return err
+	}
+	to := now
+	if *until != "" {
+		untilAge, err := client.ParseAge(*until)
+		if err != nil {
+			return err
+		}
+		to = now.Add(-untilAge)
+	}
+
+	report, err := c.Client.EnergyReport(now.Add(-sinceAge), to)
+	if err != nil {
+		return err
+	}
+
+	var rows []client.UsageTotal
+	switch *by {
+	case "light":
+		for _, l := range report.Lights {
+			name := l.Light.Name
+			if name == "" {
+				name = l.Light.Id
+			}
+			rows = append(rows, client.UsageTotal{Name: name, Lights: 1, Usage: l.Usage})
+		}
+	case "room":
+		rows = report.Rooms
+		for i := range rows {
+			if rows[i].Name == "" {
+				rows[i].Name = "(no room)"
+			}
+		}
+	case "tag":
+		rows = report.Tags
+	default:
+		return fmt.Errorf("unknown grouping %q", *by)
+	}
+
+	fmt.Fprintf(c.Out, "Energy from %s to %s\n", report.Since.Local().Format(time.DateTime), report.Until.Local().Format(time.DateTime))
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tLIGHTS\tON TIME\tKWH\tFULL BRIGHTNESS KWH\tSAVED KWH\tSAVED BY AUTOMATIONS\tSOURCE")
+	for _, r := range rows {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", r.Name, r.Lights, usageColumns(r.Usage), usageSource(r.Usage))
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%s\t%s\n", len(report.Lights), usageColumns(report.Total), usageSource(report.Total))
+	return w.Flush()
+}
+
+func usageColumns(u client.Usage) string {
+	return fmt.Sprintf("%s\t%.3f\t%.3f\t%.3f\t%.3f", u.OnTime.Round(time.Minute), u.KWh, u.FullKWh, u.SavedKWh(), u.AutomationSavedKWh)
+}
+
+func usageSource(u client.Usage) string {
+	if u.Measured {
+		return "measured"
+	}
+	return "estimated"
+}
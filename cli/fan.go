@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gowizcli/wiz"
+)
+
+func (c Cli) fan(args []string) error {
+	flags := flag.NewFlagSet("fan", flag.ContinueOnError)
+	selectorFlags := addSelectorFlags(flags)
+	power := flags.String("power", "", "on or off")
+	speed := flags.Int("speed", 0, fmt.Sprintf("speed from 1 to %d", wiz.MaxFanSpeed))
+	mode := flags.String("mode", "", "normal or breeze")
+	direction := flags.String("direction", "", "forward or reverse")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var operations []func(lightId string) (*wiz.Light, error)
+	switch *power {
+	case "":
+	case "on", "off":
+		on := *power == "on"
+		operations = append(operations, func(id string) (*wiz.Light, error) { return c.Client.SetFan(id, on) })
+	default:
+		return fmt.Errorf("unknown fan power %q", *power)
+	}
+	if *speed != 0 {
+		operations = append(operations, func(id string) (*wiz.Light, error) { return c.Client.SetFanSpeed(id, *speed) })
+	}
+	switch *mode {
+	case "":
+	case "normal", "breeze":
+		fanMode := wiz.FanNormal
+		if *mode == "breeze" {
+			fanMode = wiz.FanBreeze
+		}
+		operations = append(operations, func(id string) (*wiz.Light, error) { return c.Client.SetFanMode(id, fanMode) })
+	default:
+		return fmt.Errorf("unknown fan mode %q", *mode)
+	}
+	switch *direction {
+	case "":
+	case "forward", "reverse":
+		reverse := *direction == "reverse"
+		operations = append(operations, func(id string) (*wiz.Light, error) { return c.Client.SetFanDirection(id, reverse) })
+	default:
+		return fmt.Errorf("unknown fan direction %q", *direction)
+	}
+	if len(operations) == 0 {
+		return errors.New("fan needs -power, -speed, -mode or -direction")
+	}
+
+	lights, err := c.Client.Select(selectorFlags.selector())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, l := range lights {
+		if l.Kind() != wiz.KindFan {
+			continue
+		}
+		var result *wiz.Light
+		for _, operation := range operations {
+			if result, err = operation(l.Id); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", l.Id, l.IpAddress, err))
+			continue
+		}
+		fmt.Fprintf(c.Out, "%s (%s): fan %s\n", result.Id, result.IpAddress, fanStatus(result.Fan))
+	}
+	if len(errs) == 0 && !hasFan(lights) {
+		return errors.New("no fan matches the selector")
+	}
+	return errors.Join(errs...)
+}
+
+func hasFan(lights []wiz.Light) bool {
+	for _, l := range lights {
+		if l.Kind() == wiz.KindFan {
+			return true
+		}
+	}
+	return false
+}
+
+func fanStatus(fan *wiz.Fan) string {
+	if fan == nil {
+		return "unknown"
+	}
+	if !fan.IsOn {
+		return "off"
+	}
+	direction := "forward"
+	if fan.Reverse {
+		direction = "reverse"
+	}
+	mode := "normal"
+	if fan.Mode == wiz.FanBreeze {
+		mode = "breeze"
+	}
+	return fmt.Sprintf("on, speed %d, %s, %s", fan.Speed, mode, direction)
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func (c Cli) history(args []string) error {
+	flags := flag.NewFlagSet("history", flag.ContinueOnError)
+	lightId := flags.String("light", "", "only the events of this light id")
+	since := flags.String("since", "", "only the events newer than this age, such as 7d")
+	until := flags.String("until", "", "only the events older than this age")
+	limit := flags.Int("limit", 0, "only the latest N events")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	filter := db.EventFilter{LightId: *lightId, Limit: *limit}
+	if *since != "" {
+		age, err := client.ParseAge(*since)
+		if err != nil {
+			return err
+		}
+		filter.Since = now.Add(-age)
+	}
+	if *until != "" {
+		age, err := client.ParseAge(*until)
+		if err != nil {
+			return err
+		}
+		filter.Until = now.Add(-age)
+	}
+
+	events, err := c.Client.History(filter)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tSOURCE\tCOMMAND\tLIGHT\tPARAMS\tSTATE\tRESULT\tLATENCY")
+	for _, e := range events {
+		result := "ok"
+		if e.Error != "" {
+			result = e.Error
+		}
+		state := ""
+		if e.IsOn != nil {
+			state = status(wiz.Light{IsOn: e.IsOn})
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format(time.DateTime), e.Source, e.Command, e.LightId, formatParams(e.Params), state, result, e.Latency.Round(time.Millisecond))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if *lightId == "" || len(events) == 0 {
+		return nil
+	}
+	from, to := filter.Since, filter.Until
+	if from.IsZero() {
+		from = events[0].Time
+	}
+	if to.IsZero() {
+		to = now
+	}
+	on, err := c.Client.TimeOn(*lightId, from, to)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "On for %s between %s and %s\n", on.Round(time.Second), from.Local().Format(time.DateTime), to.Local().Format(time.DateTime))
+	return nil
+}
+
+func formatParams(params map[string]string) string {
+	pairs := make([]string, 0, len(params))
+	for _, k := range slices.Sorted(maps.Keys(params)) {
+		pairs = append(pairs, k+"="+params[k])
+	}
+	return strings.Join(pairs, ",")
+}
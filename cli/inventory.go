@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gowizcli/db"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatJson = "json"
+	formatYaml = "yaml"
+)
+
+func (c Cli) export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", "", "json or yaml, from the file extension when not given")
+	output := flags.String("o", "", "file to write, standard output when not given")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	inventoryFormat, err := inventoryFormat(*format, *output)
+	if err != nil {
+		return err
+	}
+	inventory, err := c.Client.Export()
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = c.Out
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	return encodeInventory(out, inventoryFormat, *inventory)
+}
+
+func (c Cli) importInventory(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "json or yaml, from the file extension when not given")
+	mode := flags.String("mode", string(db.ImportMerge), "merge into the inventory or replace it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("import needs a FILE")
+	}
+
+	inventoryFormat, err := inventoryFormat(*format, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var inventory db.Inventory
+	if inventoryFormat == formatYaml {
+		err = yaml.NewDecoder(file).Decode(&inventory)
+	} else {
+		err = json.NewDecoder(file).Decode(&inventory)
+	}
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", flags.Arg(0), err)
+	}
+
+	if err := c.Client.Import(inventory, db.ImportMode(*mode)); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Imported %d lights, %d rooms and %d groups\n", len(inventory.Lights), len(inventory.Rooms), len(inventory.Groups))
+	return nil
+}
+
+// inventoryFormat picks the format given, or else the one of the file
+// extension, defaulting to JSON.
+func inventoryFormat(format, file string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml":
+			format = formatYaml
+		default:
+			format = formatJson
+		}
+	}
+	if format != formatJson && format != formatYaml {
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+	return format, nil
+}
+
+func encodeInventory(w io.Writer, format string, inventory db.Inventory) error {
+	if format == formatYaml {
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(inventory); err != nil {
+			return err
+		}
+		return encoder.Close()
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(inventory)
+}
+
+func (c Cli) backupList(args []string) error {
+	backups, err := c.Client.ListBackups()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTAKEN AT\tREASON\tLIGHTS")
+	for _, b := range backups {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", b.Id, b.CreatedAt.Local().Format(time.DateTime), b.Reason, len(b.Inventory.Lights))
+	}
+	return w.Flush()
+}
+
+func (c Cli) backupRestore(args []string) error {
+	if len(args) > 1 {
+		return errors.New("backup restore takes at most one ID")
+	}
+	id := ""
+	if len(args) == 1 {
+		id = args[0]
+	}
+
+	backup, err := c.Client.RestoreBackup(id)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Restored %d lights from the %s backup of %s\n", len(backup.Inventory.Lights), backup.Reason, backup.CreatedAt.Local().Format(time.DateTime))
+	return nil
+}
+
+func (c Cli) rename(args []string) error {
+	if len(args) != 2 {
+		return errors.New("rename needs an ID and a NAME")
+	}
+	_, err := c.Client.RenameLight(args[0], args[1])
+	return err
+}
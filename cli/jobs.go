@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+func (c Cli) jobAdd(args []string) error {
+	flags := flag.NewFlagSet("job add", flag.ContinueOnError)
+	selectorFlags := addSelectorFlags(flags)
+	schedule := flags.String("schedule", "", `when the job runs, as "0 7 * * 1-5", "every weekday 07:00" or "30 min before sunset"`)
+	command := flags.String("command", "", "command to run: "+strings.Join(client.JobCommands, ", "))
+	argument := flags.String("arg", "", "snapshot of the snapshot command, percent of dimming, kelvins of temperature, R,G,B of color or name of scene")
+	timeZone := flags.String("tz", "", "time zone the schedule is read in, as Europe/Paris; the local one by default")
+	catchUp := flags.Bool("catch-up", false, "run once when runs were missed, rather than skipping them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("job add needs a NAME")
+	}
+
+	job, err := c.Client.CreateJob(db.Job{
+		Name:       flags.Arg(0),
+		Schedule:   *schedule,
+		TimeZone:   *timeZone,
+		Command:    *command,
+		Argument:   *argument,
+		Lights:     selectorFlags.selector().Selection(),
+		Transition: max(c.transition, 0),
+		CatchUp:    *catchUp,
+		Enabled:    true,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Job %s next runs %s\n", job.Name, formatRun(c.Client.NextRun(*job, time.Now())))
+	return nil
+}
+
+func (c Cli) jobList(args []string) error {
+	jobs, err := c.Client.ListJobs()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSCHEDULE\tTIME ZONE\tCOMMAND\tLIGHTS\tTRANSITION\tCATCH UP\tNEXT RUN\tLAST RUN\tLAST ERROR")
+	for _, j := range jobs {
+		next := "disabled"
+		if j.Enabled {
+			next = formatRun(c.Client.NextRun(j, now))
+		}
+		zone, command, lights := j.TimeZone, j.Command, selectionString(j.Lights)
+		if zone == "" {
+			zone = "local"
+		}
+		if j.Argument != "" {
+			command = j.Command + " " + j.Argument
+		}
+		if j.Command == client.CommandSnapshot {
+			lights = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%t\t%s\t%s\t%s\n", j.Name, j.Schedule, zone, command, lights, j.Transition, j.CatchUp, next, j.LastRun.Format(time.DateTime), j.LastError)
+	}
+	return w.Flush()
+}
+
+func formatRun(at time.Time) string {
+	if at.IsZero() {
+		return "never"
+	}
+	return at.Local().Format(time.DateTime)
+}
+
+func (c Cli) jobRemove(args []string) error {
+	if len(args) != 1 {
+		return errors.New("job rm needs a JOB")
+	}
+	return c.Client.DeleteJob(args[0])
+}
+
+func (c Cli) jobEnable(args []string) error {
+	return c.setJobEnabled("enable", args, true)
+}
+
+func (c Cli) jobDisable(args []string) error {
+	return c.setJobEnabled("disable", args, false)
+}
+
+func (c Cli) setJobEnabled(name string, args []string, enabled bool) error {
+	if len(args) != 1 {
+		return fmt.Errorf("job %s needs a JOB", name)
+	}
+	_, err := c.Client.SetJobEnabled(args[0], enabled)
+	return err
+}
+
+func (c Cli) jobTrigger(args []string) error {
+	if len(args) != 1 {
+		return errors.New("job trigger needs a JOB")
+	}
+	lights, err := c.Client.RunJob(args[0])
+	for _, l := range lights {
+		fmt.Fprintf(c.Out, "%s (%s): %s\n", l.Id, l.IpAddress, status(l))
+	}
+	return err
+}
+
+// jobRun runs the scheduled jobs until interrupted.
+func (c Cli) jobRun(args []string) error {
+	stop, release := interrupted()
+	defer release()
+
+	fmt.Fprintln(c.Out, "Running the jobs, interrupt to stop")
+	return c.Client.RunJobs(stop, func(job db.Job, lights []wiz.Light, err error) {
+		at := time.Now().Format(time.DateTime)
+		fmt.Fprintf(c.Out, "%s %s: ran %s on %d lights\n", at, job.Name, job.Command, len(lights))
+		if err != nil {
+			fmt.Fprintf(c.Out, "%s %s: %v\n", at, job.Name, err)
+		}
+	})
+}
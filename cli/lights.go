@@ -0,0 +1,171 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/wiz"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+type selectorFlags struct {
+	all   *bool
+	ids   *string
+	room  *string
+	group *string
+	tags  *string
+}
+
+func addSelectorFlags(flags *flag.FlagSet) selectorFlags {
+	return selectorFlags{
+		all:   flags.Bool("all", false, "select every light"),
+		ids:   flags.String("id", "", "comma separated light ids"),
+		room:  flags.String("room", "", "room id or name"),
+		group: flags.String("group", "", "group id or name"),
+		tags:  flags.String("tag", "", "tag query, such as 'lamp | strip' or 'upstairs & !bedroom'"),
+	}
+}
+
+func (f selectorFlags) selector() client.Selector {
+	return client.Selector{
+		All:   *f.all,
+		Ids:   splitList(*f.ids),
+		Room:  *f.room,
+		Group: *f.group,
+		Tags:  *f.tags,
+	}
+}
+
+func splitList(list string) []string {
+	var result []string
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// parseSelector parses the selector flags and returns the positional
+// arguments that follow them.
+func parseSelector(name string, args []string) (client.Selector, []string, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	selectorFlags := addSelectorFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return client.Selector{}, nil, err
+	}
+	return selectorFlags.selector(), flags.Args(), nil
+}
+
+func (c Cli) lights(args []string) error {
+	selector, _, err := parseSelector("lights", args)
+	if err != nil {
+		return err
+	}
+	if selector.IsEmpty() {
+		selector.All = true
+	}
+
+	lights, err := c.Client.Select(selector)
+	if err != nil {
+		return err
+	}
+	rooms, groups, err := c.names()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tKIND\tIP ADDRESS\tMAC ADDRESS\tROOM\tGROUPS\tTAGS")
+	for _, l := range lights {
+		groupNames := make([]string, len(l.Groups))
+		for i, g := range l.Groups {
+			groupNames[i] = groups[g]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", l.Id, l.Name, l.Kind(), l.IpAddress, l.MacAddress, rooms[l.Room], strings.Join(groupNames, ","), strings.Join(l.Tags, ","))
+	}
+	return w.Flush()
+}
+
+// names maps room and group ids to their names.
+func (c Cli) names() (map[string]string, map[string]string, error) {
+	rooms, err := c.Client.ListRooms()
+	if err != nil {
+		return nil, nil, err
+	}
+	groups, err := c.Client.ListGroups()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roomNames := make(map[string]string, len(rooms))
+	for _, r := range rooms {
+		roomNames[r.Id] = r.Name
+	}
+	groupNames := make(map[string]string, len(groups))
+	for _, g := range groups {
+		groupNames[g.Id] = g.Name
+	}
+	return roomNames, groupNames, nil
+}
+
+func (c Cli) on(args []string) error {
+	return c.forEachLight("on", args, c.Client.TurnOn)
+}
+
+func (c Cli) off(args []string) error {
+	return c.forEachLight("off", args, c.Client.TurnOff)
+}
+
+func (c Cli) daylight(args []string) error {
+	return c.forEachLight("daylight", args, c.Client.MatchDaylight)
+}
+
+// forEachLight runs apply on every selected light at once, so that they fade
+// together, carrying on past lights that fail.
+func (c Cli) forEachLight(name string, args []string, apply func(lightId string) (*wiz.Light, error)) error {
+	selector, _, err := parseSelector(name, args)
+	if err != nil {
+		return err
+	}
+
+	lights, err := c.Client.Select(selector)
+	if err != nil {
+		return err
+	}
+	if len(lights) == 0 {
+		return errors.New("no light matches the selector")
+	}
+
+	results := make([]*wiz.Light, len(lights))
+	errs := make([]error, len(lights))
+	var wg sync.WaitGroup
+	for i, l := range lights {
+		wg.Go(func() {
+			if results[i], errs[i] = apply(l.Id); errs[i] != nil {
+				errs[i] = fmt.Errorf("%s (%s): %w", l.Id, l.IpAddress, errs[i])
+			}
+		})
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result != nil {
+			fmt.Fprintf(c.Out, "%s (%s): %s\n", result.Id, result.IpAddress, status(*result))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func status(l wiz.Light) string {
+	if l.IsOn == nil {
+		return "unknown"
+	}
+	if *l.IsOn {
+		return "on"
+	}
+	return "off"
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"gowizcli/client"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func (c Cli) power(args []string) error {
+	flags := flag.NewFlagSet("power", flag.ContinueOnError)
+	lightId := flags.String("light", "", "id of the device")
+	since := flags.String("since", "24h", "samples from this age on, such as 7d")
+	until := flags.String("until", "", "samples up to this age, now when not given")
+	format := flags.String("format", "table", "table, or csv to graph the samples elsewhere")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *lightId == "" {
+		return errors.New("power needs -light")
+	}
+
+	now := time.Now()
+	sinceAge, err := client.ParseAge(*since)
+	if err != nil {
+		return err
+	}
+	to := now
+	if *until != "" {
+		untilAge, err := client.ParseAge(*until)
+		if err != nil {
+			return err
+		}
+		to = now.Add(-untilAge)
+	}
+
+	samples, err := c.Client.PowerSamples(*lightId, now.Add(-sinceAge), to)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "csv":
+		w := csv.NewWriter(c.Out)
+		w.Write([]string{"time", "watts"})
+		for _, s := range samples {
+			w.Write([]string{s.Time.Format(time.RFC3339), strconv.FormatFloat(s.Watts, 'f', -1, 64)})
+		}
+		w.Flush()
+		return w.Error()
+	case "table":
+		w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tWATTS")
+		var total, peak float64
+		for _, s := range samples {
+			fmt.Fprintf(w, "%s\t%.1f\n", s.Time.Local().Format(time.DateTime), s.Watts)
+			total += s.Watts
+			peak = max(peak, s.Watts)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if len(samples) > 0 {
+			fmt.Fprintf(c.Out, "%d samples, %.1f W average, %.1f W peak\n", len(samples), total/float64(len(samples)), peak)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
@@ -0,0 +1,44 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gowizcli/client"
+	"time"
+)
+
+func (c Cli) prune(args []string) error {
+	flags := flag.NewFlagSet("prune", flag.ContinueOnError)
+	olderThan := flags.String("older-than", "", "remove lights unseen for longer than this, such as 30d")
+	dryRun := flags.Bool("dry-run", false, "only list the lights that would be removed")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *olderThan == "" {
+		return errors.New("prune needs -older-than")
+	}
+	unseenFor, err := client.ParseAge(*olderThan)
+	if err != nil {
+		return err
+	}
+
+	prune := c.Client.Prune
+	verb := "Removed"
+	if *dryRun {
+		prune = c.Client.FindStale
+		verb = "Would remove"
+	}
+	lights, err := prune(unseenFor)
+	for _, l := range lights {
+		fmt.Fprintf(c.Out, "%s %s (%s), last seen %s\n", verb, l.Id, l.IpAddress, l.LastSeen.Local().Format(time.DateTime))
+	}
+	return err
+}
+
+func (c Cli) delete(args []string) error {
+	if len(args) != 1 {
+		return errors.New("delete needs an ID")
+	}
+	return c.Client.Delete(args[0])
+}
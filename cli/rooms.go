@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gowizcli/db"
+	"strings"
+	"text/tabwriter"
+)
+
+func (c Cli) roomAdd(args []string) error {
+	flags := flag.NewFlagSet("room add", flag.ContinueOnError)
+	floor := flags.Int("floor", 0, "floor the room is on")
+	zone := flags.String("zone", "", "zone of the floor the room is in")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("room add needs a NAME")
+	}
+
+	room, err := c.Client.CreateRoom(db.Room{Name: flags.Arg(0), Floor: *floor, Zone: *zone})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Created room %s (%s)\n", room.Name, room.Id)
+	return nil
+}
+
+func (c Cli) roomList(args []string) error {
+	rooms, err := c.Client.ListRooms()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tFLOOR\tZONE")
+	for _, r := range rooms {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", r.Id, r.Name, r.Floor, r.Zone)
+	}
+	return w.Flush()
+}
+
+func (c Cli) roomUpdate(args []string) error {
+	flags := flag.NewFlagSet("room update", flag.ContinueOnError)
+	name := flags.String("name", "", "new name of the room")
+	floor := flags.Int("floor", 0, "floor the room is on")
+	zone := flags.String("zone", "", "zone of the floor the room is in")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("room update needs a ROOM")
+	}
+
+	room, err := c.Client.FindRoom(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			room.Name = *name
+		case "floor":
+			room.Floor = *floor
+		case "zone":
+			room.Zone = *zone
+		}
+	})
+
+	updated, err := c.Client.UpdateRoom(*room)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Updated room %s (%s)\n", updated.Name, updated.Id)
+	return nil
+}
+
+func (c Cli) roomRemove(args []string) error {
+	if len(args) != 1 {
+		return errors.New("room rm needs a ROOM")
+	}
+	return c.Client.DeleteRoom(args[0])
+}
+
+func (c Cli) roomAssign(args []string) error {
+	selector, rest, err := parseSelector("room assign", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errors.New("room assign needs a ROOM")
+	}
+
+	lights, err := c.Client.AssignRoom(selector, rest[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Moved %d lights to %s\n", len(lights), rest[0])
+	return nil
+}
+
+func (c Cli) roomUnassign(args []string) error {
+	selector, _, err := parseSelector("room unassign", args)
+	if err != nil {
+		return err
+	}
+
+	lights, err := c.Client.AssignRoom(selector, "")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Removed %d lights from their room\n", len(lights))
+	return nil
+}
+
+func (c Cli) groupAdd(args []string) error {
+	if len(args) != 1 {
+		return errors.New("group add needs a NAME")
+	}
+
+	group, err := c.Client.CreateGroup(db.Group{Name: args[0]})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Created group %s (%s)\n", group.Name, group.Id)
+	return nil
+}
+
+func (c Cli) groupList(args []string) error {
+	groups, err := c.Client.ListGroups()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME")
+	for _, g := range groups {
+		fmt.Fprintf(w, "%s\t%s\n", g.Id, g.Name)
+	}
+	return w.Flush()
+}
+
+func (c Cli) groupRename(args []string) error {
+	if len(args) != 2 {
+		return errors.New("group rename needs a GROUP and a NAME")
+	}
+
+	group, err := c.Client.FindGroup(args[0])
+	if err != nil {
+		return err
+	}
+	group.Name = args[1]
+	_, err = c.Client.UpdateGroup(*group)
+	return err
+}
+
+func (c Cli) groupRemove(args []string) error {
+	if len(args) != 1 {
+		return errors.New("group rm needs a GROUP")
+	}
+	return c.Client.DeleteGroup(args[0])
+}
+
+func (c Cli) groupAddLights(args []string) error {
+	selector, rest, err := parseSelector("group add-lights", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errors.New("group add-lights needs a GROUP")
+	}
+
+	lights, err := c.Client.AddToGroup(selector, rest[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Added %d lights to %s\n", len(lights), rest[0])
+	return nil
+}
+
+func (c Cli) groupRemoveLights(args []string) error {
+	selector, rest, err := parseSelector("group remove-lights", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return errors.New("group remove-lights needs a GROUP")
+	}
+
+	lights, err := c.Client.RemoveFromGroup(selector, rest[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Removed %d lights from %s\n", len(lights), rest[0])
+	return nil
+}
+
+func (c Cli) tagAdd(args []string) error {
+	selector, rest, err := parseSelector("tag add", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return errors.New("tag add needs a TAG")
+	}
+
+	lights, err := c.Client.AddTags(selector, rest)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Tagged %d lights %s\n", len(lights), strings.Join(rest, ", "))
+	return nil
+}
+
+func (c Cli) tagRemove(args []string) error {
+	selector, rest, err := parseSelector("tag rm", args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return errors.New("tag rm needs a TAG")
+	}
+
+	lights, err := c.Client.RemoveTags(selector, rest)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "Untagged %d lights %s\n", len(lights), strings.Join(rest, ", "))
+	return nil
+}
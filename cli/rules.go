@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"gowizcli/rules"
+	"strings"
+	"time"
+)
+
+func (c Cli) loadRules(name string, args []string, dryRun *bool) ([]rules.Rule, error) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	file := flags.String("file", c.RulesFile, "YAML file of the rules")
+	if dryRun != nil {
+		flags.BoolVar(dryRun, "dry-run", false, "report what the rules would do without running their actions")
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	return c.Rules.Load(*file)
+}
+
+func (c Cli) rulesExplain(args []string) error {
+	loaded, err := c.loadRules("rules explain", args, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range c.Rules.Explain(loaded) {
+		verdict := "would not run now"
+		if e.WouldRun {
+			verdict = "would run if triggered now"
+		}
+		fmt.Fprintf(c.Out, "%s: %s\n", e.Rule, verdict)
+		for _, t := range e.Triggers {
+			fmt.Fprintf(c.Out, "  when %s: %s%s\n", t.What, t.Detail, holds(t.Holds, " (in the state it fires on)"))
+		}
+		for _, check := range e.Conditions {
+			fmt.Fprintf(c.Out, "  if %s: %s%s\n", check.What, check.Detail, holds(check.Holds, " (holds)"))
+		}
+		for _, a := range e.Actions {
+			fmt.Fprintf(c.Out, "  then %s\n", a)
+		}
+	}
+	return nil
+}
+
+func holds(holds bool, text string) string {
+	if holds {
+		return text
+	}
+	return ""
+}
+
+// rulesRun runs the rules until interrupted.
+func (c Cli) rulesRun(args []string) error {
+	var dryRun bool
+	loaded, err := c.loadRules("rules run", args, &dryRun)
+	if err != nil {
+		return err
+	}
+
+	stop, release := interrupted()
+	defer release()
+
+	fmt.Fprintf(c.Out, "Running %d rules, interrupt to stop\n", len(loaded))
+	return c.Rules.Run(loaded, dryRun, stop, func(r rules.Result) {
+		at := r.At.Format(time.DateTime)
+		switch {
+		case len(r.Fired) == 0:
+			fmt.Fprintf(c.Out, "%s %s: %v\n", at, r.Rule, r.Err)
+			return
+		case !r.Ran:
+			var failed []string
+			for _, check := range r.Conditions {
+				if !check.Holds {
+					failed = append(failed, fmt.Sprintf("%s (%s)", check.What, check.Detail))
+				}
+			}
+			fmt.Fprintf(c.Out, "%s %s: fired on %s, but not %s\n", at, r.Rule, strings.Join(r.Fired, "; "), strings.Join(failed, ", "))
+			return
+		}
+
+		verb := "ran"
+		if r.DryRun {
+			verb = "would run"
+		}
+		fmt.Fprintf(c.Out, "%s %s: fired on %s, %s %s\n", at, r.Rule, strings.Join(r.Fired, "; "), verb, strings.Join(r.Actions, ", "))
+		if r.Err != nil {
+			fmt.Fprintf(c.Out, "%s %s: %v\n", at, r.Rule, r.Err)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+)
+
+func (c Cli) snapshotSave(args []string) error {
+	selector, args, err := parseSelector("snapshot save", args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return errors.New("snapshot save needs a NAME")
+	}
+
+	snapshot, err := c.Client.SaveSnapshot(args[0], selector)
+	if snapshot != nil {
+		fmt.Fprintf(c.Out, "Saved %d lights as %s\n", len(snapshot.Lights), snapshot.Name)
+	}
+	return err
+}
+
+func (c Cli) snapshotApply(args []string) error {
+	if len(args) != 1 {
+		return errors.New("snapshot apply needs a NAME")
+	}
+
+	lights, err := c.Client.ApplySnapshot(args[0])
+	for _, l := range lights {
+		fmt.Fprintf(c.Out, "%s (%s): %s\n", l.Id, l.IpAddress, status(l))
+	}
+	return err
+}
+
+func (c Cli) snapshotList(args []string) error {
+	snapshots, err := c.Client.ListSnapshots()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSAVED AT\tLIGHTS")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", s.Name, s.CreatedAt.Local().Format(time.DateTime), len(s.Lights))
+	}
+	return w.Flush()
+}
+
+func (c Cli) snapshotDiff(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("snapshot diff needs a NAME and at most one OTHER")
+	}
+	other := ""
+	if len(args) == 2 {
+		other = args[1]
+	}
+
+	changes, err := c.Client.DiffSnapshots(args[0], other)
+	if len(changes) == 0 && err == nil {
+		fmt.Fprintln(c.Out, "No differences")
+		return nil
+	}
+
+	if other == "" {
+		other = "NOW"
+	}
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "LIGHT\t%s\t%s\n", args[0], other)
+	for _, change := range changes {
+		before, after := "-", "-"
+		if change.Before != nil {
+			before = change.Before.String()
+		}
+		if change.After != nil {
+			after = change.After.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", change.LightId, before, after)
+	}
+	if flushErr := w.Flush(); flushErr != nil {
+		return flushErr
+	}
+	return err
+}
+
+func (c Cli) snapshotRemove(args []string) error {
+	if len(args) != 1 {
+		return errors.New("snapshot rm needs a NAME")
+	}
+	return c.Client.DeleteSnapshot(args[0])
+}
@@ -0,0 +1,323 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A sunrise goes from the dimmest warm white the lights take to full cool
+// white.
+var (
+	sunriseStart = wiz.Pilot{IsOn: true, Dimming: wiz.MinDimming, Temp: wiz.MinTemperatureK}
+	sunriseEnd   = wiz.Pilot{IsOn: true, Dimming: 100, Temp: wiz.MaxTemperatureK}
+)
+
+// alarmPoll is how often RunAlarms reads the alarms again.
+const alarmPoll = time.Minute
+
+var (
+	weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	weekends = []time.Weekday{time.Saturday, time.Sunday}
+)
+
+// ParseDays parses the days an alarm rings on: daily, weekdays, weekends or
+// a comma separated list of days such as mon,wed,fri. Daily is empty.
+func ParseDays(days string) ([]time.Weekday, error) {
+	switch days {
+	case "", "daily":
+		return nil, nil
+	case "weekdays":
+		return slices.Clone(weekdays), nil
+	case "weekends":
+		return slices.Clone(weekends), nil
+	}
+
+	var result []time.Weekday
+	for _, name := range splitDays(days) {
+		day, ok := dayNames[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", name)
+		}
+		if !slices.Contains(result, day) {
+			result = append(result, day)
+		}
+	}
+	slices.Sort(result)
+	return result, nil
+}
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func splitDays(days string) []string {
+	var result []string
+	for _, d := range strings.Split(days, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// FormatDays is the reverse of ParseDays.
+func FormatDays(days []time.Weekday) string {
+	sorted := slices.Sorted(slices.Values(days))
+	switch {
+	case len(days) == 0 || len(slices.Compact(slices.Clone(sorted))) == 7:
+		return "daily"
+	case slices.Equal(sorted, weekdays):
+		return "weekdays"
+	case slices.Equal(sorted, []time.Weekday{time.Sunday, time.Saturday}):
+		return "weekends"
+	}
+
+	names := make([]string, len(sorted))
+	for i, d := range sorted {
+		names[i] = strings.ToLower(d.String()[:3])
+	}
+	return strings.Join(names, ",")
+}
+
+// NextRing returns when an alarm next rings after a time, in the location of
+// that time.
+func NextRing(alarm db.Alarm, after time.Time) time.Time {
+	for day := range 8 {
+		ring := ringOn(alarm, after.AddDate(0, 0, day))
+		if ring.After(after) && ringsOn(alarm, ring.Weekday()) {
+			return ring
+		}
+	}
+	return time.Time{}
+}
+
+// lastRing returns when an alarm last rang up to a time, if it rang within
+// the week before.
+func lastRing(alarm db.Alarm, until time.Time) (time.Time, bool) {
+	for day := range 8 {
+		ring := ringOn(alarm, until.AddDate(0, 0, -day))
+		if !ring.After(until) && ringsOn(alarm, ring.Weekday()) {
+			return ring, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func ringOn(alarm db.Alarm, day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), alarm.Hour, alarm.Minute, 0, 0, day.Location())
+}
+
+func ringsOn(alarm db.Alarm, day time.Weekday) bool {
+	return len(alarm.Days) == 0 || slices.Contains(alarm.Days, day)
+}
+
+// due tells whether an alarm is to ring now, and how far into its ramp it
+// is: it rang last since it last ran, and its ramp is not over yet. So an
+// alarm missed while no process was running still rings, for the rest of its
+// ramp.
+func due(alarm db.Alarm, now time.Time) (time.Duration, bool) {
+	if !alarm.Enabled {
+		return 0, false
+	}
+	ring, ok := lastRing(alarm, now)
+	if !ok || !ring.After(alarm.LastRun) {
+		return 0, false
+	}
+	elapsed := now.Sub(ring)
+	return elapsed, elapsed < max(alarm.Ramp, alarmPoll)
+}
+
+func (c Client) CreateAlarm(alarm db.Alarm) (*db.Alarm, error) {
+	if err := validateAlarm(alarm); err != nil {
+		return nil, err
+	}
+	// Only the rings to come count, not those earlier today.
+	alarm.LastRun = time.Now()
+	return c.LightsDb.CreateAlarm(alarm)
+}
+
+func (c Client) ListAlarms() ([]db.Alarm, error) {
+	return c.LightsDb.FindAlarms()
+}
+
+// FindAlarm finds an alarm by id or name.
+func (c Client) FindAlarm(alarm string) (*db.Alarm, error) {
+	alarms, err := c.LightsDb.FindAlarms()
+	if err != nil {
+		return nil, err
+	}
+	if i := slices.IndexFunc(alarms, func(a db.Alarm) bool { return a.Id == alarm }); i >= 0 {
+		return &alarms[i], nil
+	}
+	if i := slices.IndexFunc(alarms, func(a db.Alarm) bool { return a.Name == alarm }); i >= 0 {
+		return &alarms[i], nil
+	}
+	return nil, fmt.Errorf("alarm %s %w", alarm, db.ErrNotFound)
+}
+
+func (c Client) DeleteAlarm(alarm string) error {
+	found, err := c.FindAlarm(alarm)
+	if err != nil {
+		return err
+	}
+	return c.LightsDb.DeleteAlarm(found.Id)
+}
+
+// SetAlarmEnabled turns an alarm on or off. An alarm turned back on does not
+// ring for the times it missed while off.
+func (c Client) SetAlarmEnabled(alarm string, enabled bool) (*db.Alarm, error) {
+	found, err := c.FindAlarm(alarm)
+	if err != nil {
+		return nil, err
+	}
+	if enabled && !found.Enabled {
+		if err := c.LightsDb.MarkAlarmRun(found.Id, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	found.Enabled = enabled
+	return c.LightsDb.UpdateAlarm(*found)
+}
+
+func validateAlarm(alarm db.Alarm) error {
+	switch {
+	case alarm.Hour < 0 || alarm.Hour > 23 || alarm.Minute < 0 || alarm.Minute > 59:
+		return fmt.Errorf("invalid time %02d:%02d", alarm.Hour, alarm.Minute)
+	case alarm.Ramp <= 0:
+		return errors.New("the ramp must be longer than 0")
+	case SelectorOf(alarm.Lights).IsEmpty():
+		return errors.New("no lights selected")
+	}
+	return nil
+}
+
+// RingAlarm rings an alarm now, whether enabled or not, and returns once the
+// lights are up.
+func (c Client) RingAlarm(alarm string) ([]wiz.Light, error) {
+	found, err := c.FindAlarm(alarm)
+	if err != nil {
+		return nil, err
+	}
+	return c.ring(*found, 0)
+}
+
+// RunAlarms rings the enabled alarms when they are due, until stop is closed,
+// calling report with the lights each ring brought up. It reads the alarms
+// again every minute, so it picks up the changes made meanwhile, and should
+// run in a long-lived process. Closing stop ends the sunrises under way.
+func (c Client) RunAlarms(stop <-chan struct{}, report func(db.Alarm, []wiz.Light, error)) error {
+	c.stop = stop
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		alarms, err := c.LightsDb.FindAlarms()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		next := now.Add(alarmPoll)
+		for _, a := range alarms {
+			if elapsed, ok := due(a, now); ok {
+				if err := c.LightsDb.MarkAlarmRun(a.Id, now); err != nil {
+					return err
+				}
+				wg.Go(func() {
+					lights, err := c.ring(a, elapsed)
+					report(a, lights, err)
+				})
+			}
+			if ring := NextRing(a, now); a.Enabled && ring.Before(next) {
+				next = ring
+			}
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
+
+// ring brings the lights of an alarm up, elapsed into its ramp. Commands on a
+// light stop its sunrise, as they cancel its transition.
+func (c Client) ring(alarm db.Alarm, elapsed time.Duration) ([]wiz.Light, error) {
+	lights, err := c.Select(SelectorOf(alarm.Lights))
+	if err != nil {
+		return nil, err
+	}
+
+	start := sunriseStart
+	if elapsed > 0 {
+		start = interpolate(sunriseStart, sunriseEnd, float64(elapsed)/float64(alarm.Ramp))
+	}
+	ramp := max(alarm.Ramp-elapsed, 0)
+
+	c.Source = db.SourceAutomation
+	results := make([]*wiz.Light, len(lights))
+	errs := make([]error, len(lights))
+	var wg sync.WaitGroup
+	for i, l := range lights {
+		wg.Go(func() { results[i], errs[i] = c.sunrise(alarm, l.Id, start, ramp) })
+	}
+	wg.Wait()
+
+	var result []wiz.Light
+	for _, l := range results {
+		if l != nil {
+			result = append(result, *l)
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+func (c Client) sunrise(alarm db.Alarm, lightId string, start wiz.Pilot, ramp time.Duration) (result *wiz.Light, err error) {
+	begin := time.Now()
+	defer func() { c.record(begin, CommandAlarm, lightId, map[string]string{"alarm": alarm.Name}, result, err) }()
+
+	light, err := c.LightsDb.FindById(lightId)
+	if err != nil {
+		return nil, err
+	}
+
+	set := func(pilot wiz.Pilot) func(*wiz.Light) (*wiz.Light, error) {
+		return func(light *wiz.Light) (*wiz.Light, error) { return c.WizClient.SetPilot(light, pilot) }
+	}
+	instant, fade := c, c
+	instant.Transition, fade.Transition = 0, ramp
+
+	newLight, err := instant.apply(light, set(start), nil)
+	if err == nil {
+		newLight, err = fade.apply(light, set(sunriseEnd), func(wiz.Pilot) wiz.Pilot { return sunriseEnd })
+	}
+	if err == nil && alarm.WakeUpScene {
+		newLight, err = instant.apply(light, set(wiz.Pilot{IsOn: true, Dimming: 100, Scene: wiz.WakeUp}), nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s (%s): %w", light.Id, light.IpAddress, err)
+	}
+
+	light.LastSeen = c.seen(light.Id)
+	result = withInventory(newLight, light)
+	c.measure(result)
+	return result, nil
+}
+
+// Selection returns the selector as stored with an alarm.
+func (s Selector) Selection() db.LightSelection {
+	return db.LightSelection{All: s.All, Ids: s.Ids, Room: s.Room, Group: s.Group, Tags: s.Tags}
+}
+
+// SelectorOf is the reverse of Selection.
+func SelectorOf(s db.LightSelection) Selector {
+	return Selector{All: s.All, Ids: s.Ids, Room: s.Room, Group: s.Group, Tags: s.Tags}
+}
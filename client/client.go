@@ -1,9 +1,15 @@
 package client
 
 import (
+	"fmt"
 	"gowizcli/db"
 	"gowizcli/luminance"
 	"gowizcli/wiz"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Location struct {
@@ -11,33 +17,147 @@ type Location struct {
 	Longitude float64 `yaml:"longitude"`
 }
 
+// Client runs the commands on the lights. Source tells who issues them, as
+// recorded in the event log, and EventRetention how long events are kept.
+// Transition is how long the commands fade the lights for, through
+// Transitions, and closing stop ends their fades early.
 type Client struct {
-	LightsDb  db.Storage
-	WizClient wiz.Client
-	Luminance luminance.Luminance
-	Location  Location
+	LightsDb       db.Storage
+	WizClient      wiz.Client
+	Luminance      luminance.Luminance
+	Location       Location
+	Energy         EnergyConfig
+	Source         string
+	EventRetention time.Duration
+	Transitions    *Transitions
+	Transition     time.Duration
+	stop           <-chan struct{}
 }
 
+// Functions are the commands of a client, as run by Client here or by a
+// daemon.Remote in the daemon. WithTransition and WithSource return a copy
+// fading the lights for d, or recording the commands as from source.
 type Functions interface {
+	WithTransition(d time.Duration) Functions
+	WithSource(source string) Functions
+
+	Lights
+	Inventory
+	Rooms
+	Events
+	Automation
+}
+
+// Lights finds, reads and commands the lights.
+type Lights interface {
 	Discover() ([]wiz.Light, error)
 	ShowAll() ([]wiz.Light, error)
+	Status(lightId string) (*wiz.Light, error)
 	TurnOn(lightId string) (*wiz.Light, error)
 	TurnOff(lightId string) (*wiz.Light, error)
-	EraseAll()
+	MatchDaylight(lightId string) (*wiz.Light, error)
+	SetPilot(lightId string, pilot wiz.Pilot) (*wiz.Light, error)
+	SetFan(lightId string, on bool) (*wiz.Light, error)
+	SetFanSpeed(lightId string, speed int) (*wiz.Light, error)
+	SetFanMode(lightId string, mode wiz.FanMode) (*wiz.Light, error)
+	SetFanDirection(lightId string, reverse bool) (*wiz.Light, error)
+	Select(selector Selector) ([]wiz.Light, error)
+}
+
+// Inventory keeps the stored lights, and their backups.
+type Inventory interface {
+	RenameLight(lightId string, name string) (*wiz.Light, error)
+	Delete(lightId string) error
+	FindStale(unseenFor time.Duration) ([]wiz.Light, error)
+	Prune(unseenFor time.Duration) ([]wiz.Light, error)
+	EraseAll() error
+	Export() (*db.Inventory, error)
+	Import(inventory db.Inventory, mode db.ImportMode) error
+	ListBackups() ([]db.Backup, error)
+	RestoreBackup(id string) (*db.Backup, error)
+}
+
+// Rooms sorts the lights into rooms, groups and tags.
+type Rooms interface {
+	CreateRoom(room db.Room) (*db.Room, error)
+	ListRooms() ([]db.Room, error)
+	UpdateRoom(room db.Room) (*db.Room, error)
+	DeleteRoom(room string) error
+	FindRoom(room string) (*db.Room, error)
+	AssignRoom(selector Selector, room string) ([]wiz.Light, error)
+
+	CreateGroup(group db.Group) (*db.Group, error)
+	ListGroups() ([]db.Group, error)
+	UpdateGroup(group db.Group) (*db.Group, error)
+	DeleteGroup(group string) error
+	FindGroup(group string) (*db.Group, error)
+	AddToGroup(selector Selector, group string) ([]wiz.Light, error)
+	RemoveFromGroup(selector Selector, group string) ([]wiz.Light, error)
+
+	AddTags(selector Selector, tags []string) ([]wiz.Light, error)
+	RemoveTags(selector Selector, tags []string) ([]wiz.Light, error)
+}
+
+// Events reads what was done to the lights, and what they used.
+type Events interface {
+	History(filter db.EventFilter) ([]db.Event, error)
+	TimeOn(lightId string, since, until time.Time) (time.Duration, error)
+	PruneEvents() (int, error)
+	EnergyReport(since, until time.Time) (*EnergyReport, error)
+	PowerSamples(lightId string, since, until time.Time) ([]db.PowerSample, error)
 }
 
-func (c Client) Discover() ([]wiz.Light, error) {
+// Automation keeps and runs the snapshots, alarms and jobs.
+type Automation interface {
+	SaveSnapshot(name string, selector Selector) (*db.Snapshot, error)
+	ApplySnapshot(name string) ([]wiz.Light, error)
+	ListSnapshots() ([]db.Snapshot, error)
+	DeleteSnapshot(name string) error
+	DiffSnapshots(from, to string) ([]SnapshotChange, error)
+
+	CreateAlarm(alarm db.Alarm) (*db.Alarm, error)
+	ListAlarms() ([]db.Alarm, error)
+	FindAlarm(alarm string) (*db.Alarm, error)
+	DeleteAlarm(alarm string) error
+	SetAlarmEnabled(alarm string, enabled bool) (*db.Alarm, error)
+	RingAlarm(alarm string) ([]wiz.Light, error)
+	RunAlarms(stop <-chan struct{}, report func(db.Alarm, []wiz.Light, error)) error
+
+	ParseSchedule(spec string, loc *time.Location) (Schedule, error)
+	JobSchedule(job db.Job) (Schedule, error)
+	NextRun(job db.Job, after time.Time) time.Time
+	CreateJob(job db.Job) (*db.Job, error)
+	ListJobs() ([]db.Job, error)
+	FindJob(job string) (*db.Job, error)
+	DeleteJob(job string) error
+	SetJobEnabled(job string, enabled bool) (*db.Job, error)
+	RunJob(job string) ([]wiz.Light, error)
+	RunJobs(stop <-chan struct{}, report func(db.Job, []wiz.Light, error)) error
+}
+
+func (c Client) Discover() (result []wiz.Light, err error) {
+	start := time.Now()
+	defer func() { c.record(start, CommandDiscover, "", countParam(len(result)), nil, err) }()
+
 	lights, err := c.WizClient.Discover()
 	if err != nil {
 		return nil, err
 	}
+
+	result = make([]wiz.Light, 0, len(lights))
 	for _, light := range lights {
-		_, err := c.LightsDb.Upsert(light)
+		stored, err := c.LightsDb.Upsert(light)
 		if err != nil {
 			return nil, err
 		}
+		if stored.Model == "" {
+			if model, err := c.WizClient.Model(stored); err == nil && c.LightsDb.SetModel(stored.Id, model) == nil {
+				stored.Model = model
+			}
+		}
+		result = append(result, *stored)
 	}
-	return lights, nil
+	return result, nil
 }
 
 func (c Client) ShowAll() ([]wiz.Light, error) {
@@ -48,48 +168,224 @@ func (c Client) ShowAll() ([]wiz.Light, error) {
 
 	var result []wiz.Light = make([]wiz.Light, len(lights))
 	for i, l := range lights {
-		result[i].Id = l.Id
-		result[i].IpAddress = l.IpAddress
-		result[i].MacAddress = l.MacAddress
-		result[i].Tags = l.Tags
-
-		light, err := c.WizClient.Status(&l)
-		if err == nil {
-			result[i].IsOn = light.IsOn
-		}
+		result[i] = c.status(l)
 	}
 
 	return result, nil
 }
 
-func (c Client) TurnOn(lightId string) (*wiz.Light, error) {
+// Status asks a light for its status. A light that does not answer is
+// returned with its status unknown.
+func (c Client) Status(lightId string) (*wiz.Light, error) {
 	light, err := c.LightsDb.FindById(lightId)
 	if err != nil {
 		return nil, err
 	}
+	result := c.status(*light)
+	return &result, nil
+}
 
-	newLight, err := c.WizClient.TurnOn(light)
+func (c Client) status(l wiz.Light) wiz.Light {
+	result := wiz.Light{
+		Id:         l.Id,
+		Name:       l.Name,
+		Model:      l.Model,
+		IpAddress:  l.IpAddress,
+		MacAddress: l.MacAddress,
+		Tags:       l.Tags,
+		Room:       l.Room,
+		Groups:     l.Groups,
+		LastSeen:   l.LastSeen,
+	}
+
+	start := time.Now()
+	light, err := c.WizClient.Status(&l)
+	if err == nil {
+		result.IsOn = light.IsOn
+		result.Dimming = light.Dimming
+		result.Fan = light.Fan
+		result.LastSeen = c.seen(l.Id)
+		c.measure(&result)
+		c.recordState(start, &result)
+	}
+	return result
+}
+
+// Pushed records the state a light pushed, as it does when asked for its
+// status.
+func (c Client) Pushed(push wiz.Push) error {
+	start := time.Now()
+	lights, err := c.LightsDb.FindAll()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(lights, func(l wiz.Light) bool { return strings.EqualFold(l.MacAddress, push.MacAddress) })
+	if i < 0 {
+		return fmt.Errorf("no light has the MAC address %s", push.MacAddress)
+	}
+
+	light := lights[i]
+	light.IsOn, light.Dimming = &push.IsOn, push.Dimming
+	light.LastSeen = c.seen(light.Id)
+	c.recordState(start, &light)
+	return nil
+}
+
+func (c Client) TurnOn(lightId string) (result *wiz.Light, err error) {
+	start := time.Now()
+	defer func() { c.record(start, CommandOn, lightId, nil, result, err) }()
+
+	light, err := c.LightsDb.FindById(lightId)
+	if err != nil {
+		return nil, err
+	}
+
+	newLight, err := c.apply(light, c.WizClient.TurnOn, func(from wiz.Pilot) wiz.Pilot {
+		from.IsOn = true
+		return from
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return newLight, nil
+	light.LastSeen = c.seen(light.Id)
+	result = withInventory(newLight, light)
+	c.measure(result)
+	return result, nil
 }
 
-func (c Client) TurnOff(lightId string) (*wiz.Light, error) {
+func (c Client) TurnOff(lightId string) (result *wiz.Light, err error) {
+	start := time.Now()
+	defer func() { c.record(start, CommandOff, lightId, nil, result, err) }()
+
 	light, err := c.LightsDb.FindById(lightId)
 	if err != nil {
 		return nil, err
 	}
 
-	newLight, err := c.WizClient.TurnOff(light)
+	newLight, err := c.apply(light, c.WizClient.TurnOff, func(from wiz.Pilot) wiz.Pilot {
+		from.IsOn = false
+		return from
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return newLight, nil
+	light.LastSeen = c.seen(light.Id)
+	result = withInventory(newLight, light)
+	c.measure(result)
+	return result, nil
 }
 
-func (c Client) EraseAll() {
+func (c Client) MatchDaylight(lightId string) (result *wiz.Light, err error) {
+	start := time.Now()
+	params := map[string]string{}
+	defer func() { c.record(start, CommandDaylight, lightId, params, result, err) }()
+
+	light, err := c.LightsDb.FindById(lightId)
+	if err != nil {
+		return nil, err
+	}
+
+	daylight, err := c.Luminance.Estimate(c.Location.Latitude, c.Location.Longitude)
+	if err != nil {
+		return nil, err
+	}
+
+	kelvin := int(math.Round(luminance.ScaleCCT(daylight.CCTKelvin, wiz.MinTemperatureK, wiz.MaxTemperatureK)))
+	params["kelvin"] = strconv.Itoa(kelvin)
+	newLight, err := c.apply(light, func(light *wiz.Light) (*wiz.Light, error) {
+		return c.WizClient.SetTemperature(light, kelvin)
+	}, func(from wiz.Pilot) wiz.Pilot {
+		return wiz.Pilot{IsOn: true, Dimming: from.Dimming, Temp: kelvin}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	light.LastSeen = c.seen(light.Id)
+	result = withInventory(newLight, light)
+	c.measure(result)
+	return result, nil
+}
+
+// SetPilot sets a light to a state. The brightness and color left zero in
+// pilot stay as they are.
+func (c Client) SetPilot(lightId string, pilot wiz.Pilot) (result *wiz.Light, err error) {
+	start := time.Now()
+	defer func() { c.record(start, CommandSet, lightId, map[string]string{"state": pilot.String()}, result, err) }()
+
+	light, err := c.LightsDb.FindById(lightId)
+	if err != nil {
+		return nil, err
+	}
+
+	newLight, err := c.apply(light, func(light *wiz.Light) (*wiz.Light, error) {
+		return c.WizClient.SetPilot(light, pilot)
+	}, func(from wiz.Pilot) wiz.Pilot {
+		to := pilot
+		if to.Dimming == 0 {
+			to.Dimming = from.Dimming
+		}
+		if to.Scene == 0 && to.Temp == 0 && to.Color == nil {
+			to.Scene, to.Speed, to.Temp, to.Color = from.Scene, from.Speed, from.Temp, from.Color
+		}
+		return to
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	light.LastSeen = c.seen(light.Id)
+	result = withInventory(newLight, light)
+	c.measure(result)
+	return result, nil
+}
+
+// withInventory completes a light reported by the bulb with what only the
+// storage knows about it.
+func withInventory(live *wiz.Light, stored *wiz.Light) *wiz.Light {
+	result := *live
+	result.Name = stored.Name
+	result.Model = stored.Model
+	result.Tags = stored.Tags
+	result.Room = stored.Room
+	result.Groups = stored.Groups
+	result.LastSeen = stored.LastSeen
+	return &result
+}
+
+// measure reads the watts drawn by the devices that measure them, keeping
+// them as a power sample. Failing to read them leaves them unknown.
+func (c Client) measure(light *wiz.Light) {
+	if !light.MeasuresPower() {
+		return
+	}
+	watts, err := c.WizClient.Power(light)
+	if err != nil {
+		return
+	}
+	light.Watts = &watts
+	c.LightsDb.RecordPowerSample(db.PowerSample{LightId: light.Id, Time: time.Now(), Watts: watts})
+}
+
+// seen records that a light answered now. Failing to record it does not fail
+// the command that reached the light.
+func (c Client) seen(lightId string) time.Time {
+	now := time.Now()
+	c.LightsDb.MarkSeen(lightId, now)
+	return now
+}
+
+// EraseAll backs the inventory up before erasing the lights, so they can be
+// restored with RestoreBackup.
+func (c Client) EraseAll() (err error) {
+	start := time.Now()
+	defer func() { c.record(start, CommandEraseAll, "", nil, nil, err) }()
+
+	if _, err := c.LightsDb.CreateBackup(BackupReasonEraseAll); err != nil {
+		return fmt.Errorf("backing up before erasing: %w", err)
+	}
 	c.LightsDb.EraseAll()
+	return nil
 }
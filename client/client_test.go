@@ -0,0 +1,1143 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"gowizcli/wiz/wiztest"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_DiscoverKeepsKnownIds(t *testing.T) {
+	storage := db.NewMemoryDB()
+	storage.Upsert(wiz.Light{Id: "known", MacAddress: "aa", IpAddress: "10.0.0.1"})
+	wizClient := wiztest.NewClient(
+		wiz.Light{Id: "fresh-1", MacAddress: "aa", IpAddress: "10.0.0.5"},
+		wiz.Light{Id: "fresh-2", MacAddress: "bb", IpAddress: "10.0.0.2"},
+	)
+	c := Client{LightsDb: storage, WizClient: wizClient}
+
+	lights, err := c.Discover()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(lights) != 2 || lights[0].Id != "known" || lights[0].IpAddress != "10.0.0.5" || lights[1].Id != "fresh-2" {
+		t.Fatalf("got %+v; expected the stored ids with discovered addresses", lights)
+	}
+}
+
+func TestClient_ShowAllReportsStatus(t *testing.T) {
+	storage := wiztest.Inventory(2)
+	wizClient := wiztest.NewClient()
+	wizClient.Pilots["10.0.0.1"] = wiz.Pilot{IsOn: true}
+	wizClient.Unreachable["10.0.0.2"] = true
+	c := Client{LightsDb: storage, WizClient: wizClient}
+
+	lights, err := c.ShowAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if lights[0].IsOn == nil || !*lights[0].IsOn {
+		t.Fatalf("got %+v; expected the first light on", lights[0])
+	}
+	if lights[1].IsOn != nil {
+		t.Fatalf("got %+v; expected the unreachable light to have an unknown status", lights[1])
+	}
+}
+
+func TestClient_TurnOnAndOff(t *testing.T) {
+	storage := wiztest.Inventory(1)
+	wizClient := wiztest.NewClient()
+	c := Client{LightsDb: storage, WizClient: wizClient}
+
+	on, err := c.TurnOn("1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !*on.IsOn || !wizClient.IsOn("10.0.0.1") {
+		t.Fatalf("got %+v; expected the light on", on)
+	}
+
+	off, err := c.TurnOff("1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *off.IsOn || wizClient.IsOn("10.0.0.1") {
+		t.Fatalf("got %+v; expected the light off", off)
+	}
+
+	if _, err := c.TurnOn("unknown"); err == nil {
+		t.Fatalf("expected an error for an unknown light")
+	}
+}
+
+func TestClient_EraseAll(t *testing.T) {
+	storage := wiztest.Inventory(1)
+	c := Client{LightsDb: storage, WizClient: wiztest.NewClient()}
+
+	if err := c.EraseAll(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lights, _ := c.ShowAll()
+	if len(lights) != 0 {
+		t.Fatalf("got %d lights; expected none", len(lights))
+	}
+}
+
+func TestClient_RestoreAfterEraseAll(t *testing.T) {
+	storage := wiztest.Inventory(1)
+	c := Client{LightsDb: storage, WizClient: wiztest.NewClient()}
+	c.RenameLight("1", "Desk")
+
+	c.EraseAll()
+	restored, err := c.RestoreBackup("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if restored.Reason != BackupReasonEraseAll {
+		t.Fatalf("got %s; expected the backup taken before erasing", restored.Reason)
+	}
+
+	lights, _ := c.ShowAll()
+	if len(lights) != 1 || lights[0].Name != "Desk" {
+		t.Fatalf("got %+v; expected the erased light back", lights)
+	}
+
+	// The restore itself was backed up, with no lights.
+	backups, _ := c.ListBackups()
+	if len(backups) != 2 || backups[0].Reason != BackupReasonRestore || len(backups[0].Inventory.Lights) != 0 {
+		t.Fatalf("got %+v; expected a backup of the erased state", backups)
+	}
+	if _, err := c.RestoreBackup("missing"); err == nil {
+		t.Fatalf("expected an error for an unknown backup")
+	}
+}
+
+func TestClient_RestoreTwiceKeepsTheRestore(t *testing.T) {
+	storage := wiztest.Inventory(1)
+	c := Client{LightsDb: storage, WizClient: wiztest.NewClient()}
+	c.EraseAll()
+
+	for range 2 {
+		restored, err := c.RestoreBackup("")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if restored.Reason != BackupReasonEraseAll {
+			t.Fatalf("got %s; expected the backup taken before erasing", restored.Reason)
+		}
+		if lights, _ := c.ShowAll(); len(lights) != 1 {
+			t.Fatalf("got %+v; expected the erased light back", lights)
+		}
+	}
+
+	// The first restore is undone by the id of the backup it took.
+	backups, _ := c.ListBackups()
+	if len(backups) != 3 || backups[1].Reason != BackupReasonRestore {
+		t.Fatalf("got %+v; expected the backups of both restores", backups)
+	}
+	if _, err := c.RestoreBackup(backups[1].Id); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lights, _ := c.ShowAll(); len(lights) != 0 {
+		t.Fatalf("got %+v; expected the restore undone", lights)
+	}
+}
+
+func TestClient_SelectByRoomGroupAndTags(t *testing.T) {
+	storage := wiztest.Inventory(3)
+	c := Client{LightsDb: storage, WizClient: wiztest.NewClient()}
+
+	c.CreateRoom(db.Room{Name: "kitchen"})
+	c.CreateGroup(db.Group{Name: "reading"})
+	if _, err := c.AssignRoom(Selector{Ids: []string{"1", "2"}}, "kitchen"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.AddToGroup(Selector{Ids: []string{"2", "3"}}, "reading"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	one, _ := storage.FindById("1")
+	storage.AddTags([]wiz.Light{*one}, []string{"lamp"})
+
+	tests := []struct {
+		name     string
+		selector Selector
+		expected []string
+	}{
+		{"room", Selector{Room: "kitchen"}, []string{"1", "2"}},
+		{"group", Selector{Group: "reading"}, []string{"2", "3"}},
+		{"room and group", Selector{Room: "kitchen", Group: "reading"}, []string{"2"}},
+		{"room and tag", Selector{Room: "kitchen", Tags: "lamp"}, []string{"1"}},
+		{"tag query", Selector{Tags: "lamp | !*"}, []string{"1", "2", "3"}},
+		{"group and negated tag", Selector{Group: "reading", Tags: "!lamp"}, []string{"2", "3"}},
+		{"ids and group", Selector{Ids: []string{"1", "3"}, Group: "reading"}, []string{"3"}},
+		{"all", Selector{All: true}, []string{"1", "2", "3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lights, err := c.Select(tt.selector)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := make([]string, len(lights))
+			for i, l := range lights {
+				got[i] = l.Id
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Fatalf("got %v; expected %v", got, tt.expected)
+			}
+		})
+	}
+
+	if _, err := c.Select(Selector{}); err == nil {
+		t.Fatalf("expected an error for an empty selector")
+	}
+	if _, err := c.Select(Selector{Room: "garden"}); err == nil {
+		t.Fatalf("expected an error for an unknown room")
+	}
+	if _, err := c.Select(Selector{Tags: "lamp &"}); err == nil {
+		t.Fatalf("expected an error for a malformed tag query")
+	}
+}
+
+func TestClient_TurnOnKeepsRoomAndGroups(t *testing.T) {
+	storage := wiztest.Inventory(1)
+	c := Client{LightsDb: storage, WizClient: wiztest.NewClient()}
+	room, _ := c.CreateRoom(db.Room{Name: "kitchen"})
+	group, _ := c.CreateGroup(db.Group{Name: "reading"})
+	c.AssignRoom(Selector{Ids: []string{"1"}}, room.Id)
+	c.AddToGroup(Selector{Ids: []string{"1"}}, group.Name)
+
+	on, err := c.TurnOn("1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if on.Room != room.Id || len(on.Groups) != 1 || on.Groups[0] != group.Id {
+		t.Fatalf("got %+v; expected the stored room and group", on)
+	}
+}
+
+func TestClient_AddAndRemoveTags(t *testing.T) {
+	storage := wiztest.Inventory(2)
+	c := Client{LightsDb: storage, WizClient: wiztest.NewClient()}
+
+	if _, err := c.AddTags(Selector{All: true}, []string{"lamp", "floor:1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.RemoveTags(Selector{Ids: []string{"2"}}, []string{"lamp"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lamps, _ := c.Select(Selector{Tags: "lamp & floor:1"})
+	if len(lamps) != 1 || lamps[0].Id != "1" {
+		t.Fatalf("got %+v; expected only light 1 tagged lamp", lamps)
+	}
+
+	for _, tags := range [][]string{nil, {""}, {"a|b"}, {"two words"}} {
+		if _, err := c.AddTags(Selector{All: true}, tags); err == nil {
+			t.Fatalf("expected an error for the tags %q", tags)
+		}
+	}
+}
+
+func TestClient_ShowAllMarksAnsweringLightsSeen(t *testing.T) {
+	storage := wiztest.Inventory(2)
+	monthAgo := time.Now().Add(-30 * 24 * time.Hour)
+	storage.MarkSeen("1", monthAgo)
+	storage.MarkSeen("2", monthAgo)
+	wizClient := wiztest.NewClient()
+	wizClient.Unreachable["10.0.0.2"] = true
+	c := Client{LightsDb: storage, WizClient: wizClient}
+
+	lights, _ := c.ShowAll()
+	if lights[0].LastSeen.Before(time.Now().Add(-time.Minute)) || !lights[1].LastSeen.Equal(monthAgo.UTC()) {
+		t.Fatalf("got %v and %v; expected only the answering light seen now", lights[0].LastSeen, lights[1].LastSeen)
+	}
+
+	stale, _ := c.FindStale(7 * 24 * time.Hour)
+	if len(stale) != 1 || stale[0].Id != "2" {
+		t.Fatalf("got %+v; expected the unreachable light to be stale", stale)
+	}
+}
+
+func TestClient_PushedRecordsState(t *testing.T) {
+	storage := db.NewMemoryDB()
+	storage.Upsert(wiz.Light{Id: "1", MacAddress: "cc40857ce53c", IpAddress: "10.0.0.1"})
+	c := Client{LightsDb: storage, WizClient: wiztest.NewClient(), Source: db.SourceDaemon}
+
+	for _, push := range []wiz.Push{
+		{MacAddress: "CC40857CE53C", IsOn: true, Dimming: 40},
+		{MacAddress: "cc40857ce53c", IsOn: true, Dimming: 40},
+		{MacAddress: "cc40857ce53c", IsOn: false, Dimming: 40},
+	} {
+		if err := c.Pushed(push); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := c.Pushed(wiz.Push{MacAddress: "ffffffffffff"}); err == nil {
+		t.Fatalf("expected an error for an unknown light")
+	}
+
+	events, _ := c.History(db.EventFilter{LightId: "1"})
+	if len(events) != 2 || !*events[0].IsOn || *events[1].IsOn || events[0].Source != db.SourceDaemon {
+		t.Fatalf("got %+v; expected the light on then off, from the daemon", events)
+	}
+	light, _ := storage.FindById("1")
+	if time.Since(light.LastSeen) > time.Minute {
+		t.Fatalf("got %v; expected the light seen just now", light.LastSeen)
+	}
+}
+
+func TestClient_PruneDeletesStaleLights(t *testing.T) {
+	storage := wiztest.Inventory(2)
+	storage.MarkSeen("2", time.Now().Add(-40*24*time.Hour))
+	c := Client{LightsDb: storage, WizClient: wiztest.NewClient()}
+
+	pruned, err := c.Prune(30 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(pruned) != 1 || pruned[0].Id != "2" {
+		t.Fatalf("got %+v; expected light 2 pruned", pruned)
+	}
+	remaining, _ := storage.FindAll()
+	if len(remaining) != 1 || remaining[0].Id != "1" {
+		t.Fatalf("got %+v; expected light 1 to remain", remaining)
+	}
+	backups, _ := c.ListBackups()
+	if len(backups) != 1 || backups[0].Reason != BackupReasonPrune {
+		t.Fatalf("got %+v; expected a backup before pruning", backups)
+	}
+
+	if err := c.Delete("1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Delete("1"); err == nil {
+		t.Fatalf("expected an error for a deleted light")
+	}
+}
+
+func TestClient_RecordsCommandsAndStateChanges(t *testing.T) {
+	storage := wiztest.Inventory(1)
+	wizClient := wiztest.NewClient()
+	c := Client{LightsDb: storage, WizClient: wizClient, Source: db.SourceTUI}
+
+	c.TurnOn("1")
+	c.ShowAll()
+	wizClient.Pilots["10.0.0.1"] = wiz.Pilot{}
+	c.ShowAll()
+	c.ShowAll()
+	c.TurnOff("unknown")
+
+	events, err := c.History(db.EventFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got %+v; expected the command, one state change and the failure", events)
+	}
+	on, change, failed := events[0], events[1], events[2]
+	if on.Command != CommandOn || on.Source != db.SourceTUI || on.LightId != "1" || !*on.IsOn || on.Error != "" {
+		t.Fatalf("got %+v; expected the light turned on from the TUI", on)
+	}
+	if change.Command != CommandStatus || *change.IsOn {
+		t.Fatalf("got %+v; expected the light noticed off", change)
+	}
+	if failed.Command != CommandOff || failed.Error == "" {
+		t.Fatalf("got %+v; expected the failed command with its error", failed)
+	}
+}
+
+func TestClient_TimeOn(t *testing.T) {
+	storage := db.NewMemoryDB()
+	c := Client{LightsDb: storage}
+	on, off := true, false
+	start := time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC)
+	storage.RecordEvent(db.Event{Time: start.Add(-time.Hour), Command: CommandOn, LightId: "1", IsOn: &on})
+	storage.RecordEvent(db.Event{Time: start.Add(30 * time.Minute), Command: CommandOff, LightId: "1", IsOn: &off})
+	storage.RecordEvent(db.Event{Time: start.Add(time.Hour), Command: CommandRename, LightId: "1"})
+	storage.RecordEvent(db.Event{Time: start.Add(2 * time.Hour), Command: CommandOn, LightId: "1", IsOn: &on})
+
+	got, err := c.TimeOn("1", start, start.Add(3*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 90*time.Minute {
+		t.Fatalf("got %v; expected 1h30m", got)
+	}
+}
+
+func TestClient_PruneEventsKeepsTheRetention(t *testing.T) {
+	storage := db.NewMemoryDB()
+	storage.RecordEvent(db.Event{Time: time.Now().Add(-100 * 24 * time.Hour), Command: CommandOn})
+	storage.RecordEvent(db.Event{Time: time.Now().Add(-time.Hour), Command: CommandOff})
+	storage.RecordPowerSample(db.PowerSample{LightId: "1", Time: time.Now().Add(-100 * 24 * time.Hour), Watts: 10})
+
+	if removed, _ := (Client{LightsDb: storage}).PruneEvents(); removed != 0 {
+		t.Fatalf("got %d removed; expected no retention to keep every event", removed)
+	}
+	c := Client{LightsDb: storage, EventRetention: 90 * 24 * time.Hour}
+	if removed, _ := c.PruneEvents(); removed != 2 {
+		t.Fatalf("got %d removed; expected the old event and sample removed", removed)
+	}
+}
+
+func TestClient_PruneEventsKeepsALightOnAcrossTheCutoff(t *testing.T) {
+	storage := db.NewMemoryDB()
+	on := true
+	now := time.Now()
+	storage.RecordEvent(db.Event{Time: now.Add(-100 * 24 * time.Hour), Command: CommandOn, LightId: "1", IsOn: &on})
+	c := Client{LightsDb: storage, EventRetention: 90 * 24 * time.Hour}
+
+	if removed, _ := c.PruneEvents(); removed != 0 {
+		t.Fatalf("got %d removed; expected the latest state of the light kept", removed)
+	}
+	got, err := c.TimeOn("1", now.Add(-7*24*time.Hour), now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != 7*24*time.Hour {
+		t.Fatalf("got %v; expected the light on the whole week", got)
+	}
+}
+
+func TestClient_DiscoverStoresModels(t *testing.T) {
+	storage := db.NewMemoryDB()
+	wizClient := wiztest.NewClient(wiz.Light{Id: "1", MacAddress: "aa", IpAddress: "10.0.0.1"})
+	wizClient.Models["10.0.0.1"] = "ESP10_SOCKET_06"
+	wizClient.Watts["10.0.0.1"] = 42
+	wizClient.Pilots["10.0.0.1"] = wiz.Pilot{IsOn: true}
+	c := Client{LightsDb: storage, WizClient: wizClient}
+
+	c.Discover()
+	lights, _ := c.ShowAll()
+	if lights[0].Model != "ESP10_SOCKET_06" || lights[0].Kind() != wiz.KindPlug || lights[0].Watts == nil || *lights[0].Watts != 42 {
+		t.Fatalf("got %+v; expected the plug model and its measured watts", lights[0])
+	}
+
+	wizClient.Watts["10.0.0.1"] = 40
+	c.TurnOn("1")
+	samples, err := c.PowerSamples("1", time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(samples) != 2 || samples[0].Watts != 42 || samples[1].Watts != 40 {
+		t.Fatalf("got %+v; expected a sample per reading", samples)
+	}
+}
+
+func TestClient_EnergyReport(t *testing.T) {
+	storage := db.NewMemoryDB()
+	storage.Upsert(wiz.Light{Id: "bulb", MacAddress: "aa", IpAddress: "10.0.0.1"})
+	storage.Upsert(wiz.Light{Id: "plug", MacAddress: "bb", IpAddress: "10.0.0.2"})
+	storage.SetModel("bulb", "ESP01_SHRGB1C_31")
+	bulb, _ := storage.FindById("bulb")
+	storage.AddTags([]wiz.Light{*bulb}, []string{"lamp"})
+	c := Client{
+		LightsDb: storage,
+		Energy:   EnergyConfig{DefaultWatts: 5, Models: map[string]float64{"ESP01_SHRGB1C_31": 10}},
+	}
+
+	on, off := true, false
+	measured := 100.0
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	// The bulb is on at full brightness for 10 hours, then dimmed to half by
+	// an automation for 10 more; the plug draws 100 W for 5 hours.
+	storage.RecordEvent(db.Event{Time: start.Add(-time.Hour), LightId: "bulb", IsOn: &on, Dimming: 100})
+	storage.RecordEvent(db.Event{Time: start.Add(10 * time.Hour), LightId: "bulb", IsOn: &on, Dimming: 50, Source: db.SourceAutomation})
+	storage.RecordEvent(db.Event{Time: start.Add(20 * time.Hour), LightId: "bulb", IsOn: &off})
+	storage.RecordEvent(db.Event{Time: start.Add(time.Hour), LightId: "plug", IsOn: &on, Watts: &measured})
+	storage.RecordEvent(db.Event{Time: start.Add(6 * time.Hour), LightId: "plug", IsOn: &off})
+
+	report, err := c.EnergyReport(start, start.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	bulbUsage, plugUsage := report.Lights[0].Usage, report.Lights[1].Usage
+	if bulbUsage.OnTime != 20*time.Hour || !closeTo(bulbUsage.KWh, 0.15) || !closeTo(bulbUsage.FullKWh, 0.2) || !closeTo(bulbUsage.AutomationSavedKWh, 0.05) || bulbUsage.Measured {
+		t.Fatalf("got %+v; expected 20h and 0.15 kWh, 0.05 kWh saved by automation", bulbUsage)
+	}
+	if plugUsage.OnTime != 5*time.Hour || !closeTo(plugUsage.KWh, 0.5) || plugUsage.SavedKWh() != 0 || !plugUsage.Measured {
+		t.Fatalf("got %+v; expected 0.5 kWh measured", plugUsage)
+	}
+	if !closeTo(report.Total.KWh, 0.65) {
+		t.Fatalf("got %v kWh; expected 0.65 in total", report.Total.KWh)
+	}
+	if len(report.Tags) != 1 || report.Tags[0].Name != "lamp" || !closeTo(report.Tags[0].KWh, 0.15) {
+		t.Fatalf("got %+v; expected the bulb under its tag", report.Tags)
+	}
+	if len(report.Rooms) != 1 || report.Rooms[0].Lights != 2 {
+		t.Fatalf("got %+v; expected both lights outside any room", report.Rooms)
+	}
+}
+
+func closeTo(got, expected float64) bool {
+	return math.Abs(got-expected) < 1e-9
+}
+
+func TestClient_FanCommands(t *testing.T) {
+	storage := db.NewMemoryDB()
+	storage.Upsert(wiz.Light{Id: "fan", MacAddress: "aa", IpAddress: "10.0.0.1"})
+	storage.Upsert(wiz.Light{Id: "bulb", MacAddress: "bb", IpAddress: "10.0.0.2"})
+	storage.SetModel("fan", "ESP20_FANDIMS_01")
+	wizClient := wiztest.NewClient()
+	wizClient.Fans["10.0.0.1"] = &wiz.Fan{Speed: 1, Mode: wiz.FanNormal}
+	c := Client{LightsDb: storage, WizClient: wizClient}
+
+	c.SetFan("fan", true)
+	c.SetFanSpeed("fan", 4)
+	c.SetFanMode("fan", wiz.FanBreeze)
+	got, err := c.SetFanDirection("fan", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := wiz.Fan{IsOn: true, Speed: 4, Mode: wiz.FanBreeze, Reverse: true}
+	if got.Fan == nil || *got.Fan != expected {
+		t.Fatalf("got %+v; expected fan %+v", got.Fan, expected)
+	}
+
+	if _, err := c.SetFan("bulb", true); err == nil {
+		t.Fatalf("expected an error for a light that is not a fan")
+	}
+	if _, err := c.SetFanSpeed("fan", wiz.MaxFanSpeed+1); err == nil {
+		t.Fatalf("expected an error for a speed out of range")
+	}
+}
+
+func TestClient_SaveAndApplySnapshot(t *testing.T) {
+	storage := db.NewMemoryDB()
+	storage.Upsert(wiz.Light{Id: "sofa", MacAddress: "aa", IpAddress: "10.0.0.1"})
+	storage.Upsert(wiz.Light{Id: "tv", MacAddress: "bb", IpAddress: "10.0.0.2"})
+	storage.Upsert(wiz.Light{Id: "hall", MacAddress: "cc", IpAddress: "10.0.0.3"})
+	wizClient := wiztest.NewClient()
+	c := Client{LightsDb: storage, WizClient: wizClient}
+
+	dim := wiz.Pilot{IsOn: true, Dimming: 20, Temp: 2700}
+	red := wiz.Pilot{IsOn: true, Dimming: 50, Color: &wiz.Rgb{R: 255}}
+	c.WizClient.SetPilot(&wiz.Light{IpAddress: "10.0.0.1"}, dim)
+	c.WizClient.SetPilot(&wiz.Light{IpAddress: "10.0.0.2"}, red)
+	if _, err := c.SaveSnapshot("movie-night", Selector{Ids: []string{"sofa", "tv"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c.TurnOff("sofa")
+	changes, err := c.DiffSnapshots("movie-night", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].LightId != "sofa" || changes[0].After.IsOn {
+		t.Fatalf("got %+v; expected the sofa turned off", changes)
+	}
+
+	lights, err := c.ApplySnapshot("movie-night")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lights) != 2 || lights[0].Id != "sofa" || !*lights[0].IsOn {
+		t.Fatalf("got %+v; expected the sofa and tv set back", lights)
+	}
+	for ip, expected := range map[string]wiz.Pilot{"10.0.0.1": dim, "10.0.0.2": red} {
+		if got := wizClient.Pilots[ip]; !got.Equal(expected) {
+			t.Fatalf("%s: got %v; expected %v", ip, got, expected)
+		}
+	}
+	if changes, _ := c.DiffSnapshots("movie-night", ""); len(changes) != 0 {
+		t.Fatalf("got %+v; expected no change after applying", changes)
+	}
+
+	events, _ := c.History(db.EventFilter{})
+	applied := 0
+	for _, e := range events {
+		if e.Command == CommandSnapshot && e.Params["snapshot"] == "movie-night" {
+			applied++
+		}
+	}
+	if applied != 2 {
+		t.Fatalf("got %d snapshot events; expected 2", applied)
+	}
+}
+
+func TestClient_SnapshotSkipsUnreachableLights(t *testing.T) {
+	storage := db.NewMemoryDB()
+	storage.Upsert(wiz.Light{Id: "sofa", MacAddress: "aa", IpAddress: "10.0.0.1"})
+	storage.Upsert(wiz.Light{Id: "tv", MacAddress: "bb", IpAddress: "10.0.0.2"})
+	wizClient := wiztest.NewClient()
+	wizClient.Unreachable["10.0.0.2"] = true
+	c := Client{LightsDb: storage, WizClient: wizClient}
+
+	snapshot, err := c.SaveSnapshot("all", Selector{})
+	if err == nil {
+		t.Fatalf("expected an error for the unreachable light")
+	}
+	if snapshot == nil || len(snapshot.Lights) != 1 || snapshot.Lights[0].LightId != "sofa" {
+		t.Fatalf("got %+v; expected the reachable light saved", snapshot)
+	}
+
+	c.SaveSnapshot("other", Selector{Ids: []string{"sofa"}})
+	wizClient.Unreachable["10.0.0.1"] = true
+	if _, err := c.ApplySnapshot("other"); err == nil {
+		t.Fatalf("expected an error for the unreachable light")
+	}
+}
+
+func TestDiffPilots(t *testing.T) {
+	on := wiz.Pilot{IsOn: true}
+	off := wiz.Pilot{}
+	before := []db.SnapshotLight{{LightId: "a", Pilot: on}, {LightId: "b", Pilot: on}, {LightId: "c", Pilot: on}}
+	after := []db.SnapshotLight{{LightId: "a", Pilot: on}, {LightId: "b", Pilot: off}, {LightId: "d", Pilot: on}}
+
+	var got []string
+	for _, change := range diffPilots(before, after) {
+		got = append(got, fmt.Sprintf("%s %v %v", change.LightId, change.Before, change.After))
+	}
+	expected := []string{"b on off", "c on <nil>", "d <nil> on"}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("got %v; expected %v", got, expected)
+	}
+}
+
+func TestClient_TurnOnWithTransition(t *testing.T) {
+	storage := wiztest.Inventory(1)
+	wizClient := wiztest.NewClient()
+	wizClient.Pilots["10.0.0.1"] = wiz.Pilot{Dimming: 80, Temp: 2700}
+	transitions, err := NewTransitions(TransitionConfig{Rate: 50, Easing: "linear"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c := Client{LightsDb: storage, WizClient: wizClient, Transitions: transitions}
+
+	light, err := c.WithTransition(100 * time.Millisecond).TurnOn("1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !*light.IsOn || light.Dimming != 80 {
+		t.Fatalf("got %+v; expected the light on at 80%%", light)
+	}
+
+	steps := wizClient.Sent["10.0.0.1"]
+	if len(steps) != 5 {
+		t.Fatalf("got %d steps; expected 5", len(steps))
+	}
+	for i, step := range steps {
+		if !step.IsOn || step.Temp != 2700 || (i > 0 && step.Dimming <= steps[i-1].Dimming) {
+			t.Fatalf("got steps %+v; expected the dimming rising at 2700K", steps)
+		}
+	}
+	if last := steps[len(steps)-1]; last.Dimming != 80 {
+		t.Fatalf("got last step %+v; expected 80%%", last)
+	}
+}
+
+func TestClient_TurnOffWithTransitionKeepsTheDimming(t *testing.T) {
+	storage := wiztest.Inventory(1)
+	wizClient := wiztest.NewClient()
+	wizClient.Pilots["10.0.0.1"] = wiz.Pilot{IsOn: true, Dimming: 80, Temp: 2700}
+	transitions, _ := NewTransitions(TransitionConfig{Rate: 50, Easing: "linear"})
+	c := Client{LightsDb: storage, WizClient: wizClient, Transitions: transitions}
+
+	if _, err := c.WithTransition(100 * time.Millisecond).TurnOff("1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	steps := wizClient.Sent["10.0.0.1"]
+	if len(steps) < 2 || steps[len(steps)-2].Dimming != 24 {
+		t.Fatalf("got steps %+v; expected the dimming falling", steps)
+	}
+	if last := steps[len(steps)-1]; last.IsOn || last.Dimming != 80 {
+		t.Fatalf("got last step %+v; expected the light off at 80%%", last)
+	}
+
+	light, err := c.TurnOn("1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !*light.IsOn || light.Dimming != 80 {
+		t.Fatalf("got %+v; expected the light back on at 80%%", light)
+	}
+}
+
+func TestClient_SetPilotKeepsTheColor(t *testing.T) {
+	storage := wiztest.Inventory(1)
+	wizClient := wiztest.NewClient()
+	wizClient.Pilots["10.0.0.1"] = wiz.Pilot{Dimming: 30, Temp: 2700}
+	transitions, _ := NewTransitions(TransitionConfig{Rate: 50, Easing: "linear"})
+	c := Client{LightsDb: storage, WizClient: wizClient, Transitions: transitions}
+
+	light, err := c.WithTransition(100*time.Millisecond).SetPilot("1", wiz.Pilot{IsOn: true, Dimming: 60})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !*light.IsOn || light.Dimming != 60 {
+		t.Fatalf("got %+v; expected the light on at 60%%", light)
+	}
+
+	steps := wizClient.Sent["10.0.0.1"]
+	expected := wiz.Pilot{IsOn: true, Dimming: 60, Temp: 2700}
+	if len(steps) == 0 || !steps[len(steps)-1].Equal(expected) {
+		t.Fatalf("got steps %+v; expected a fade to %+v", steps, expected)
+	}
+
+	events, _ := c.History(db.EventFilter{LightId: "1"})
+	if len(events) != 1 || events[0].Command != CommandSet {
+		t.Fatalf("got %+v; expected a set event", events)
+	}
+}
+
+func TestClient_CommandCancelsTransition(t *testing.T) {
+	storage := wiztest.Inventory(1)
+	wizClient := wiztest.NewClient()
+	transitions, _ := NewTransitions(TransitionConfig{Rate: 50})
+	c := Client{LightsDb: storage, WizClient: wizClient, Transitions: transitions}
+
+	done := make(chan error)
+	go func() {
+		_, err := c.WithTransition(5 * time.Second).TurnOn("1")
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := c.TurnOff("1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrTransitionCancelled) {
+			t.Fatalf("got %v; expected %v", err, ErrTransitionCancelled)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the transition cancelled")
+	}
+	if light, _ := c.WizClient.Status(&wiz.Light{IpAddress: "10.0.0.1"}); *light.IsOn {
+		t.Fatalf("expected the light left off")
+	}
+}
+
+func TestTransitions_StepsFollowTheChange(t *testing.T) {
+	transitions, _ := NewTransitions(TransitionConfig{Rate: 50, Easing: "linear"})
+
+	tests := []struct {
+		from, to wiz.Pilot
+		expected int
+	}{
+		{wiz.Pilot{IsOn: true, Dimming: 50}, wiz.Pilot{IsOn: true, Dimming: 53}, 3},
+		{wiz.Pilot{IsOn: true, Dimming: 50, Temp: 2700}, wiz.Pilot{IsOn: true, Dimming: 50, Temp: 6500}, 5},
+		{wiz.Pilot{IsOn: true, Dimming: 50, Color: &wiz.Rgb{R: 255}}, wiz.Pilot{IsOn: true, Dimming: 50, Color: &wiz.Rgb{R: 253, G: 2}}, 2},
+		{wiz.Pilot{IsOn: true, Dimming: 50}, wiz.Pilot{IsOn: true, Dimming: 50, Scene: wiz.WakeUp}, 1},
+	}
+	for i, tt := range tests {
+		var steps []wiz.Pilot
+		err := transitions.run("1", tt.from, tt.to, 100*time.Millisecond, nil, func(step wiz.Pilot) error {
+			steps = append(steps, step)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%d: unexpected error: %v", i, err)
+		}
+		if len(steps) != tt.expected || !steps[len(steps)-1].Equal(tt.to) {
+			t.Fatalf("%d: got steps %+v; expected %d ending at %+v", i, steps, tt.expected, tt.to)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	var tests = []struct {
+		from, to wiz.Pilot
+		p        float64
+		expected wiz.Pilot
+	}{
+		{wiz.Pilot{IsOn: true, Dimming: 20, Temp: 2200}, wiz.Pilot{IsOn: true, Dimming: 100, Temp: 6200}, 0.5, wiz.Pilot{IsOn: true, Dimming: 60, Temp: 4200}},
+		{wiz.Pilot{IsOn: true, Dimming: 50, Color: &wiz.Rgb{R: 255}}, wiz.Pilot{IsOn: true, Dimming: 50, Color: &wiz.Rgb{B: 255}}, 0.2, wiz.Pilot{IsOn: true, Dimming: 50, Color: &wiz.Rgb{R: 204, B: 51}}},
+		{wiz.Pilot{Dimming: 80, Temp: 3000}, wiz.Pilot{IsOn: true, Dimming: 90, Temp: 3000}, 0.5, wiz.Pilot{IsOn: true, Dimming: 50, Temp: 3000}},
+		{wiz.Pilot{IsOn: true, Temp: 3000}, wiz.Pilot{Dimming: 40, Color: &wiz.Rgb{R: 1}}, 0.5, wiz.Pilot{IsOn: true, Dimming: 55, Temp: 3000}},
+		{wiz.Pilot{IsOn: true, Dimming: 40, Temp: 3000}, wiz.Pilot{IsOn: true, Dimming: 40, Scene: wiz.Scene(4)}, 0.5, wiz.Pilot{IsOn: true, Dimming: 40, Scene: wiz.Scene(4)}},
+	}
+
+	for i, tt := range tests {
+		if got := interpolate(tt.from, tt.to, tt.p); !got.Equal(tt.expected) {
+			t.Fatalf("%d: got %+v; expected %+v", i, got, tt.expected)
+		}
+	}
+}
+
+func TestParseEasing(t *testing.T) {
+	for _, name := range []string{"", "linear", "ease-in", "ease-out", "ease-in-out"} {
+		easing, err := ParseEasing(name)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", name, err)
+		}
+		if easing(0) != 0 || easing(1) != 1 || easing(0.25) > easing(0.75) {
+			t.Fatalf("%q: expected a curve rising from 0 to 1", name)
+		}
+	}
+	if _, err := ParseEasing("bounce"); err == nil {
+		t.Fatalf("expected an error for an unknown easing")
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	var tests = []struct {
+		days     string
+		expected []time.Weekday
+		format   string
+	}{
+		{"", nil, "daily"},
+		{"daily", nil, "daily"},
+		{"weekdays", []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}, "weekdays"},
+		{"weekends", []time.Weekday{time.Saturday, time.Sunday}, "weekends"},
+		{"Fri, mon,fri", []time.Weekday{time.Monday, time.Friday}, "mon,fri"},
+		{"sat,sun", []time.Weekday{time.Sunday, time.Saturday}, "weekends"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDays(tt.days)
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", tt.days, err)
+		}
+		if !slices.Equal(got, tt.expected) {
+			t.Fatalf("%q: got %v; expected %v", tt.days, got, tt.expected)
+		}
+		if format := FormatDays(got); format != tt.format {
+			t.Fatalf("%q: got %q; expected %q", tt.days, format, tt.format)
+		}
+	}
+	if _, err := ParseDays("mon,someday"); err == nil {
+		t.Fatalf("expected an error for an unknown day")
+	}
+}
+
+func TestNextRing(t *testing.T) {
+	weekdays, _ := ParseDays("weekdays")
+	weekends, _ := ParseDays("weekends")
+	friday := time.Date(2025, 1, 10, 6, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		days     []time.Weekday
+		after    time.Time
+		expected time.Time
+	}{
+		{weekdays, friday, time.Date(2025, 1, 10, 7, 30, 0, 0, time.UTC)},
+		{weekdays, friday.Add(2 * time.Hour), time.Date(2025, 1, 13, 7, 30, 0, 0, time.UTC)},
+		{weekends, friday, time.Date(2025, 1, 11, 7, 30, 0, 0, time.UTC)},
+		{nil, friday.Add(2 * time.Hour), time.Date(2025, 1, 11, 7, 30, 0, 0, time.UTC)},
+	}
+
+	for i, tt := range tests {
+		alarm := db.Alarm{Hour: 7, Minute: 30, Days: tt.days}
+		if got := NextRing(alarm, tt.after); !got.Equal(tt.expected) {
+			t.Fatalf("%d: got %v; expected %v", i, got, tt.expected)
+		}
+	}
+}
+
+func TestDue(t *testing.T) {
+	ring := time.Date(2025, 1, 10, 7, 0, 0, 0, time.UTC)
+	alarm := db.Alarm{Hour: 7, Ramp: 30 * time.Minute, Enabled: true, LastRun: ring.AddDate(0, 0, -1)}
+	ran := alarm
+	ran.LastRun = ring
+	disabled := alarm
+	disabled.Enabled = false
+
+	var tests = []struct {
+		alarm    db.Alarm
+		now      time.Time
+		elapsed  time.Duration
+		expected bool
+	}{
+		{alarm, ring, 0, true},
+		{alarm, ring.Add(10 * time.Minute), 10 * time.Minute, true},
+		{alarm, ring.Add(40 * time.Minute), 0, false},
+		{alarm, ring.Add(-time.Minute), 0, false},
+		{ran, ring.Add(time.Minute), 0, false},
+		{disabled, ring, 0, false},
+	}
+
+	for i, tt := range tests {
+		elapsed, got := due(tt.alarm, tt.now)
+		if got != tt.expected || (got && elapsed != tt.elapsed) {
+			t.Fatalf("%d: got %v after %v; expected %v after %v", i, got, elapsed, tt.expected, tt.elapsed)
+		}
+	}
+}
+
+func TestClient_RingAlarm(t *testing.T) {
+	storage := wiztest.Inventory(2)
+	wizClient := wiztest.NewClient()
+	transitions, _ := NewTransitions(TransitionConfig{Rate: 50, Easing: "linear"})
+	c := Client{LightsDb: storage, WizClient: wizClient, Transitions: transitions}
+
+	_, err := c.CreateAlarm(db.Alarm{Name: "wake", Hour: 7, Ramp: 100 * time.Millisecond, Lights: db.LightSelection{Ids: []string{"1"}}, WakeUpScene: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := c.CreateAlarm(db.Alarm{Name: "nothing", Hour: 7, Ramp: time.Minute}); err == nil {
+		t.Fatalf("expected an error for an alarm without lights")
+	}
+
+	lights, err := c.RingAlarm("wake")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lights) != 1 || !*lights[0].IsOn {
+		t.Fatalf("got %+v; expected light 1 on", lights)
+	}
+
+	steps := wizClient.Sent["10.0.0.1"]
+	if len(steps) == 0 || steps[0].Temp <= wiz.MinTemperatureK || !steps[len(steps)-1].Equal(sunriseEnd) {
+		t.Fatalf("got steps %+v; expected a ramp up to %+v", steps, sunriseEnd)
+	}
+	if got := wizClient.Pilots["10.0.0.1"]; got.Scene != wiz.WakeUp {
+		t.Fatalf("got %+v; expected the wake up scene", got)
+	}
+	if _, touched := wizClient.Pilots["10.0.0.2"]; touched {
+		t.Fatalf("expected light 2 left alone")
+	}
+
+	events, _ := c.History(db.EventFilter{LightId: "1"})
+	if len(events) != 1 || events[0].Command != CommandAlarm || events[0].Source != db.SourceAutomation {
+		t.Fatalf("got %+v; expected an alarm event from automation", events)
+	}
+}
+
+func TestClient_RunAlarmsStopsTheSunrise(t *testing.T) {
+	storage := wiztest.Inventory(1)
+	wizClient := wiztest.NewClient()
+	transitions, _ := NewTransitions(TransitionConfig{Rate: 50, Easing: "linear"})
+	c := Client{LightsDb: storage, WizClient: wizClient, Transitions: transitions}
+
+	now := time.Now()
+	storage.CreateAlarm(db.Alarm{Name: "wake", Hour: now.Hour(), Minute: now.Minute(), Ramp: time.Hour, Lights: db.LightSelection{Ids: []string{"1"}}, Enabled: true, LastRun: now.Add(-time.Hour)})
+
+	stop := make(chan struct{})
+	reports := make(chan error, 1)
+	done := make(chan error)
+	go func() {
+		done <- c.RunAlarms(stop, func(alarm db.Alarm, lights []wiz.Light, err error) { reports <- err })
+	}()
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected RunAlarms to return without waiting for the sunrise")
+	}
+	if err := <-reports; !errors.Is(err, ErrTransitionStopped) {
+		t.Fatalf("got %v; expected %v", err, ErrTransitionStopped)
+	}
+	if got := wizClient.Pilot("10.0.0.1"); !got.IsOn || got.Temp >= sunriseEnd.Temp {
+		t.Fatalf("got %+v; expected the sunrise started", got)
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	c := Client{Location: Location{Latitude: 48.8566, Longitude: 2.3522}}
+	friday := time.Date(2025, time.June, 20, 12, 0, 0, 0, paris)
+
+	tests := []struct {
+		spec     string
+		after    time.Time
+		expected time.Time
+	}{
+		{"0 7 * * 1-5", friday, time.Date(2025, time.June, 23, 7, 0, 0, 0, paris)},
+		{"*/15 * * * *", friday, time.Date(2025, time.June, 20, 12, 15, 0, 0, paris)},
+		{"0 0 1 * *", friday, time.Date(2025, time.July, 1, 0, 0, 0, 0, paris)},
+		{"0 9 13 * 5", friday, time.Date(2025, time.June, 27, 9, 0, 0, 0, paris)},
+		{"every weekday 07:00", friday, time.Date(2025, time.June, 23, 7, 0, 0, 0, paris)},
+		{"every day 12:30", friday, time.Date(2025, time.June, 20, 12, 30, 0, 0, paris)},
+		{"every sat,sun 08:15", friday, time.Date(2025, time.June, 21, 8, 15, 0, 0, paris)},
+		// Summer time starts at 2:00 on March 30, 2025.
+		{"every day 07:00", time.Date(2025, time.March, 29, 7, 0, 0, 0, paris), time.Date(2025, time.March, 30, 7, 0, 0, 0, paris)},
+		{"30 2 * * *", time.Date(2025, time.March, 29, 3, 0, 0, 0, paris), time.Date(2025, time.March, 30, 3, 30, 0, 0, paris)},
+		{"sunset", friday, time.Date(2025, time.June, 20, 21, 58, 0, 0, paris)},
+		{"30 min before sunset", friday, time.Date(2025, time.June, 20, 21, 28, 0, 0, paris)},
+		{"at civil dusk +10m", friday, time.Date(2025, time.June, 20, 22, 50, 0, 0, paris)},
+		{"1h after sunrise on weekends", friday, time.Date(2025, time.June, 21, 6, 47, 0, 0, paris)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := c.ParseSchedule(tt.spec, paris)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := schedule.Next(tt.after); got.Sub(tt.expected).Abs() > 3*time.Minute {
+				t.Fatalf("got %v; expected %v", got, tt.expected)
+			}
+		})
+	}
+
+	for _, spec := range []string{"", "61 * * * *", "every day 25:00", "every someday 07:00", "before sunset", "moonrise"} {
+		if _, err := c.ParseSchedule(spec, paris); err == nil {
+			t.Fatalf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestClient_DueRun(t *testing.T) {
+	c := Client{}
+	now := time.Date(2025, time.June, 20, 7, 0, 30, 0, time.Local)
+	job := db.Job{Schedule: "every day 07:00", Enabled: true}
+
+	tests := []struct {
+		name       string
+		lastRun    time.Time
+		catchUp    bool
+		run        bool
+		missedRuns bool
+	}{
+		{"not yet", now, false, false, false},
+		{"on time", now.Add(-time.Hour), false, true, false},
+		{"missed", now.Add(-25 * time.Hour), false, false, true},
+		{"caught up", now.Add(-25 * time.Hour), true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job.LastRun, job.CatchUp = tt.lastRun, tt.catchUp
+			run, missed := c.dueRun(job, now)
+			if run != tt.run || missed.IsZero() == tt.missedRuns {
+				t.Fatalf("got %v, %v; expected %v, missed %v", run, missed, tt.run, tt.missedRuns)
+			}
+		})
+	}
+}
+
+func TestClient_RunJob(t *testing.T) {
+	storage := wiztest.Inventory(2)
+	c := Client{LightsDb: storage, WizClient: wiztest.NewClient()}
+
+	if _, err := c.CreateJob(db.Job{Name: "evening", Schedule: "sunset", Command: CommandOn, Lights: db.LightSelection{All: true}, Enabled: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, job := range []db.Job{
+		{Name: "bad schedule", Schedule: "sometimes", Command: CommandOn, Lights: db.LightSelection{All: true}},
+		{Name: "bad zone", Schedule: "sunset", TimeZone: "Mars/Olympus", Command: CommandOn, Lights: db.LightSelection{All: true}},
+		{Name: "bad command", Schedule: "sunset", Command: "dance", Lights: db.LightSelection{All: true}},
+		{Name: "no lights", Schedule: "sunset", Command: CommandOn},
+		{Name: "no snapshot", Schedule: "sunset", Command: CommandSnapshot},
+		{Name: "too dim", Schedule: "sunset", Command: JobDimming, Argument: "5", Lights: db.LightSelection{All: true}},
+		{Name: "too warm", Schedule: "sunset", Command: JobTemperature, Argument: "1800", Lights: db.LightSelection{All: true}},
+		{Name: "two colors", Schedule: "sunset", Command: JobColor, Argument: "255,0", Lights: db.LightSelection{All: true}},
+		{Name: "bad color", Schedule: "sunset", Command: JobColor, Argument: "255,0,300", Lights: db.LightSelection{All: true}},
+		{Name: "bad scene", Schedule: "sunset", Command: JobScene, Argument: "disco", Lights: db.LightSelection{All: true}},
+	} {
+		if _, err := c.CreateJob(job); err == nil {
+			t.Fatalf("expected an error for %s", job.Name)
+		}
+	}
+
+	lights, err := c.RunJob("evening")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(lights) != 2 || !*lights[0].IsOn || !*lights[1].IsOn {
+		t.Fatalf("got %+v; expected both lights on", lights)
+	}
+
+	job, _ := c.FindJob("evening")
+	if time.Since(job.LastRun) > time.Minute || job.LastError != "" {
+		t.Fatalf("got %+v; expected a successful run just now", job)
+	}
+	events, _ := c.History(db.EventFilter{LightId: "1"})
+	if len(events) != 1 || events[0].Command != CommandOn || events[0].Source != db.SourceAutomation {
+		t.Fatalf("got %+v; expected an on event from automation", events)
+	}
+
+	tests := []struct {
+		command, argument string
+		expected          wiz.Pilot
+	}{
+		{JobDimming, "40", wiz.Pilot{IsOn: true, Dimming: 40}},
+		{JobTemperature, "2700K", wiz.Pilot{IsOn: true, Dimming: 40, Temp: 2700}},
+		{JobColor, "255, 0, 64", wiz.Pilot{IsOn: true, Dimming: 40, Color: &wiz.Rgb{R: 255, B: 64}}},
+		{JobScene, "wake up", wiz.Pilot{IsOn: true, Dimming: 40, Scene: wiz.WakeUp}},
+	}
+	for _, tt := range tests {
+		job := db.Job{Name: tt.command, Schedule: "sunset", Command: tt.command, Argument: tt.argument, Lights: db.LightSelection{Ids: []string{"2"}}}
+		if _, err := c.CreateJob(job); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.command, err)
+		}
+		if _, err := c.RunJob(tt.command); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.command, err)
+		}
+		if got := c.WizClient.(*wiztest.Client).Pilot("10.0.0.2"); !got.Equal(tt.expected) {
+			t.Fatalf("%s: got %+v; expected %+v", tt.command, got, tt.expected)
+		}
+	}
+}
+
+func TestClient_RunJobsStopsTheTransition(t *testing.T) {
+	storage := wiztest.Inventory(1)
+	wizClient := wiztest.NewClient()
+	transitions, _ := NewTransitions(TransitionConfig{Rate: 50, Easing: "linear"})
+	c := Client{LightsDb: storage, WizClient: wizClient, Transitions: transitions}
+
+	now := time.Now()
+	storage.CreateJob(db.Job{Name: "evening", Schedule: now.Format("every day 15:04"), Command: CommandOn, Transition: time.Hour, Lights: db.LightSelection{All: true}, Enabled: true, LastRun: now.Add(-time.Hour)})
+
+	stop := make(chan struct{})
+	reports := make(chan error, 1)
+	done := make(chan error)
+	go func() {
+		done <- c.RunJobs(stop, func(job db.Job, lights []wiz.Light, err error) { reports <- err })
+	}()
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected RunJobs to return without waiting for the transition")
+	}
+	if err := <-reports; !errors.Is(err, ErrTransitionStopped) {
+		t.Fatalf("got %v; expected %v", err, ErrTransitionStopped)
+	}
+	if job, _ := c.FindJob("evening"); !strings.Contains(job.LastError, ErrTransitionStopped.Error()) {
+		t.Fatalf("got %+v; expected the run recorded as stopped", job)
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		age      string
+		expected time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"1.5d", 36 * time.Hour},
+		{"12h", 12 * time.Hour},
+	}
+	for _, tt := range tests {
+		got, err := ParseAge(tt.age)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.age, err)
+		}
+		if got != tt.expected {
+			t.Fatalf("got %v; expected %v", got, tt.expected)
+		}
+	}
+
+	for _, age := range []string{"", "d", "30x", "thirty days"} {
+		if _, err := ParseAge(age); err == nil {
+			t.Fatalf("%q: expected an error", age)
+		}
+	}
+}
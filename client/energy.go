@@ -0,0 +1,167 @@
+package client
+
+import (
+	"cmp"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"slices"
+	"time"
+)
+
+// EnergyConfig gives the rated watts of the lights by model, as reported by
+// the bulbs, for the lights that do not measure what they draw.
+type EnergyConfig struct {
+	DefaultWatts float64            `yaml:"defaultWatts"`
+	Models       map[string]float64 `yaml:"models"`
+}
+
+func (e EnergyConfig) ratedWatts(model string) float64 {
+	if watts, ok := e.Models[model]; ok {
+		return watts
+	}
+	return e.DefaultWatts
+}
+
+// Usage is how long lights were on and the energy they took. FullKWh is what
+// the same time on would have taken at full brightness, so the difference is
+// what dimming saved; AutomationSavedKWh is the part of it saved while an
+// automation had set the light.
+type Usage struct {
+	OnTime             time.Duration
+	KWh                float64
+	FullKWh            float64
+	AutomationSavedKWh float64
+	// Measured tells that some of the energy was measured by the device
+	// rather than estimated.
+	Measured bool
+}
+
+func (u Usage) SavedKWh() float64 {
+	return u.FullKWh - u.KWh
+}
+
+func (u *Usage) add(other Usage) {
+	u.OnTime += other.OnTime
+	u.KWh += other.KWh
+	u.FullKWh += other.FullKWh
+	u.AutomationSavedKWh += other.AutomationSavedKWh
+	u.Measured = u.Measured || other.Measured
+}
+
+type LightUsage struct {
+	Light wiz.Light
+	Usage
+}
+
+// UsageTotal adds up the usage of the lights in a room or with a tag.
+type UsageTotal struct {
+	Name   string
+	Lights int
+	Usage
+}
+
+type EnergyReport struct {
+	Since  time.Time
+	Until  time.Time
+	Lights []LightUsage
+	// Rooms holds the lights outside any room under an empty name.
+	Rooms []UsageTotal
+	// Tags counts a light under each of its tags.
+	Tags  []UsageTotal
+	Total Usage
+}
+
+// EnergyReport estimates the energy the lights took between since and until
+// from the states in the event log. A light draws the watts it measured, when
+// it measures them, or else the rated watts of its model scaled by its
+// dimming.
+func (c Client) EnergyReport(since, until time.Time) (*EnergyReport, error) {
+	lights, err := c.LightsDb.FindAll()
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := c.LightsDb.FindRooms()
+	if err != nil {
+		return nil, err
+	}
+	roomNames := make(map[string]string, len(rooms))
+	for _, r := range rooms {
+		roomNames[r.Id] = r.Name
+	}
+
+	report := EnergyReport{Since: since, Until: until}
+	byRoom := map[string]*UsageTotal{}
+	byTag := map[string]*UsageTotal{}
+	addTo := func(totals map[string]*UsageTotal, name string, usage Usage) {
+		if totals[name] == nil {
+			totals[name] = &UsageTotal{Name: name}
+		}
+		totals[name].Lights++
+		totals[name].add(usage)
+	}
+
+	for _, l := range lights {
+		spans, err := c.stateSpans(l.Id, since, until)
+		if err != nil {
+			return nil, err
+		}
+		usage := c.usage(l, spans)
+
+		report.Lights = append(report.Lights, LightUsage{Light: l, Usage: usage})
+		report.Total.add(usage)
+		addTo(byRoom, roomNames[l.Room], usage)
+		for _, t := range l.Tags {
+			addTo(byTag, t, usage)
+		}
+	}
+
+	report.Rooms = sortedTotals(byRoom)
+	report.Tags = sortedTotals(byTag)
+	return &report, nil
+}
+
+func (c Client) usage(light wiz.Light, spans []stateSpan) Usage {
+	rated := c.Energy.ratedWatts(light.Model)
+
+	var usage Usage
+	for _, s := range spans {
+		if !*s.state.IsOn {
+			continue
+		}
+		hours := s.duration().Hours()
+
+		watts, full := rated*dimmingFactor(s.state.Dimming), rated
+		if s.state.Watts != nil {
+			watts, full = *s.state.Watts, *s.state.Watts
+			usage.Measured = true
+		}
+
+		usage.OnTime += s.duration()
+		usage.KWh += watts * hours / 1000
+		usage.FullKWh += full * hours / 1000
+		if s.state.Source == db.SourceAutomation {
+			usage.AutomationSavedKWh += (full - watts) * hours / 1000
+		}
+	}
+	return usage
+}
+
+// dimmingFactor takes the power of a LED as proportional to its dimming,
+// which is close enough for an estimate.
+func dimmingFactor(dimming int) float64 {
+	if dimming <= 0 {
+		return 1
+	}
+	return float64(min(dimming, 100)) / 100
+}
+
+func sortedTotals(totals map[string]*UsageTotal) []UsageTotal {
+	result := make([]UsageTotal, 0, len(totals))
+	for _, t := range totals {
+		result = append(result, *t)
+	}
+	slices.SortFunc(result, func(a, b UsageTotal) int {
+		return cmp.Or(cmp.Compare(b.KWh, a.KWh), cmp.Compare(a.Name, b.Name))
+	})
+	return result
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Commands as recorded in the event log. CommandStatus records a change in
+// the state of a light, noticed when asking for its status.
+const (
+	CommandDiscover = "discover"
+	CommandStatus   = "status"
+	CommandOn       = "on"
+	CommandOff      = "off"
+	CommandDaylight = "daylight"
+	CommandRename   = "rename"
+	CommandDelete   = "delete"
+	CommandPrune    = "prune"
+	CommandEraseAll = "erase all"
+	CommandImport   = "import"
+	CommandRestore  = "restore"
+	CommandSnapshot = "snapshot"
+	CommandAlarm    = "alarm"
+	CommandSet      = "set"
+)
+
+// WithSource returns the client with its commands recorded as issued by
+// source.
+func (c Client) WithSource(source string) Functions {
+	c.Source = source
+	return c
+}
+
+// record appends to the event log a command that started at start. Failing
+// to record it does not fail the command.
+func (c Client) record(start time.Time, command string, lightId string, params map[string]string, light *wiz.Light, err error) {
+	event := db.Event{
+		Time:    start,
+		Source:  c.Source,
+		Command: command,
+		LightId: lightId,
+		Params:  params,
+		Latency: time.Since(start),
+	}
+	if light != nil {
+		event.IsOn = light.IsOn
+		event.Dimming = light.Dimming
+		event.Watts = light.Watts
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	c.LightsDb.RecordEvent(event)
+}
+
+// recordState records the state a light reported, if it differs from the
+// last one recorded for it.
+func (c Client) recordState(start time.Time, light *wiz.Light) {
+	if light.IsOn == nil {
+		return
+	}
+	last, err := c.LightsDb.FindEvents(db.EventFilter{LightId: light.Id, WithState: true, Limit: 1})
+	if err != nil || (len(last) == 1 && sameState(last[0], light)) {
+		return
+	}
+	c.record(start, CommandStatus, light.Id, nil, light, nil)
+}
+
+// sameState tells whether a light is as an event left it. Measured watts
+// fluctuate, so they change the state only when they move by a tenth, and at
+// least a watt.
+func sameState(e db.Event, light *wiz.Light) bool {
+	if *e.IsOn != *light.IsOn || e.Dimming != light.Dimming {
+		return false
+	}
+	if e.Watts == nil || light.Watts == nil {
+		return e.Watts == nil && light.Watts == nil
+	}
+	return math.Abs(*e.Watts-*light.Watts) < max(1, *e.Watts/10)
+}
+
+// History returns the logged events matching filter, oldest first.
+func (c Client) History(filter db.EventFilter) ([]db.Event, error) {
+	return c.LightsDb.FindEvents(filter)
+}
+
+// TimeOn adds up how long a light was on between since and until, going by
+// the states in the event log. Until the first recorded state the light is
+// taken as off.
+func (c Client) TimeOn(lightId string, since, until time.Time) (time.Duration, error) {
+	spans, err := c.stateSpans(lightId, since, until)
+	if err != nil {
+		return 0, err
+	}
+
+	var total time.Duration
+	for _, s := range spans {
+		if *s.state.IsOn {
+			total += s.duration()
+		}
+	}
+	return total, nil
+}
+
+// stateSpan is a stretch of time a light stayed in the state an event left
+// it in.
+type stateSpan struct {
+	from, until time.Time
+	state       db.Event
+}
+
+func (s stateSpan) duration() time.Duration {
+	return s.until.Sub(s.from)
+}
+
+// stateSpans splits the time between since and until by the states recorded
+// for a light, starting from the last state recorded before since.
+func (c Client) stateSpans(lightId string, since, until time.Time) ([]stateSpan, error) {
+	before, err := c.LightsDb.FindEvents(db.EventFilter{LightId: lightId, Until: since, WithState: true, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	during, err := c.LightsDb.FindEvents(db.EventFilter{LightId: lightId, Since: since, Until: until, WithState: true})
+	if err != nil {
+		return nil, err
+	}
+
+	var spans []stateSpan
+	if len(before) == 1 {
+		spans = append(spans, stateSpan{from: since, state: before[0]})
+	}
+	for _, e := range during {
+		spans = append(spans, stateSpan{from: e.Time, state: e})
+	}
+	for i := range spans {
+		spans[i].until = until
+		if i+1 < len(spans) {
+			spans[i].until = spans[i+1].from
+		}
+	}
+	return spans, nil
+}
+
+// PruneEvents removes the events and power samples older than the retention
+// and returns how many were removed. A zero retention keeps them all.
+func (c Client) PruneEvents() (int, error) {
+	if c.EventRetention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-c.EventRetention)
+	events, err := c.LightsDb.DeleteEventsBefore(cutoff)
+	if err != nil {
+		return events, err
+	}
+	samples, err := c.LightsDb.DeletePowerSamplesBefore(cutoff)
+	return events + samples, err
+}
+
+// PowerSamples returns the watts a device measured between since and until,
+// oldest first.
+func (c Client) PowerSamples(lightId string, since, until time.Time) ([]db.PowerSample, error) {
+	if _, err := c.LightsDb.FindById(lightId); err != nil {
+		return nil, err
+	}
+	return c.LightsDb.FindPowerSamples(lightId, since, until)
+}
+
+func countParam(n int) map[string]string {
+	return map[string]string{"count": strconv.Itoa(n)}
+}
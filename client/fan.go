@@ -0,0 +1,63 @@
+package client
+
+import (
+	"fmt"
+	"gowizcli/wiz"
+	"strconv"
+	"time"
+)
+
+const CommandFan = "fan"
+
+func (c Client) SetFan(lightId string, on bool) (*wiz.Light, error) {
+	return c.fanCommand(lightId, map[string]string{"on": strconv.FormatBool(on)}, func(light *wiz.Light) (*wiz.Light, error) {
+		return c.WizClient.SetFan(light, on)
+	})
+}
+
+func (c Client) SetFanSpeed(lightId string, speed int) (*wiz.Light, error) {
+	if speed < 1 || speed > wiz.MaxFanSpeed {
+		return nil, fmt.Errorf("fan speed must be from 1 to %d", wiz.MaxFanSpeed)
+	}
+	return c.fanCommand(lightId, map[string]string{"speed": strconv.Itoa(speed)}, func(light *wiz.Light) (*wiz.Light, error) {
+		return c.WizClient.SetFanSpeed(light, speed)
+	})
+}
+
+func (c Client) SetFanMode(lightId string, mode wiz.FanMode) (*wiz.Light, error) {
+	if mode != wiz.FanNormal && mode != wiz.FanBreeze {
+		return nil, fmt.Errorf("unknown fan mode %d", mode)
+	}
+	return c.fanCommand(lightId, map[string]string{"mode": strconv.Itoa(int(mode))}, func(light *wiz.Light) (*wiz.Light, error) {
+		return c.WizClient.SetFanMode(light, mode)
+	})
+}
+
+func (c Client) SetFanDirection(lightId string, reverse bool) (*wiz.Light, error) {
+	return c.fanCommand(lightId, map[string]string{"reverse": strconv.FormatBool(reverse)}, func(light *wiz.Light) (*wiz.Light, error) {
+		return c.WizClient.SetFanDirection(light, reverse)
+	})
+}
+
+// fanCommand runs a fan operation on a light, which must be a fan.
+func (c Client) fanCommand(lightId string, params map[string]string, apply func(light *wiz.Light) (*wiz.Light, error)) (result *wiz.Light, err error) {
+	start := time.Now()
+	defer func() { c.record(start, CommandFan, lightId, params, result, err) }()
+
+	light, err := c.LightsDb.FindById(lightId)
+	if err != nil {
+		return nil, err
+	}
+	if light.Kind() != wiz.KindFan {
+		return nil, fmt.Errorf("light %s is not a fan", lightId)
+	}
+	c.Transitions.Cancel(light.Id)
+
+	newLight, err := apply(light)
+	if err != nil {
+		return nil, err
+	}
+
+	light.LastSeen = c.seen(light.Id)
+	return withInventory(newLight, light), nil
+}
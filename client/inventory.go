@@ -0,0 +1,87 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"strconv"
+	"time"
+)
+
+const (
+	BackupReasonEraseAll = "erase all"
+	BackupReasonImport   = "import"
+	BackupReasonRestore  = "restore"
+)
+
+func (c Client) RenameLight(lightId string, name string) (result *wiz.Light, err error) {
+	start := time.Now()
+	defer func() { c.record(start, CommandRename, lightId, map[string]string{"name": name}, nil, err) }()
+
+	if err := c.LightsDb.SetName(lightId, name); err != nil {
+		return nil, err
+	}
+	return c.LightsDb.FindById(lightId)
+}
+
+func (c Client) Export() (*db.Inventory, error) {
+	return c.LightsDb.Export()
+}
+
+// Import backs the inventory up before replacing it.
+func (c Client) Import(inventory db.Inventory, mode db.ImportMode) (err error) {
+	start := time.Now()
+	defer func() {
+		c.record(start, CommandImport, "", map[string]string{"mode": string(mode), "count": strconv.Itoa(len(inventory.Lights))}, nil, err)
+	}()
+
+	if mode == db.ImportReplace {
+		if _, err := c.LightsDb.CreateBackup(BackupReasonImport); err != nil {
+			return fmt.Errorf("backing up before import: %w", err)
+		}
+	}
+	return c.LightsDb.Import(inventory, mode)
+}
+
+func (c Client) ListBackups() ([]db.Backup, error) {
+	return c.LightsDb.FindBackups()
+}
+
+// RestoreBackup replaces the inventory with a backup or, when id is empty,
+// with the latest one not taken by a restore, so that restoring again does
+// not undo the restore. The current inventory is backed up first, so a
+// restore can itself be undone by its id.
+func (c Client) RestoreBackup(id string) (result *db.Backup, err error) {
+	start := time.Now()
+	params := map[string]string{}
+	defer func() { c.record(start, CommandRestore, "", params, nil, err) }()
+
+	backups, err := c.LightsDb.FindBackups()
+	if err != nil {
+		return nil, err
+	}
+
+	var backup *db.Backup
+	for _, b := range backups {
+		if b.Id == id || (id == "" && b.Reason != BackupReasonRestore) {
+			backup = &b
+			break
+		}
+	}
+	switch {
+	case backup == nil && id != "":
+		return nil, fmt.Errorf("backup %s %w", id, db.ErrNotFound)
+	case backup == nil:
+		return nil, errors.New("there are no backups to restore")
+	}
+
+	params["backup"] = backup.Id
+	if _, err := c.LightsDb.CreateBackup(BackupReasonRestore); err != nil {
+		return nil, fmt.Errorf("backing up before restore: %w", err)
+	}
+	if err := c.LightsDb.Import(backup.Inventory, db.ImportReplace); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
@@ -0,0 +1,303 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jobGrace is how late the scheduler may find a run and still count it as on
+// time rather than missed.
+const jobGrace = 2 * alarmPoll
+
+// The commands of the jobs that set the lights to the state in their
+// argument: a dimming in percent, a temperature in kelvins, a color as R,G,B
+// or the name of a scene.
+const (
+	JobDimming     = "dimming"
+	JobTemperature = "temperature"
+	JobColor       = "color"
+	JobScene       = "scene"
+)
+
+// JobCommands are the commands a job runs.
+var JobCommands = []string{CommandOn, CommandOff, CommandDaylight, CommandSnapshot, JobDimming, JobTemperature, JobColor, JobScene}
+
+// JobSchedule parses the schedule of a job in its time zone.
+func (c Client) JobSchedule(job db.Job) (Schedule, error) {
+	loc := time.Local
+	if job.TimeZone != "" {
+		var err error
+		if loc, err = time.LoadLocation(job.TimeZone); err != nil {
+			return nil, fmt.Errorf("unknown time zone %s", job.TimeZone)
+		}
+	}
+	return c.ParseSchedule(job.Schedule, loc)
+}
+
+// NextRun returns when a job next runs after a time, zero when it does not.
+func (c Client) NextRun(job db.Job, after time.Time) time.Time {
+	schedule, err := c.JobSchedule(job)
+	if err != nil || !job.Enabled {
+		return time.Time{}
+	}
+	return schedule.Next(after)
+}
+
+func (c Client) CreateJob(job db.Job) (*db.Job, error) {
+	if err := c.validateJob(job); err != nil {
+		return nil, err
+	}
+	// Only the runs to come count, not those already past.
+	job.LastRun = time.Now()
+	return c.LightsDb.CreateJob(job)
+}
+
+func (c Client) ListJobs() ([]db.Job, error) {
+	return c.LightsDb.FindJobs()
+}
+
+// FindJob finds a job by id or name.
+func (c Client) FindJob(job string) (*db.Job, error) {
+	jobs, err := c.LightsDb.FindJobs()
+	if err != nil {
+		return nil, err
+	}
+	if i := slices.IndexFunc(jobs, func(j db.Job) bool { return j.Id == job }); i >= 0 {
+		return &jobs[i], nil
+	}
+	if i := slices.IndexFunc(jobs, func(j db.Job) bool { return j.Name == job }); i >= 0 {
+		return &jobs[i], nil
+	}
+	return nil, fmt.Errorf("job %s %w", job, db.ErrNotFound)
+}
+
+func (c Client) DeleteJob(job string) error {
+	found, err := c.FindJob(job)
+	if err != nil {
+		return err
+	}
+	return c.LightsDb.DeleteJob(found.Id)
+}
+
+// SetJobEnabled turns a job on or off. A job turned back on does not catch
+// up on the runs it missed while off.
+func (c Client) SetJobEnabled(job string, enabled bool) (*db.Job, error) {
+	found, err := c.FindJob(job)
+	if err != nil {
+		return nil, err
+	}
+	if enabled && !found.Enabled {
+		if err := c.LightsDb.MarkJobRun(found.Id, time.Now(), ""); err != nil {
+			return nil, err
+		}
+	}
+	found.Enabled = enabled
+	return c.LightsDb.UpdateJob(*found)
+}
+
+func (c Client) validateJob(job db.Job) error {
+	if _, err := c.JobSchedule(job); err != nil {
+		return err
+	}
+	switch {
+	case !slices.Contains(JobCommands, job.Command):
+		return fmt.Errorf("unknown command %q, expected one of %v", job.Command, JobCommands)
+	case job.Command == CommandSnapshot && job.Argument == "":
+		return errors.New("the snapshot to apply is missing")
+	case job.Command != CommandSnapshot && SelectorOf(job.Lights).IsEmpty():
+		return errors.New("no lights selected")
+	case job.Transition < 0:
+		return errors.New("the transition must not be negative")
+	}
+	if slices.Contains(pilotJobCommands, job.Command) {
+		_, err := jobPilot(job)
+		return err
+	}
+	return nil
+}
+
+var pilotJobCommands = []string{JobDimming, JobTemperature, JobColor, JobScene}
+
+// jobPilot returns the state a job sets the lights to from its argument.
+func jobPilot(job db.Job) (wiz.Pilot, error) {
+	pilot := wiz.Pilot{IsOn: true}
+	switch job.Command {
+	case JobDimming:
+		dimming, err := strconv.Atoi(job.Argument)
+		if err != nil || dimming < wiz.MinDimming || dimming > 100 {
+			return pilot, fmt.Errorf("the dimming must be from %d to 100, not %q", wiz.MinDimming, job.Argument)
+		}
+		pilot.Dimming = dimming
+	case JobTemperature:
+		kelvin, err := strconv.Atoi(strings.TrimSuffix(job.Argument, "K"))
+		if err != nil || kelvin < wiz.MinTemperatureK || kelvin > wiz.MaxTemperatureK {
+			return pilot, fmt.Errorf("the temperature must be from %d to %d kelvins, not %q", wiz.MinTemperatureK, wiz.MaxTemperatureK, job.Argument)
+		}
+		pilot.Temp = kelvin
+	case JobColor:
+		parts := strings.Split(job.Argument, ",")
+		rgb := make([]int, len(parts))
+		for i, part := range parts {
+			var err error
+			if rgb[i], err = strconv.Atoi(strings.TrimSpace(part)); err != nil || rgb[i] < 0 || rgb[i] > 255 {
+				rgb = nil
+				break
+			}
+		}
+		if len(rgb) != 3 {
+			return pilot, fmt.Errorf("the color must be R,G,B from 0 to 255, not %q", job.Argument)
+		}
+		pilot.Color = &wiz.Rgb{R: rgb[0], G: rgb[1], B: rgb[2]}
+	case JobScene:
+		scene, err := wiz.ParseScene(job.Argument)
+		if err != nil {
+			return pilot, err
+		}
+		pilot.Scene = scene
+	default:
+		return pilot, fmt.Errorf("unknown command %q", job.Command)
+	}
+	return pilot, nil
+}
+
+// RunJob runs a job now, whether enabled or not, and records the run.
+func (c Client) RunJob(job string) ([]wiz.Light, error) {
+	found, err := c.FindJob(job)
+	if err != nil {
+		return nil, err
+	}
+	lights, err := c.run(*found)
+	if err := c.LightsDb.MarkJobRun(found.Id, time.Now(), errorText(err)); err != nil {
+		return nil, err
+	}
+	return lights, err
+}
+
+// dueRun tells whether a job is to run now: it was scheduled since it last
+// ran. A run found later than jobGrace was missed, as when no scheduler was
+// running, and only runs if the job catches up.
+func (c Client) dueRun(job db.Job, now time.Time) (run bool, missed time.Time) {
+	next := c.NextRun(job, job.LastRun)
+	if next.IsZero() || next.After(now) {
+		return false, time.Time{}
+	}
+	if now.Sub(next) > jobGrace {
+		return job.CatchUp, next
+	}
+	return true, time.Time{}
+}
+
+// RunJobs runs the enabled jobs when they are due, until stop is closed,
+// calling report with the lights each run changed. It reads the jobs again
+// every minute, so it picks up the changes made meanwhile, and should run in
+// a long-lived process. Closing stop ends the transitions under way.
+func (c Client) RunJobs(stop <-chan struct{}, report func(db.Job, []wiz.Light, error)) error {
+	c.stop = stop
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		jobs, err := c.LightsDb.FindJobs()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		next := now.Add(alarmPoll)
+		for _, j := range jobs {
+			if !j.Enabled {
+				continue
+			}
+			run, missed := c.dueRun(j, now)
+			if run || !missed.IsZero() {
+				lastError := ""
+				if !run {
+					lastError = fmt.Sprintf("missed the run of %s", missed.Format(time.DateTime))
+				}
+				if err := c.LightsDb.MarkJobRun(j.Id, now, lastError); err != nil {
+					return err
+				}
+			}
+			if run {
+				wg.Go(func() {
+					lights, err := c.run(j)
+					if markErr := c.LightsDb.MarkJobRun(j.Id, now, errorText(err)); markErr != nil {
+						err = errors.Join(err, markErr)
+					}
+					report(j, lights, err)
+				})
+			}
+			if at := c.NextRun(j, now); !at.IsZero() && at.Before(next) {
+				next = at
+			}
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
+
+// run runs the command of a job, with its transition, on the lights it
+// selects or the snapshot it names.
+func (c Client) run(job db.Job) ([]wiz.Light, error) {
+	c.Source = db.SourceAutomation
+	c.Transition = job.Transition
+
+	var command func(lightId string) (*wiz.Light, error)
+	switch job.Command {
+	case CommandSnapshot:
+		return c.ApplySnapshot(job.Argument)
+	case CommandOn:
+		command = c.TurnOn
+	case CommandOff:
+		command = c.TurnOff
+	case CommandDaylight:
+		command = c.MatchDaylight
+	case JobDimming, JobTemperature, JobColor, JobScene:
+		pilot, err := jobPilot(job)
+		if err != nil {
+			return nil, err
+		}
+		command = func(lightId string) (*wiz.Light, error) { return c.SetPilot(lightId, pilot) }
+	default:
+		return nil, fmt.Errorf("unknown command %q", job.Command)
+	}
+
+	lights, err := c.Select(SelectorOf(job.Lights))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*wiz.Light, len(lights))
+	errs := make([]error, len(lights))
+	var wg sync.WaitGroup
+	for i, l := range lights {
+		wg.Go(func() { results[i], errs[i] = command(l.Id) })
+	}
+	wg.Wait()
+
+	var result []wiz.Light
+	for _, l := range results {
+		if l != nil {
+			result = append(result, *l)
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"fmt"
+	"gowizcli/wiz"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BackupReasonDelete = "delete"
+	BackupReasonPrune  = "prune"
+)
+
+// Delete removes a light, after backing the inventory up. A deleted light that
+// is discovered again comes back without its name, tags, room or groups.
+func (c Client) Delete(lightId string) (err error) {
+	start := time.Now()
+	defer func() { c.record(start, CommandDelete, lightId, nil, nil, err) }()
+
+	if _, err := c.LightsDb.FindById(lightId); err != nil {
+		return err
+	}
+	if _, err := c.LightsDb.CreateBackup(BackupReasonDelete); err != nil {
+		return fmt.Errorf("backing up before deleting: %w", err)
+	}
+	return c.LightsDb.Delete(lightId)
+}
+
+// FindStale returns the lights not seen, by discovery or by answering a
+// command, for longer than unseenFor.
+func (c Client) FindStale(unseenFor time.Duration) ([]wiz.Light, error) {
+	return c.LightsDb.FindUnseenSince(time.Now().Add(-unseenFor))
+}
+
+// Prune deletes the stale lights, after backing the inventory up, and returns
+// them.
+func (c Client) Prune(unseenFor time.Duration) ([]wiz.Light, error) {
+	stale, err := c.FindStale(unseenFor)
+	if err != nil || len(stale) == 0 {
+		return stale, err
+	}
+
+	if _, err := c.LightsDb.CreateBackup(BackupReasonPrune); err != nil {
+		return nil, fmt.Errorf("backing up before pruning: %w", err)
+	}
+	params := map[string]string{"olderThan": unseenFor.String()}
+	for i, l := range stale {
+		start := time.Now()
+		err := c.LightsDb.Delete(l.Id)
+		c.record(start, CommandPrune, l.Id, params, nil, err)
+		if err != nil {
+			return stale[:i], err
+		}
+	}
+	return stale, nil
+}
+
+// IsStale tells whether a light was last seen longer than staleAfter ago. A
+// zero staleAfter disables it.
+func IsStale(light wiz.Light, staleAfter time.Duration, now time.Time) bool {
+	return staleAfter > 0 && !light.LastSeen.IsZero() && now.Sub(light.LastSeen) > staleAfter
+}
+
+// ParseAge reads a duration such as 30d or 2w, besides the units of
+// time.ParseDuration.
+func ParseAge(age string) (time.Duration, error) {
+	units := map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+	for suffix, unit := range units {
+		if count, ok := strings.CutSuffix(age, suffix); ok {
+			n, err := strconv.ParseFloat(count, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid age %q", age)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+
+	d, err := time.ParseDuration(age)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age %q", age)
+	}
+	return d, nil
+}
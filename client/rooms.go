@@ -0,0 +1,286 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"slices"
+	"strings"
+)
+
+// Selector picks the lights a command applies to. Rooms and groups are given
+// by id or name and Tags is a tag query, as parsed by db.ParseTagQuery. A light
+// must match every criterion that is set.
+type Selector struct {
+	All   bool
+	Ids   []string
+	Room  string
+	Group string
+	Tags  string
+}
+
+func (s Selector) IsEmpty() bool {
+	return !s.All && len(s.Ids) == 0 && s.Room == "" && s.Group == "" && s.Tags == ""
+}
+
+// String writes the selector as the command line takes it.
+func (s Selector) String() string {
+	var parts []string
+	if s.All {
+		parts = append(parts, "-all")
+	}
+	if len(s.Ids) > 0 {
+		parts = append(parts, "-id "+strings.Join(s.Ids, ","))
+	}
+	if s.Room != "" {
+		parts = append(parts, "-room "+s.Room)
+	}
+	if s.Group != "" {
+		parts = append(parts, "-group "+s.Group)
+	}
+	if s.Tags != "" {
+		parts = append(parts, "-tag '"+s.Tags+"'")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (c Client) Select(selector Selector) ([]wiz.Light, error) {
+	if selector.IsEmpty() {
+		return nil, errors.New("no lights selected")
+	}
+
+	var tags db.TagQuery
+	if selector.Tags != "" {
+		query, err := db.ParseTagQuery(selector.Tags)
+		if err != nil {
+			return nil, err
+		}
+		tags = query
+	}
+
+	var roomId, groupId string
+	if selector.Room != "" {
+		room, err := c.FindRoom(selector.Room)
+		if err != nil {
+			return nil, err
+		}
+		roomId = room.Id
+	}
+	if selector.Group != "" {
+		group, err := c.FindGroup(selector.Group)
+		if err != nil {
+			return nil, err
+		}
+		groupId = group.Id
+	}
+
+	var candidates []wiz.Light
+	var err error
+	switch {
+	case len(selector.Ids) > 0:
+		for _, id := range selector.Ids {
+			light, err := c.LightsDb.FindById(id)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, *light)
+		}
+	case roomId != "":
+		candidates, err = c.LightsDb.FindByRoom(roomId)
+	case groupId != "":
+		candidates, err = c.LightsDb.FindByGroup(groupId)
+	case selector.Tags != "":
+		candidates, err = c.LightsDb.FindByTagQuery(tags)
+	default:
+		candidates, err = c.LightsDb.FindAll()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]wiz.Light, 0, len(candidates))
+	for _, l := range candidates {
+		if roomId != "" && l.Room != roomId {
+			continue
+		}
+		if groupId != "" && !slices.Contains(l.Groups, groupId) {
+			continue
+		}
+		if !tags.Matches(l.Tags) {
+			continue
+		}
+		result = append(result, l)
+	}
+	return result, nil
+}
+
+func (c Client) CreateRoom(room db.Room) (*db.Room, error) {
+	return c.LightsDb.CreateRoom(room)
+}
+
+func (c Client) ListRooms() ([]db.Room, error) {
+	return c.LightsDb.FindRooms()
+}
+
+func (c Client) UpdateRoom(room db.Room) (*db.Room, error) {
+	return c.LightsDb.UpdateRoom(room)
+}
+
+func (c Client) DeleteRoom(room string) error {
+	found, err := c.FindRoom(room)
+	if err != nil {
+		return err
+	}
+	return c.LightsDb.DeleteRoom(found.Id)
+}
+
+// FindRoom looks a room up by id, then by name.
+func (c Client) FindRoom(room string) (*db.Room, error) {
+	rooms, err := c.LightsDb.FindRooms()
+	if err != nil {
+		return nil, err
+	}
+	if i := slices.IndexFunc(rooms, func(r db.Room) bool { return r.Id == room }); i >= 0 {
+		return &rooms[i], nil
+	}
+	if i := slices.IndexFunc(rooms, func(r db.Room) bool { return r.Name == room }); i >= 0 {
+		return &rooms[i], nil
+	}
+	return nil, fmt.Errorf("room %s %w", room, db.ErrNotFound)
+}
+
+// AssignRoom moves the selected lights to a room, or out of any room when
+// room is empty.
+func (c Client) AssignRoom(selector Selector, room string) ([]wiz.Light, error) {
+	roomId := ""
+	if room != "" {
+		found, err := c.FindRoom(room)
+		if err != nil {
+			return nil, err
+		}
+		roomId = found.Id
+	}
+
+	return c.updateSelected(selector, func(ids []string) error {
+		return c.LightsDb.SetRoom(ids, roomId)
+	})
+}
+
+func (c Client) CreateGroup(group db.Group) (*db.Group, error) {
+	return c.LightsDb.CreateGroup(group)
+}
+
+func (c Client) ListGroups() ([]db.Group, error) {
+	return c.LightsDb.FindGroups()
+}
+
+func (c Client) UpdateGroup(group db.Group) (*db.Group, error) {
+	return c.LightsDb.UpdateGroup(group)
+}
+
+func (c Client) DeleteGroup(group string) error {
+	found, err := c.FindGroup(group)
+	if err != nil {
+		return err
+	}
+	return c.LightsDb.DeleteGroup(found.Id)
+}
+
+// FindGroup looks a group up by id, then by name.
+func (c Client) FindGroup(group string) (*db.Group, error) {
+	groups, err := c.LightsDb.FindGroups()
+	if err != nil {
+		return nil, err
+	}
+	if i := slices.IndexFunc(groups, func(g db.Group) bool { return g.Id == group }); i >= 0 {
+		return &groups[i], nil
+	}
+	if i := slices.IndexFunc(groups, func(g db.Group) bool { return g.Name == group }); i >= 0 {
+		return &groups[i], nil
+	}
+	return nil, fmt.Errorf("group %s %w", group, db.ErrNotFound)
+}
+
+func (c Client) AddToGroup(selector Selector, group string) ([]wiz.Light, error) {
+	found, err := c.FindGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	return c.updateSelected(selector, func(ids []string) error {
+		return c.LightsDb.AddToGroup(ids, found.Id)
+	})
+}
+
+func (c Client) RemoveFromGroup(selector Selector, group string) ([]wiz.Light, error) {
+	found, err := c.FindGroup(group)
+	if err != nil {
+		return nil, err
+	}
+	return c.updateSelected(selector, func(ids []string) error {
+		return c.LightsDb.RemoveFromGroup(ids, found.Id)
+	})
+}
+
+// AddTags tags the selected lights. Tags are single words, without the
+// characters that tag queries give a meaning to.
+func (c Client) AddTags(selector Selector, tags []string) ([]wiz.Light, error) {
+	if err := checkTags(tags); err != nil {
+		return nil, err
+	}
+	lights, err := c.Select(selector)
+	if err != nil {
+		return nil, err
+	}
+	return c.LightsDb.AddTags(lights, tags)
+}
+
+func (c Client) RemoveTags(selector Selector, tags []string) ([]wiz.Light, error) {
+	if err := checkTags(tags); err != nil {
+		return nil, err
+	}
+	lights, err := c.Select(selector)
+	if err != nil {
+		return nil, err
+	}
+	return c.LightsDb.RemoveTags(lights, tags)
+}
+
+func checkTags(tags []string) error {
+	if len(tags) == 0 {
+		return errors.New("no tags given")
+	}
+	for _, t := range tags {
+		if t == "" || strings.ContainsAny(t, " \t\n*&|,!()") {
+			return fmt.Errorf("invalid tag %q", t)
+		}
+	}
+	return nil
+}
+
+// updateSelected applies update to the ids of the selected lights and
+// returns them as stored afterwards.
+func (c Client) updateSelected(selector Selector, update func(ids []string) error) ([]wiz.Light, error) {
+	lights, err := c.Select(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(lights))
+	for i, l := range lights {
+		ids[i] = l.Id
+	}
+	if err := update(ids); err != nil {
+		return nil, err
+	}
+
+	result := make([]wiz.Light, len(ids))
+	for i, id := range ids {
+		light, err := c.LightsDb.FindById(id)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = *light
+	}
+	return result, nil
+}
@@ -0,0 +1,316 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/luminance"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when a job runs.
+type Schedule interface {
+	// Next returns the first run strictly after a time, zero when it finds
+	// none in the next years.
+	Next(after time.Time) time.Time
+}
+
+// ParseSchedule parses when a job runs, in the time zone loc. It takes:
+//   - a cron expression of five fields, minute hour day month weekday, as
+//     "0 7 * * 1-5";
+//   - every DAYS HH:MM, DAYS being day, weekday, weekend or days as mon,wed,
+//     as "every weekday 07:00";
+//   - a solar event of the location of the client, shifted by an offset, as
+//     "sunset", "30 min before sunset" or "at civil dusk +10m", optionally
+//     followed by "on DAYS".
+func (c Client) ParseSchedule(spec string, loc *time.Location) (Schedule, error) {
+	spec = strings.Join(strings.Fields(strings.ToLower(spec)), " ")
+	switch {
+	case spec == "":
+		return nil, errors.New("empty schedule")
+	case strings.HasPrefix(spec, "every "):
+		return parseEvery(strings.TrimPrefix(spec, "every "), loc)
+	case cronSpec.MatchString(spec):
+		return parseCron(spec, loc)
+	}
+	return parseSolar(spec, c.Location, loc)
+}
+
+// cronSchedule runs at the minutes matching every field, each a set of
+// allowed values. As in cron, a day matches either field when both the day of
+// the month and the weekday are restricted.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64
+	anyDay, anyWeekday                     bool
+	loc                                    *time.Location
+}
+
+var cronSpec = regexp.MustCompile(`^[0-9*,/-]+( [0-9*,/-]+){4}$`)
+
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day", 1, 31},
+	{"month", 1, 12},
+	{"weekday", 0, 7},
+}
+
+func parseCron(spec string, loc *time.Location) (Schedule, error) {
+	fields := strings.Fields(spec)
+	sets := make([]uint64, len(fields))
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("cron %s: %w", cronFields[i].name, err)
+		}
+		sets[i] = set
+	}
+	// Both 0 and 7 are Sunday.
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	return cronSchedule{
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+		loc:        loc,
+	}, nil
+}
+
+// parseCronField parses a comma separated list of *, values and ranges, each
+// with an optional /step.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			s, err := strconv.Atoi(stepPart)
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = s
+		}
+
+		from, to := min, max
+		if rangePart != "*" {
+			low, high, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = strconv.Atoi(low); err != nil {
+				return 0, fmt.Errorf("invalid value %q", low)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(high); err != nil {
+					return 0, fmt.Errorf("invalid value %q", high)
+				}
+			} else if hasStep {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("%q is out of %d-%d", rangePart, min, max)
+		}
+
+		for v := from; v <= to; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (s cronSchedule) Next(after time.Time) time.Time {
+	after = after.In(s.loc)
+	for day := range 5 * 366 {
+		date := time.Date(after.Year(), after.Month(), after.Day()+day, 0, 0, 0, 0, s.loc)
+		if !s.matchesDay(date) {
+			continue
+		}
+		for hour := range 24 {
+			if s.hours&(1<<hour) == 0 {
+				continue
+			}
+			for minute := range 60 {
+				if s.minutes&(1<<minute) == 0 {
+					continue
+				}
+				// A time skipped by a change to summer time runs right
+				// after the change.
+				run := time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, s.loc)
+				if run.After(after) {
+					return run
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+func (s cronSchedule) matchesDay(date time.Time) bool {
+	if s.months&(1<<int(date.Month())) == 0 {
+		return false
+	}
+	day := s.days&(1<<date.Day()) != 0
+	weekday := s.weekdays&(1<<int(date.Weekday())) != 0
+	switch {
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	}
+	return day || weekday
+}
+
+// parseEvery parses DAYS HH:MM into the cron schedule running then.
+func parseEvery(spec string, loc *time.Location) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("expected every DAYS HH:MM, got every %s", spec)
+	}
+	at, err := time.Parse("15:04", fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q, expected HH:MM", fields[1])
+	}
+	days, err := parseScheduleDays(fields[0])
+	if err != nil {
+		return nil, err
+	}
+
+	weekdays := "*"
+	if len(days) > 0 {
+		numbers := make([]string, len(days))
+		for i, d := range days {
+			numbers[i] = strconv.Itoa(int(d))
+		}
+		weekdays = strings.Join(numbers, ",")
+	}
+	return parseCron(fmt.Sprintf("%d %d * * %s", at.Minute(), at.Hour(), weekdays), loc)
+}
+
+// parseScheduleDays takes the days of ParseDays, in the singular as well.
+func parseScheduleDays(days string) ([]time.Weekday, error) {
+	switch days {
+	case "day":
+		days = "daily"
+	case "weekday":
+		days = "weekdays"
+	case "weekend":
+		days = "weekends"
+	}
+	return ParseDays(days)
+}
+
+// solarSchedule runs offset from a solar event, on the days given or every
+// day. Days without the event, near the poles, are skipped.
+type solarSchedule struct {
+	event    luminance.SolarEvent
+	offset   time.Duration
+	days     []time.Weekday
+	location Location
+	loc      *time.Location
+}
+
+var solarAliases = map[string]luminance.SolarEvent{
+	"dawn":       luminance.CivilDawn,
+	"dusk":       luminance.CivilDusk,
+	"solar noon": luminance.SolarNoon,
+}
+
+var (
+	relativeOffset = regexp.MustCompile(`^(.+?) (before|after) (.+)$`)
+	signedOffset   = regexp.MustCompile(`^(.+?) ?([+-]) ?([0-9].*)$`)
+	offsetWords    = regexp.MustCompile(`^([0-9]+) ?(s|sec|secs|seconds?|m|min|mins|minutes?|h|hr|hrs|hours?)$`)
+)
+
+func parseSolar(spec string, location Location, loc *time.Location) (Schedule, error) {
+	schedule := solarSchedule{location: location, loc: loc}
+
+	spec = strings.TrimPrefix(spec, "at ")
+	if rest, days, ok := strings.Cut(spec, " on "); ok {
+		weekdays, err := parseScheduleDays(days)
+		if err != nil {
+			return nil, err
+		}
+		spec, schedule.days = rest, weekdays
+	}
+
+	event := spec
+	if m := relativeOffset.FindStringSubmatch(spec); m != nil {
+		offset, err := parseOffset(m[1])
+		if err != nil {
+			return nil, err
+		}
+		if m[2] == "before" {
+			offset = -offset
+		}
+		event, schedule.offset = m[3], offset
+	} else if m := signedOffset.FindStringSubmatch(spec); m != nil {
+		offset, err := parseOffset(m[3])
+		if err != nil {
+			return nil, err
+		}
+		if m[2] == "-" {
+			offset = -offset
+		}
+		event, schedule.offset = m[1], offset
+	}
+
+	if alias, ok := solarAliases[event]; ok {
+		event = string(alias)
+	}
+	if !slices.Contains(luminance.SolarEvents, luminance.SolarEvent(event)) {
+		return nil, fmt.Errorf("unknown schedule %q", spec)
+	}
+	schedule.event = luminance.SolarEvent(event)
+	return schedule, nil
+}
+
+// parseOffset parses a duration as Go writes it, 1h30m, or in words, 30 min.
+func parseOffset(offset string) (time.Duration, error) {
+	if d, err := time.ParseDuration(offset); err == nil {
+		return d, nil
+	}
+	m := offsetWords.FindStringSubmatch(offset)
+	if m == nil {
+		return 0, fmt.Errorf("invalid offset %q", offset)
+	}
+	n, _ := strconv.Atoi(m[1])
+	unit := time.Minute
+	switch m[2][0] {
+	case 's':
+		unit = time.Second
+	case 'h':
+		unit = time.Hour
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func (s solarSchedule) Next(after time.Time) time.Time {
+	after = after.In(s.loc)
+	// The offset may move a run to the day before or after its event.
+	for day := -1; day < 2*366; day++ {
+		date := time.Date(after.Year(), after.Month(), after.Day()+day, 12, 0, 0, 0, s.loc)
+		if len(s.days) > 0 && !slices.Contains(s.days, date.Weekday()) {
+			continue
+		}
+		event, ok := luminance.SolarEventTime(s.location.Latitude, s.location.Longitude, date, s.event)
+		if !ok {
+			continue
+		}
+		if run := event.Add(s.offset); run.After(after) {
+			return run
+		}
+	}
+	return time.Time{}
+}
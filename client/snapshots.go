@@ -0,0 +1,194 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"sync"
+	"time"
+)
+
+// SnapshotChange is a light whose state differs between two snapshots. Before
+// or After is nil when the light is missing from that side.
+type SnapshotChange struct {
+	LightId string
+	Before  *wiz.Pilot
+	After   *wiz.Pilot
+}
+
+// SaveSnapshot reads the state of the selected lights, every light when the
+// selector is empty, and saves it under name, replacing any snapshot of that
+// name. Lights that do not answer are left out and reported in the error.
+func (c Client) SaveSnapshot(name string, selector Selector) (*db.Snapshot, error) {
+	if selector.IsEmpty() {
+		selector.All = true
+	}
+	lights, err := c.Select(selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(lights) == 0 {
+		return nil, errors.New("no light matches the selector")
+	}
+
+	states, err := c.readPilots(lights)
+	if len(states) == 0 {
+		return nil, err
+	}
+	snapshot, saveErr := c.LightsDb.SaveSnapshot(db.Snapshot{Name: name, Lights: states})
+	if saveErr != nil {
+		return nil, saveErr
+	}
+	return snapshot, err
+}
+
+// ApplySnapshot sets every light of a snapshot back to its saved state, all
+// lights at once, fading them with the transition of the client. It returns
+// the lights it succeeded on, in the order of the snapshot, along with the
+// errors of the others.
+func (c Client) ApplySnapshot(name string) ([]wiz.Light, error) {
+	snapshot, err := c.LightsDb.FindSnapshot(name)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*wiz.Light, len(snapshot.Lights))
+	errs := make([]error, len(snapshot.Lights))
+	var wg sync.WaitGroup
+	for i, s := range snapshot.Lights {
+		wg.Go(func() { results[i], errs[i] = c.applyPilot(name, s) })
+	}
+	wg.Wait()
+
+	var lights []wiz.Light
+	for _, l := range results {
+		if l != nil {
+			lights = append(lights, *l)
+		}
+	}
+	return lights, errors.Join(errs...)
+}
+
+func (c Client) applyPilot(name string, state db.SnapshotLight) (result *wiz.Light, err error) {
+	start := time.Now()
+	defer func() {
+		c.record(start, CommandSnapshot, state.LightId, map[string]string{"snapshot": name, "state": state.Pilot.String()}, result, err)
+	}()
+
+	light, err := c.LightsDb.FindById(state.LightId)
+	if err != nil {
+		return nil, err
+	}
+
+	newLight, err := c.apply(light, func(light *wiz.Light) (*wiz.Light, error) {
+		return c.WizClient.SetPilot(light, state.Pilot)
+	}, func(wiz.Pilot) wiz.Pilot {
+		return state.Pilot
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s (%s): %w", light.Id, light.IpAddress, err)
+	}
+
+	light.LastSeen = c.seen(light.Id)
+	result = withInventory(newLight, light)
+	c.measure(result)
+	return result, nil
+}
+
+func (c Client) ListSnapshots() ([]db.Snapshot, error) {
+	return c.LightsDb.FindSnapshots()
+}
+
+func (c Client) DeleteSnapshot(name string) error {
+	return c.LightsDb.DeleteSnapshot(name)
+}
+
+// DiffSnapshots returns the lights whose state differs between two
+// snapshots. When to is empty, from is compared with the live state of its
+// lights instead.
+func (c Client) DiffSnapshots(from, to string) ([]SnapshotChange, error) {
+	before, err := c.LightsDb.FindSnapshot(from)
+	if err != nil {
+		return nil, err
+	}
+
+	var after []db.SnapshotLight
+	var liveErr error
+	if to != "" {
+		snapshot, err := c.LightsDb.FindSnapshot(to)
+		if err != nil {
+			return nil, err
+		}
+		after = snapshot.Lights
+	} else {
+		var lights []wiz.Light
+		for _, s := range before.Lights {
+			light, err := c.LightsDb.FindById(s.LightId)
+			if err != nil {
+				continue
+			}
+			lights = append(lights, *light)
+		}
+		after, liveErr = c.readPilots(lights)
+	}
+
+	return diffPilots(before.Lights, after), liveErr
+}
+
+func diffPilots(before, after []db.SnapshotLight) []SnapshotChange {
+	afterById := make(map[string]wiz.Pilot, len(after))
+	for _, s := range after {
+		afterById[s.LightId] = s.Pilot
+	}
+
+	var changes []SnapshotChange
+	seen := make(map[string]bool, len(before))
+	for _, s := range before {
+		seen[s.LightId] = true
+		was := s.Pilot
+		is, ok := afterById[s.LightId]
+		switch {
+		case !ok:
+			changes = append(changes, SnapshotChange{LightId: s.LightId, Before: &was})
+		case !was.Equal(is):
+			changes = append(changes, SnapshotChange{LightId: s.LightId, Before: &was, After: &is})
+		}
+	}
+	for _, s := range after {
+		if !seen[s.LightId] {
+			is := s.Pilot
+			changes = append(changes, SnapshotChange{LightId: s.LightId, After: &is})
+		}
+	}
+	return changes
+}
+
+// readPilots asks every light for its state at once. It returns the states of
+// the lights that answered, in the order given, along with the errors of the
+// others.
+func (c Client) readPilots(lights []wiz.Light) ([]db.SnapshotLight, error) {
+	pilots := make([]*wiz.Pilot, len(lights))
+	errs := make([]error, len(lights))
+	var wg sync.WaitGroup
+	for i := range lights {
+		wg.Go(func() {
+			pilot, err := c.WizClient.GetPilot(&lights[i])
+			if err != nil {
+				errs[i] = fmt.Errorf("%s (%s): %w", lights[i].Id, lights[i].IpAddress, err)
+				return
+			}
+			c.seen(lights[i].Id)
+			pilots[i] = pilot
+		})
+	}
+	wg.Wait()
+
+	var states []db.SnapshotLight
+	for i, pilot := range pilots {
+		if pilot != nil {
+			states = append(states, db.SnapshotLight{LightId: lights[i].Id, Pilot: *pilot})
+		}
+	}
+	return states, errors.Join(errs...)
+}
@@ -0,0 +1,248 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/wiz"
+	"math"
+	"sync"
+	"time"
+)
+
+// TransitionConfig tells how lights fade. Rate is how many steps a second are
+// sent to a light at most, Easing the curve they follow and Default the
+// transition of the commands that do not give one.
+type TransitionConfig struct {
+	Rate    float64 `yaml:"rate"`
+	Easing  string  `yaml:"easing"`
+	Default string  `yaml:"default"`
+}
+
+const (
+	defaultTransitionRate = 10
+	maxTransitionRate     = 50
+)
+
+// ErrTransitionCancelled is returned by a transition cut short by another
+// command on the same light.
+var ErrTransitionCancelled = errors.New("transition cancelled by a newer command")
+
+// ErrTransitionStopped is returned by a transition cut short as the alarms or
+// jobs that run it stop.
+var ErrTransitionStopped = errors.New("transition stopped")
+
+// Easing maps the elapsed part of a transition, from 0 to 1, to the part of
+// the change made by then.
+type Easing func(t float64) float64
+
+var easings = map[string]Easing{
+	"linear":      func(t float64) float64 { return t },
+	"ease-in":     func(t float64) float64 { return t * t },
+	"ease-out":    func(t float64) float64 { return t * (2 - t) },
+	"ease-in-out": func(t float64) float64 { return t * t * (3 - 2*t) },
+}
+
+// ParseEasing returns the easing of the given name, ease-in-out when empty.
+func ParseEasing(name string) (Easing, error) {
+	if name == "" {
+		name = "ease-in-out"
+	}
+	easing, ok := easings[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown easing %q", name)
+	}
+	return easing, nil
+}
+
+// Transitions runs the transitions of the lights, one at a time per light:
+// starting a transition, or any other command, on a light cancels the one
+// running on it.
+type Transitions struct {
+	interval time.Duration
+	easing   Easing
+
+	mu      sync.Mutex
+	running map[string]chan struct{}
+}
+
+func NewTransitions(config TransitionConfig) (*Transitions, error) {
+	rate := config.Rate
+	if rate == 0 {
+		rate = defaultTransitionRate
+	}
+	if rate < 0 || rate > maxTransitionRate {
+		return nil, fmt.Errorf("transition rate must be between 0 and %d steps a second", maxTransitionRate)
+	}
+	easing, err := ParseEasing(config.Easing)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transitions{
+		interval: time.Duration(float64(time.Second) / rate),
+		easing:   easing,
+		running:  make(map[string]chan struct{}),
+	}, nil
+}
+
+// Cancel stops the transition running on a light, if any.
+func (t *Transitions) Cancel(lightId string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if cancelled, ok := t.running[lightId]; ok {
+		close(cancelled)
+		delete(t.running, lightId)
+	}
+}
+
+// run fades a light from one state to another over duration, handing each
+// step to send, the last one being exactly to. There are no more steps than
+// units of change, so that slow fades send few. Closing stop leaves the
+// light where it is.
+func (t *Transitions) run(lightId string, from, to wiz.Pilot, duration time.Duration, stop <-chan struct{}, send func(wiz.Pilot) error) error {
+	cancelled := t.start(lightId)
+	defer t.finish(lightId, cancelled)
+
+	steps := min(int(duration/t.interval), largestChange(from, to))
+	if steps == 0 {
+		return send(to)
+	}
+	interval := duration / time.Duration(steps)
+	begin := time.Now()
+	for i := 1; i <= steps; i++ {
+		select {
+		case <-cancelled:
+			return ErrTransitionCancelled
+		case <-stop:
+			return ErrTransitionStopped
+		case <-time.After(time.Until(begin.Add(time.Duration(i) * interval))):
+		}
+
+		step := to
+		if i < steps {
+			step = interpolate(from, to, t.easing(float64(i)/float64(steps)))
+		}
+		if err := send(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Transitions) start(lightId string) chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if previous, ok := t.running[lightId]; ok {
+		close(previous)
+	}
+	cancelled := make(chan struct{})
+	t.running[lightId] = cancelled
+	return cancelled
+}
+
+func (t *Transitions) finish(lightId string, cancelled chan struct{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.running[lightId] == cancelled {
+		delete(t.running, lightId)
+	}
+}
+
+// interpolate returns the state part p of the way from one state to another.
+// A light off is taken as at the lowest dimming, so that lights fade in and
+// out. Scenes, and changes between white and color, cannot be blended: the
+// light takes those of the target at once, or keeps its own while fading out.
+func interpolate(from, to wiz.Pilot, p float64) wiz.Pilot {
+	step := to
+	if !to.IsOn {
+		step = from
+	}
+	step.IsOn = true
+	step.Dimming = lerp(fadeDimming(from), fadeDimming(to), p)
+
+	switch {
+	case !from.IsOn || !to.IsOn:
+	case from.Temp != 0 && to.Temp != 0:
+		step.Temp = lerp(from.Temp, to.Temp, p)
+	case from.Color != nil && to.Color != nil:
+		step.Color = &wiz.Rgb{
+			R: lerp(from.Color.R, to.Color.R, p),
+			G: lerp(from.Color.G, to.Color.G, p),
+			B: lerp(from.Color.B, to.Color.B, p),
+		}
+	}
+	return step
+}
+
+// largestChange is the largest change of the dimming, temperature or color
+// channels interpolate blends from one state to another.
+func largestChange(from, to wiz.Pilot) int {
+	change := abs(fadeDimming(to) - fadeDimming(from))
+	switch {
+	case !from.IsOn || !to.IsOn:
+	case from.Temp != 0 && to.Temp != 0:
+		change = max(change, abs(to.Temp-from.Temp))
+	case from.Color != nil && to.Color != nil:
+		change = max(change, abs(to.Color.R-from.Color.R), abs(to.Color.G-from.Color.G), abs(to.Color.B-from.Color.B))
+	}
+	return change
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func fadeDimming(pilot wiz.Pilot) int {
+	switch {
+	case !pilot.IsOn:
+		return wiz.MinDimming
+	case pilot.Dimming == 0:
+		return 100
+	}
+	return pilot.Dimming
+}
+
+func lerp(from, to int, p float64) int {
+	return from + int(math.Round(float64(to-from)*p))
+}
+
+// WithTransition returns the client with its commands fading the lights over
+// d, or setting them at once when d is 0.
+func (c Client) WithTransition(d time.Duration) Functions {
+	c.Transition = d
+	return c
+}
+
+// apply runs a command on a light, cancelling the transition running on it.
+// With a transition set, the light is instead faded to the state target makes
+// of its current one.
+func (c Client) apply(light *wiz.Light, command func(*wiz.Light) (*wiz.Light, error), target func(from wiz.Pilot) wiz.Pilot) (*wiz.Light, error) {
+	if c.Transition <= 0 {
+		c.Transitions.Cancel(light.Id)
+		return command(light)
+	}
+	if c.Transitions == nil {
+		return nil, errors.New("transitions are not configured")
+	}
+
+	from, err := c.WizClient.GetPilot(light)
+	if err != nil {
+		return nil, err
+	}
+	err = c.Transitions.run(light.Id, *from, target(*from), c.Transition, c.stop, func(step wiz.Pilot) error {
+		return c.WizClient.SendPilot(light, step)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c.WizClient.Status(light)
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"fmt"
+	"gowizcli/api"
 	"gowizcli/client"
+	"gowizcli/daemon"
+	"gowizcli/db"
 	"gowizcli/luminance"
+	"gowizcli/rules"
 	"gowizcli/wiz"
 	"os"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 	"gopkg.in/yaml.v3"
@@ -12,13 +18,39 @@ import (
 
 type Config struct {
 	Luminance struct {
-		IpGeolocation luminance.IpGeolocationConfig `yaml:"ipGeolocation"`
-		OpenMeteo     luminance.OpenMeteoConfig     `yaml:"openMeteo"`
+		IpGeolocation    luminance.IpGeolocationConfig    `yaml:"ipGeolocation"`
+		Meteorology      string                           `yaml:"meteorology"`
+		OpenMeteo        luminance.OpenMeteoConfig        `yaml:"openMeteo"`
+		MetNorway        luminance.MetNorwayConfig        `yaml:"metNorway"`
+		OpenWeatherMap   luminance.OpenWeatherMapConfig   `yaml:"openWeatherMap"`
+		OpenMeteoArchive luminance.OpenMeteoArchiveConfig `yaml:"openMeteoArchive"`
+		Turbidity        luminance.LinkeTurbidityConfig   `yaml:"linkeTurbidity"`
+		Cache            struct {
+			Astronomy   luminance.CacheConfig `yaml:"astronomy"`
+			Meteorology luminance.CacheConfig `yaml:"meteorology"`
+		} `yaml:"cache"`
+		Fallback    luminance.FallbackConfig `yaml:"fallback"`
+		Calibration struct {
+			File string `yaml:"file"`
+		} `yaml:"calibration"`
 	} `yaml:"luminance"`
-	Location client.Location   `yaml:"location"`
-	Network  wiz.NetworkConfig `yaml:"network"`
-	Database struct {
-		File string `yaml:"file"`
+	Location  client.Location     `yaml:"location"`
+	Energy    client.EnergyConfig `yaml:"energy"`
+	Inventory struct {
+		StaleAfter string `yaml:"staleAfter"`
+	} `yaml:"inventory"`
+	Events struct {
+		Retention string `yaml:"retention"`
+	} `yaml:"events"`
+	Transitions client.TransitionConfig `yaml:"transitions"`
+	Rules       rules.Config            `yaml:"rules"`
+	Daemon      daemon.Config           `yaml:"daemon"`
+	Api         api.Config              `yaml:"api"`
+	Network     wiz.NetworkConfig       `yaml:"network"`
+	Database    struct {
+		Driver string `yaml:"driver"`
+		File   string `yaml:"file"`
+		Dsn    string `yaml:"dsn" envconfig:"DATABASE_DSN"`
 	} `yaml:"database"`
 }
 
@@ -44,3 +76,58 @@ func readConfigEnvironment(config *Config) error {
 	}
 	return nil
 }
+
+func meteorologyProvider(config *Config) (luminance.Meteorology, error) {
+	switch config.Luminance.Meteorology {
+	case "", luminance.ProviderOpenMeteo:
+		return luminance.OpenMeteo{Config: config.Luminance.OpenMeteo}, nil
+	case luminance.ProviderMetNorway:
+		return luminance.MetNorway{Config: config.Luminance.MetNorway}, nil
+	case luminance.ProviderOpenWeatherMap:
+		return luminance.OpenWeatherMap{Config: config.Luminance.OpenWeatherMap}, nil
+	default:
+		return nil, fmt.Errorf("unknown meteorology provider %q", config.Luminance.Meteorology)
+	}
+}
+
+func storage(config *Config) (db.Storage, error) {
+	switch config.Database.Driver {
+	case "", db.DriverSQLite:
+		sqlite, err := db.NewSQLiteDB(config.Database.File)
+		if err != nil {
+			return nil, err
+		}
+		return sqlite, nil
+	case db.DriverMySQL:
+		mysql, err := db.NewMySQLDB(config.Database.Dsn)
+		if err != nil {
+			return nil, err
+		}
+		return mysql, nil
+	case db.DriverMemory:
+		return db.NewMemoryDB(), nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", config.Database.Driver)
+	}
+}
+
+func staleAfter(config *Config) (time.Duration, error) {
+	if config.Inventory.StaleAfter == "" {
+		return 0, nil
+	}
+	return client.ParseAge(config.Inventory.StaleAfter)
+}
+
+func eventRetention(config *Config) (time.Duration, error) {
+	if config.Events.Retention == "" {
+		return 0, nil
+	}
+	return client.ParseAge(config.Events.Retention)
+}
+
+func defaultTransition(config *Config) (time.Duration, error) {
+	if config.Transitions.Default == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(config.Transitions.Default)
+}
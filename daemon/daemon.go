@@ -0,0 +1,368 @@
+// Package daemon runs the automations of gowizcli headlessly: the alarms,
+// the jobs, the rules, the polling of the lights and listening to what they
+// push, and the REST API. The CLI and the TUI attach to it through a unix
+// socket to run their commands, so that the daemon alone talks to the lights.
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/api"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/rules"
+	"gowizcli/wiz"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// defaultPoll is how often the daemon asks the lights for their status when
+// Poll is not set.
+const defaultPoll = time.Minute
+
+// pruneEvery is how often the daemon removes the events past their
+// retention.
+const pruneEvery = time.Hour
+
+// stopTimeout is how long the daemon waits for the work under way once
+// stopped, short of the 30s systemd gives it before killing it.
+var stopTimeout = 20 * time.Second
+
+// Config tells where the daemon listens and keeps its PID, how often it
+// polls the lights and whether they push their state to it, and how it logs.
+type Config struct {
+	Socket    string        `yaml:"socket"`
+	PidFile   string        `yaml:"pidFile"`
+	Poll      time.Duration `yaml:"poll"`
+	Push      bool          `yaml:"push"`
+	LogFormat string        `yaml:"logFormat"`
+	LogLevel  string        `yaml:"logLevel"`
+}
+
+type Daemon struct {
+	Config    Config
+	Client    client.Client
+	Rules     rules.Engine
+	RulesFile string
+	// Api is served when it has an address to listen on.
+	Api api.Server
+	Log *slog.Logger
+}
+
+// registrar is the wiz.Client that lights can push their state to.
+type registrar interface {
+	Register(light *wiz.Light, hostIp string) error
+}
+
+// NewLogger logs to w as text or JSON, from the level given on.
+func NewLogger(config Config, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if config.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(config.LogLevel)); err != nil {
+			return nil, fmt.Errorf("unknown log level %q", config.LogLevel)
+		}
+	}
+	options := &slog.HandlerOptions{Level: level}
+
+	switch config.LogFormat {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, expected text or json", config.LogFormat)
+}
+
+// Run runs the daemon until stop is closed, which ends the sunrises and the
+// transitions of the jobs under way, then waits up to stopTimeout for the
+// rest of the work under way to finish. It fails to start when another daemon
+// holds the PID file.
+func (d Daemon) Run(stop <-chan struct{}) error {
+	if d.Log == nil {
+		d.Log = slog.Default()
+	}
+
+	serveApi := d.Api.Config.Listen != ""
+	if serveApi {
+		if err := d.Api.Config.Check(); err != nil {
+			return err
+		}
+	}
+
+	release, err := lockPid(d.Config.PidFile)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var loaded []rules.Rule
+	if d.RulesFile != "" {
+		loaded, err = d.Rules.Load(d.RulesFile)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			d.Log.Info("no rules to run", "file", d.RulesFile)
+		case err != nil:
+			return fmt.Errorf("rules: %w", err)
+		}
+	}
+
+	listener, err := listen(d.Config.Socket)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(d.Config.Socket)
+
+	var push net.PacketConn
+	if d.Config.Push {
+		if push, err = net.ListenPacket("udp4", ":"+strconv.Itoa(wiz.PushPort)); err != nil {
+			d.Log.Warn("not listening to the lights", "error", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var conns connections
+	wg.Go(func() { d.serve(listener, &conns, &wg) })
+	wg.Go(func() { d.report("alarms", d.Client.RunAlarms(stop, d.logAlarm)) })
+	wg.Go(func() { d.report("jobs", d.Client.RunJobs(stop, d.logJob)) })
+	if len(loaded) > 0 {
+		wg.Go(func() { d.report("rules", d.Rules.Run(loaded, false, stop, d.logRule)) })
+	}
+	if push != nil {
+		wg.Go(func() { d.report("push", wiz.ListenPush(push, d.pushed)) })
+	}
+	if serveApi {
+		wg.Go(func() { d.report("api", d.Api.Serve(stop)) })
+	}
+	wg.Go(func() { d.poll(stop, push != nil) })
+	wg.Go(func() { d.prune(stop) })
+	d.Log.Info("daemon started", "pid", os.Getpid(), "socket", d.Config.Socket, "rules", len(loaded), "push", push != nil, "api", d.Api.Config.Listen)
+
+	<-stop
+	d.Log.Info("daemon stopping")
+	listener.Close()
+	if push != nil {
+		push.Close()
+	}
+	conns.closeAll()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		d.Log.Info("daemon stopped")
+	case <-time.After(stopTimeout):
+		d.Log.Warn("daemon stopped with work still under way", "waited", stopTimeout)
+	}
+	return nil
+}
+
+// listen listens on the socket, which only the user may connect to from the
+// start, as it is created under a umask leaving the others out. A socket
+// left behind by a daemon that died, the PID file being taken, is replaced.
+func listen(socket string) (net.Listener, error) {
+	if err := os.Remove(socket); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	umask := syscall.Umask(0o177)
+	defer syscall.Umask(umask)
+	return net.Listen("unix", socket)
+}
+
+// connections are the attached processes, hung up on when the daemon stops.
+type connections struct {
+	mu     sync.Mutex
+	conns  map[net.Conn]bool
+	closed bool
+}
+
+func (c *connections) add(conn net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		conn.Close()
+		return
+	}
+	if c.conns == nil {
+		c.conns = map[net.Conn]bool{}
+	}
+	c.conns[conn] = true
+}
+
+func (c *connections) remove(conn net.Conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.conns, conn)
+}
+
+func (c *connections) closeAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for conn := range c.conns {
+		conn.Close()
+	}
+}
+
+// serve runs the calls of the attached processes until the listener is
+// closed. A connection hung up on finishes the calls under way first.
+func (d Daemon) serve(listener net.Listener, conns *connections, wg *sync.WaitGroup) {
+	server := rpc.NewServer()
+	if err := server.RegisterName("Daemon", &service{functions: d.Client, log: d.Log}); err != nil {
+		d.report("calls", err)
+		return
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			d.report("calls", err)
+			return
+		}
+		conns.add(conn)
+		wg.Go(func() {
+			defer conns.remove(conn)
+			server.ServeCodec(jsonrpc.NewServerCodec(conn))
+		})
+	}
+}
+
+// poll asks the lights for their status every poll, recording their changes
+// and power. With push, it renews the registrations with the lights as well.
+func (d Daemon) poll(stop <-chan struct{}, push bool) {
+	poll := d.Config.Poll
+	if poll <= 0 {
+		poll = defaultPoll
+	}
+
+	for {
+		if push {
+			d.register()
+		}
+		lights, err := d.Client.ShowAll()
+		if err != nil {
+			d.Log.Error("polling failed", "error", err)
+		} else {
+			reachable := 0
+			for _, l := range lights {
+				if l.IsOn != nil {
+					reachable++
+				}
+			}
+			d.Log.Debug("polled", "lights", len(lights), "reachable", reachable)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(poll):
+		}
+	}
+}
+
+// prune removes the events and power samples past their retention every
+// pruneEvery, as the CLI attached to the daemon does not.
+func (d Daemon) prune(stop <-chan struct{}) {
+	for {
+		if removed, err := d.Client.PruneEvents(); err != nil {
+			d.Log.Error("pruning the events failed", "error", err)
+		} else if removed > 0 {
+			d.Log.Debug("pruned the events", "removed", removed)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(pruneEvery):
+		}
+	}
+}
+
+func (d Daemon) register() {
+	r, ok := d.Client.WizClient.(registrar)
+	if !ok {
+		return
+	}
+	lights, err := d.Client.LightsDb.FindAll()
+	if err != nil {
+		d.Log.Error("registering with the lights failed", "error", err)
+		return
+	}
+	for _, l := range lights {
+		host, err := wiz.HostAddress(&l)
+		if err == nil {
+			err = r.Register(&l, host)
+		}
+		if err != nil {
+			d.Log.Debug("registering with a light failed", "light", l.Id, "error", err)
+		}
+	}
+}
+
+func (d Daemon) pushed(push wiz.Push) {
+	if err := d.Client.Pushed(push); err != nil {
+		d.Log.Debug("push ignored", "mac", push.MacAddress, "ip", push.IpAddress, "error", err)
+	}
+}
+
+func (d Daemon) logRule(r rules.Result) {
+	switch {
+	case len(r.Fired) == 0:
+		d.Log.Error("rule failed", "rule", r.Rule, "error", r.Err)
+	case !r.Ran:
+		var failed []string
+		for _, c := range r.Conditions {
+			if !c.Holds {
+				failed = append(failed, c.What)
+			}
+		}
+		d.Log.Info("rule held back", "rule", r.Rule, "fired", r.Fired, "failed", failed)
+	case r.Err != nil:
+		d.Log.Error("rule ran with errors", "rule", r.Rule, "fired", r.Fired, "actions", r.Actions, "error", r.Err)
+	default:
+		d.Log.Info("rule ran", "rule", r.Rule, "fired", r.Fired, "actions", r.Actions, "lights", len(r.Lights))
+	}
+}
+
+func (d Daemon) logAlarm(alarm db.Alarm, lights []wiz.Light, err error) {
+	switch {
+	case errors.Is(err, client.ErrTransitionStopped):
+		d.Log.Info("alarm stopped", "alarm", alarm.Name, "lights", len(lights))
+	case err != nil:
+		d.Log.Error("alarm rang with errors", "alarm", alarm.Name, "lights", len(lights), "error", err)
+	default:
+		d.Log.Info("alarm rang", "alarm", alarm.Name, "lights", len(lights))
+	}
+}
+
+func (d Daemon) logJob(job db.Job, lights []wiz.Light, err error) {
+	switch {
+	case errors.Is(err, client.ErrTransitionStopped):
+		d.Log.Info("job stopped", "job", job.Name, "lights", len(lights))
+	case err != nil:
+		d.Log.Error("job ran with errors", "job", job.Name, "command", job.Command, "lights", len(lights), "error", err)
+	default:
+		d.Log.Info("job ran", "job", job.Name, "command", job.Command, "lights", len(lights))
+	}
+}
+
+// report logs how a part of the daemon stopped, when it failed.
+func (d Daemon) report(part string, err error) {
+	if err != nil {
+		d.Log.Error("stopped on an error", "part", part, "error", err)
+	}
+}
@@ -0,0 +1,237 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/api"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/wiz/wiztest"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLockPid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gowizcli.pid")
+
+	release, err := lockPid(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := lockPid(path); err == nil || !strings.Contains(err.Error(), fmt.Sprintf("already running with pid %d", os.Getpid())) {
+		t.Fatalf("got %v; expected the second lock to fail", err)
+	}
+	release()
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("got %v; expected the PID file removed", err)
+	}
+
+	// A PID file left behind by a process long gone is taken over.
+	os.WriteFile(path, []byte("2147483646\n"), 0o644)
+	release, err = lockPid(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer release()
+	data, _ := os.ReadFile(path)
+	if expected := fmt.Sprintf("%d\n", os.Getpid()); string(data) != expected {
+		t.Fatalf("got %q; expected %q", data, expected)
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		config Config
+		fails  bool
+	}{
+		{Config{}, false},
+		{Config{LogFormat: "json", LogLevel: "debug"}, false},
+		{Config{LogFormat: "xml"}, true},
+		{Config{LogLevel: "loud"}, true},
+	}
+	for _, test := range tests {
+		_, err := NewLogger(test.config, io.Discard)
+		if (err != nil) != test.fails {
+			t.Fatalf("got %v for %+v; expected it to fail: %v", err, test.config, test.fails)
+		}
+	}
+}
+
+func TestDaemon_RunAndAttach(t *testing.T) {
+	dir := t.TempDir()
+	storage := wiztest.Inventory(1)
+	storage.RecordEvent(db.Event{Time: time.Now().AddDate(0, 0, -60), Source: db.SourceCLI, Command: client.CommandOff, LightId: "1"})
+	wizClient := wiztest.NewClient()
+	d := Daemon{
+		Config: Config{
+			Socket:  filepath.Join(dir, "gowizcli.sock"),
+			PidFile: filepath.Join(dir, "gowizcli.pid"),
+			Poll:    time.Hour,
+		},
+		Client: client.Client{LightsDb: storage, WizClient: wizClient, Source: db.SourceDaemon, EventRetention: 30 * 24 * time.Hour},
+		Log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan error)
+	go func() { stopped <- d.Run(stop) }()
+
+	remote := attach(t, d.Config.Socket)
+	defer remote.Close()
+
+	if err := d.Run(stop); err == nil {
+		t.Fatalf("expected a second daemon to fail to start")
+	}
+	info, err := os.Stat(d.Config.Socket)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("got %v; expected the socket for the user only", info.Mode())
+	}
+
+	functions := remote.WithSource(db.SourceCLI)
+	light, err := functions.TurnOn("1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if light.IsOn == nil || !*light.IsOn || !wizClient.IsOn("10.0.0.1") {
+		t.Fatalf("got %+v; expected the light turned on by the daemon", light)
+	}
+	if _, err := functions.TurnOn("2"); err == nil {
+		t.Fatalf("expected the error of the daemon for an unknown light")
+	}
+
+	events, err := functions.History(db.EventFilter{LightId: "1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.ContainsFunc(events, func(e db.Event) bool { return e.Command == client.CommandOn && e.Source == db.SourceCLI }) {
+		t.Fatalf("got %+v; expected the command recorded from the CLI", events)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for slices.ContainsFunc(events, func(e db.Event) bool { return e.Command == client.CommandOff }) {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %+v; expected the events past their retention pruned by the daemon", events)
+		}
+		time.Sleep(10 * time.Millisecond)
+		events, _ = functions.History(db.EventFilter{LightId: "1"})
+	}
+	if err := functions.RunAlarms(stop, nil); err != errRunsInDaemon {
+		t.Fatalf("got %v; expected %v", err, errRunsInDaemon)
+	}
+
+	close(stop)
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the daemon did not stop")
+	}
+	for _, path := range []string{d.Config.Socket, d.Config.PidFile} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("got %v; expected %s removed", err, path)
+		}
+	}
+}
+
+func TestDaemon_RunStopsDuringASunrise(t *testing.T) {
+	dir := t.TempDir()
+	storage := wiztest.Inventory(1)
+	now := time.Now()
+	storage.CreateAlarm(db.Alarm{Name: "wake", Hour: now.Hour(), Minute: now.Minute(), Ramp: time.Hour, Lights: db.LightSelection{All: true}, Enabled: true, LastRun: now.Add(-time.Hour)})
+	wizClient := wiztest.NewClient()
+	transitions, _ := client.NewTransitions(client.TransitionConfig{})
+	d := Daemon{
+		Config: Config{
+			Socket:  filepath.Join(dir, "gowizcli.sock"),
+			PidFile: filepath.Join(dir, "gowizcli.pid"),
+			Poll:    time.Hour,
+		},
+		Client: client.Client{LightsDb: storage, WizClient: wizClient, Transitions: transitions, Source: db.SourceDaemon},
+		Log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan error)
+	go func() { stopped <- d.Run(stop) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !wizClient.IsOn("10.0.0.1") {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the alarm to ring")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(stop)
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the daemon did not stop during the sunrise")
+	}
+	for _, path := range []string{d.Config.Socket, d.Config.PidFile} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("got %v; expected %s removed", err, path)
+		}
+	}
+}
+
+func TestDaemon_RunNeedsTheApiToken(t *testing.T) {
+	dir := t.TempDir()
+	d := Daemon{
+		Config: Config{Socket: filepath.Join(dir, "gowizcli.sock"), PidFile: filepath.Join(dir, "gowizcli.pid")},
+		Api:    api.Server{Config: api.Config{Listen: "localhost:0"}},
+		Log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	if err := d.Run(make(chan struct{})); err == nil || !strings.Contains(err.Error(), "token") {
+		t.Fatalf("got %v; expected the daemon to refuse serving the API without a token", err)
+	}
+	if _, err := os.Stat(d.Config.PidFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("got %v; expected no PID file", err)
+	}
+}
+
+func TestService_CallsTheRolesOfTheClient(t *testing.T) {
+	s := service{
+		functions: client.Client{LightsDb: wiztest.Inventory(1), WizClient: wiztest.NewClient()},
+		log:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	var response Response
+	if err := s.Call(Request{Method: "ShowAll"}, &response); err != nil || len(response.Results) != 1 {
+		t.Fatalf("got %v, %+v; expected the lights", err, response)
+	}
+	for _, method := range []string{"WithSource", "RunJobs", "ParseSchedule", "record"} {
+		if err := s.Call(Request{Method: method}, &Response{}); err == nil {
+			t.Fatalf("expected %s not to run through the daemon", method)
+		}
+	}
+}
+
+// attach attaches to the daemon once it listens.
+func attach(t *testing.T, socket string) *Remote {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		remote, err := Attach(socket)
+		if err == nil {
+			return remote
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("could not attach: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
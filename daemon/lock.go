@@ -0,0 +1,52 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// lockPid writes the PID file of the daemon and locks it for as long as the
+// daemon runs, failing when a running daemon holds the lock. A file left
+// behind by a daemon that died is unlocked, and taken over. release removes
+// the file and drops the lock.
+func lockPid(path string) (release func(), err error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		defer file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("a daemon is already running with pid %d, as %s tells", pidOf(file), path)
+		}
+		return nil, err
+	}
+
+	if err := file.Truncate(0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := fmt.Fprintf(file, "%d\n", os.Getpid()); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return func() {
+		os.Remove(path)
+		file.Close()
+	}, nil
+}
+
+// pidOf reads the PID of a locked PID file, 0 when unreadable.
+func pidOf(file *os.File) int {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
@@ -0,0 +1,380 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"time"
+)
+
+// Remote runs the commands in a running daemon rather than on the lights,
+// so that the daemon alone talks to them. Schedules are parsed in this
+// process, at Location; the long-running loops only run in the daemon.
+type Remote struct {
+	Location client.Location
+
+	rpc        *rpc.Client
+	source     string
+	transition *time.Duration
+}
+
+// Attach connects to the daemon listening on socket.
+func Attach(socket string) (*Remote, error) {
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &Remote{rpc: jsonrpc.NewClient(conn)}, nil
+}
+
+func (r *Remote) Close() error {
+	return r.rpc.Close()
+}
+
+// call runs a method in the daemon, decoding its results into results. The
+// results are decoded even when the method fails, as some return what they
+// managed along with the error.
+func (r Remote) call(method string, results []any, args ...any) error {
+	request := Request{Method: method, Source: r.source, Transition: r.transition}
+	for _, arg := range args {
+		encoded, err := json.Marshal(arg)
+		if err != nil {
+			return err
+		}
+		request.Args = append(request.Args, encoded)
+	}
+
+	var response Response
+	if err := r.rpc.Call("Daemon.Call", request, &response); err != nil {
+		return fmt.Errorf("daemon: %w", err)
+	}
+	if len(response.Results) != len(results) {
+		return fmt.Errorf("daemon: %s returned %d results, expected %d", method, len(response.Results), len(results))
+	}
+	for i, result := range response.Results {
+		if err := json.Unmarshal(result, results[i]); err != nil {
+			return fmt.Errorf("daemon: %s result %d: %w", method, i+1, err)
+		}
+	}
+	return errorOf(&response)
+}
+
+func (r Remote) WithTransition(d time.Duration) client.Functions {
+	r.transition = &d
+	return r
+}
+
+func (r Remote) WithSource(source string) client.Functions {
+	r.source = source
+	return r
+}
+
+func (r Remote) Discover() (lights []wiz.Light, err error) {
+	err = r.call("Discover", []any{&lights})
+	return
+}
+
+func (r Remote) ShowAll() (lights []wiz.Light, err error) {
+	err = r.call("ShowAll", []any{&lights})
+	return
+}
+
+func (r Remote) Status(lightId string) (light *wiz.Light, err error) {
+	err = r.call("Status", []any{&light}, lightId)
+	return
+}
+
+func (r Remote) TurnOn(lightId string) (light *wiz.Light, err error) {
+	err = r.call("TurnOn", []any{&light}, lightId)
+	return
+}
+
+func (r Remote) TurnOff(lightId string) (light *wiz.Light, err error) {
+	err = r.call("TurnOff", []any{&light}, lightId)
+	return
+}
+
+func (r Remote) MatchDaylight(lightId string) (light *wiz.Light, err error) {
+	err = r.call("MatchDaylight", []any{&light}, lightId)
+	return
+}
+
+func (r Remote) SetPilot(lightId string, pilot wiz.Pilot) (light *wiz.Light, err error) {
+	err = r.call("SetPilot", []any{&light}, lightId, pilot)
+	return
+}
+
+func (r Remote) SetFan(lightId string, on bool) (light *wiz.Light, err error) {
+	err = r.call("SetFan", []any{&light}, lightId, on)
+	return
+}
+
+func (r Remote) SetFanSpeed(lightId string, speed int) (light *wiz.Light, err error) {
+	err = r.call("SetFanSpeed", []any{&light}, lightId, speed)
+	return
+}
+
+func (r Remote) SetFanMode(lightId string, mode wiz.FanMode) (light *wiz.Light, err error) {
+	err = r.call("SetFanMode", []any{&light}, lightId, mode)
+	return
+}
+
+func (r Remote) SetFanDirection(lightId string, reverse bool) (light *wiz.Light, err error) {
+	err = r.call("SetFanDirection", []any{&light}, lightId, reverse)
+	return
+}
+
+func (r Remote) Select(selector client.Selector) (lights []wiz.Light, err error) {
+	err = r.call("Select", []any{&lights}, selector)
+	return
+}
+
+func (r Remote) RenameLight(lightId string, name string) (light *wiz.Light, err error) {
+	err = r.call("RenameLight", []any{&light}, lightId, name)
+	return
+}
+
+func (r Remote) Delete(lightId string) error {
+	return r.call("Delete", nil, lightId)
+}
+
+func (r Remote) FindStale(unseenFor time.Duration) (lights []wiz.Light, err error) {
+	err = r.call("FindStale", []any{&lights}, unseenFor)
+	return
+}
+
+func (r Remote) Prune(unseenFor time.Duration) (lights []wiz.Light, err error) {
+	err = r.call("Prune", []any{&lights}, unseenFor)
+	return
+}
+
+func (r Remote) EraseAll() error {
+	return r.call("EraseAll", nil)
+}
+
+func (r Remote) Export() (inventory *db.Inventory, err error) {
+	err = r.call("Export", []any{&inventory})
+	return
+}
+
+func (r Remote) Import(inventory db.Inventory, mode db.ImportMode) error {
+	return r.call("Import", nil, inventory, mode)
+}
+
+func (r Remote) ListBackups() (backups []db.Backup, err error) {
+	err = r.call("ListBackups", []any{&backups})
+	return
+}
+
+func (r Remote) RestoreBackup(id string) (backup *db.Backup, err error) {
+	err = r.call("RestoreBackup", []any{&backup}, id)
+	return
+}
+
+func (r Remote) CreateRoom(room db.Room) (created *db.Room, err error) {
+	err = r.call("CreateRoom", []any{&created}, room)
+	return
+}
+
+func (r Remote) ListRooms() (rooms []db.Room, err error) {
+	err = r.call("ListRooms", []any{&rooms})
+	return
+}
+
+func (r Remote) UpdateRoom(room db.Room) (updated *db.Room, err error) {
+	err = r.call("UpdateRoom", []any{&updated}, room)
+	return
+}
+
+func (r Remote) DeleteRoom(room string) error {
+	return r.call("DeleteRoom", nil, room)
+}
+
+func (r Remote) FindRoom(room string) (found *db.Room, err error) {
+	err = r.call("FindRoom", []any{&found}, room)
+	return
+}
+
+func (r Remote) AssignRoom(selector client.Selector, room string) (lights []wiz.Light, err error) {
+	err = r.call("AssignRoom", []any{&lights}, selector, room)
+	return
+}
+
+func (r Remote) CreateGroup(group db.Group) (created *db.Group, err error) {
+	err = r.call("CreateGroup", []any{&created}, group)
+	return
+}
+
+func (r Remote) ListGroups() (groups []db.Group, err error) {
+	err = r.call("ListGroups", []any{&groups})
+	return
+}
+
+func (r Remote) UpdateGroup(group db.Group) (updated *db.Group, err error) {
+	err = r.call("UpdateGroup", []any{&updated}, group)
+	return
+}
+
+func (r Remote) DeleteGroup(group string) error {
+	return r.call("DeleteGroup", nil, group)
+}
+
+func (r Remote) FindGroup(group string) (found *db.Group, err error) {
+	err = r.call("FindGroup", []any{&found}, group)
+	return
+}
+
+func (r Remote) AddToGroup(selector client.Selector, group string) (lights []wiz.Light, err error) {
+	err = r.call("AddToGroup", []any{&lights}, selector, group)
+	return
+}
+
+func (r Remote) RemoveFromGroup(selector client.Selector, group string) (lights []wiz.Light, err error) {
+	err = r.call("RemoveFromGroup", []any{&lights}, selector, group)
+	return
+}
+
+func (r Remote) AddTags(selector client.Selector, tags []string) (lights []wiz.Light, err error) {
+	err = r.call("AddTags", []any{&lights}, selector, tags)
+	return
+}
+
+func (r Remote) RemoveTags(selector client.Selector, tags []string) (lights []wiz.Light, err error) {
+	err = r.call("RemoveTags", []any{&lights}, selector, tags)
+	return
+}
+
+func (r Remote) History(filter db.EventFilter) (events []db.Event, err error) {
+	err = r.call("History", []any{&events}, filter)
+	return
+}
+
+func (r Remote) TimeOn(lightId string, since, until time.Time) (on time.Duration, err error) {
+	err = r.call("TimeOn", []any{&on}, lightId, since, until)
+	return
+}
+
+func (r Remote) PruneEvents() (pruned int, err error) {
+	err = r.call("PruneEvents", []any{&pruned})
+	return
+}
+
+func (r Remote) EnergyReport(since, until time.Time) (report *client.EnergyReport, err error) {
+	err = r.call("EnergyReport", []any{&report}, since, until)
+	return
+}
+
+func (r Remote) PowerSamples(lightId string, since, until time.Time) (samples []db.PowerSample, err error) {
+	err = r.call("PowerSamples", []any{&samples}, lightId, since, until)
+	return
+}
+
+func (r Remote) SaveSnapshot(name string, selector client.Selector) (snapshot *db.Snapshot, err error) {
+	err = r.call("SaveSnapshot", []any{&snapshot}, name, selector)
+	return
+}
+
+func (r Remote) ApplySnapshot(name string) (lights []wiz.Light, err error) {
+	err = r.call("ApplySnapshot", []any{&lights}, name)
+	return
+}
+
+func (r Remote) ListSnapshots() (snapshots []db.Snapshot, err error) {
+	err = r.call("ListSnapshots", []any{&snapshots})
+	return
+}
+
+func (r Remote) DeleteSnapshot(name string) error {
+	return r.call("DeleteSnapshot", nil, name)
+}
+
+func (r Remote) DiffSnapshots(from, to string) (changes []client.SnapshotChange, err error) {
+	err = r.call("DiffSnapshots", []any{&changes}, from, to)
+	return
+}
+
+func (r Remote) CreateAlarm(alarm db.Alarm) (created *db.Alarm, err error) {
+	err = r.call("CreateAlarm", []any{&created}, alarm)
+	return
+}
+
+func (r Remote) ListAlarms() (alarms []db.Alarm, err error) {
+	err = r.call("ListAlarms", []any{&alarms})
+	return
+}
+
+func (r Remote) FindAlarm(alarm string) (found *db.Alarm, err error) {
+	err = r.call("FindAlarm", []any{&found}, alarm)
+	return
+}
+
+func (r Remote) DeleteAlarm(alarm string) error {
+	return r.call("DeleteAlarm", nil, alarm)
+}
+
+func (r Remote) SetAlarmEnabled(alarm string, enabled bool) (updated *db.Alarm, err error) {
+	err = r.call("SetAlarmEnabled", []any{&updated}, alarm, enabled)
+	return
+}
+
+func (r Remote) RingAlarm(alarm string) (lights []wiz.Light, err error) {
+	err = r.call("RingAlarm", []any{&lights}, alarm)
+	return
+}
+
+func (r Remote) RunAlarms(stop <-chan struct{}, report func(db.Alarm, []wiz.Light, error)) error {
+	return errRunsInDaemon
+}
+
+func (r Remote) ParseSchedule(spec string, loc *time.Location) (client.Schedule, error) {
+	return client.Client{Location: r.Location}.ParseSchedule(spec, loc)
+}
+
+func (r Remote) JobSchedule(job db.Job) (client.Schedule, error) {
+	return client.Client{Location: r.Location}.JobSchedule(job)
+}
+
+func (r Remote) NextRun(job db.Job, after time.Time) time.Time {
+	return client.Client{Location: r.Location}.NextRun(job, after)
+}
+
+func (r Remote) CreateJob(job db.Job) (created *db.Job, err error) {
+	err = r.call("CreateJob", []any{&created}, job)
+	return
+}
+
+func (r Remote) ListJobs() (jobs []db.Job, err error) {
+	err = r.call("ListJobs", []any{&jobs})
+	return
+}
+
+func (r Remote) FindJob(job string) (found *db.Job, err error) {
+	err = r.call("FindJob", []any{&found}, job)
+	return
+}
+
+func (r Remote) DeleteJob(job string) error {
+	return r.call("DeleteJob", nil, job)
+}
+
+func (r Remote) SetJobEnabled(job string, enabled bool) (updated *db.Job, err error) {
+	err = r.call("SetJobEnabled", []any{&updated}, job, enabled)
+	return
+}
+
+func (r Remote) RunJob(job string) (lights []wiz.Light, err error) {
+	err = r.call("RunJob", []any{&lights}, job)
+	return
+}
+
+func (r Remote) RunJobs(stop <-chan struct{}, report func(db.Job, []wiz.Light, error)) error {
+	return errRunsInDaemon
+}
+
+var errRunsInDaemon = errors.New("a daemon is running, which runs the alarms and jobs")
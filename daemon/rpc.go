@@ -0,0 +1,134 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gowizcli/client"
+	"log/slog"
+	"reflect"
+	"time"
+)
+
+// Request calls a method of the roles of client.Functions by name, with its
+// arguments in JSON, on the client of the daemon set to the source and
+// transition of the caller. A nil Transition keeps the one of the daemon.
+type Request struct {
+	Method     string
+	Args       []json.RawMessage
+	Source     string
+	Transition *time.Duration
+}
+
+// Response holds the results of a method in JSON, but for the error, which
+// is in Error, empty when the method succeeded.
+type Response struct {
+	Results []json.RawMessage
+	Error   string
+}
+
+var (
+	roles = []reflect.Type{
+		reflect.TypeFor[client.Lights](),
+		reflect.TypeFor[client.Inventory](),
+		reflect.TypeFor[client.Rooms](),
+		reflect.TypeFor[client.Events](),
+		reflect.TypeFor[client.Automation](),
+	}
+	errorType = reflect.TypeFor[error]()
+)
+
+// service runs the calls of the attached processes.
+type service struct {
+	functions client.Functions
+	log       *slog.Logger
+}
+
+func (s *service) Call(request Request, response *Response) error {
+	start := time.Now()
+	err := s.call(request, response)
+	attrs := []any{"method", request.Method, "source", request.Source, "duration", time.Since(start)}
+	if failed := errors.Join(err, errorOf(response)); failed != nil {
+		attrs = append(attrs, "error", failed)
+	}
+	s.log.Debug("call", attrs...)
+	return err
+}
+
+func (s *service) call(request Request, response *Response) error {
+	f := s.functions
+	if request.Source != "" {
+		f = f.WithSource(request.Source)
+	}
+	if request.Transition != nil {
+		f = f.WithTransition(*request.Transition)
+	}
+
+	declared, ok := declaredMethod(request.Method)
+	if !ok {
+		return fmt.Errorf("unknown method %s", request.Method)
+	}
+	if !remotable(declared.Type) {
+		return fmt.Errorf("%s does not run through the daemon", request.Method)
+	}
+	method := reflect.ValueOf(f).MethodByName(request.Method)
+	if len(request.Args) != method.Type().NumIn() {
+		return fmt.Errorf("%s takes %d arguments, got %d", request.Method, method.Type().NumIn(), len(request.Args))
+	}
+
+	args := make([]reflect.Value, len(request.Args))
+	for i, raw := range request.Args {
+		arg := reflect.New(method.Type().In(i))
+		if err := json.Unmarshal(raw, arg.Interface()); err != nil {
+			return fmt.Errorf("%s argument %d: %w", request.Method, i+1, err)
+		}
+		args[i] = arg.Elem()
+	}
+
+	for _, result := range method.Call(args) {
+		if result.Type() == errorType {
+			if !result.IsNil() {
+				response.Error = result.Interface().(error).Error()
+			}
+			continue
+		}
+		encoded, err := json.Marshal(result.Interface())
+		if err != nil {
+			return err
+		}
+		response.Results = append(response.Results, encoded)
+	}
+	return nil
+}
+
+func declaredMethod(name string) (reflect.Method, bool) {
+	for _, role := range roles {
+		if method, ok := role.MethodByName(name); ok {
+			return method, true
+		}
+	}
+	return reflect.Method{}, false
+}
+
+// remotable tells whether a method can run in the daemon for another
+// process: it takes no channel and returns no interface but errors.
+func remotable(method reflect.Type) bool {
+	for i := range method.NumIn() {
+		if method.In(i).Kind() == reflect.Chan {
+			return false
+		}
+	}
+	for i := range method.NumOut() {
+		if out := method.Out(i); out.Kind() == reflect.Interface && out != errorType {
+			return false
+		}
+	}
+	return true
+}
+
+func errorOf(response *Response) error {
+	if response.Error == "" {
+		return nil
+	}
+	return errors.New(response.Error)
+}
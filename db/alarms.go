@@ -0,0 +1,165 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Alarm wakes someone up with the lights: on its days, at Hour:Minute local
+// time, the lights it selects ramp up from a dim warm white to full cool white
+// over Ramp.
+type Alarm struct {
+	Id     string
+	Name   string
+	Hour   int
+	Minute int
+	// Days are the weekdays the alarm rings on, every day when empty.
+	Days   []time.Weekday
+	Ramp   time.Duration
+	Lights LightSelection
+	// WakeUpScene finishes the ramp with the Wake up scene.
+	WakeUpScene bool
+	Enabled     bool
+	// LastRun is when the alarm last rang, zero if never.
+	LastRun time.Time
+}
+
+// LightSelection picks lights as client.Selector does, for what is stored.
+type LightSelection struct {
+	All   bool     `json:"all,omitempty"`
+	Ids   []string `json:"ids,omitempty"`
+	Room  string   `json:"room,omitempty"`
+	Group string   `json:"group,omitempty"`
+	Tags  string   `json:"tags,omitempty"`
+}
+
+func (s gormStorage) CreateAlarm(alarm Alarm) (*Alarm, error) {
+	if alarm.Id == "" {
+		alarm.Id = uuid.NewString()
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := nameTaken(tx, &storedAlarm{}, alarm.Name, alarm.Id); err != nil {
+			return err
+		}
+		return tx.Create(toStoredAlarm(alarm)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &alarm, nil
+}
+
+func (s gormStorage) FindAlarms() ([]Alarm, error) {
+	var stored []storedAlarm
+	if err := s.db.Order("name").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]Alarm, len(stored))
+	for i, a := range stored {
+		result[i] = a.toAlarm()
+	}
+	return result, nil
+}
+
+// UpdateAlarm replaces an alarm but for when it last rang.
+func (s gormStorage) UpdateAlarm(alarm Alarm) (*Alarm, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := nameTaken(tx, &storedAlarm{}, alarm.Name, alarm.Id); err != nil {
+			return err
+		}
+		if err := exists(tx, &storedAlarm{}, alarm.Id, "alarm"); err != nil {
+			return err
+		}
+		return tx.Model(&storedAlarm{ID: alarm.Id}).
+			Select("name", "hour", "minute", "days", "ramp", "lights", "wake_up_scene", "enabled").
+			Updates(toStoredAlarm(alarm)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &alarm, nil
+}
+
+func (s gormStorage) DeleteAlarm(id string) error {
+	result := s.db.Delete(&storedAlarm{ID: id})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("alarm %s %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+func (s gormStorage) MarkAlarmRun(id string, at time.Time) error {
+	result := s.db.Model(&storedAlarm{ID: id}).Update("last_run", at.UTC())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("alarm %s %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+type storedAlarm struct {
+	ID          string `gorm:"primaryKey;size:64"`
+	Name        string `gorm:"uniqueIndex;size:128"`
+	Hour        int
+	Minute      int
+	Days        datatypes.JSONType[[]time.Weekday]
+	Ramp        time.Duration
+	Lights      datatypes.JSONType[LightSelection]
+	WakeUpScene bool
+	Enabled     bool
+	LastRun     *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (storedAlarm) TableName() string {
+	return "alarms"
+}
+
+func toStoredAlarm(a Alarm) *storedAlarm {
+	stored := &storedAlarm{
+		ID:          a.Id,
+		Name:        a.Name,
+		Hour:        a.Hour,
+		Minute:      a.Minute,
+		Days:        datatypes.NewJSONType(a.Days),
+		Ramp:        a.Ramp,
+		Lights:      datatypes.NewJSONType(a.Lights),
+		WakeUpScene: a.WakeUpScene,
+		Enabled:     a.Enabled,
+	}
+	if !a.LastRun.IsZero() {
+		lastRun := a.LastRun.UTC()
+		stored.LastRun = &lastRun
+	}
+	return stored
+}
+
+func (a storedAlarm) toAlarm() Alarm {
+	alarm := Alarm{
+		Id:          a.ID,
+		Name:        a.Name,
+		Hour:        a.Hour,
+		Minute:      a.Minute,
+		Days:        a.Days.Data(),
+		Ramp:        a.Ramp,
+		Lights:      a.Lights.Data(),
+		WakeUpScene: a.WakeUpScene,
+		Enabled:     a.Enabled,
+	}
+	if a.LastRun != nil {
+		alarm.LastRun = *a.LastRun
+	}
+	return alarm
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func (s gormStorage) Export() (*Inventory, error) {
+	var inventory *Inventory
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		inventory, err = exportInventory(gormStorage{db: tx, tags: s.tags})
+		return err
+	})
+	return inventory, err
+}
+
+func (s gormStorage) Import(inventory Inventory, mode ImportMode) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return importInventory(gormStorage{db: tx, tags: s.tags}, inventory, mode)
+	})
+}
+
+func (s gormStorage) CreateBackup(reason string) (*Backup, error) {
+	var backup Backup
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		inventory, err := exportInventory(gormStorage{db: tx, tags: s.tags})
+		if err != nil {
+			return err
+		}
+
+		backup = Backup{
+			Id:        uuid.NewString(),
+			CreatedAt: time.Now().UTC(),
+			Reason:    reason,
+			Inventory: *inventory,
+		}
+		err = tx.Create(&storedBackup{
+			ID:        backup.Id,
+			CreatedAt: backup.CreatedAt,
+			Reason:    backup.Reason,
+			Inventory: datatypes.NewJSONType(backup.Inventory),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		var expired []string
+		err = tx.Model(&storedBackup{}).
+			Order("created_at DESC").
+			Offset(MaxBackups).
+			Limit(-1).
+			Pluck("id", &expired).Error
+		if err != nil || len(expired) == 0 {
+			return err
+		}
+		return tx.Where("id IN ?", expired).Delete(&storedBackup{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &backup, nil
+}
+
+func (s gormStorage) FindBackups() ([]Backup, error) {
+	var stored []storedBackup
+	if err := s.db.Order("created_at DESC").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]Backup, len(stored))
+	for i, b := range stored {
+		result[i] = Backup{
+			Id:        b.ID,
+			CreatedAt: b.CreatedAt,
+			Reason:    b.Reason,
+			Inventory: b.Inventory.Data(),
+		}
+	}
+	return result, nil
+}
+
+type storedBackup struct {
+	ID        string    `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time `gorm:"index"`
+	Reason    string    `gorm:"size:255"`
+	Inventory datatypes.JSONType[Inventory]
+}
+
+func (storedBackup) TableName() string {
+	return "backups"
+}
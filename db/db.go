@@ -4,26 +4,97 @@ import (
 	"errors"
 	"fmt"
 	"gowizcli/wiz"
+	"strings"
 	"time"
 
 	"gorm.io/datatypes"
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+// ErrNotFound is wrapped by the errors of the lookups of a light, room, group,
+// snapshot, alarm or job that finds none.
+var ErrNotFound = errors.New("not found")
+
 type Storage interface {
 	Upsert(bulb wiz.Light) (*wiz.Light, error)
 	FindAll() ([]wiz.Light, error)
 	EraseAll()
 	FindById(id string) (*wiz.Light, error)
+	SetName(id string, name string) error
+	SetModel(id string, model string) error
+	MarkSeen(id string, seen time.Time) error
+	FindUnseenSince(cutoff time.Time) ([]wiz.Light, error)
+	Delete(id string) error
 	AddTags(bulbs []wiz.Light, tags []string) ([]wiz.Light, error)
 	RemoveTags(bulbs []wiz.Light, tags []string) ([]wiz.Light, error)
 	FindByTags(tags []string) ([]wiz.Light, error)
+	FindByTagQuery(query TagQuery) ([]wiz.Light, error)
+
+	CreateRoom(room Room) (*Room, error)
+	FindRooms() ([]Room, error)
+	UpdateRoom(room Room) (*Room, error)
+	DeleteRoom(id string) error
+	SetRoom(lightIds []string, roomId string) error
+	FindByRoom(roomId string) ([]wiz.Light, error)
+
+	CreateGroup(group Group) (*Group, error)
+	FindGroups() ([]Group, error)
+	UpdateGroup(group Group) (*Group, error)
+	DeleteGroup(id string) error
+	AddToGroup(lightIds []string, groupId string) error
+	RemoveFromGroup(lightIds []string, groupId string) error
+	FindByGroup(groupId string) ([]wiz.Light, error)
+
+	Export() (*Inventory, error)
+	Import(inventory Inventory, mode ImportMode) error
+	CreateBackup(reason string) (*Backup, error)
+	FindBackups() ([]Backup, error)
+
+	RecordEvent(event Event) (*Event, error)
+	FindEvents(filter EventFilter) ([]Event, error)
+	DeleteEventsBefore(cutoff time.Time) (int, error)
+
+	RecordPowerSample(sample PowerSample) error
+	FindPowerSamples(lightId string, since, until time.Time) ([]PowerSample, error)
+	DeletePowerSamplesBefore(cutoff time.Time) (int, error)
+
+	SaveSnapshot(snapshot Snapshot) (*Snapshot, error)
+	FindSnapshots() ([]Snapshot, error)
+	FindSnapshot(name string) (*Snapshot, error)
+	DeleteSnapshot(name string) error
+
+	CreateAlarm(alarm Alarm) (*Alarm, error)
+	FindAlarms() ([]Alarm, error)
+	UpdateAlarm(alarm Alarm) (*Alarm, error)
+	DeleteAlarm(id string) error
+	MarkAlarmRun(id string, at time.Time) error
+
+	CreateJob(job Job) (*Job, error)
+	FindJobs() ([]Job, error)
+	UpdateJob(job Job) (*Job, error)
+	DeleteJob(id string) error
+	MarkJobRun(id string, at time.Time, lastError string) error
+}
+
+const (
+	DriverSQLite = "sqlite"
+	DriverMySQL  = "mysql"
+	DriverMemory = "memory"
+)
+
+// gormStorage implements Storage on any database gorm supports. The only
+// dialect specific queries, matching a tag inside the JSON tags column, are
+// provided by each backend.
+type gormStorage struct {
+	db   *gorm.DB
+	tags tagDialect
 }
 
 type SQLiteDB struct {
-	db *gorm.DB
+	gormStorage
 }
 
 func NewSQLiteDB(filename string) (*SQLiteDB, error) {
@@ -31,34 +102,104 @@ func NewSQLiteDB(filename string) (*SQLiteDB, error) {
 	if err != nil {
 		return nil, err
 	}
-	db.AutoMigrate(&storedWizLight{})
+	// Commands on many lights run at once; one connection makes their writes
+	// wait for each other rather than fail on a locked database.
+	sqlDb, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDb.SetMaxOpenConns(1)
+	err = migrate(db)
+	if err != nil {
+		return nil, err
+	}
 
-	return &SQLiteDB{db: db}, nil
+	return &SQLiteDB{gormStorage{db: db, tags: tagDialect{hasTag: sqliteHasTag, hasTagLike: sqliteHasTagLike}}}, nil
 }
 
-func (s SQLiteDB) Upsert(bulb wiz.Light) (*wiz.Light, error) {
-	storedWizLight := storedWizLight{
+func sqliteHasTag(tag string) (string, []any) {
+	return "exists (select 1 from json_each(tags) where value = ?)", []any{tag}
+}
+
+// sqliteHasTagLike uses GLOB, which unlike LIKE is case sensitive as exact
+// matches are. Its other special characters are escaped by bracketing them.
+func sqliteHasTagLike(pattern string) (string, []any) {
+	glob := strings.NewReplacer("?", "[?]", "[", "[[]").Replace(pattern)
+	return "exists (select 1 from json_each(tags) where value GLOB ?)", []any{glob}
+}
+
+type MySQLDB struct {
+	gormStorage
+}
+
+// NewMySQLDB connects to MySQL or MariaDB. The DSN must set parseTime=true,
+// as in user:password@tcp(host:3306)/gowizcli?parseTime=true.
+func NewMySQLDB(dsn string) (*MySQLDB, error) {
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	err = migrate(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MySQLDB{gormStorage{db: db, tags: tagDialect{hasTag: mysqlHasTag, hasTagLike: mysqlHasTagLike}}}, nil
+}
+
+func mysqlHasTag(tag string) (string, []any) {
+	return "COALESCE(JSON_CONTAINS(tags, JSON_QUOTE(?)), 0) = 1", []any{tag}
+}
+
+func mysqlHasTagLike(pattern string) (string, []any) {
+	like := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "*", "%").Replace(pattern)
+	return "JSON_SEARCH(tags, 'one', ?) IS NOT NULL", []any{like}
+}
+
+func (s gormStorage) Upsert(bulb wiz.Light) (*wiz.Light, error) {
+	now := time.Now().UTC()
+	toStore := storedWizLight{
 		ID:         bulb.Id,
 		MacAddress: bulb.MacAddress,
 		IpAddress:  bulb.IpAddress,
+		LastSeen:   &now,
 	}
 
-	result := s.db.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "mac_address"}},
-		DoUpdates: clause.AssignmentColumns([]string{"ip_address"}),
-	}).Create(&storedWizLight)
-	if result.Error != nil {
-		return nil, result.Error
+	var stored storedWizLight
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var ipHolders int64
+		err := tx.Model(&storedWizLight{}).
+			Where("ip_address = ? AND mac_address <> ?", bulb.IpAddress, bulb.MacAddress).
+			Count(&ipHolders).Error
+		if err != nil {
+			return err
+		}
+		if ipHolders > 0 {
+			return fmt.Errorf("ip address %s is already used by another light", bulb.IpAddress)
+		}
+
+		err = tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "mac_address"}},
+			DoUpdates: clause.AssignmentColumns([]string{"ip_address", "last_seen"}),
+		}).Create(&toStore).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("mac_address = ?", bulb.MacAddress).First(&stored).Error
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return &wiz.Light{
-		Id:         storedWizLight.ID,
-		MacAddress: storedWizLight.MacAddress,
-		IpAddress:  storedWizLight.IpAddress,
-	}, nil
+	lights, err := s.toLights([]storedWizLight{stored})
+	if err != nil {
+		return nil, err
+	}
+	return &lights[0], nil
 }
 
-func (s SQLiteDB) FindAll() ([]wiz.Light, error) {
+func (s gormStorage) FindAll() ([]wiz.Light, error) {
 	var storedWizLights []storedWizLight
 
 	queryResult := s.db.Find(&storedWizLights)
@@ -66,43 +207,85 @@ func (s SQLiteDB) FindAll() ([]wiz.Light, error) {
 		return nil, queryResult.Error
 	}
 
-	result := make([]wiz.Light, len(storedWizLights))
-	for i, l := range storedWizLights {
-		result[i] = wiz.Light{
-			Id:         l.ID,
-			IpAddress:  l.IpAddress,
-			MacAddress: l.MacAddress,
-			Tags:       l.Tags.Data(),
-		}
-	}
-	return result, nil
+	return s.toLights(storedWizLights)
 }
 
-func (s SQLiteDB) EraseAll() {
-	tableName := "stored_lights"
-	s.db.Exec(fmt.Sprintf("DELETE FROM %s", tableName))
+func (s gormStorage) EraseAll() {
+	for _, tableName := range []string{"light_group_members", "stored_lights"} {
+		s.db.Exec(fmt.Sprintf("DELETE FROM %s", tableName))
+	}
 }
 
-func (s SQLiteDB) FindById(id string) (*wiz.Light, error) {
-	storedWizLight := storedWizLight{ID: id}
+func (s gormStorage) FindById(id string) (*wiz.Light, error) {
+	stored := storedWizLight{ID: id}
 
-	queryResult := s.db.First(&storedWizLight)
+	queryResult := s.db.First(&stored)
 	if queryResult.Error != nil && errors.Is(queryResult.Error, gorm.ErrRecordNotFound) {
-		return nil, fmt.Errorf("id %s not found", id)
+		return nil, fmt.Errorf("id %s %w", id, ErrNotFound)
 	}
 	if queryResult.Error != nil {
 		return nil, queryResult.Error
 	}
 
-	return &wiz.Light{
-		Id:         storedWizLight.ID,
-		IpAddress:  storedWizLight.IpAddress,
-		MacAddress: storedWizLight.MacAddress,
-		Tags:       storedWizLight.Tags.Data(),
-	}, nil
+	lights, err := s.toLights([]storedWizLight{stored})
+	if err != nil {
+		return nil, err
+	}
+	return &lights[0], nil
+}
+
+func (s gormStorage) SetName(id string, name string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := exists(tx, &storedWizLight{}, id, "light"); err != nil {
+			return err
+		}
+		return tx.Model(&storedWizLight{}).Where("id = ?", id).Update("name", name).Error
+	})
+}
+
+func (s gormStorage) SetModel(id string, model string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := exists(tx, &storedWizLight{}, id, "light"); err != nil {
+			return err
+		}
+		return tx.Model(&storedWizLight{}).Where("id = ?", id).Update("model", model).Error
+	})
+}
+
+func (s gormStorage) MarkSeen(id string, seen time.Time) error {
+	seen = seen.UTC()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := exists(tx, &storedWizLight{}, id, "light"); err != nil {
+			return err
+		}
+		return tx.Model(&storedWizLight{}).Where("id = ?", id).Update("last_seen", &seen).Error
+	})
+}
+
+// FindUnseenSince returns the lights last seen before cutoff.
+func (s gormStorage) FindUnseenSince(cutoff time.Time) ([]wiz.Light, error) {
+	var stored []storedWizLight
+	err := s.db.Where("last_seen < ? OR (last_seen IS NULL AND updated_at < ?)", cutoff.UTC(), cutoff.UTC()).Find(&stored).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.toLights(stored)
+}
+
+func (s gormStorage) Delete(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&storedWizLight{ID: id})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("id %s %w", id, ErrNotFound)
+		}
+		return tx.Where("light_id = ?", id).Delete(&storedGroupMember{}).Error
+	})
 }
 
-func (s SQLiteDB) AddTags(bulbs []wiz.Light, tags []string) ([]wiz.Light, error) {
+func (s gormStorage) AddTags(bulbs []wiz.Light, tags []string) ([]wiz.Light, error) {
 	result := make([]wiz.Light, len(bulbs))
 
 	for i, b := range bulbs {
@@ -118,10 +301,13 @@ func (s SQLiteDB) AddTags(bulbs []wiz.Light, tags []string) ([]wiz.Light, error)
 
 		result[i] = wiz.Light{
 			Id:         b.Id,
+			Name:       b.Name,
 			IpAddress:  b.IpAddress,
 			MacAddress: b.MacAddress,
 			IsOn:       b.IsOn,
 			Tags:       newTags,
+			Room:       b.Room,
+			Groups:     b.Groups,
 		}
 	}
 
@@ -145,7 +331,7 @@ func add(source []string, toAdd []string) []string {
 	return result
 }
 
-func (s SQLiteDB) RemoveTags(bulbs []wiz.Light, tags []string) ([]wiz.Light, error) {
+func (s gormStorage) RemoveTags(bulbs []wiz.Light, tags []string) ([]wiz.Light, error) {
 	result := make([]wiz.Light, len(bulbs))
 
 	for i, b := range bulbs {
@@ -161,10 +347,13 @@ func (s SQLiteDB) RemoveTags(bulbs []wiz.Light, tags []string) ([]wiz.Light, err
 
 		result[i] = wiz.Light{
 			Id:         b.Id,
+			Name:       b.Name,
 			IpAddress:  b.IpAddress,
 			MacAddress: b.MacAddress,
 			IsOn:       b.IsOn,
 			Tags:       newTags,
+			Room:       b.Room,
+			Groups:     b.Groups,
 		}
 	}
 
@@ -186,37 +375,30 @@ func filter(source []string, toRemove []string) []string {
 	return result
 }
 
-func (s SQLiteDB) FindByTags(tags []string) ([]wiz.Light, error) {
-	var storedWizLights []storedWizLight
+func (s gormStorage) FindByTags(tags []string) ([]wiz.Light, error) {
+	return s.FindByTagQuery(AllTags(tags))
+}
 
-	tx := s.db.Model(&storedWizLight{})
-	for _, t := range tags {
-		tx = tx.Where("exists (select 1 from json_each(tags) where value = ?)", t)
-	}
+func (s gormStorage) FindByTagQuery(query TagQuery) ([]wiz.Light, error) {
+	var storedWizLights []storedWizLight
 
-	if err := tx.Find(&storedWizLights).Error; err != nil {
+	where, args := query.where(s.tags)
+	if err := s.db.Where(where, args...).Find(&storedWizLights).Error; err != nil {
 		return nil, err
 	}
 
-	result := make([]wiz.Light, len(storedWizLights))
-	for i, s := range storedWizLights {
-		result[i] = wiz.Light{
-			Id:         s.ID,
-			IpAddress:  s.IpAddress,
-			MacAddress: s.MacAddress,
-			Tags:       s.Tags.Data(),
-		}
-	}
-
-	return result, nil
+	return s.toLights(storedWizLights)
 }
 
 type storedWizLight struct {
-	gorm.Model
-	ID         string
-	MacAddress string `gorm:"uniqueIndex"`
-	IpAddress  string `gorm:"uniqueIndex"`
+	ID         string `gorm:"primaryKey;size:64"`
+	Name       string `gorm:"size:128"`
+	Model      string `gorm:"size:64"`
+	MacAddress string `gorm:"uniqueIndex;size:32"`
+	IpAddress  string `gorm:"uniqueIndex;size:64"`
 	Tags       datatypes.JSONType[[]string]
+	RoomID     *string    `gorm:"index;size:64"`
+	LastSeen   *time.Time `gorm:"index"`
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
 }
@@ -224,3 +406,19 @@ type storedWizLight struct {
 func (storedWizLight) TableName() string {
 	return "stored_lights"
 }
+
+// lastSeen falls back to the last update for lights stored before last seen
+// times were recorded.
+func (l storedWizLight) lastSeen() time.Time {
+	if l.LastSeen == nil {
+		return l.UpdatedAt
+	}
+	return *l.LastSeen
+}
+
+func (l storedWizLight) room() string {
+	if l.RoomID == nil {
+		return ""
+	}
+	return *l.RoomID
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// Event is an entry of the event log: a command issued through the client,
+// or a change in the state of a light noticed by asking it. Events are only
+// ever appended, and removed once older than the retention.
+type Event struct {
+	Id      uint64
+	Time    time.Time
+	Source  string
+	Command string
+	// LightId is empty for commands not aimed at a single light.
+	LightId string
+	Params  map[string]string
+	// IsOn is the state the light was left in, when the event tells it,
+	// along with its dimming, 0 when unknown, and the watts it measured, for
+	// devices that measure them.
+	IsOn    *bool
+	Dimming int
+	Watts   *float64
+	// Error is empty when the command succeeded.
+	Error   string
+	Latency time.Duration
+}
+
+// Sources of the events, telling who issued a command.
+const (
+	SourceCLI        = "cli"
+	SourceTUI        = "tui"
+	SourceAutomation = "automation"
+	SourceDaemon     = "daemon"
+	SourceAPI        = "api"
+)
+
+// EventFilter narrows down the events looked up. Zero fields do not filter.
+type EventFilter struct {
+	LightId string
+	// Since is inclusive and Until exclusive.
+	Since time.Time
+	Until time.Time
+	// WithState keeps only the events that tell the state of the light.
+	WithState bool
+	// Limit keeps the latest events only.
+	Limit int
+}
+
+func (f EventFilter) matches(e Event) bool {
+	return (f.LightId == "" || e.LightId == f.LightId) &&
+		(f.Since.IsZero() || !e.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || e.Time.Before(f.Until)) &&
+		(!f.WithState || e.IsOn != nil)
+}
+
+func (s gormStorage) RecordEvent(event Event) (*Event, error) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Time = event.Time.UTC()
+
+	stored := storedEvent{
+		OccurredAt: event.Time,
+		Source:     event.Source,
+		Command:    event.Command,
+		LightID:    event.LightId,
+		Params:     datatypes.NewJSONType(event.Params),
+		IsOn:       event.IsOn,
+		Dimming:    event.Dimming,
+		Watts:      event.Watts,
+		Error:      event.Error,
+		Latency:    event.Latency,
+	}
+	if err := s.db.Create(&stored).Error; err != nil {
+		return nil, err
+	}
+	event.Id = stored.ID
+	return &event, nil
+}
+
+// FindEvents returns the events matching the filter, oldest first.
+func (s gormStorage) FindEvents(filter EventFilter) ([]Event, error) {
+	query := s.db.Model(&storedEvent{})
+	if filter.LightId != "" {
+		query = query.Where("light_id = ?", filter.LightId)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("occurred_at >= ?", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("occurred_at < ?", filter.Until.UTC())
+	}
+	if filter.WithState {
+		query = query.Where("is_on IS NOT NULL")
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	var stored []storedEvent
+	if err := query.Order("occurred_at DESC, id DESC").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]Event, len(stored))
+	for i, e := range stored {
+		result[len(stored)-1-i] = e.toEvent()
+	}
+	return result, nil
+}
+
+// DeleteEventsBefore removes the events older than cutoff and returns how
+// many were removed. The latest state of each light is kept, as the state it
+// stayed in from then on.
+func (s gormStorage) DeleteEventsBefore(cutoff time.Time) (int, error) {
+	later := s.db.Table("events AS later").Select("1").
+		Where("later.light_id = events.light_id AND later.is_on IS NOT NULL AND later.occurred_at < ?", cutoff.UTC()).
+		Where("later.occurred_at > events.occurred_at OR (later.occurred_at = events.occurred_at AND later.id > events.id)")
+	var latest []uint64
+	err := s.db.Model(&storedEvent{}).
+		Where("occurred_at < ? AND is_on IS NOT NULL AND light_id <> ''", cutoff.UTC()).
+		Where("NOT EXISTS (?)", later).
+		Pluck("id", &latest).Error
+	if err != nil {
+		return 0, err
+	}
+
+	query := s.db.Where("occurred_at < ?", cutoff.UTC())
+	if len(latest) > 0 {
+		query = query.Where("id NOT IN ?", latest)
+	}
+	result := query.Delete(&storedEvent{})
+	return int(result.RowsAffected), result.Error
+}
+
+type storedEvent struct {
+	ID         uint64    `gorm:"primaryKey;autoIncrement"`
+	OccurredAt time.Time `gorm:"index;index:idx_events_light_occurred_at,priority:2"`
+	Source     string    `gorm:"size:32"`
+	Command    string    `gorm:"size:64"`
+	LightID    string    `gorm:"size:64;index:idx_events_light_occurred_at,priority:1"`
+	Params     datatypes.JSONType[map[string]string]
+	IsOn       *bool
+	Dimming    int
+	Watts      *float64
+	Error      string `gorm:"type:text"`
+	Latency    time.Duration
+}
+
+func (storedEvent) TableName() string {
+	return "events"
+}
+
+func (e storedEvent) toEvent() Event {
+	return Event{
+		Id:      e.ID,
+		Time:    e.OccurredAt,
+		Source:  e.Source,
+		Command: e.Command,
+		LightId: e.LightID,
+		Params:  e.Params.Data(),
+		IsOn:    e.IsOn,
+		Dimming: e.Dimming,
+		Watts:   e.Watts,
+		Error:   e.Error,
+		Latency: e.Latency,
+	}
+}
@@ -0,0 +1,305 @@
+package db
+
+import (
+	"fmt"
+	"gowizcli/wiz"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Inventory is everything the storage knows about the lights, in a form that
+// can be exported to a file and imported on another machine.
+type Inventory struct {
+	Version    int              `json:"version" yaml:"version"`
+	ExportedAt time.Time        `json:"exportedAt" yaml:"exportedAt"`
+	Rooms      []InventoryRoom  `json:"rooms" yaml:"rooms"`
+	Groups     []InventoryGroup `json:"groups" yaml:"groups"`
+	Lights     []InventoryLight `json:"lights" yaml:"lights"`
+}
+
+type InventoryRoom struct {
+	Id    string `json:"id" yaml:"id"`
+	Name  string `json:"name" yaml:"name"`
+	Floor int    `json:"floor" yaml:"floor"`
+	Zone  string `json:"zone,omitempty" yaml:"zone,omitempty"`
+}
+
+type InventoryGroup struct {
+	Id   string `json:"id" yaml:"id"`
+	Name string `json:"name" yaml:"name"`
+}
+
+// InventoryLight refers to its room and groups by their ids in the same
+// inventory.
+type InventoryLight struct {
+	Id         string     `json:"id" yaml:"id"`
+	Name       string     `json:"name,omitempty" yaml:"name,omitempty"`
+	Model      string     `json:"model,omitempty" yaml:"model,omitempty"`
+	MacAddress string     `json:"macAddress" yaml:"macAddress"`
+	IpAddress  string     `json:"ipAddress" yaml:"ipAddress"`
+	Tags       []string   `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Room       string     `json:"room,omitempty" yaml:"room,omitempty"`
+	Groups     []string   `json:"groups,omitempty" yaml:"groups,omitempty"`
+	LastSeen   *time.Time `json:"lastSeen,omitempty" yaml:"lastSeen,omitempty"`
+}
+
+const InventoryVersion = 1
+
+type ImportMode string
+
+const (
+	// ImportMerge adds the imported rooms, groups and lights, replacing the
+	// existing ones with the same name, for rooms and groups, or MAC address,
+	// for lights. Everything else is kept.
+	ImportMerge ImportMode = "merge"
+	// ImportReplace removes every room, group and light before importing.
+	ImportReplace ImportMode = "replace"
+)
+
+// Backup is an inventory saved by the storage itself, before a destructive
+// operation.
+type Backup struct {
+	Id        string
+	CreatedAt time.Time
+	Reason    string
+	Inventory Inventory
+}
+
+// MaxBackups is how many backups are kept; older ones are removed as new ones
+// are taken.
+const MaxBackups = 10
+
+func exportInventory(s Storage) (*Inventory, error) {
+	rooms, err := s.FindRooms()
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.FindGroups()
+	if err != nil {
+		return nil, err
+	}
+	lights, err := s.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := Inventory{
+		Version:    InventoryVersion,
+		ExportedAt: time.Now().UTC(),
+		Rooms:      make([]InventoryRoom, len(rooms)),
+		Groups:     make([]InventoryGroup, len(groups)),
+		Lights:     make([]InventoryLight, len(lights)),
+	}
+	for i, r := range rooms {
+		inventory.Rooms[i] = InventoryRoom{Id: r.Id, Name: r.Name, Floor: r.Floor, Zone: r.Zone}
+	}
+	for i, g := range groups {
+		inventory.Groups[i] = InventoryGroup{Id: g.Id, Name: g.Name}
+	}
+	for i, l := range lights {
+		inventory.Lights[i] = InventoryLight{
+			Id:         l.Id,
+			Name:       l.Name,
+			Model:      l.Model,
+			MacAddress: l.MacAddress,
+			IpAddress:  l.IpAddress,
+			Tags:       l.Tags,
+			Room:       l.Room,
+			Groups:     l.Groups,
+			LastSeen:   &l.LastSeen,
+		}
+	}
+	return &inventory, nil
+}
+
+// importInventory applies an inventory through the Storage methods. Callers
+// make it atomic: gorm backends run it in a transaction and the memory
+// backend restores its previous state on failure.
+func importInventory(s Storage, inventory Inventory, mode ImportMode) error {
+	if inventory.Version != InventoryVersion {
+		return fmt.Errorf("unsupported inventory version %d", inventory.Version)
+	}
+
+	switch mode {
+	case ImportReplace:
+		if err := removeAll(s); err != nil {
+			return err
+		}
+	case ImportMerge:
+	default:
+		return fmt.Errorf("unknown import mode %q", mode)
+	}
+
+	roomIds, err := importRooms(s, inventory.Rooms)
+	if err != nil {
+		return err
+	}
+	groupIds, err := importGroups(s, inventory.Groups)
+	if err != nil {
+		return err
+	}
+
+	existing, err := s.FindAll()
+	if err != nil {
+		return err
+	}
+	for _, l := range inventory.Lights {
+		if err := importLight(s, l, existing, roomIds, groupIds); err != nil {
+			return fmt.Errorf("light %s (%s): %w", l.Id, l.MacAddress, err)
+		}
+	}
+	return nil
+}
+
+func removeAll(s Storage) error {
+	s.EraseAll()
+
+	rooms, err := s.FindRooms()
+	if err != nil {
+		return err
+	}
+	for _, r := range rooms {
+		if err := s.DeleteRoom(r.Id); err != nil {
+			return err
+		}
+	}
+
+	groups, err := s.FindGroups()
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if err := s.DeleteGroup(g.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importRooms creates or updates the rooms by name and maps the ids in the
+// inventory to the stored ones.
+func importRooms(s Storage, rooms []InventoryRoom) (map[string]string, error) {
+	existing, err := s.FindRooms()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]string, len(rooms))
+	for _, r := range rooms {
+		room := Room{Id: r.Id, Name: r.Name, Floor: r.Floor, Zone: r.Zone}
+
+		if i := slices.IndexFunc(existing, func(e Room) bool { return e.Name == r.Name }); i >= 0 {
+			room.Id = existing[i].Id
+			if _, err := s.UpdateRoom(room); err != nil {
+				return nil, err
+			}
+		} else {
+			if slices.ContainsFunc(existing, func(e Room) bool { return e.Id == r.Id }) {
+				room.Id = ""
+			}
+			created, err := s.CreateRoom(room)
+			if err != nil {
+				return nil, err
+			}
+			room.Id = created.Id
+			existing = append(existing, *created)
+		}
+		ids[r.Id] = room.Id
+	}
+	return ids, nil
+}
+
+func importGroups(s Storage, groups []InventoryGroup) (map[string]string, error) {
+	existing, err := s.FindGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]string, len(groups))
+	for _, g := range groups {
+		group := Group{Id: g.Id, Name: g.Name}
+
+		if i := slices.IndexFunc(existing, func(e Group) bool { return e.Name == g.Name }); i >= 0 {
+			group.Id = existing[i].Id
+		} else {
+			if slices.ContainsFunc(existing, func(e Group) bool { return e.Id == g.Id }) {
+				group.Id = ""
+			}
+			created, err := s.CreateGroup(group)
+			if err != nil {
+				return nil, err
+			}
+			group.Id = created.Id
+			existing = append(existing, *created)
+		}
+		ids[g.Id] = group.Id
+	}
+	return ids, nil
+}
+
+// importLight upserts a light by MAC address and makes its name, tags, room
+// and groups those of the inventory.
+func importLight(s Storage, l InventoryLight, existing []wiz.Light, roomIds, groupIds map[string]string) error {
+	id := l.Id
+	if id == "" || slices.ContainsFunc(existing, func(e wiz.Light) bool { return e.Id == id && e.MacAddress != l.MacAddress }) {
+		id = uuid.NewString()
+	}
+
+	stored, err := s.Upsert(wiz.Light{Id: id, MacAddress: l.MacAddress, IpAddress: l.IpAddress})
+	if err != nil {
+		return err
+	}
+	if err := s.SetName(stored.Id, l.Name); err != nil {
+		return err
+	}
+	if err := s.SetModel(stored.Id, l.Model); err != nil {
+		return err
+	}
+	if l.LastSeen != nil {
+		if err := s.MarkSeen(stored.Id, *l.LastSeen); err != nil {
+			return err
+		}
+	}
+
+	untagged, err := s.RemoveTags([]wiz.Light{*stored}, stored.Tags)
+	if err != nil {
+		return err
+	}
+	if _, err := s.AddTags(untagged, l.Tags); err != nil {
+		return err
+	}
+
+	roomId := ""
+	if l.Room != "" {
+		var ok bool
+		if roomId, ok = roomIds[l.Room]; !ok {
+			return fmt.Errorf("room %s is not in the inventory", l.Room)
+		}
+	}
+	if err := s.SetRoom([]string{stored.Id}, roomId); err != nil {
+		return err
+	}
+
+	wanted := make([]string, len(l.Groups))
+	for i, g := range l.Groups {
+		var ok bool
+		if wanted[i], ok = groupIds[g]; !ok {
+			return fmt.Errorf("group %s is not in the inventory", g)
+		}
+	}
+	for _, g := range stored.Groups {
+		if !slices.Contains(wanted, g) {
+			if err := s.RemoveFromGroup([]string{stored.Id}, g); err != nil {
+				return err
+			}
+		}
+	}
+	for _, g := range wanted {
+		if err := s.AddToGroup([]string{stored.Id}, g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Job runs a light command on the lights it selects whenever its schedule is
+// due. Schedule is kept as written, to be parsed by the client, and TimeZone
+// is the IANA zone it is read in, the local one when empty.
+type Job struct {
+	Id       string
+	Name     string
+	Schedule string
+	TimeZone string
+	// Command is on, off, daylight or snapshot, the latter applying the
+	// snapshot named by Argument rather than the selected lights.
+	Command    string
+	Argument   string
+	Lights     LightSelection
+	Transition time.Duration
+	// CatchUp runs a job once when the scheduler finds it missed runs, as
+	// when it was not running; otherwise missed runs are skipped.
+	CatchUp bool
+	Enabled bool
+	// LastRun is when the job last ran, and LastError how it failed then,
+	// empty when it succeeded.
+	LastRun   time.Time
+	LastError string
+}
+
+func (s gormStorage) CreateJob(job Job) (*Job, error) {
+	if job.Id == "" {
+		job.Id = uuid.NewString()
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := nameTaken(tx, &storedJob{}, job.Name, job.Id); err != nil {
+			return err
+		}
+		return tx.Create(toStoredJob(job)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s gormStorage) FindJobs() ([]Job, error) {
+	var stored []storedJob
+	if err := s.db.Order("name").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]Job, len(stored))
+	for i, j := range stored {
+		result[i] = j.toJob()
+	}
+	return result, nil
+}
+
+// UpdateJob replaces a job but for its last run.
+func (s gormStorage) UpdateJob(job Job) (*Job, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := nameTaken(tx, &storedJob{}, job.Name, job.Id); err != nil {
+			return err
+		}
+		if err := exists(tx, &storedJob{}, job.Id, "job"); err != nil {
+			return err
+		}
+		return tx.Model(&storedJob{ID: job.Id}).
+			Select("name", "schedule", "time_zone", "command", "argument", "lights", "transition", "catch_up", "enabled").
+			Updates(toStoredJob(job)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s gormStorage) DeleteJob(id string) error {
+	result := s.db.Delete(&storedJob{ID: id})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("job %s %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+func (s gormStorage) MarkJobRun(id string, at time.Time, lastError string) error {
+	result := s.db.Model(&storedJob{ID: id}).Updates(map[string]any{"last_run": at.UTC(), "last_error": lastError})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("job %s %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+type storedJob struct {
+	ID         string `gorm:"primaryKey;size:64"`
+	Name       string `gorm:"uniqueIndex;size:128"`
+	Schedule   string `gorm:"size:255"`
+	TimeZone   string `gorm:"size:64"`
+	Command    string `gorm:"size:64"`
+	Argument   string `gorm:"size:255"`
+	Lights     datatypes.JSONType[LightSelection]
+	Transition time.Duration
+	CatchUp    bool
+	Enabled    bool
+	LastRun    *time.Time
+	LastError  string `gorm:"type:text"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (storedJob) TableName() string {
+	return "jobs"
+}
+
+func toStoredJob(j Job) *storedJob {
+	stored := &storedJob{
+		ID:         j.Id,
+		Name:       j.Name,
+		Schedule:   j.Schedule,
+		TimeZone:   j.TimeZone,
+		Command:    j.Command,
+		Argument:   j.Argument,
+		Lights:     datatypes.NewJSONType(j.Lights),
+		Transition: j.Transition,
+		CatchUp:    j.CatchUp,
+		Enabled:    j.Enabled,
+		LastError:  j.LastError,
+	}
+	if !j.LastRun.IsZero() {
+		lastRun := j.LastRun.UTC()
+		stored.LastRun = &lastRun
+	}
+	return stored
+}
+
+func (j storedJob) toJob() Job {
+	job := Job{
+		Id:         j.ID,
+		Name:       j.Name,
+		Schedule:   j.Schedule,
+		TimeZone:   j.TimeZone,
+		Command:    j.Command,
+		Argument:   j.Argument,
+		Lights:     j.Lights.Data(),
+		Transition: j.Transition,
+		CatchUp:    j.CatchUp,
+		Enabled:    j.Enabled,
+		LastError:  j.LastError,
+	}
+	if j.LastRun != nil {
+		job.LastRun = *j.LastRun
+	}
+	return job
+}
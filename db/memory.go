@@ -0,0 +1,793 @@
+package db
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"gowizcli/wiz"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryDB is a Storage kept in memory, for tests and for running without a
+// database file.
+type MemoryDB struct {
+	mu      sync.Mutex
+	lights  []wiz.Light
+	rooms   []Room
+	groups  []Group
+	backups []Backup
+	events  []Event
+	power   []PowerSample
+	snaps   []Snapshot
+	alarms  []Alarm
+	jobs    []Job
+
+	lastEventId uint64
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{}
+}
+
+func (m *MemoryDB) Upsert(bulb wiz.Light) (*wiz.Light, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, l := range m.lights {
+		if l.IpAddress == bulb.IpAddress && l.MacAddress != bulb.MacAddress {
+			return nil, fmt.Errorf("ip address %s is already used by another light", bulb.IpAddress)
+		}
+	}
+
+	now := time.Now().UTC()
+	if i := m.indexOf(func(l wiz.Light) bool { return l.MacAddress == bulb.MacAddress }); i >= 0 {
+		m.lights[i].IpAddress = bulb.IpAddress
+		m.lights[i].LastSeen = now
+		return copyLight(m.lights[i]), nil
+	}
+
+	stored := wiz.Light{
+		Id:         bulb.Id,
+		MacAddress: bulb.MacAddress,
+		IpAddress:  bulb.IpAddress,
+		Tags:       []string{},
+		LastSeen:   now,
+	}
+	m.lights = append(m.lights, stored)
+	return copyLight(stored), nil
+}
+
+func (m *MemoryDB) FindAll() ([]wiz.Light, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]wiz.Light, len(m.lights))
+	for i, l := range m.lights {
+		result[i] = *copyLight(l)
+	}
+	return result, nil
+}
+
+func (m *MemoryDB) EraseAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lights = nil
+}
+
+func (m *MemoryDB) FindById(id string) (*wiz.Light, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOf(func(l wiz.Light) bool { return l.Id == id })
+	if i < 0 {
+		return nil, fmt.Errorf("id %s %w", id, ErrNotFound)
+	}
+	return copyLight(m.lights[i]), nil
+}
+
+func (m *MemoryDB) SetName(id string, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOf(func(l wiz.Light) bool { return l.Id == id })
+	if i < 0 {
+		return fmt.Errorf("light %s %w", id, ErrNotFound)
+	}
+	m.lights[i].Name = name
+	return nil
+}
+
+func (m *MemoryDB) SetModel(id string, model string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOf(func(l wiz.Light) bool { return l.Id == id })
+	if i < 0 {
+		return fmt.Errorf("light %s %w", id, ErrNotFound)
+	}
+	m.lights[i].Model = model
+	return nil
+}
+
+func (m *MemoryDB) MarkSeen(id string, seen time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOf(func(l wiz.Light) bool { return l.Id == id })
+	if i < 0 {
+		return fmt.Errorf("light %s %w", id, ErrNotFound)
+	}
+	m.lights[i].LastSeen = seen.UTC()
+	return nil
+}
+
+func (m *MemoryDB) FindUnseenSince(cutoff time.Time) ([]wiz.Light, error) {
+	return m.findLights(func(l wiz.Light) bool { return l.LastSeen.Before(cutoff) }), nil
+}
+
+func (m *MemoryDB) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.indexOf(func(l wiz.Light) bool { return l.Id == id })
+	if i < 0 {
+		return fmt.Errorf("id %s %w", id, ErrNotFound)
+	}
+	m.lights = slices.Delete(m.lights, i, i+1)
+	return nil
+}
+
+func (m *MemoryDB) AddTags(bulbs []wiz.Light, tags []string) ([]wiz.Light, error) {
+	return m.updateTags(bulbs, func(existing []string) []string { return add(existing, tags) })
+}
+
+func (m *MemoryDB) RemoveTags(bulbs []wiz.Light, tags []string) ([]wiz.Light, error) {
+	return m.updateTags(bulbs, func(existing []string) []string { return filter(existing, tags) })
+}
+
+func (m *MemoryDB) updateTags(bulbs []wiz.Light, update func([]string) []string) ([]wiz.Light, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]wiz.Light, len(bulbs))
+	for i, b := range bulbs {
+		newTags := update(b.Tags)
+
+		if j := m.indexOf(func(l wiz.Light) bool { return l.Id == b.Id }); j >= 0 {
+			m.lights[j].Tags = slices.Clone(newTags)
+		}
+
+		result[i] = wiz.Light{
+			Id:         b.Id,
+			Name:       b.Name,
+			IpAddress:  b.IpAddress,
+			MacAddress: b.MacAddress,
+			IsOn:       b.IsOn,
+			Tags:       newTags,
+			Room:       b.Room,
+			Groups:     b.Groups,
+		}
+	}
+	return result, nil
+}
+
+func (m *MemoryDB) FindByTags(tags []string) ([]wiz.Light, error) {
+	return m.FindByTagQuery(AllTags(tags))
+}
+
+func (m *MemoryDB) FindByTagQuery(query TagQuery) ([]wiz.Light, error) {
+	return m.findLights(func(l wiz.Light) bool { return query.Matches(l.Tags) }), nil
+}
+
+func (m *MemoryDB) indexOf(match func(wiz.Light) bool) int {
+	return slices.IndexFunc(m.lights, match)
+}
+
+func copyLight(l wiz.Light) *wiz.Light {
+	return &wiz.Light{
+		Id:         l.Id,
+		Name:       l.Name,
+		Model:      l.Model,
+		MacAddress: l.MacAddress,
+		IpAddress:  l.IpAddress,
+		Tags:       slices.Clone(l.Tags),
+		Room:       l.Room,
+		Groups:     slices.Clone(l.Groups),
+		LastSeen:   l.LastSeen,
+	}
+}
+
+func (m *MemoryDB) CreateRoom(room Room) (*Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if room.Id == "" {
+		room.Id = uuid.NewString()
+	}
+	if err := m.roomNameTaken(room); err != nil {
+		return nil, err
+	}
+	m.rooms = append(m.rooms, room)
+	return &room, nil
+}
+
+func (m *MemoryDB) FindRooms() ([]Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := slices.Clone(m.rooms)
+	slices.SortFunc(result, func(a, b Room) int {
+		return cmp.Or(cmp.Compare(a.Floor, b.Floor), cmp.Compare(a.Name, b.Name))
+	})
+	return result, nil
+}
+
+func (m *MemoryDB) UpdateRoom(room Room) (*Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.roomNameTaken(room); err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(m.rooms, func(r Room) bool { return r.Id == room.Id })
+	if i < 0 {
+		return nil, fmt.Errorf("room %s %w", room.Id, ErrNotFound)
+	}
+	m.rooms[i] = room
+	return &room, nil
+}
+
+func (m *MemoryDB) DeleteRoom(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.rooms, func(r Room) bool { return r.Id == id })
+	if i < 0 {
+		return fmt.Errorf("room %s %w", id, ErrNotFound)
+	}
+	m.rooms = slices.Delete(m.rooms, i, i+1)
+	for j := range m.lights {
+		if m.lights[j].Room == id {
+			m.lights[j].Room = ""
+		}
+	}
+	return nil
+}
+
+func (m *MemoryDB) SetRoom(lightIds []string, roomId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if roomId != "" && !slices.ContainsFunc(m.rooms, func(r Room) bool { return r.Id == roomId }) {
+		return fmt.Errorf("room %s %w", roomId, ErrNotFound)
+	}
+	indexes, err := m.indexesOf(lightIds)
+	if err != nil {
+		return err
+	}
+	for _, i := range indexes {
+		m.lights[i].Room = roomId
+	}
+	return nil
+}
+
+func (m *MemoryDB) FindByRoom(roomId string) ([]wiz.Light, error) {
+	return m.findLights(func(l wiz.Light) bool { return l.Room == roomId }), nil
+}
+
+func (m *MemoryDB) CreateGroup(group Group) (*Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if group.Id == "" {
+		group.Id = uuid.NewString()
+	}
+	if err := m.groupNameTaken(group); err != nil {
+		return nil, err
+	}
+	m.groups = append(m.groups, group)
+	return &group, nil
+}
+
+func (m *MemoryDB) FindGroups() ([]Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := slices.Clone(m.groups)
+	slices.SortFunc(result, func(a, b Group) int { return cmp.Compare(a.Name, b.Name) })
+	return result, nil
+}
+
+func (m *MemoryDB) UpdateGroup(group Group) (*Group, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.groupNameTaken(group); err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(m.groups, func(g Group) bool { return g.Id == group.Id })
+	if i < 0 {
+		return nil, fmt.Errorf("group %s %w", group.Id, ErrNotFound)
+	}
+	m.groups[i] = group
+	return &group, nil
+}
+
+func (m *MemoryDB) DeleteGroup(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.groups, func(g Group) bool { return g.Id == id })
+	if i < 0 {
+		return fmt.Errorf("group %s %w", id, ErrNotFound)
+	}
+	m.groups = slices.Delete(m.groups, i, i+1)
+	for j := range m.lights {
+		m.lights[j].Groups = filter(m.lights[j].Groups, []string{id})
+	}
+	return nil
+}
+
+func (m *MemoryDB) AddToGroup(lightIds []string, groupId string) error {
+	return m.updateGroups(lightIds, groupId, func(existing []string) []string {
+		result := add(existing, []string{groupId})
+		slices.Sort(result)
+		return result
+	})
+}
+
+func (m *MemoryDB) RemoveFromGroup(lightIds []string, groupId string) error {
+	return m.updateGroups(lightIds, groupId, func(existing []string) []string {
+		return filter(existing, []string{groupId})
+	})
+}
+
+func (m *MemoryDB) updateGroups(lightIds []string, groupId string, update func([]string) []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.ContainsFunc(m.groups, func(g Group) bool { return g.Id == groupId }) {
+		return fmt.Errorf("group %s %w", groupId, ErrNotFound)
+	}
+	indexes, err := m.indexesOf(lightIds)
+	if err != nil {
+		return err
+	}
+	for _, i := range indexes {
+		m.lights[i].Groups = update(m.lights[i].Groups)
+	}
+	return nil
+}
+
+func (m *MemoryDB) FindByGroup(groupId string) ([]wiz.Light, error) {
+	return m.findLights(func(l wiz.Light) bool { return slices.Contains(l.Groups, groupId) }), nil
+}
+
+func (m *MemoryDB) findLights(match func(wiz.Light) bool) []wiz.Light {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]wiz.Light, 0)
+	for _, l := range m.lights {
+		if match(l) {
+			result = append(result, *copyLight(l))
+		}
+	}
+	return result
+}
+
+// indexesOf resolves every light id before anything is changed, so an unknown
+// id leaves the storage untouched.
+func (m *MemoryDB) indexesOf(lightIds []string) ([]int, error) {
+	result := make([]int, len(lightIds))
+	for i, id := range lightIds {
+		result[i] = m.indexOf(func(l wiz.Light) bool { return l.Id == id })
+		if result[i] < 0 {
+			return nil, fmt.Errorf("light %s %w", id, ErrNotFound)
+		}
+	}
+	return result, nil
+}
+
+func (m *MemoryDB) roomNameTaken(room Room) error {
+	if room.Name == "" {
+		return errors.New("name must not be empty")
+	}
+	if slices.ContainsFunc(m.rooms, func(r Room) bool { return r.Name == room.Name && r.Id != room.Id }) {
+		return fmt.Errorf("name %s is already used", room.Name)
+	}
+	return nil
+}
+
+func (m *MemoryDB) groupNameTaken(group Group) error {
+	if group.Name == "" {
+		return errors.New("name must not be empty")
+	}
+	if slices.ContainsFunc(m.groups, func(g Group) bool { return g.Name == group.Name && g.Id != group.Id }) {
+		return fmt.Errorf("name %s is already used", group.Name)
+	}
+	return nil
+}
+
+func (m *MemoryDB) Export() (*Inventory, error) {
+	return exportInventory(m)
+}
+
+// Import restores the previous state when the import fails. It is not
+// isolated from concurrent changes.
+func (m *MemoryDB) Import(inventory Inventory, mode ImportMode) error {
+	m.mu.Lock()
+	lights, rooms, groups := m.copyState()
+	m.mu.Unlock()
+
+	err := importInventory(m, inventory, mode)
+	if err != nil {
+		m.mu.Lock()
+		m.lights, m.rooms, m.groups = lights, rooms, groups
+		m.mu.Unlock()
+	}
+	return err
+}
+
+func (m *MemoryDB) copyState() ([]wiz.Light, []Room, []Group) {
+	lights := make([]wiz.Light, len(m.lights))
+	for i, l := range m.lights {
+		lights[i] = *copyLight(l)
+	}
+	return lights, slices.Clone(m.rooms), slices.Clone(m.groups)
+}
+
+func (m *MemoryDB) CreateBackup(reason string) (*Backup, error) {
+	inventory, err := exportInventory(m)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	backup := Backup{
+		Id:        uuid.NewString(),
+		CreatedAt: time.Now().UTC(),
+		Reason:    reason,
+		Inventory: *inventory,
+	}
+	m.backups = append([]Backup{backup}, m.backups...)
+	if len(m.backups) > MaxBackups {
+		m.backups = m.backups[:MaxBackups]
+	}
+	return &backup, nil
+}
+
+func (m *MemoryDB) FindBackups() ([]Backup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return slices.Clone(m.backups), nil
+}
+
+func (m *MemoryDB) RecordEvent(event Event) (*Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Time = event.Time.UTC()
+	m.lastEventId++
+	event.Id = m.lastEventId
+	m.events = append(m.events, copyEvent(event))
+	return &event, nil
+}
+
+func (m *MemoryDB) FindEvents(filter EventFilter) ([]Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []Event
+	for _, e := range m.events {
+		if filter.matches(e) {
+			result = append(result, copyEvent(e))
+		}
+	}
+	slices.SortStableFunc(result, func(a, b Event) int { return a.Time.Compare(b.Time) })
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[len(result)-filter.Limit:]
+	}
+	return result, nil
+}
+
+func (m *MemoryDB) DeleteEventsBefore(cutoff time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	latest := map[string]Event{}
+	for _, e := range m.events {
+		if e.LightId == "" || e.IsOn == nil || !e.Time.Before(cutoff) {
+			continue
+		}
+		if l, ok := latest[e.LightId]; !ok || e.Time.After(l.Time) || (e.Time.Equal(l.Time) && e.Id > l.Id) {
+			latest[e.LightId] = e
+		}
+	}
+
+	before := len(m.events)
+	m.events = slices.DeleteFunc(m.events, func(e Event) bool {
+		return e.Time.Before(cutoff) && latest[e.LightId].Id != e.Id
+	})
+	return before - len(m.events), nil
+}
+
+func copyEvent(e Event) Event {
+	if e.Params != nil {
+		params := make(map[string]string, len(e.Params))
+		for k, v := range e.Params {
+			params[k] = v
+		}
+		e.Params = params
+	}
+	if e.IsOn != nil {
+		isOn := *e.IsOn
+		e.IsOn = &isOn
+	}
+	if e.Watts != nil {
+		watts := *e.Watts
+		e.Watts = &watts
+	}
+	return e
+}
+
+func (m *MemoryDB) RecordPowerSample(sample PowerSample) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sample.Time = sample.Time.UTC()
+	m.power = append(m.power, sample)
+	return nil
+}
+
+func (m *MemoryDB) FindPowerSamples(lightId string, since, until time.Time) ([]PowerSample, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []PowerSample
+	for _, p := range m.power {
+		if p.LightId == lightId && !p.Time.Before(since) && p.Time.Before(until) {
+			result = append(result, p)
+		}
+	}
+	slices.SortStableFunc(result, func(a, b PowerSample) int { return a.Time.Compare(b.Time) })
+	return result, nil
+}
+
+func (m *MemoryDB) DeletePowerSamplesBefore(cutoff time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.power)
+	m.power = slices.DeleteFunc(m.power, func(p PowerSample) bool { return p.Time.Before(cutoff) })
+	return before - len(m.power), nil
+}
+
+func (m *MemoryDB) SaveSnapshot(snapshot Snapshot) (*Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if snapshot.Name == "" {
+		return nil, errors.New("name must not be empty")
+	}
+	snapshot.CreatedAt = time.Now().UTC()
+	snapshot.Lights = slices.Clone(snapshot.Lights)
+
+	if i := slices.IndexFunc(m.snaps, func(s Snapshot) bool { return s.Name == snapshot.Name }); i >= 0 {
+		snapshot.Id = m.snaps[i].Id
+		m.snaps[i] = snapshot
+	} else {
+		snapshot.Id = uuid.NewString()
+		m.snaps = append(m.snaps, snapshot)
+	}
+	return &snapshot, nil
+}
+
+func (m *MemoryDB) FindSnapshots() ([]Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := slices.Clone(m.snaps)
+	slices.SortFunc(result, func(a, b Snapshot) int { return cmp.Compare(a.Name, b.Name) })
+	return result, nil
+}
+
+func (m *MemoryDB) FindSnapshot(name string) (*Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.snaps, func(s Snapshot) bool { return s.Name == name })
+	if i < 0 {
+		return nil, fmt.Errorf("snapshot %s %w", name, ErrNotFound)
+	}
+	snapshot := m.snaps[i]
+	snapshot.Lights = slices.Clone(snapshot.Lights)
+	return &snapshot, nil
+}
+
+func (m *MemoryDB) DeleteSnapshot(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.snaps, func(s Snapshot) bool { return s.Name == name })
+	if i < 0 {
+		return fmt.Errorf("snapshot %s %w", name, ErrNotFound)
+	}
+	m.snaps = slices.Delete(m.snaps, i, i+1)
+	return nil
+}
+
+func (m *MemoryDB) CreateAlarm(alarm Alarm) (*Alarm, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if alarm.Id == "" {
+		alarm.Id = uuid.NewString()
+	}
+	if err := m.alarmNameTaken(alarm); err != nil {
+		return nil, err
+	}
+	m.alarms = append(m.alarms, copyAlarm(alarm))
+	return &alarm, nil
+}
+
+func (m *MemoryDB) FindAlarms() ([]Alarm, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]Alarm, len(m.alarms))
+	for i, a := range m.alarms {
+		result[i] = copyAlarm(a)
+	}
+	slices.SortFunc(result, func(a, b Alarm) int { return cmp.Compare(a.Name, b.Name) })
+	return result, nil
+}
+
+func (m *MemoryDB) UpdateAlarm(alarm Alarm) (*Alarm, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.alarmNameTaken(alarm); err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(m.alarms, func(a Alarm) bool { return a.Id == alarm.Id })
+	if i < 0 {
+		return nil, fmt.Errorf("alarm %s %w", alarm.Id, ErrNotFound)
+	}
+	alarm.LastRun = m.alarms[i].LastRun
+	m.alarms[i] = copyAlarm(alarm)
+	return &alarm, nil
+}
+
+func (m *MemoryDB) DeleteAlarm(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.alarms, func(a Alarm) bool { return a.Id == id })
+	if i < 0 {
+		return fmt.Errorf("alarm %s %w", id, ErrNotFound)
+	}
+	m.alarms = slices.Delete(m.alarms, i, i+1)
+	return nil
+}
+
+func (m *MemoryDB) MarkAlarmRun(id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.alarms, func(a Alarm) bool { return a.Id == id })
+	if i < 0 {
+		return fmt.Errorf("alarm %s %w", id, ErrNotFound)
+	}
+	m.alarms[i].LastRun = at.UTC()
+	return nil
+}
+
+func (m *MemoryDB) alarmNameTaken(alarm Alarm) error {
+	if alarm.Name == "" {
+		return errors.New("name must not be empty")
+	}
+	if slices.ContainsFunc(m.alarms, func(a Alarm) bool { return a.Name == alarm.Name && a.Id != alarm.Id }) {
+		return fmt.Errorf("name %s is already used", alarm.Name)
+	}
+	return nil
+}
+
+func copyAlarm(a Alarm) Alarm {
+	a.Days = slices.Clone(a.Days)
+	a.Lights.Ids = slices.Clone(a.Lights.Ids)
+	return a
+}
+
+func (m *MemoryDB) CreateJob(job Job) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job.Id == "" {
+		job.Id = uuid.NewString()
+	}
+	if err := m.jobNameTaken(job); err != nil {
+		return nil, err
+	}
+	m.jobs = append(m.jobs, copyJob(job))
+	return &job, nil
+}
+
+func (m *MemoryDB) FindJobs() ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]Job, len(m.jobs))
+	for i, j := range m.jobs {
+		result[i] = copyJob(j)
+	}
+	slices.SortFunc(result, func(a, b Job) int { return cmp.Compare(a.Name, b.Name) })
+	return result, nil
+}
+
+func (m *MemoryDB) UpdateJob(job Job) (*Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.jobNameTaken(job); err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(m.jobs, func(j Job) bool { return j.Id == job.Id })
+	if i < 0 {
+		return nil, fmt.Errorf("job %s %w", job.Id, ErrNotFound)
+	}
+	job.LastRun, job.LastError = m.jobs[i].LastRun, m.jobs[i].LastError
+	m.jobs[i] = copyJob(job)
+	return &job, nil
+}
+
+func (m *MemoryDB) DeleteJob(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.jobs, func(j Job) bool { return j.Id == id })
+	if i < 0 {
+		return fmt.Errorf("job %s %w", id, ErrNotFound)
+	}
+	m.jobs = slices.Delete(m.jobs, i, i+1)
+	return nil
+}
+
+func (m *MemoryDB) MarkJobRun(id string, at time.Time, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := slices.IndexFunc(m.jobs, func(j Job) bool { return j.Id == id })
+	if i < 0 {
+		return fmt.Errorf("job %s %w", id, ErrNotFound)
+	}
+	m.jobs[i].LastRun = at.UTC()
+	m.jobs[i].LastError = lastError
+	return nil
+}
+
+func (m *MemoryDB) jobNameTaken(job Job) error {
+	if job.Name == "" {
+		return errors.New("name must not be empty")
+	}
+	if slices.ContainsFunc(m.jobs, func(j Job) bool { return j.Name == job.Name && j.Id != job.Id }) {
+		return fmt.Errorf("name %s is already used", job.Name)
+	}
+	return nil
+}
+
+func copyJob(j Job) Job {
+	j.Lights.Ids = slices.Clone(j.Lights.Ids)
+	return j
+}
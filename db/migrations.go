@@ -0,0 +1,430 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// migration moves the schema from version-1 to version. Migrations only ever
+// go up and never change once released; snapshot structs below freeze the
+// shape of the tables at the version that uses them.
+type migration struct {
+	version     int
+	description string
+	up          func(tx *gorm.DB) error
+}
+
+var migrations = []migration{
+	{version: 1, description: "create stored_lights", up: createStoredLights},
+	{version: 2, description: "drop soft delete from stored_lights", up: dropStoredLightsSoftDelete},
+	{version: 3, description: "add rooms and groups", up: addRoomsAndGroups},
+	{version: 4, description: "add light names and backups", up: addLightNamesAndBackups},
+	{version: 5, description: "add last seen to stored_lights", up: addLastSeen},
+	{version: 6, description: "create events", up: createEvents},
+	{version: 7, description: "add light models and event power", up: addModelsAndPower},
+	{version: 8, description: "create power_samples", up: createPowerSamples},
+	{version: 9, description: "create snapshots", up: createSnapshots},
+	{version: 10, description: "create alarms", up: createAlarms},
+	{version: 11, description: "create jobs", up: createJobs},
+}
+
+type schemaVersion struct {
+	Version     int `gorm:"primaryKey;autoIncrement:false"`
+	Description string
+	AppliedAt   time.Time
+}
+
+func (schemaVersion) TableName() string {
+	return "schema_version"
+}
+
+func latestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+func migrate(db *gorm.DB) error {
+	return migrateTo(db, latestVersion())
+}
+
+func migrateTo(db *gorm.DB, target int) error {
+	err := db.Migrator().AutoMigrate(&schemaVersion{})
+	if err != nil {
+		return err
+	}
+
+	current, err := currentVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current || m.version > target {
+			continue
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaVersion{
+				Version:     m.version,
+				Description: m.description,
+				AppliedAt:   time.Now().UTC(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migrating to version %d (%s): %w", m.version, m.description, err)
+		}
+	}
+
+	return nil
+}
+
+// currentVersion reads the applied version. Databases created before
+// versioning have stored_lights but no recorded version; their schema is the
+// one of version 1, so they are marked as such.
+func currentVersion(db *gorm.DB) (int, error) {
+	var version int
+	err := db.Model(&schemaVersion{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if version == 0 && db.Migrator().HasTable("stored_lights") {
+		err = db.Create(&schemaVersion{
+			Version:     1,
+			Description: "adopt unversioned stored_lights",
+			AppliedAt:   time.Now().UTC(),
+		}).Error
+		return 1, err
+	}
+
+	return version, nil
+}
+
+type storedWizLightV1 struct {
+	ID         string `gorm:"primaryKey;size:64"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	DeletedAt  gorm.DeletedAt `gorm:"index"`
+	MacAddress string         `gorm:"uniqueIndex;size:32"`
+	IpAddress  string         `gorm:"uniqueIndex;size:64"`
+	Tags       datatypes.JSONType[[]string]
+}
+
+func (storedWizLightV1) TableName() string {
+	return "stored_lights"
+}
+
+func createStoredLights(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&storedWizLightV1{})
+}
+
+type storedWizLightV2 struct {
+	ID         string `gorm:"primaryKey;size:64"`
+	MacAddress string `gorm:"uniqueIndex;size:32"`
+	IpAddress  string `gorm:"uniqueIndex;size:64"`
+	Tags       datatypes.JSONType[[]string]
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (storedWizLightV2) TableName() string {
+	return "stored_lights"
+}
+
+func dropStoredLightsSoftDelete(tx *gorm.DB) error {
+	err := tx.Exec("DELETE FROM stored_lights WHERE deleted_at IS NOT NULL").Error
+	if err != nil {
+		return err
+	}
+
+	m := tx.Migrator()
+	if m.HasIndex(&storedWizLightV1{}, "idx_stored_lights_deleted_at") {
+		if err := m.DropIndex(&storedWizLightV1{}, "idx_stored_lights_deleted_at"); err != nil {
+			return err
+		}
+	}
+	if err := m.DropColumn(&storedWizLightV1{}, "deleted_at"); err != nil {
+		return err
+	}
+
+	// SQLite drops a column by rebuilding the table, which loses its indexes.
+	for _, index := range []string{"idx_stored_lights_mac_address", "idx_stored_lights_ip_address"} {
+		if !m.HasIndex(&storedWizLightV2{}, index) {
+			if err := m.CreateIndex(&storedWizLightV2{}, index); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+type storedWizLightV3 struct {
+	ID         string `gorm:"primaryKey;size:64"`
+	MacAddress string `gorm:"uniqueIndex;size:32"`
+	IpAddress  string `gorm:"uniqueIndex;size:64"`
+	Tags       datatypes.JSONType[[]string]
+	RoomID     *string `gorm:"index;size:64"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (storedWizLightV3) TableName() string {
+	return "stored_lights"
+}
+
+type roomV3 struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	Name      string `gorm:"uniqueIndex;size:128"`
+	Floor     int
+	Zone      string `gorm:"size:128"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (roomV3) TableName() string {
+	return "rooms"
+}
+
+type lightGroupV3 struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	Name      string `gorm:"uniqueIndex;size:128"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (lightGroupV3) TableName() string {
+	return "light_groups"
+}
+
+type lightGroupMemberV3 struct {
+	LightID string `gorm:"primaryKey;size:64"`
+	GroupID string `gorm:"primaryKey;size:64;index"`
+}
+
+func (lightGroupMemberV3) TableName() string {
+	return "light_group_members"
+}
+
+func addRoomsAndGroups(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if err := m.CreateTable(&roomV3{}, &lightGroupV3{}, &lightGroupMemberV3{}); err != nil {
+		return err
+	}
+	if err := m.AddColumn(&storedWizLightV3{}, "RoomID"); err != nil {
+		return err
+	}
+	return m.CreateIndex(&storedWizLightV3{}, "RoomID")
+}
+
+type storedWizLightV4 struct {
+	ID         string `gorm:"primaryKey;size:64"`
+	Name       string `gorm:"size:128"`
+	MacAddress string `gorm:"uniqueIndex;size:32"`
+	IpAddress  string `gorm:"uniqueIndex;size:64"`
+	Tags       datatypes.JSONType[[]string]
+	RoomID     *string `gorm:"index;size:64"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (storedWizLightV4) TableName() string {
+	return "stored_lights"
+}
+
+type backupV4 struct {
+	ID        string    `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time `gorm:"index"`
+	Reason    string    `gorm:"size:255"`
+	Inventory datatypes.JSON
+}
+
+func (backupV4) TableName() string {
+	return "backups"
+}
+
+func addLightNamesAndBackups(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if err := m.AddColumn(&storedWizLightV4{}, "Name"); err != nil {
+		return err
+	}
+	return m.CreateTable(&backupV4{})
+}
+
+type storedWizLightV5 struct {
+	ID         string `gorm:"primaryKey;size:64"`
+	Name       string `gorm:"size:128"`
+	MacAddress string `gorm:"uniqueIndex;size:32"`
+	IpAddress  string `gorm:"uniqueIndex;size:64"`
+	Tags       datatypes.JSONType[[]string]
+	RoomID     *string    `gorm:"index;size:64"`
+	LastSeen   *time.Time `gorm:"index"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (storedWizLightV5) TableName() string {
+	return "stored_lights"
+}
+
+// addLastSeen takes the last update as when existing lights were last seen,
+// since they were updated on discovery.
+func addLastSeen(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if err := m.AddColumn(&storedWizLightV5{}, "LastSeen"); err != nil {
+		return err
+	}
+	if err := m.CreateIndex(&storedWizLightV5{}, "LastSeen"); err != nil {
+		return err
+	}
+	return tx.Exec("UPDATE stored_lights SET last_seen = updated_at").Error
+}
+
+type eventV6 struct {
+	ID         uint64    `gorm:"primaryKey;autoIncrement"`
+	OccurredAt time.Time `gorm:"index;index:idx_events_light_occurred_at,priority:2"`
+	Source     string    `gorm:"size:32"`
+	Command    string    `gorm:"size:64"`
+	LightID    string    `gorm:"size:64;index:idx_events_light_occurred_at,priority:1"`
+	Params     datatypes.JSON
+	IsOn       *bool
+	Error      string `gorm:"type:text"`
+	Latency    int64
+}
+
+func (eventV6) TableName() string {
+	return "events"
+}
+
+func createEvents(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&eventV6{})
+}
+
+type storedWizLightV7 struct {
+	ID         string `gorm:"primaryKey;size:64"`
+	Name       string `gorm:"size:128"`
+	Model      string `gorm:"size:64"`
+	MacAddress string `gorm:"uniqueIndex;size:32"`
+	IpAddress  string `gorm:"uniqueIndex;size:64"`
+	Tags       datatypes.JSONType[[]string]
+	RoomID     *string    `gorm:"index;size:64"`
+	LastSeen   *time.Time `gorm:"index"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (storedWizLightV7) TableName() string {
+	return "stored_lights"
+}
+
+type eventV7 struct {
+	ID         uint64    `gorm:"primaryKey;autoIncrement"`
+	OccurredAt time.Time `gorm:"index;index:idx_events_light_occurred_at,priority:2"`
+	Source     string    `gorm:"size:32"`
+	Command    string    `gorm:"size:64"`
+	LightID    string    `gorm:"size:64;index:idx_events_light_occurred_at,priority:1"`
+	Params     datatypes.JSON
+	IsOn       *bool
+	Dimming    int
+	Watts      *float64
+	Error      string `gorm:"type:text"`
+	Latency    int64
+}
+
+func (eventV7) TableName() string {
+	return "events"
+}
+
+func addModelsAndPower(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if err := m.AddColumn(&storedWizLightV7{}, "Model"); err != nil {
+		return err
+	}
+	if err := m.AddColumn(&eventV7{}, "Dimming"); err != nil {
+		return err
+	}
+	return m.AddColumn(&eventV7{}, "Watts")
+}
+
+type powerSampleV8 struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement"`
+	LightID   string    `gorm:"size:64;index:idx_power_samples_light_sampled_at,priority:1"`
+	SampledAt time.Time `gorm:"index;index:idx_power_samples_light_sampled_at,priority:2"`
+	Watts     float64
+}
+
+func (powerSampleV8) TableName() string {
+	return "power_samples"
+}
+
+func createPowerSamples(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&powerSampleV8{})
+}
+
+type snapshotV9 struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	Name      string `gorm:"uniqueIndex;size:128"`
+	CreatedAt time.Time
+	Lights    datatypes.JSON
+}
+
+func (snapshotV9) TableName() string {
+	return "snapshots"
+}
+
+func createSnapshots(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&snapshotV9{})
+}
+
+type alarmV10 struct {
+	ID          string `gorm:"primaryKey;size:64"`
+	Name        string `gorm:"uniqueIndex;size:128"`
+	Hour        int
+	Minute      int
+	Days        datatypes.JSON
+	Ramp        time.Duration
+	Lights      datatypes.JSON
+	WakeUpScene bool
+	Enabled     bool
+	LastRun     *time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (alarmV10) TableName() string {
+	return "alarms"
+}
+
+func createAlarms(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&alarmV10{})
+}
+
+type jobV11 struct {
+	ID         string `gorm:"primaryKey;size:64"`
+	Name       string `gorm:"uniqueIndex;size:128"`
+	Schedule   string `gorm:"size:255"`
+	TimeZone   string `gorm:"size:64"`
+	Command    string `gorm:"size:64"`
+	Argument   string `gorm:"size:255"`
+	Lights     datatypes.JSON
+	Transition time.Duration
+	CatchUp    bool
+	Enabled    bool
+	LastRun    *time.Time
+	LastError  string `gorm:"type:text"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (jobV11) TableName() string {
+	return "jobs"
+}
+
+func createJobs(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&jobV11{})
+}
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fixtures seed a database at the schema of the version they are keyed by.
+// A database at some version is seeded with the fixture of the highest
+// version not above it; version 0 is the schema AutoMigrate created before
+// migrations were versioned.
+var fixtures = map[int]func(db *gorm.DB) error{
+	0: func(db *gorm.DB) error {
+		return execAll(db,
+			"CREATE TABLE `stored_lights` (`id` text,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,`mac_address` text,`ip_address` text,`tags` JSON,PRIMARY KEY (`id`))",
+			"CREATE UNIQUE INDEX `idx_stored_lights_ip_address` ON `stored_lights`(`ip_address`)",
+			"CREATE UNIQUE INDEX `idx_stored_lights_mac_address` ON `stored_lights`(`mac_address`)",
+			"CREATE INDEX `idx_stored_lights_deleted_at` ON `stored_lights`(`deleted_at`)",
+			"INSERT INTO stored_lights (id, created_at, updated_at, mac_address, ip_address, tags) VALUES ('light-1', '2025-01-01 10:00:00', '2025-01-01 10:00:00', 'cc40857ce53c', '192.168.1.174', '[\"kitchen\"]')",
+			"INSERT INTO stored_lights (id, created_at, updated_at, deleted_at, mac_address, ip_address, tags) VALUES ('deleted', '2025-01-01 10:00:00', '2025-01-01 10:00:00', '2025-01-02 10:00:00', 'cc40857ce53d', '192.168.1.175', '[]')",
+		)
+	},
+	1: func(db *gorm.DB) error {
+		return execAll(db,
+			"INSERT INTO stored_lights (id, created_at, updated_at, mac_address, ip_address, tags) VALUES ('light-1', '2025-01-01 10:00:00', '2025-01-01 10:00:00', 'cc40857ce53c', '192.168.1.174', '[\"kitchen\"]')",
+			"INSERT INTO stored_lights (id, created_at, updated_at, deleted_at, mac_address, ip_address, tags) VALUES ('deleted', '2025-01-01 10:00:00', '2025-01-01 10:00:00', '2025-01-02 10:00:00', 'cc40857ce53d', '192.168.1.175', '[]')",
+		)
+	},
+	2: func(db *gorm.DB) error {
+		return execAll(db,
+			"INSERT INTO stored_lights (id, created_at, updated_at, mac_address, ip_address, tags) VALUES ('light-1', '2025-01-01 10:00:00', '2025-01-01 10:00:00', 'cc40857ce53c', '192.168.1.174', '[\"kitchen\"]')",
+		)
+	},
+	3: func(db *gorm.DB) error {
+		return execAll(db,
+			"INSERT INTO rooms (id, name, floor, zone, created_at, updated_at) VALUES ('room-1', 'kitchen', 0, 'north', '2025-01-01 10:00:00', '2025-01-01 10:00:00')",
+			"INSERT INTO light_groups (id, name, created_at, updated_at) VALUES ('group-1', 'reading', '2025-01-01 10:00:00', '2025-01-01 10:00:00')",
+			"INSERT INTO stored_lights (id, created_at, updated_at, mac_address, ip_address, tags, room_id) VALUES ('light-1', '2025-01-01 10:00:00', '2025-01-01 10:00:00', 'cc40857ce53c', '192.168.1.174', '[\"kitchen\"]', 'room-1')",
+			"INSERT INTO light_group_members (light_id, group_id) VALUES ('light-1', 'group-1')",
+		)
+	},
+	4: func(db *gorm.DB) error {
+		return execAll(db,
+			"INSERT INTO rooms (id, name, floor, zone, created_at, updated_at) VALUES ('room-1', 'kitchen', 0, 'north', '2025-01-01 10:00:00', '2025-01-01 10:00:00')",
+			"INSERT INTO stored_lights (id, name, created_at, updated_at, mac_address, ip_address, tags, room_id) VALUES ('light-1', 'Counter', '2025-01-01 10:00:00', '2025-01-01 10:00:00', 'cc40857ce53c', '192.168.1.174', '[\"kitchen\"]', 'room-1')",
+			"INSERT INTO backups (id, created_at, reason, inventory) VALUES ('backup-1', '2025-01-01 10:00:00', 'erase all', '{\"version\":1,\"lights\":[]}')",
+		)
+	},
+	5: func(db *gorm.DB) error {
+		return execAll(db,
+			"INSERT INTO stored_lights (id, name, created_at, updated_at, last_seen, mac_address, ip_address, tags) VALUES ('light-1', 'Counter', '2025-01-01 10:00:00', '2025-01-01 10:00:00', '2025-01-03 10:00:00', 'cc40857ce53c', '192.168.1.174', '[\"kitchen\"]')",
+		)
+	},
+	6: func(db *gorm.DB) error {
+		return execAll(db,
+			"INSERT INTO stored_lights (id, name, created_at, updated_at, last_seen, mac_address, ip_address, tags) VALUES ('light-1', 'Counter', '2025-01-01 10:00:00', '2025-01-01 10:00:00', '2025-01-03 10:00:00', 'cc40857ce53c', '192.168.1.174', '[\"kitchen\"]')",
+			"INSERT INTO events (occurred_at, source, command, light_id, params, is_on, error, latency) VALUES ('2025-01-03 10:00:00', 'cli', 'on', 'light-1', '{}', 1, '', 120000000)",
+		)
+	},
+	7: func(db *gorm.DB) error {
+		return execAll(db,
+			"INSERT INTO stored_lights (id, name, model, created_at, updated_at, last_seen, mac_address, ip_address, tags) VALUES ('light-1', 'Counter', 'ESP01_SHRGB1C_31', '2025-01-01 10:00:00', '2025-01-01 10:00:00', '2025-01-03 10:00:00', 'cc40857ce53c', '192.168.1.174', '[\"kitchen\"]')",
+			"INSERT INTO events (occurred_at, source, command, light_id, params, is_on, dimming, watts, error, latency) VALUES ('2025-01-03 10:00:00', 'cli', 'on', 'light-1', '{}', 1, 80, NULL, '', 120000000)",
+		)
+	},
+	8: func(db *gorm.DB) error {
+		return execAll(db,
+			"INSERT INTO stored_lights (id, name, model, created_at, updated_at, last_seen, mac_address, ip_address, tags) VALUES ('light-1', 'Counter', 'ESP10_SOCKET_06', '2025-01-01 10:00:00', '2025-01-01 10:00:00', '2025-01-03 10:00:00', 'cc40857ce53c', '192.168.1.174', '[\"kitchen\"]')",
+			"INSERT INTO power_samples (light_id, sampled_at, watts) VALUES ('light-1', '2025-01-03 10:00:00', 42.5)",
+		)
+	},
+	9: func(db *gorm.DB) error {
+		return execAll(db,
+			"INSERT INTO stored_lights (id, name, model, created_at, updated_at, last_seen, mac_address, ip_address, tags) VALUES ('light-1', 'Counter', 'ESP01_SHRGB1C_31', '2025-01-01 10:00:00', '2025-01-01 10:00:00', '2025-01-03 10:00:00', 'cc40857ce53c', '192.168.1.174', '[\"kitchen\"]')",
+			"INSERT INTO snapshots (id, name, created_at, lights) VALUES ('snapshot-1', 'movie-night', '2025-01-03 10:00:00', '[{\"lightId\":\"light-1\",\"pilot\":{\"isOn\":true,\"dimming\":20,\"temp\":2700}}]')",
+		)
+	},
+	10: func(db *gorm.DB) error {
+		return execAll(db,
+			"INSERT INTO stored_lights (id, name, model, created_at, updated_at, last_seen, mac_address, ip_address, tags) VALUES ('light-1', 'Counter', 'ESP01_SHRGB1C_31', '2025-01-01 10:00:00', '2025-01-01 10:00:00', '2025-01-03 10:00:00', 'cc40857ce53c', '192.168.1.174', '[\"kitchen\"]')",
+			"INSERT INTO alarms (id, name, hour, minute, days, ramp, lights, wake_up_scene, enabled, created_at, updated_at) VALUES ('alarm-1', 'workdays', 7, 0, '[1,2,3,4,5]', 1800000000000, '{\"ids\":[\"light-1\"]}', true, true, '2025-01-03 10:00:00', '2025-01-03 10:00:00')",
+		)
+	},
+	11: func(db *gorm.DB) error {
+		return execAll(db,
+			"INSERT INTO stored_lights (id, name, model, created_at, updated_at, last_seen, mac_address, ip_address, tags) VALUES ('light-1', 'Counter', 'ESP01_SHRGB1C_31', '2025-01-01 10:00:00', '2025-01-01 10:00:00', '2025-01-03 10:00:00', 'cc40857ce53c', '192.168.1.174', '[\"kitchen\"]')",
+			"INSERT INTO jobs (id, name, schedule, time_zone, command, argument, lights, transition, catch_up, enabled, last_error, created_at, updated_at) VALUES ('job-1', 'porch', '30m before sunset', 'Europe/Paris', 'on', '', '{\"tags\":\"kitchen\"}', 0, true, true, '', '2025-01-03 10:00:00', '2025-01-03 10:00:00')",
+		)
+	},
+}
+
+func TestMigrate_FromEveryVersion(t *testing.T) {
+	for version := 0; version <= latestVersion(); version++ {
+		t.Run(versionName(version), func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "lights.db")
+			db := openTestGorm(t, file)
+
+			if version > 0 {
+				if err := migrateTo(db, version); err != nil {
+					t.Fatalf("migrating fixture to version %d: %v", version, err)
+				}
+			}
+			if err := fixtureFor(version)(db); err != nil {
+				t.Fatalf("seeding fixture: %v", err)
+			}
+
+			storage, err := NewSQLiteDB(file)
+			if err != nil {
+				t.Fatalf("upgrading from version %d: %v", version, err)
+			}
+
+			assertLatestVersion(t, storage.db)
+			lights, err := storage.FindAll()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(lights) != 1 {
+				t.Fatalf("got %d lights; expected 1", len(lights))
+			}
+			l := lights[0]
+			if l.Id != "light-1" || l.MacAddress != "cc40857ce53c" || l.IpAddress != "192.168.1.174" || len(l.Tags) != 1 || l.Tags[0] != "kitchen" {
+				t.Fatalf("got %+v; expected the fixture light", l)
+			}
+			if l.LastSeen.Year() != 2025 {
+				t.Fatalf("got last seen %v; expected a time from the fixture", l.LastSeen)
+			}
+
+			// The upgraded database still enforces unique MAC addresses.
+			upserted, err := storage.Upsert(l)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if upserted.Id != l.Id {
+				t.Fatalf("got id %s; expected %s", upserted.Id, l.Id)
+			}
+			lights, _ = storage.FindAll()
+			if len(lights) != 1 {
+				t.Fatalf("got %d lights after upsert; expected 1", len(lights))
+			}
+		})
+	}
+}
+
+func TestMigrate_IsIdempotent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lights.db")
+	for i := 0; i < 2; i++ {
+		storage, err := NewSQLiteDB(file)
+		if err != nil {
+			t.Fatalf("opening database, attempt %d: %v", i+1, err)
+		}
+		assertLatestVersion(t, storage.db)
+
+		var applied int64
+		storage.db.Model(&schemaVersion{}).Count(&applied)
+		if applied != int64(len(migrations)) {
+			t.Fatalf("got %d applied migrations; expected %d", applied, len(migrations))
+		}
+	}
+}
+
+func TestMigrations_AreOrdered(t *testing.T) {
+	versions := make([]int, len(migrations))
+	for i, m := range migrations {
+		versions[i] = m.version
+	}
+	if !sort.IntsAreSorted(versions) {
+		t.Fatalf("migrations are not sorted: %v", versions)
+	}
+	for i, v := range versions {
+		if v != i+1 {
+			t.Fatalf("got version %d at position %d; expected consecutive versions", v, i)
+		}
+	}
+	for v := 0; v <= latestVersion(); v++ {
+		if fixtureFor(v) == nil {
+			t.Fatalf("no fixture for version %d", v)
+		}
+	}
+}
+
+func fixtureFor(version int) func(db *gorm.DB) error {
+	for v := version; v >= 0; v-- {
+		if f, ok := fixtures[v]; ok {
+			return f
+		}
+	}
+	return nil
+}
+
+func assertLatestVersion(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	version, err := currentVersion(db)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != latestVersion() {
+		t.Fatalf("got version %d; expected %d", version, latestVersion())
+	}
+}
+
+func openTestGorm(t *testing.T, file string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(file), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("opening %s: %v", file, err)
+	}
+	return db
+}
+
+func execAll(db *gorm.DB, statements ...string) error {
+	for _, s := range statements {
+		if err := db.Exec(s).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func versionName(version int) string {
+	if version == 0 {
+		return "unversioned"
+	}
+	return fmt.Sprintf("version %d", version)
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"time"
+)
+
+// PowerSample is the power a device measured at some time.
+type PowerSample struct {
+	LightId string
+	Time    time.Time
+	Watts   float64
+}
+
+func (s gormStorage) RecordPowerSample(sample PowerSample) error {
+	return s.db.Create(&storedPowerSample{
+		LightID:   sample.LightId,
+		SampledAt: sample.Time.UTC(),
+		Watts:     sample.Watts,
+	}).Error
+}
+
+// FindPowerSamples returns the samples of a light taken from since, included,
+// to until, excluded, oldest first.
+func (s gormStorage) FindPowerSamples(lightId string, since, until time.Time) ([]PowerSample, error) {
+	var stored []storedPowerSample
+	err := s.db.
+		Where("light_id = ? AND sampled_at >= ? AND sampled_at < ?", lightId, since.UTC(), until.UTC()).
+		Order("sampled_at").
+		Find(&stored).Error
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]PowerSample, len(stored))
+	for i, p := range stored {
+		result[i] = PowerSample{LightId: p.LightID, Time: p.SampledAt, Watts: p.Watts}
+	}
+	return result, nil
+}
+
+func (s gormStorage) DeletePowerSamplesBefore(cutoff time.Time) (int, error) {
+	result := s.db.Where("sampled_at < ?", cutoff.UTC()).Delete(&storedPowerSample{})
+	return int(result.RowsAffected), result.Error
+}
+
+type storedPowerSample struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement"`
+	LightID   string    `gorm:"size:64;index:idx_power_samples_light_sampled_at,priority:1"`
+	SampledAt time.Time `gorm:"index;index:idx_power_samples_light_sampled_at,priority:2"`
+	Watts     float64
+}
+
+func (storedPowerSample) TableName() string {
+	return "power_samples"
+}
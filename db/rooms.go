@@ -0,0 +1,321 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/wiz"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Room is where a light is installed. Each light is in at most one room.
+type Room struct {
+	Id    string
+	Name  string
+	Floor int
+	Zone  string
+}
+
+// Group is a named set of lights. A light can be in any number of groups.
+type Group struct {
+	Id   string
+	Name string
+}
+
+func (s gormStorage) CreateRoom(room Room) (*Room, error) {
+	if room.Id == "" {
+		room.Id = uuid.NewString()
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := nameTaken(tx, &storedRoom{}, room.Name, room.Id); err != nil {
+			return err
+		}
+		return tx.Create(&storedRoom{ID: room.Id, Name: room.Name, Floor: room.Floor, Zone: room.Zone}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+func (s gormStorage) FindRooms() ([]Room, error) {
+	var stored []storedRoom
+	if err := s.db.Order("floor, name").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]Room, len(stored))
+	for i, r := range stored {
+		result[i] = Room{Id: r.ID, Name: r.Name, Floor: r.Floor, Zone: r.Zone}
+	}
+	return result, nil
+}
+
+func (s gormStorage) UpdateRoom(room Room) (*Room, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := nameTaken(tx, &storedRoom{}, room.Name, room.Id); err != nil {
+			return err
+		}
+		if err := exists(tx, &storedRoom{}, room.Id, "room"); err != nil {
+			return err
+		}
+		return tx.Model(&storedRoom{ID: room.Id}).
+			Select("name", "floor", "zone").
+			Updates(storedRoom{Name: room.Name, Floor: room.Floor, Zone: room.Zone}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+func (s gormStorage) DeleteRoom(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&storedRoom{ID: id})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("room %s %w", id, ErrNotFound)
+		}
+		return tx.Model(&storedWizLight{}).Where("room_id = ?", id).Update("room_id", nil).Error
+	})
+}
+
+func (s gormStorage) SetRoom(lightIds []string, roomId string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var room *string
+		if roomId != "" {
+			if err := exists(tx, &storedRoom{}, roomId, "room"); err != nil {
+				return err
+			}
+			room = &roomId
+		}
+
+		for _, id := range lightIds {
+			if err := exists(tx, &storedWizLight{}, id, "light"); err != nil {
+				return err
+			}
+			err := tx.Model(&storedWizLight{}).Where("id = ?", id).Update("room_id", room).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s gormStorage) FindByRoom(roomId string) ([]wiz.Light, error) {
+	var stored []storedWizLight
+	if err := s.db.Where("room_id = ?", roomId).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	return s.toLights(stored)
+}
+
+func (s gormStorage) CreateGroup(group Group) (*Group, error) {
+	if group.Id == "" {
+		group.Id = uuid.NewString()
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := nameTaken(tx, &storedGroup{}, group.Name, group.Id); err != nil {
+			return err
+		}
+		return tx.Create(&storedGroup{ID: group.Id, Name: group.Name}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (s gormStorage) FindGroups() ([]Group, error) {
+	var stored []storedGroup
+	if err := s.db.Order("name").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]Group, len(stored))
+	for i, g := range stored {
+		result[i] = Group{Id: g.ID, Name: g.Name}
+	}
+	return result, nil
+}
+
+func (s gormStorage) UpdateGroup(group Group) (*Group, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := nameTaken(tx, &storedGroup{}, group.Name, group.Id); err != nil {
+			return err
+		}
+		if err := exists(tx, &storedGroup{}, group.Id, "group"); err != nil {
+			return err
+		}
+		return tx.Model(&storedGroup{ID: group.Id}).Update("name", group.Name).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+func (s gormStorage) DeleteGroup(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&storedGroup{ID: id})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("group %s %w", id, ErrNotFound)
+		}
+		return tx.Where("group_id = ?", id).Delete(&storedGroupMember{}).Error
+	})
+}
+
+func (s gormStorage) AddToGroup(lightIds []string, groupId string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := exists(tx, &storedGroup{}, groupId, "group"); err != nil {
+			return err
+		}
+
+		for _, id := range lightIds {
+			if err := exists(tx, &storedWizLight{}, id, "light"); err != nil {
+				return err
+			}
+			var members int64
+			err := tx.Model(&storedGroupMember{}).Where("light_id = ? AND group_id = ?", id, groupId).Count(&members).Error
+			if err != nil {
+				return err
+			}
+			if members > 0 {
+				continue
+			}
+			if err := tx.Create(&storedGroupMember{LightID: id, GroupID: groupId}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s gormStorage) RemoveFromGroup(lightIds []string, groupId string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := exists(tx, &storedGroup{}, groupId, "group"); err != nil {
+			return err
+		}
+		if len(lightIds) == 0 {
+			return nil
+		}
+		return tx.Where("group_id = ? AND light_id IN ?", groupId, lightIds).Delete(&storedGroupMember{}).Error
+	})
+}
+
+func (s gormStorage) FindByGroup(groupId string) ([]wiz.Light, error) {
+	var stored []storedWizLight
+	err := s.db.
+		Where("id IN (?)", s.db.Model(&storedGroupMember{}).Select("light_id").Where("group_id = ?", groupId)).
+		Find(&stored).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.toLights(stored)
+}
+
+// toLights converts stored lights, loading the groups each one is in.
+func (s gormStorage) toLights(stored []storedWizLight) ([]wiz.Light, error) {
+	ids := make([]string, len(stored))
+	for i, l := range stored {
+		ids[i] = l.ID
+	}
+
+	groups := make(map[string][]string, len(stored))
+	if len(ids) > 0 {
+		var members []storedGroupMember
+		if err := s.db.Where("light_id IN ?", ids).Order("group_id").Find(&members).Error; err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			groups[m.LightID] = append(groups[m.LightID], m.GroupID)
+		}
+	}
+
+	result := make([]wiz.Light, len(stored))
+	for i, l := range stored {
+		result[i] = wiz.Light{
+			Id:         l.ID,
+			Name:       l.Name,
+			Model:      l.Model,
+			MacAddress: l.MacAddress,
+			IpAddress:  l.IpAddress,
+			Tags:       l.Tags.Data(),
+			Room:       l.room(),
+			Groups:     groups[l.ID],
+			LastSeen:   l.lastSeen(),
+		}
+	}
+	return result, nil
+}
+
+func nameTaken(tx *gorm.DB, model any, name, id string) error {
+	if name == "" {
+		return errors.New("name must not be empty")
+	}
+
+	var holders int64
+	err := tx.Model(model).Where("name = ? AND id <> ?", name, id).Count(&holders).Error
+	if err != nil {
+		return err
+	}
+	if holders > 0 {
+		return fmt.Errorf("name %s is already used", name)
+	}
+	return nil
+}
+
+func exists(tx *gorm.DB, model any, id, kind string) error {
+	var count int64
+	if err := tx.Model(model).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%s %s %w", kind, id, ErrNotFound)
+	}
+	return nil
+}
+
+type storedRoom struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	Name      string `gorm:"uniqueIndex;size:128"`
+	Floor     int
+	Zone      string `gorm:"size:128"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (storedRoom) TableName() string {
+	return "rooms"
+}
+
+// storedGroup lives in light_groups, as groups is a reserved word in MySQL.
+type storedGroup struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	Name      string `gorm:"uniqueIndex;size:128"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (storedGroup) TableName() string {
+	return "light_groups"
+}
+
+type storedGroupMember struct {
+	LightID string `gorm:"primaryKey;size:64"`
+	GroupID string `gorm:"primaryKey;size:64;index"`
+}
+
+func (storedGroupMember) TableName() string {
+	return "light_group_members"
+}
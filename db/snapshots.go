@@ -0,0 +1,115 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/wiz"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Snapshot is the state of a set of lights saved under a name, to be set back
+// later.
+type Snapshot struct {
+	Id        string
+	Name      string
+	CreatedAt time.Time
+	Lights    []SnapshotLight
+}
+
+type SnapshotLight struct {
+	LightId string    `json:"lightId"`
+	Pilot   wiz.Pilot `json:"pilot"`
+}
+
+// SaveSnapshot stores a snapshot, replacing the one with the same name.
+func (s gormStorage) SaveSnapshot(snapshot Snapshot) (*Snapshot, error) {
+	if snapshot.Name == "" {
+		return nil, errors.New("name must not be empty")
+	}
+	snapshot.CreatedAt = time.Now().UTC()
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var existing storedSnapshot
+		err := tx.Where("name = ?", snapshot.Name).First(&existing).Error
+		switch {
+		case err == nil:
+			snapshot.Id = existing.ID
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			snapshot.Id = uuid.NewString()
+		default:
+			return err
+		}
+
+		return tx.Save(&storedSnapshot{
+			ID:        snapshot.Id,
+			Name:      snapshot.Name,
+			CreatedAt: snapshot.CreatedAt,
+			Lights:    datatypes.NewJSONType(snapshot.Lights),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func (s gormStorage) FindSnapshots() ([]Snapshot, error) {
+	var stored []storedSnapshot
+	if err := s.db.Order("name").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]Snapshot, len(stored))
+	for i, snapshot := range stored {
+		result[i] = snapshot.toSnapshot()
+	}
+	return result, nil
+}
+
+func (s gormStorage) FindSnapshot(name string) (*Snapshot, error) {
+	var stored storedSnapshot
+	err := s.db.Where("name = ?", name).First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("snapshot %s %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	snapshot := stored.toSnapshot()
+	return &snapshot, nil
+}
+
+func (s gormStorage) DeleteSnapshot(name string) error {
+	result := s.db.Where("name = ?", name).Delete(&storedSnapshot{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("snapshot %s %w", name, ErrNotFound)
+	}
+	return nil
+}
+
+type storedSnapshot struct {
+	ID        string `gorm:"primaryKey;size:64"`
+	Name      string `gorm:"uniqueIndex;size:128"`
+	CreatedAt time.Time
+	Lights    datatypes.JSONType[[]SnapshotLight]
+}
+
+func (storedSnapshot) TableName() string {
+	return "snapshots"
+}
+
+func (s storedSnapshot) toSnapshot() Snapshot {
+	return Snapshot{
+		Id:        s.ID,
+		Name:      s.Name,
+		CreatedAt: s.CreatedAt,
+		Lights:    s.Lights.Data(),
+	}
+}
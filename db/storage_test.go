@@ -0,0 +1,1005 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/wiz"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+// testStorageContract runs the behavior every Storage backend must share.
+// newStorage must return an empty storage.
+func testStorageContract(t *testing.T, newStorage func(t *testing.T) Storage) {
+	t.Run("Upsert then FindById", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+
+		got, err := s.FindById("1")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.MacAddress != "aa" || got.IpAddress != "10.0.0.1" {
+			t.Fatalf("got %+v; expected the upserted light", got)
+		}
+	})
+
+	t.Run("FindById of an unknown light fails", func(t *testing.T) {
+		s := newStorage(t)
+		if _, err := s.FindById("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("got %v; expected %v", err, ErrNotFound)
+		}
+	})
+
+	t.Run("Changes to what is missing fail as not found", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		room, _ := s.CreateRoom(Room{Name: "kitchen"})
+		group, _ := s.CreateGroup(Group{Name: "downstairs"})
+
+		tests := map[string]func() error{
+			"Delete":           func() error { return s.Delete("missing") },
+			"SetName":          func() error { return s.SetName("missing", "lamp") },
+			"SetModel":         func() error { return s.SetModel("missing", "ESP01_SHDW_01") },
+			"MarkSeen":         func() error { return s.MarkSeen("missing", time.Now()) },
+			"UpdateRoom":       func() error { _, err := s.UpdateRoom(Room{Id: "missing", Name: "attic"}); return err },
+			"DeleteRoom":       func() error { return s.DeleteRoom("missing") },
+			"SetRoom":          func() error { return s.SetRoom([]string{"1"}, "missing") },
+			"SetRoom light":    func() error { return s.SetRoom([]string{"missing"}, room.Id) },
+			"UpdateGroup":      func() error { _, err := s.UpdateGroup(Group{Id: "missing", Name: "upstairs"}); return err },
+			"DeleteGroup":      func() error { return s.DeleteGroup("missing") },
+			"AddToGroup":       func() error { return s.AddToGroup([]string{"1"}, "missing") },
+			"AddToGroup light": func() error { return s.AddToGroup([]string{"missing"}, group.Id) },
+			"FindSnapshot":     func() error { _, err := s.FindSnapshot("missing"); return err },
+			"DeleteSnapshot":   func() error { return s.DeleteSnapshot("missing") },
+			"UpdateAlarm":      func() error { _, err := s.UpdateAlarm(Alarm{Id: "missing", Name: "wake"}); return err },
+			"DeleteAlarm":      func() error { return s.DeleteAlarm("missing") },
+			"MarkAlarmRun":     func() error { return s.MarkAlarmRun("missing", time.Now()) },
+			"UpdateJob":        func() error { _, err := s.UpdateJob(Job{Id: "missing", Name: "evening"}); return err },
+			"DeleteJob":        func() error { return s.DeleteJob("missing") },
+			"MarkJobRun":       func() error { return s.MarkJobRun("missing", time.Now(), "") },
+		}
+		for name, change := range tests {
+			if err := change(); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("%s: got %v; expected %v", name, err, ErrNotFound)
+			}
+		}
+	})
+
+	t.Run("Upsert of a known MAC updates the IP and keeps the id", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		mustUpsert(t, s, light("2", "aa", "10.0.0.9"))
+
+		all := mustFindAll(t, s)
+		if len(all) != 1 {
+			t.Fatalf("got %d lights; expected 1", len(all))
+		}
+		if all[0].Id != "1" || all[0].IpAddress != "10.0.0.9" {
+			t.Fatalf("got %+v; expected id 1 with the new IP", all[0])
+		}
+	})
+
+	t.Run("Upsert returns the stored light", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		stored, _ := s.FindById("1")
+		s.AddTags([]wiz.Light{*stored}, []string{"kitchen"})
+
+		got, err := s.Upsert(light("2", "aa", "10.0.0.9"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got.Id != "1" || got.IpAddress != "10.0.0.9" {
+			t.Fatalf("got %+v; expected id 1 with the new IP", got)
+		}
+		assertSameStrings(t, got.Tags, "kitchen")
+	})
+
+	t.Run("Upsert of a new MAC on a taken IP fails", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+
+		if _, err := s.Upsert(light("2", "bb", "10.0.0.1")); err == nil {
+			t.Fatalf("expected an error")
+		}
+		if all := mustFindAll(t, s); len(all) != 1 || all[0].MacAddress != "aa" {
+			t.Fatalf("got %+v; expected only the first light", all)
+		}
+	})
+
+	t.Run("AddTags and RemoveTags", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		l, _ := s.FindById("1")
+
+		tagged, err := s.AddTags([]wiz.Light{*l}, []string{"kitchen", "lamp"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		untagged, err := s.RemoveTags(tagged, []string{"lamp"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got, _ := s.FindById("1")
+		assertSameStrings(t, got.Tags, "kitchen")
+		assertSameStrings(t, untagged[0].Tags, "kitchen")
+	})
+
+	t.Run("AddTags and RemoveTags are idempotent", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		l, _ := s.FindById("1")
+
+		once, _ := s.AddTags([]wiz.Light{*l}, []string{"kitchen"})
+		twice, err := s.AddTags(once, []string{"kitchen"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, _ := s.FindById("1")
+		assertSameStrings(t, twice[0].Tags, "kitchen")
+		assertSameStrings(t, got.Tags, "kitchen")
+
+		removed, _ := s.RemoveTags(twice, []string{"kitchen"})
+		removedAgain, err := s.RemoveTags(removed, []string{"kitchen", "never-added"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, _ = s.FindById("1")
+		assertSameStrings(t, removedAgain[0].Tags)
+		assertSameStrings(t, got.Tags)
+	})
+
+	t.Run("FindByTags matches all tags", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		mustUpsert(t, s, light("2", "bb", "10.0.0.2"))
+		one, _ := s.FindById("1")
+		two, _ := s.FindById("2")
+		s.AddTags([]wiz.Light{*one}, []string{"kitchen", "lamp"})
+		s.AddTags([]wiz.Light{*two}, []string{"kitchen"})
+
+		kitchen, err := s.FindByTags([]string{"kitchen"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		both, err := s.FindByTags([]string{"kitchen", "lamp"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assertIds(t, kitchen, "1", "2")
+		assertIds(t, both, "1")
+
+		none, err := s.FindByTags([]string{"kitchen", "garden"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertIds(t, none)
+	})
+
+	t.Run("FindByTagQuery combines tags", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		mustUpsert(t, s, light("2", "bb", "10.0.0.2"))
+		mustUpsert(t, s, light("3", "cc", "10.0.0.3"))
+		one, _ := s.FindById("1")
+		two, _ := s.FindById("2")
+		three, _ := s.FindById("3")
+		s.AddTags([]wiz.Light{*one}, []string{"upstairs", "bedroom", "floor:1", "lamp"})
+		s.AddTags([]wiz.Light{*two}, []string{"upstairs", "strip", "50%_off"})
+		s.AddTags([]wiz.Light{*three}, []string{"outdoor", "a?b"})
+
+		tests := []struct {
+			query    string
+			expected []string
+		}{
+			{"lamp | strip", []string{"1", "2"}},
+			{"lamp,outdoor", []string{"1", "3"}},
+			{"upstairs & !bedroom", []string{"2"}},
+			{"!outdoor", []string{"1", "2"}},
+			{"floor:*", []string{"1"}},
+			{"FLOOR:*", nil},
+			{"50%*", []string{"2"}},
+			{"5*_off", []string{"2"}},
+			{"50_*", nil},
+			{"a?*", []string{"3"}},
+			{"ab*", nil},
+			{"(lamp | outdoor) & !a*", []string{"1"}},
+		}
+		for _, tt := range tests {
+			q, err := ParseTagQuery(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := s.FindByTagQuery(q)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tt.query, err)
+			}
+			t.Run(tt.query, func(t *testing.T) {
+				assertIds(t, got, tt.expected...)
+			})
+		}
+	})
+
+	t.Run("EraseAll removes every light", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		mustUpsert(t, s, light("2", "bb", "10.0.0.2"))
+
+		s.EraseAll()
+
+		if all := mustFindAll(t, s); len(all) != 0 {
+			t.Fatalf("got %d lights; expected none", len(all))
+		}
+		if _, err := s.FindById("1"); err == nil {
+			t.Fatalf("expected erased light to be gone")
+		}
+
+		mustUpsert(t, s, light("3", "aa", "10.0.0.1"))
+		if all := mustFindAll(t, s); len(all) != 1 || all[0].Id != "3" {
+			t.Fatalf("got %+v; expected the light added after erasing", all)
+		}
+	})
+
+	t.Run("Rooms are created, listed by floor and updated", func(t *testing.T) {
+		s := newStorage(t)
+		attic, err := s.CreateRoom(Room{Name: "attic", Floor: 2})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if attic.Id == "" {
+			t.Fatalf("expected an id to be assigned")
+		}
+		s.CreateRoom(Room{Id: "kitchen", Name: "kitchen", Floor: 0, Zone: "north"})
+
+		if _, err := s.CreateRoom(Room{Name: "attic"}); err == nil {
+			t.Fatalf("expected an error for a duplicate name")
+		}
+
+		attic.Zone = "south"
+		if _, err := s.UpdateRoom(*attic); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := s.UpdateRoom(Room{Id: "missing", Name: "missing"}); err == nil {
+			t.Fatalf("expected an error for an unknown room")
+		}
+
+		rooms, err := s.FindRooms()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rooms) != 2 || rooms[0].Name != "kitchen" || rooms[0].Zone != "north" || rooms[1].Zone != "south" {
+			t.Fatalf("got %+v; expected kitchen then the updated attic", rooms)
+		}
+	})
+
+	t.Run("SetRoom assigns and clears the room of lights", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		mustUpsert(t, s, light("2", "bb", "10.0.0.2"))
+		s.CreateRoom(Room{Id: "kitchen", Name: "kitchen"})
+
+		if err := s.SetRoom([]string{"1", "2"}, "kitchen"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.SetRoom([]string{"2"}, ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		inKitchen, err := s.FindByRoom("kitchen")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertIds(t, inKitchen, "1")
+		if got, _ := s.FindById("1"); got.Room != "kitchen" {
+			t.Fatalf("got room %q; expected kitchen", got.Room)
+		}
+
+		if err := s.SetRoom([]string{"1"}, "missing"); err == nil {
+			t.Fatalf("expected an error for an unknown room")
+		}
+		if err := s.SetRoom([]string{"2", "missing"}, "kitchen"); err == nil {
+			t.Fatalf("expected an error for an unknown light")
+		}
+		inKitchen, _ = s.FindByRoom("kitchen")
+		assertIds(t, inKitchen, "1")
+	})
+
+	t.Run("DeleteRoom leaves its lights without a room", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		s.CreateRoom(Room{Id: "kitchen", Name: "kitchen"})
+		s.SetRoom([]string{"1"}, "kitchen")
+
+		if err := s.DeleteRoom("kitchen"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.DeleteRoom("kitchen"); err == nil {
+			t.Fatalf("expected an error for a deleted room")
+		}
+
+		if got, _ := s.FindById("1"); got.Room != "" {
+			t.Fatalf("got room %q; expected none", got.Room)
+		}
+		if rooms, _ := s.FindRooms(); len(rooms) != 0 {
+			t.Fatalf("got %+v; expected no rooms", rooms)
+		}
+	})
+
+	t.Run("Lights join and leave groups", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		mustUpsert(t, s, light("2", "bb", "10.0.0.2"))
+		s.CreateGroup(Group{Id: "reading", Name: "reading"})
+		s.CreateGroup(Group{Id: "ambient", Name: "ambient"})
+
+		if err := s.AddToGroup([]string{"1", "2"}, "reading"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.AddToGroup([]string{"1"}, "reading"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.AddToGroup([]string{"1"}, "ambient")
+		if err := s.RemoveFromGroup([]string{"2"}, "reading"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		reading, err := s.FindByGroup("reading")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertIds(t, reading, "1")
+		got, _ := s.FindById("1")
+		assertSameStrings(t, got.Groups, "ambient", "reading")
+
+		if err := s.AddToGroup([]string{"1"}, "missing"); err == nil {
+			t.Fatalf("expected an error for an unknown group")
+		}
+		if err := s.AddToGroup([]string{"missing"}, "reading"); err == nil {
+			t.Fatalf("expected an error for an unknown light")
+		}
+	})
+
+	t.Run("Groups are renamed and deleted", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		group, _ := s.CreateGroup(Group{Name: "reading"})
+		s.CreateGroup(Group{Name: "ambient"})
+		s.AddToGroup([]string{"1"}, group.Id)
+
+		if _, err := s.UpdateGroup(Group{Id: group.Id, Name: "ambient"}); err == nil {
+			t.Fatalf("expected an error for a duplicate name")
+		}
+		if _, err := s.UpdateGroup(Group{Id: group.Id, Name: "study"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		groups, _ := s.FindGroups()
+		if len(groups) != 2 || groups[0].Name != "ambient" || groups[1].Name != "study" {
+			t.Fatalf("got %+v; expected ambient and study", groups)
+		}
+
+		if err := s.DeleteGroup(group.Id); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got, _ := s.FindById("1")
+		assertSameStrings(t, got.Groups)
+	})
+
+	t.Run("EraseAll keeps rooms and groups but drops memberships", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		s.CreateRoom(Room{Id: "kitchen", Name: "kitchen"})
+		s.CreateGroup(Group{Id: "reading", Name: "reading"})
+		s.SetRoom([]string{"1"}, "kitchen")
+		s.AddToGroup([]string{"1"}, "reading")
+
+		s.EraseAll()
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+
+		got, _ := s.FindById("1")
+		if got.Room != "" || len(got.Groups) != 0 {
+			t.Fatalf("got %+v; expected a light without room or groups", got)
+		}
+		rooms, _ := s.FindRooms()
+		groups, _ := s.FindGroups()
+		if len(rooms) != 1 || len(groups) != 1 {
+			t.Fatalf("got %+v and %+v; expected the room and group to remain", rooms, groups)
+		}
+	})
+	t.Run("SetName names a light", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+
+		if err := s.SetName("1", "Desk"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.SetName("missing", "Desk"); err == nil {
+			t.Fatalf("expected an error for an unknown light")
+		}
+		mustUpsert(t, s, light("2", "aa", "10.0.0.9"))
+
+		if got, _ := s.FindById("1"); got.Name != "Desk" {
+			t.Fatalf("got name %q; expected Desk to survive an upsert", got.Name)
+		}
+	})
+
+	t.Run("Export then Import restores the inventory", func(t *testing.T) {
+		s := newStorage(t)
+		seedInventory(t, s)
+		exported, err := s.Export()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		target := newStorage(t)
+		if err := target.Import(*exported, ImportReplace); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got, _ := target.FindById("1")
+		if got.Name != "Desk" || got.Room != "kitchen" || got.MacAddress != "aa" {
+			t.Fatalf("got %+v; expected the exported light", got)
+		}
+		assertSameStrings(t, got.Tags, "lamp")
+		assertSameStrings(t, got.Groups, "reading")
+		rooms, _ := target.FindRooms()
+		if len(rooms) != 1 || rooms[0].Zone != "north" {
+			t.Fatalf("got %+v; expected the exported room", rooms)
+		}
+	})
+
+	t.Run("Import merge updates by MAC and keeps the rest", func(t *testing.T) {
+		s := newStorage(t)
+		seedInventory(t, s)
+		mustUpsert(t, s, light("local", "zz", "10.0.0.50"))
+
+		err := s.Import(Inventory{
+			Version: InventoryVersion,
+			Rooms:   []InventoryRoom{{Id: "r", Name: "kitchen", Floor: 1}, {Id: "g", Name: "garden"}},
+			Lights: []InventoryLight{
+				{Id: "other-id", Name: "Renamed", MacAddress: "aa", IpAddress: "10.0.0.1", Tags: []string{"strip"}, Room: "g"},
+				{Id: "3", MacAddress: "cc", IpAddress: "10.0.0.3"},
+			},
+		}, ImportMerge)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		got, _ := s.FindById("1")
+		if got.Name != "Renamed" {
+			t.Fatalf("got %+v; expected the light to keep its id and take the imported name", got)
+		}
+		assertSameStrings(t, got.Tags, "strip")
+		assertSameStrings(t, got.Groups)
+		garden, _ := s.FindByRoom(got.Room)
+		assertIds(t, garden, "1")
+		assertIds(t, mustFindAll(t, s), "1", "2", "local", "3")
+
+		rooms, _ := s.FindRooms()
+		if len(rooms) != 2 || rooms[0].Name != "garden" || rooms[1].Id != "kitchen" || rooms[1].Floor != 1 {
+			t.Fatalf("got %+v; expected the kitchen updated in place and the garden added", rooms)
+		}
+	})
+
+	t.Run("Import replace drops what is not imported", func(t *testing.T) {
+		s := newStorage(t)
+		seedInventory(t, s)
+
+		err := s.Import(Inventory{
+			Version: InventoryVersion,
+			Lights:  []InventoryLight{{Id: "3", MacAddress: "cc", IpAddress: "10.0.0.3"}},
+		}, ImportReplace)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assertIds(t, mustFindAll(t, s), "3")
+		rooms, _ := s.FindRooms()
+		groups, _ := s.FindGroups()
+		if len(rooms) != 0 || len(groups) != 0 {
+			t.Fatalf("got %+v and %+v; expected no rooms or groups", rooms, groups)
+		}
+	})
+
+	t.Run("A failed Import changes nothing", func(t *testing.T) {
+		s := newStorage(t)
+		seedInventory(t, s)
+
+		err := s.Import(Inventory{
+			Version: InventoryVersion,
+			Lights: []InventoryLight{
+				{Id: "3", MacAddress: "cc", IpAddress: "10.0.0.3"},
+				{Id: "4", MacAddress: "dd", IpAddress: "10.0.0.4", Room: "missing"},
+			},
+		}, ImportReplace)
+		if err == nil {
+			t.Fatalf("expected an error for an unknown room")
+		}
+
+		assertIds(t, mustFindAll(t, s), "1", "2")
+		if got, _ := s.FindById("1"); got.Room != "kitchen" {
+			t.Fatalf("got %+v; expected the light to keep its room", got)
+		}
+		if err := s.Import(Inventory{Version: 99}, ImportMerge); err == nil {
+			t.Fatalf("expected an error for an unknown version")
+		}
+	})
+
+	t.Run("Backups are listed newest first and capped", func(t *testing.T) {
+		s := newStorage(t)
+		seedInventory(t, s)
+
+		first, err := s.CreateBackup("first")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(first.Inventory.Lights) != 2 {
+			t.Fatalf("got %d lights; expected the backup to hold both", len(first.Inventory.Lights))
+		}
+		for i := 0; i < MaxBackups; i++ {
+			s.CreateBackup(fmt.Sprintf("backup %d", i))
+		}
+
+		backups, err := s.FindBackups()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(backups) != MaxBackups {
+			t.Fatalf("got %d backups; expected %d", len(backups), MaxBackups)
+		}
+		if backups[0].Reason != fmt.Sprintf("backup %d", MaxBackups-1) {
+			t.Fatalf("got %s first; expected the newest backup", backups[0].Reason)
+		}
+		for _, b := range backups {
+			if b.Id == first.Id {
+				t.Fatalf("expected the oldest backup to be dropped")
+			}
+		}
+
+		s.EraseAll()
+		if err := s.Import(backups[0].Inventory, ImportReplace); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertIds(t, mustFindAll(t, s), "1", "2")
+	})
+
+	t.Run("Upsert and MarkSeen record when a light was last seen", func(t *testing.T) {
+		s := newStorage(t)
+		before := time.Now().Add(-time.Second)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		mustUpsert(t, s, light("2", "bb", "10.0.0.2"))
+
+		got, _ := s.FindById("1")
+		if got.LastSeen.Before(before) {
+			t.Fatalf("got last seen %v; expected the time of the upsert", got.LastSeen)
+		}
+
+		monthAgo := time.Now().Add(-30 * 24 * time.Hour)
+		if err := s.MarkSeen("1", monthAgo); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.MarkSeen("missing", monthAgo); err == nil {
+			t.Fatalf("expected an error for an unknown light")
+		}
+
+		stale, err := s.FindUnseenSince(time.Now().Add(-7 * 24 * time.Hour))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertIds(t, stale, "1")
+		if !stale[0].LastSeen.Round(time.Second).Equal(monthAgo.Round(time.Second)) {
+			t.Fatalf("got last seen %v; expected %v", stale[0].LastSeen, monthAgo)
+		}
+
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		stale, _ = s.FindUnseenSince(time.Now().Add(-7 * 24 * time.Hour))
+		assertIds(t, stale)
+	})
+
+	t.Run("Delete removes one light and its memberships", func(t *testing.T) {
+		s := newStorage(t)
+		seedInventory(t, s)
+
+		if err := s.Delete("1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.Delete("1"); err == nil {
+			t.Fatalf("expected an error for a deleted light")
+		}
+
+		assertIds(t, mustFindAll(t, s), "2")
+		reading, _ := s.FindByGroup("reading")
+		assertIds(t, reading)
+
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+		got, _ := s.FindById("1")
+		if got.Room != "" || len(got.Groups) != 0 || got.Name != "" {
+			t.Fatalf("got %+v; expected a rediscovered light to start afresh", got)
+		}
+	})
+
+	t.Run("Power samples are found by light and time range, oldest first", func(t *testing.T) {
+		s := newStorage(t)
+		start := time.Now().Add(-time.Hour).Truncate(time.Second)
+		for i, watts := range []float64{30, 10, 20} {
+			if err := s.RecordPowerSample(PowerSample{LightId: "1", Time: start.Add(time.Duration(2-i) * time.Minute), Watts: watts}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		s.RecordPowerSample(PowerSample{LightId: "2", Time: start, Watts: 99})
+
+		samples, err := s.FindPowerSamples("1", start, start.Add(2*time.Minute))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(samples) != 2 || samples[0].Watts != 20 || samples[1].Watts != 10 || !samples[0].Time.Equal(start) {
+			t.Fatalf("got %+v; expected the first two minutes of light 1", samples)
+		}
+
+		removed, err := s.DeletePowerSamplesBefore(start.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if removed != 2 {
+			t.Fatalf("got %d removed samples; expected 2", removed)
+		}
+	})
+
+	t.Run("Jobs are stored with their schedule and last run", func(t *testing.T) {
+		s := newStorage(t)
+		job, err := s.CreateJob(Job{
+			Name:       "porch",
+			Schedule:   "30m before sunset",
+			TimeZone:   "Europe/Paris",
+			Command:    "on",
+			Lights:     LightSelection{Tags: "outdoor"},
+			Transition: 5 * time.Second,
+			Enabled:    true,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := s.CreateJob(Job{Name: "porch"}); err == nil {
+			t.Fatalf("expected an error for a name already used")
+		}
+
+		ranAt := time.Date(2025, 1, 6, 16, 30, 0, 0, time.UTC)
+		if err := s.MarkJobRun(job.Id, ranAt, "light 1 did not respond"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		job.Schedule = "at civil dusk +10m"
+		job.CatchUp = true
+		if _, err := s.UpdateJob(*job); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		jobs, err := s.FindJobs()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(jobs) != 1 {
+			t.Fatalf("got %d jobs; expected 1", len(jobs))
+		}
+		got := jobs[0]
+		if got.Schedule != "at civil dusk +10m" || !got.CatchUp || got.TimeZone != "Europe/Paris" || got.Lights.Tags != "outdoor" ||
+			got.Transition != 5*time.Second || !got.LastRun.Equal(ranAt) || got.LastError != "light 1 did not respond" {
+			t.Fatalf("got %+v; expected the updated job, run at %v", got, ranAt)
+		}
+
+		if err := s.DeleteJob(job.Id); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.DeleteJob(job.Id); err == nil {
+			t.Fatalf("expected an error deleting a missing job")
+		}
+	})
+
+	t.Run("Alarms are stored with their schedule and last run", func(t *testing.T) {
+		s := newStorage(t)
+		alarm, err := s.CreateAlarm(Alarm{
+			Name:    "workdays",
+			Hour:    7,
+			Minute:  15,
+			Days:    []time.Weekday{time.Monday, time.Friday},
+			Ramp:    30 * time.Minute,
+			Lights:  LightSelection{Ids: []string{"1", "2"}},
+			Enabled: true,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := s.CreateAlarm(Alarm{Name: "workdays"}); err == nil {
+			t.Fatalf("expected an error for a name already used")
+		}
+
+		ranAt := time.Date(2025, 1, 6, 7, 15, 0, 0, time.UTC)
+		if err := s.MarkAlarmRun(alarm.Id, ranAt); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		alarm.Enabled = false
+		alarm.Lights = LightSelection{Room: "bedroom"}
+		if _, err := s.UpdateAlarm(*alarm); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		alarms, err := s.FindAlarms()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(alarms) != 1 {
+			t.Fatalf("got %d alarms; expected 1", len(alarms))
+		}
+		got := alarms[0]
+		if got.Hour != 7 || got.Minute != 15 || got.Ramp != 30*time.Minute || got.Enabled || got.Lights.Room != "bedroom" ||
+			!slices.Equal(got.Days, []time.Weekday{time.Monday, time.Friday}) || !got.LastRun.Equal(ranAt) {
+			t.Fatalf("got %+v; expected the updated alarm, run at %v", got, ranAt)
+		}
+
+		if err := s.DeleteAlarm(alarm.Id); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.DeleteAlarm(alarm.Id); err == nil {
+			t.Fatalf("expected an error deleting a missing alarm")
+		}
+		if err := s.MarkAlarmRun(alarm.Id, ranAt); err == nil {
+			t.Fatalf("expected an error marking a missing alarm")
+		}
+	})
+
+	t.Run("Snapshots are saved by name, replacing older ones", func(t *testing.T) {
+		s := newStorage(t)
+		dim := wiz.Pilot{IsOn: true, Dimming: 20, Temp: 2700}
+		red := wiz.Pilot{IsOn: true, Color: &wiz.Rgb{R: 255}}
+
+		first, err := s.SaveSnapshot(Snapshot{Name: "movie-night", Lights: []SnapshotLight{{LightId: "1", Pilot: dim}}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.SaveSnapshot(Snapshot{Name: "all-off", Lights: []SnapshotLight{{LightId: "1"}}})
+		second, err := s.SaveSnapshot(Snapshot{Name: "movie-night", Lights: []SnapshotLight{{LightId: "1", Pilot: dim}, {LightId: "2", Pilot: red}}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if second.Id != first.Id {
+			t.Fatalf("got id %s; expected the snapshot replaced under %s", second.Id, first.Id)
+		}
+		if _, err := s.SaveSnapshot(Snapshot{}); err == nil {
+			t.Fatalf("expected an error for an empty name")
+		}
+
+		snapshots, err := s.FindSnapshots()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(snapshots) != 2 || snapshots[0].Name != "all-off" || snapshots[1].Name != "movie-night" {
+			t.Fatalf("got %+v; expected both snapshots by name", snapshots)
+		}
+
+		got, err := s.FindSnapshot("movie-night")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got.Lights) != 2 || !got.Lights[0].Pilot.Equal(dim) || !got.Lights[1].Pilot.Equal(red) {
+			t.Fatalf("got %+v; expected the lights of the last save", got.Lights)
+		}
+
+		if err := s.DeleteSnapshot("movie-night"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := s.FindSnapshot("movie-night"); err == nil {
+			t.Fatalf("expected an error for a deleted snapshot")
+		}
+		if err := s.DeleteSnapshot("movie-night"); err == nil {
+			t.Fatalf("expected an error deleting a missing snapshot")
+		}
+	})
+
+	t.Run("SetModel stores the model of a light", func(t *testing.T) {
+		s := newStorage(t)
+		mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+
+		if err := s.SetModel("1", "ESP10_SOCKET_06"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.SetModel("missing", "ESP10_SOCKET_06"); err == nil {
+			t.Fatalf("expected an error for an unknown light")
+		}
+		if got, _ := s.FindById("1"); got.Model != "ESP10_SOCKET_06" {
+			t.Fatalf("got %+v; expected the model stored", got)
+		}
+
+		inventory, _ := s.Export()
+		s.EraseAll()
+		if err := s.Import(*inventory, ImportMerge); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got, _ := s.FindById("1"); got.Model != "ESP10_SOCKET_06" {
+			t.Fatalf("got %+v; expected the model imported", got)
+		}
+	})
+
+	t.Run("Events are found by light and time range, oldest first", func(t *testing.T) {
+		s := newStorage(t)
+		on, off := true, false
+		start := time.Now().Add(-time.Hour).Truncate(time.Second)
+		watts := 7.5
+		record := func(offset time.Duration, command, lightId string, isOn *bool) {
+			t.Helper()
+			_, err := s.RecordEvent(Event{
+				Time:    start.Add(offset),
+				Source:  SourceCLI,
+				Command: command,
+				LightId: lightId,
+				Params:  map[string]string{"kelvin": "4000"},
+				IsOn:    isOn,
+				Dimming: 80,
+				Watts:   &watts,
+				Latency: 120 * time.Millisecond,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		record(2*time.Minute, "off", "1", &off)
+		record(time.Minute, "on", "1", &on)
+		record(3*time.Minute, "rename", "1", nil)
+		record(4*time.Minute, "on", "2", &on)
+		record(5*time.Minute, "discover", "", nil)
+
+		events, err := s.FindEvents(EventFilter{LightId: "1"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		assertCommands(t, events, "on", "off", "rename")
+		e := events[0]
+		if e.Id == 0 || e.Source != SourceCLI || e.Params["kelvin"] != "4000" || e.IsOn == nil || !*e.IsOn || e.Dimming != 80 || e.Watts == nil || *e.Watts != watts || e.Latency != 120*time.Millisecond || !e.Time.Equal(start.Add(time.Minute)) {
+			t.Fatalf("got %+v; expected the recorded event", e)
+		}
+
+		events, _ = s.FindEvents(EventFilter{Since: start.Add(2 * time.Minute), Until: start.Add(5 * time.Minute)})
+		assertCommands(t, events, "off", "rename", "on")
+		events, _ = s.FindEvents(EventFilter{LightId: "1", WithState: true, Limit: 1})
+		assertCommands(t, events, "off")
+		events, _ = s.FindEvents(EventFilter{Limit: 2})
+		assertCommands(t, events, "on", "discover")
+
+		// The off of light 1 is kept as its latest state.
+		removed, err := s.DeleteEventsBefore(start.Add(150 * time.Second))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if removed != 1 {
+			t.Fatalf("got %d removed events; expected 1", removed)
+		}
+		events, _ = s.FindEvents(EventFilter{})
+		assertCommands(t, events, "off", "rename", "on", "discover")
+
+		removed, _ = s.DeleteEventsBefore(start.Add(10 * time.Minute))
+		if removed != 2 {
+			t.Fatalf("got %d removed events; expected 2", removed)
+		}
+		events, _ = s.FindEvents(EventFilter{})
+		assertCommands(t, events, "off", "on")
+	})
+}
+
+func TestMemoryDB_Contract(t *testing.T) {
+	testStorageContract(t, func(t *testing.T) Storage {
+		return NewMemoryDB()
+	})
+}
+
+func TestSQLiteDB_Contract(t *testing.T) {
+	testStorageContract(t, func(t *testing.T) Storage {
+		s, err := NewSQLiteDB(filepath.Join(t.TempDir(), "lights.db"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return s
+	})
+}
+
+// TestMySQLDB_Contract runs against the database in GOWIZCLI_TEST_MYSQL_DSN,
+// which is wiped before each test. It is skipped without one; the test
+// workflow in .github runs it against a MySQL 8.4 container.
+func TestMySQLDB_Contract(t *testing.T) {
+	dsn := os.Getenv("GOWIZCLI_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("GOWIZCLI_TEST_MYSQL_DSN is not set")
+	}
+
+	testStorageContract(t, func(t *testing.T) Storage {
+		s, err := NewMySQLDB(dsn)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.EraseAll()
+		s.db.Exec("DELETE FROM rooms")
+		s.db.Exec("DELETE FROM light_groups")
+		s.db.Exec("DELETE FROM backups")
+		s.db.Exec("DELETE FROM events")
+		s.db.Exec("DELETE FROM power_samples")
+		s.db.Exec("DELETE FROM snapshots")
+		s.db.Exec("DELETE FROM alarms")
+		s.db.Exec("DELETE FROM jobs")
+		return s
+	})
+}
+
+// seedInventory stores lights 1 and 2, the first named Desk, tagged lamp, in
+// the kitchen room and the reading group.
+func seedInventory(t *testing.T, s Storage) {
+	t.Helper()
+	mustUpsert(t, s, light("1", "aa", "10.0.0.1"))
+	mustUpsert(t, s, light("2", "bb", "10.0.0.2"))
+	s.CreateRoom(Room{Id: "kitchen", Name: "kitchen", Zone: "north"})
+	s.CreateGroup(Group{Id: "reading", Name: "reading"})
+	if err := s.SetName("1", "Desk"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	one, _ := s.FindById("1")
+	s.AddTags([]wiz.Light{*one}, []string{"lamp"})
+	s.SetRoom([]string{"1"}, "kitchen")
+	s.AddToGroup([]string{"1"}, "reading")
+}
+
+func light(id, mac, ip string) wiz.Light {
+	return wiz.Light{Id: id, MacAddress: mac, IpAddress: ip}
+}
+
+func mustUpsert(t *testing.T, s Storage, l wiz.Light) {
+	t.Helper()
+	if _, err := s.Upsert(l); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func mustFindAll(t *testing.T, s Storage) []wiz.Light {
+	t.Helper()
+	all, err := s.FindAll()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return all
+}
+
+func assertSameStrings(t *testing.T, got []string, expected ...string) {
+	t.Helper()
+	sorted := append([]string{}, got...)
+	sort.Strings(sorted)
+	sort.Strings(expected)
+	if len(sorted) != len(expected) {
+		t.Fatalf("got %v; expected %v", got, expected)
+	}
+	for i := range sorted {
+		if sorted[i] != expected[i] {
+			t.Fatalf("got %v; expected %v", got, expected)
+		}
+	}
+}
+
+func assertIds(t *testing.T, lights []wiz.Light, expected ...string) {
+	t.Helper()
+	ids := make([]string, len(lights))
+	for i, l := range lights {
+		ids[i] = l.Id
+	}
+	assertSameStrings(t, ids, expected...)
+}
+
+func assertCommands(t *testing.T, events []Event, expected ...string) {
+	t.Helper()
+	got := make([]string, len(events))
+	for i, e := range events {
+		got[i] = e.Command
+	}
+	if !slices.Equal(got, expected) {
+		t.Fatalf("got commands %v; expected %v", got, expected)
+	}
+}
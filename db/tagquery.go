@@ -0,0 +1,269 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TagQuery selects lights by their tags. Tags combine with & (and), | or ,
+// (or) and ! (not), & binding tighter than | and parentheses grouping. A * in
+// a tag matches any run of characters, as in floor:*.
+//
+//	upstairs & !bedroom
+//	lamp | strip
+//	(kitchen, dining) & floor:*
+type TagQuery struct {
+	source string
+	root   tagNode
+}
+
+func ParseTagQuery(query string) (TagQuery, error) {
+	p := tagParser{tokens: tokenizeTagQuery(query)}
+	if len(p.tokens) == 0 {
+		return TagQuery{}, fmt.Errorf("empty tag query")
+	}
+
+	root, err := p.or()
+	if err != nil {
+		return TagQuery{}, fmt.Errorf("tag query %q: %w", query, err)
+	}
+	if t := p.peek(); t != "" {
+		return TagQuery{}, fmt.Errorf("tag query %q: unexpected %q", query, t)
+	}
+	return TagQuery{source: query, root: root}, nil
+}
+
+// AllTags is the query matching lights that have every one of tags.
+func AllTags(tags []string) TagQuery {
+	var root tagNode
+	for _, t := range tags {
+		var leaf tagNode = tagLeaf{pattern: t}
+		if root == nil {
+			root = leaf
+		} else {
+			root = tagAnd{root, leaf}
+		}
+	}
+	return TagQuery{source: strings.Join(tags, " & "), root: root}
+}
+
+func (q TagQuery) String() string {
+	return q.source
+}
+
+// Matches tells whether a light with the given tags is selected. The empty
+// query matches every light.
+func (q TagQuery) Matches(tags []string) bool {
+	return q.root == nil || q.root.matches(tags)
+}
+
+// where renders the query as a SQL condition on the tags column, with the
+// tag values as arguments.
+func (q TagQuery) where(d tagDialect) (string, []any) {
+	if q.root == nil {
+		return "1 = 1", nil
+	}
+	return q.root.sql(d)
+}
+
+// tagDialect renders a single tag test. hasTag matches a tag exactly and
+// hasTagLike a pattern where * matches any run of characters.
+type tagDialect struct {
+	hasTag     func(tag string) (string, []any)
+	hasTagLike func(pattern string) (string, []any)
+}
+
+type tagNode interface {
+	matches(tags []string) bool
+	sql(d tagDialect) (string, []any)
+}
+
+type tagLeaf struct {
+	pattern string
+}
+
+func (n tagLeaf) matches(tags []string) bool {
+	for _, t := range tags {
+		if wildcardMatch(n.pattern, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n tagLeaf) sql(d tagDialect) (string, []any) {
+	if strings.Contains(n.pattern, "*") {
+		return d.hasTagLike(n.pattern)
+	}
+	return d.hasTag(n.pattern)
+}
+
+type tagNot struct {
+	operand tagNode
+}
+
+func (n tagNot) matches(tags []string) bool {
+	return !n.operand.matches(tags)
+}
+
+func (n tagNot) sql(d tagDialect) (string, []any) {
+	query, args := n.operand.sql(d)
+	return "NOT (" + query + ")", args
+}
+
+type tagAnd struct {
+	left, right tagNode
+}
+
+func (n tagAnd) matches(tags []string) bool {
+	return n.left.matches(tags) && n.right.matches(tags)
+}
+
+func (n tagAnd) sql(d tagDialect) (string, []any) {
+	return binarySql(d, n.left, "AND", n.right)
+}
+
+type tagOr struct {
+	left, right tagNode
+}
+
+func (n tagOr) matches(tags []string) bool {
+	return n.left.matches(tags) || n.right.matches(tags)
+}
+
+func (n tagOr) sql(d tagDialect) (string, []any) {
+	return binarySql(d, n.left, "OR", n.right)
+}
+
+func binarySql(d tagDialect, left tagNode, operator string, right tagNode) (string, []any) {
+	leftQuery, leftArgs := left.sql(d)
+	rightQuery, rightArgs := right.sql(d)
+	return "(" + leftQuery + ") " + operator + " (" + rightQuery + ")", append(leftArgs, rightArgs...)
+}
+
+// wildcardMatch matches value against pattern, where * matches any run of
+// characters, including none.
+func wildcardMatch(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	return len(value) >= len(last) && strings.HasSuffix(value, last)
+}
+
+const tagOperators = "&|,!()"
+
+func tokenizeTagQuery(query string) []string {
+	var tokens []string
+	var tag strings.Builder
+	flush := func() {
+		if tag.Len() > 0 {
+			tokens = append(tokens, tag.String())
+			tag.Reset()
+		}
+	}
+
+	for _, r := range query {
+		switch {
+		case strings.ContainsRune(tagOperators, r):
+			flush()
+			tokens = append(tokens, string(r))
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		default:
+			tag.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+type tagParser struct {
+	tokens []string
+	next   int
+}
+
+func (p *tagParser) peek() string {
+	if p.next >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.next]
+}
+
+func (p *tagParser) take() string {
+	t := p.peek()
+	p.next++
+	return t
+}
+
+func (p *tagParser) or() (tagNode, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "|" || p.peek() == "," {
+		p.take()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = tagOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *tagParser) and() (tagNode, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&" {
+		p.take()
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = tagAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *tagParser) unary() (tagNode, error) {
+	switch t := p.take(); {
+	case t == "":
+		return nil, fmt.Errorf("unexpected end of query")
+	case t == "!":
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return tagNot{operand}, nil
+	case t == "(":
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.take() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		return inner, nil
+	case strings.Contains(tagOperators, t):
+		return nil, fmt.Errorf("unexpected %q", t)
+	default:
+		return tagLeaf{pattern: t}, nil
+	}
+}
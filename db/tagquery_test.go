@@ -0,0 +1,70 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestParseTagQuery_Matches(t *testing.T) {
+	tests := []struct {
+		query    string
+		tags     []string
+		expected bool
+	}{
+		{"kitchen", []string{"kitchen"}, true},
+		{"kitchen", []string{"kitchenette"}, false},
+		{"kitchen,dining", []string{"dining"}, true},
+		{"lamp | strip", []string{"bulb"}, false},
+		{"!outdoor", []string{"kitchen"}, true},
+		{"!outdoor", []string{"outdoor"}, false},
+		{"!outdoor", nil, true},
+		{"upstairs & !bedroom", []string{"upstairs", "bath"}, true},
+		{"upstairs & !bedroom", []string{"upstairs", "bedroom"}, false},
+		{"floor:*", []string{"floor:2"}, true},
+		{"floor:*", []string{"floor"}, false},
+		{"*lamp", []string{"desklamp"}, true},
+		{"a*b*c", []string{"axxbyyc"}, true},
+		{"a*b*c", []string{"acb"}, false},
+		{"a | b & c", []string{"a"}, true},
+		{"(a | b) & c", []string{"a"}, false},
+		{"!!a", []string{"a"}, true},
+		{"Kitchen", []string{"kitchen"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseTagQuery(tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := q.Matches(tt.tags); got != tt.expected {
+				t.Fatalf("got %v for %v; expected %v", got, tt.tags, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseTagQuery_Errors(t *testing.T) {
+	for _, query := range []string{"", "  ", "a &", "& a", "(a | b", "a)", "a !", "()", "a,,b"} {
+		t.Run(query, func(t *testing.T) {
+			if _, err := ParseTagQuery(query); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
+
+func TestTagQuery_Where(t *testing.T) {
+	d := tagDialect{
+		hasTag:     func(tag string) (string, []any) { return "has(?)", []any{tag} },
+		hasTagLike: func(pattern string) (string, []any) { return "like(?)", []any{pattern} },
+	}
+	q, _ := ParseTagQuery("upstairs & !(bed* | bath)")
+
+	where, args := q.where(d)
+	if where != "(has(?)) AND (NOT ((like(?)) OR (has(?))))" {
+		t.Fatalf("got %s; expected the nested condition", where)
+	}
+	if len(args) != 3 || args[0] != "upstairs" || args[1] != "bed*" || args[2] != "bath" {
+		t.Fatalf("got %v; expected the tags in order", args)
+	}
+}
@@ -0,0 +1,196 @@
+package luminance
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type CacheConfig struct {
+	TtlSec      int `yaml:"ttlSec"`
+	StaleTtlSec int `yaml:"staleTtlSec"`
+}
+
+type CachedAstronomy struct {
+	source Astronomy
+	cache  *cache[AstronomyData]
+}
+
+func NewCachedAstronomy(source Astronomy, config CacheConfig) *CachedAstronomy {
+	return &CachedAstronomy{
+		source: source,
+		cache:  newCache[AstronomyData](config),
+	}
+}
+
+func (c *CachedAstronomy) GetSolarElevation(latitude, longitude float64) (*AstronomyData, error) {
+	data, err := c.cache.get(cacheKey(latitude, longitude), func() (AstronomyData, error) {
+		data, err := c.source.GetSolarElevation(latitude, longitude)
+		if err != nil {
+			return AstronomyData{}, err
+		}
+		return *data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// LastKnown returns an Astronomy that answers with the last value fetched by
+// this cache, regardless of its age.
+func (c *CachedAstronomy) LastKnown() Astronomy {
+	return lastKnownAstronomy{cache: c.cache}
+}
+
+type CachedMeteorology struct {
+	source Meteorology
+	cache  *cache[MeteorologyData]
+}
+
+func NewCachedMeteorology(source Meteorology, config CacheConfig) *CachedMeteorology {
+	return &CachedMeteorology{
+		source: source,
+		cache:  newCache[MeteorologyData](config),
+	}
+}
+
+func (c *CachedMeteorology) GetCurrent(latitude, longitude float64) (*MeteorologyData, error) {
+	data, err := c.cache.get(cacheKey(latitude, longitude), func() (MeteorologyData, error) {
+		data, err := c.source.GetCurrent(latitude, longitude)
+		if err != nil {
+			return MeteorologyData{}, err
+		}
+		return *data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// LastKnown returns a Meteorology that answers with the last value fetched by
+// this cache, regardless of its age.
+func (c *CachedMeteorology) LastKnown() Meteorology {
+	return lastKnownMeteorology{cache: c.cache}
+}
+
+type lastKnownAstronomy struct {
+	cache *cache[AstronomyData]
+}
+
+func (l lastKnownAstronomy) GetSolarElevation(latitude, longitude float64) (*AstronomyData, error) {
+	data, ok := l.cache.lastKnown(cacheKey(latitude, longitude))
+	if !ok {
+		return nil, fmt.Errorf("no astronomy data known for %v,%v", latitude, longitude)
+	}
+	return &data, nil
+}
+
+type lastKnownMeteorology struct {
+	cache *cache[MeteorologyData]
+}
+
+func (l lastKnownMeteorology) GetCurrent(latitude, longitude float64) (*MeteorologyData, error) {
+	data, ok := l.cache.lastKnown(cacheKey(latitude, longitude))
+	if !ok {
+		return nil, fmt.Errorf("no meteorology data known for %v,%v", latitude, longitude)
+	}
+	return &data, nil
+}
+
+// cache keeps one entry per location. Entries younger than the TTL are served
+// as they are. Entries older than the TTL but within the stale window are
+// served while a background refresh runs. Anything older is fetched again.
+type cache[T any] struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	entries map[string]*cacheEntry[T]
+	ttl     time.Duration
+	stale   time.Duration
+	now     func() time.Time
+}
+
+type cacheEntry[T any] struct {
+	value      T
+	fetchedAt  time.Time
+	refreshing bool
+}
+
+func newCache[T any](config CacheConfig) *cache[T] {
+	return &cache[T]{
+		entries: make(map[string]*cacheEntry[T]),
+		ttl:     time.Duration(config.TtlSec) * time.Second,
+		stale:   time.Duration(config.StaleTtlSec) * time.Second,
+		now:     time.Now,
+	}
+}
+
+func (c *cache[T]) get(key string, fetch func() (T, error)) (T, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok {
+		age := c.now().Sub(entry.fetchedAt)
+		if age < c.ttl {
+			c.mu.Unlock()
+			return entry.value, nil
+		}
+		if age < c.ttl+c.stale {
+			if !entry.refreshing {
+				entry.refreshing = true
+				c.wg.Add(1)
+				go c.refresh(key, fetch)
+			}
+			c.mu.Unlock()
+			return entry.value, nil
+		}
+	}
+	c.mu.Unlock()
+
+	value, err := fetch()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	c.store(key, value)
+	return value, nil
+}
+
+func (c *cache[T]) refresh(key string, fetch func() (T, error)) {
+	defer c.wg.Done()
+
+	value, err := fetch()
+	if err != nil {
+		c.mu.Lock()
+		if entry, ok := c.entries[key]; ok {
+			entry.refreshing = false
+		}
+		c.mu.Unlock()
+		return
+	}
+	c.store(key, value)
+}
+
+func (c *cache[T]) store(key string, value T) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = &cacheEntry[T]{
+		value:     value,
+		fetchedAt: c.now(),
+	}
+}
+
+func (c *cache[T]) lastKnown(key string) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func cacheKey(latitude, longitude float64) string {
+	return fmt.Sprintf("%.4f,%.4f", latitude, longitude)
+}
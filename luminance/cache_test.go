@@ -0,0 +1,219 @@
+package luminance
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCachedMeteorology_ServesFreshEntries(t *testing.T) {
+	source := &fakeMeteorology{data: []MeteorologyData{{CloudCover: 10}, {CloudCover: 20}}}
+	cached, clock := newTestCachedMeteorology(source)
+
+	first, _ := cached.GetCurrent(1, 2)
+	*clock = clock.Add(30 * time.Second)
+	second, _ := cached.GetCurrent(1, 2)
+
+	if source.calls != 1 {
+		t.Fatalf("got %d calls; expected 1", source.calls)
+	}
+	if first.CloudCover != 10 || second.CloudCover != 10 {
+		t.Fatalf("got %v and %v; expected 10 both times", first.CloudCover, second.CloudCover)
+	}
+}
+
+func TestCachedMeteorology_StaleWhileRevalidate(t *testing.T) {
+	source := &fakeMeteorology{data: []MeteorologyData{{CloudCover: 10}, {CloudCover: 20}}}
+	cached, clock := newTestCachedMeteorology(source)
+
+	cached.GetCurrent(1, 2)
+	*clock = clock.Add(90 * time.Second)
+	stale, _ := cached.GetCurrent(1, 2)
+	cached.cache.wg.Wait()
+	refreshed, _ := cached.GetCurrent(1, 2)
+
+	if stale.CloudCover != 10 {
+		t.Fatalf("got %v; expected the stale value 10", stale.CloudCover)
+	}
+	if refreshed.CloudCover != 20 {
+		t.Fatalf("got %v; expected the refreshed value 20", refreshed.CloudCover)
+	}
+	if source.calls != 2 {
+		t.Fatalf("got %d calls; expected 2", source.calls)
+	}
+}
+
+func TestCachedMeteorology_ExpiredEntriesAreFetched(t *testing.T) {
+	source := &fakeMeteorology{data: []MeteorologyData{{CloudCover: 10}, {CloudCover: 20}}}
+	cached, clock := newTestCachedMeteorology(source)
+
+	cached.GetCurrent(1, 2)
+	*clock = clock.Add(10 * time.Minute)
+	got, _ := cached.GetCurrent(1, 2)
+
+	if got.CloudCover != 20 {
+		t.Fatalf("got %v; expected 20", got.CloudCover)
+	}
+}
+
+func TestNewMeteorology_FallbackChain(t *testing.T) {
+	source := &fakeMeteorology{data: []MeteorologyData{{CloudCover: 35}}, failAfter: 1}
+	meteorology, err := NewMeteorology(source, CacheConfig{}, []string{FallbackLastKnown, FallbackSeasonalAverage})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	meteorology.GetCurrent(1, 2)
+	lastKnown, err := meteorology.GetCurrent(1, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lastKnown.CloudCover != 35 {
+		t.Fatalf("got %v; expected the last known value 35", lastKnown.CloudCover)
+	}
+
+	seasonal, err := meteorology.GetCurrent(50, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if seasonal.CloudCover <= 0 || seasonal.CloudCover > 100 {
+		t.Fatalf("got %v; expected a seasonal average", seasonal.CloudCover)
+	}
+}
+
+func TestNewMeteorology_UnknownFallback(t *testing.T) {
+	_, err := NewMeteorology(&fakeMeteorology{}, CacheConfig{}, []string{"crystalBall"})
+	if err == nil {
+		t.Fatalf("expected an error for an unknown fallback")
+	}
+}
+
+func TestNewAstronomy_SolarPositionFallback(t *testing.T) {
+	astronomy, err := NewAstronomy(failingAstronomy{}, CacheConfig{}, []string{FallbackSolarPosition})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := astronomy.GetSolarElevation(-34.6, -58.4)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.SunAltitude < -90 || got.SunAltitude > 90 {
+		t.Fatalf("got %v; expected a valid elevation", got.SunAltitude)
+	}
+}
+
+func TestSolarElevation(t *testing.T) {
+	tests := []struct {
+		name      string
+		latitude  float64
+		longitude float64
+		when      time.Time
+		expected  float64
+	}{
+		{
+			name:      "Equator at noon on the March equinox",
+			latitude:  0,
+			longitude: 0,
+			when:      time.Date(2025, time.March, 20, 12, 7, 0, 0, time.UTC),
+			expected:  90,
+		},
+		{
+			name:      "Buenos Aires at noon on the June solstice",
+			latitude:  -34.6,
+			longitude: -58.4,
+			when:      time.Date(2025, time.June, 21, 15, 55, 0, 0, time.UTC),
+			expected:  32,
+		},
+		{
+			name:      "Buenos Aires at midnight on the June solstice",
+			latitude:  -34.6,
+			longitude: -58.4,
+			when:      time.Date(2025, time.June, 21, 3, 55, 0, 0, time.UTC),
+			expected:  -79,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SolarElevation(tt.latitude, tt.longitude, tt.when)
+			if got < tt.expected-0.5 || got > tt.expected+0.5 {
+				t.Fatalf("got %f; expected %f", got, tt.expected)
+			}
+		})
+	}
+}
+
+func newTestCachedMeteorology(source Meteorology) (*CachedMeteorology, *time.Time) {
+	clock := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	cached := NewCachedMeteorology(source, CacheConfig{TtlSec: 60, StaleTtlSec: 120})
+	cached.cache.now = func() time.Time { return clock }
+	return cached, &clock
+}
+
+type fakeMeteorology struct {
+	data      []MeteorologyData
+	calls     int
+	failAfter int
+}
+
+func (f *fakeMeteorology) GetCurrent(latitude, longitude float64) (*MeteorologyData, error) {
+	f.calls++
+	if f.failAfter > 0 && f.calls > f.failAfter {
+		return nil, errors.New("provider unavailable")
+	}
+	if len(f.data) == 0 {
+		return nil, errors.New("no data")
+	}
+	data := f.data[min(f.calls, len(f.data))-1]
+	return &data, nil
+}
+
+type failingAstronomy struct {
+}
+
+func (f failingAstronomy) GetSolarElevation(latitude, longitude float64) (*AstronomyData, error) {
+	return nil, errors.New("provider unavailable")
+}
+
+func TestSolarEventTime(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+	summer := time.Date(2025, time.June, 21, 0, 0, 0, 0, paris)
+	winter := time.Date(2025, time.December, 21, 0, 0, 0, 0, paris)
+
+	tests := []struct {
+		date     time.Time
+		event    SolarEvent
+		expected time.Time
+	}{
+		{summer, Sunrise, time.Date(2025, time.June, 21, 5, 47, 0, 0, paris)},
+		{summer, SolarNoon, time.Date(2025, time.June, 21, 13, 52, 0, 0, paris)},
+		{summer, Sunset, time.Date(2025, time.June, 21, 21, 58, 0, 0, paris)},
+		{summer, CivilDusk, time.Date(2025, time.June, 21, 22, 40, 0, 0, paris)},
+		{winter, Sunrise, time.Date(2025, time.December, 21, 8, 42, 0, 0, paris)},
+		{winter, Sunset, time.Date(2025, time.December, 21, 16, 56, 0, 0, paris)},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.date.Format(time.DateOnly), tt.event), func(t *testing.T) {
+			got, ok := SolarEventTime(48.8566, 2.3522, tt.date, tt.event)
+			if !ok {
+				t.Fatalf("expected the event to happen")
+			}
+			if diff := got.Sub(tt.expected).Abs(); diff > 3*time.Minute {
+				t.Fatalf("got %v; expected %v", got, tt.expected)
+			}
+			if got.Location() != paris {
+				t.Fatalf("got %v; expected the time in Paris", got.Location())
+			}
+		})
+	}
+
+	if _, ok := SolarEventTime(78.2, 15.6, time.Date(2025, time.June, 21, 0, 0, 0, 0, time.UTC), Sunset); ok {
+		t.Fatalf("expected no sunset on a polar day")
+	}
+}
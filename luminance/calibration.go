@@ -0,0 +1,355 @@
+package luminance
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type LuxMeasurement struct {
+	Time       time.Time
+	Lux        float64
+	CloudCover *float64
+}
+
+type CalibrationProfile struct {
+	Latitude     float64   `yaml:"latitude"`
+	Longitude    float64   `yaml:"longitude"`
+	CalibratedAt time.Time `yaml:"calibratedAt"`
+	Samples      int       `yaml:"samples"`
+	RmseLux      float64   `yaml:"rmseLux"`
+	Calibration  `yaml:",inline"`
+}
+
+type CalibrationProfiles struct {
+	Profiles []CalibrationProfile `yaml:"profiles"`
+}
+
+// Calibrator replays the model inputs at the time of each measurement and fits
+// the cloud loss coefficient, cloud exponent and efficacy scale to them. The
+// elevation of the location comes from Meteorology, as for the estimates, or
+// is the sea level without it.
+type Calibrator struct {
+	History     MeteorologyHistory
+	Meteorology Meteorology
+	Turbidity   Turbidity
+}
+
+func (c Calibrator) Calibrate(latitude, longitude float64, measurements []LuxMeasurement) (*CalibrationProfile, error) {
+	if len(measurements) == 0 {
+		return nil, errors.New("no measurements to calibrate with")
+	}
+
+	hourly, err := c.history(latitude, longitude, measurements)
+	if err != nil {
+		return nil, err
+	}
+	altitude, err := c.altitude(latitude, longitude)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]calibrationSample, 0, len(measurements))
+	for _, m := range measurements {
+		elevation := SolarElevation(latitude, longitude, m.Time)
+		if elevation < CalibrationMinSolarElevationDeg {
+			continue
+		}
+
+		weather, ok := nearestHour(hourly, m.Time)
+		if m.CloudCover != nil {
+			weather.CloudCover = *m.CloudCover
+		} else if !ok {
+			continue
+		}
+
+		linkeTurbidity := LinkeTurbidityDefault
+		if c.Turbidity != nil {
+			if tl, err := c.Turbidity.GetLinkeTurbidity(latitude, longitude, m.Time); err == nil {
+				linkeTurbidity = tl
+			}
+		}
+
+		airMass := airmassKastenYoung(elevation)
+		e0 := eccentricityFactor(m.Time.YearDay())
+		samples = append(samples, calibrationSample{
+			solarElevationDeg: elevation,
+			airMass:           airMass,
+			eccentricity:      e0,
+			ghiClear:          clearSkyGHI(altitude, linkeTurbidity, elevation, airMass, e0),
+			dniClear:          clearSkyDNI(altitude, linkeTurbidity, airMass, e0),
+			cloudCover:        math.Max(0, math.Min(100, weather.CloudCover)),
+			lux:               m.Lux,
+		})
+	}
+
+	if len(samples) < CalibrationMinSamples {
+		return nil, fmt.Errorf("only %d measurements were taken in daylight, at least %d are needed", len(samples), CalibrationMinSamples)
+	}
+
+	calibration, rmse := fitCalibration(samples)
+	return &CalibrationProfile{
+		Latitude:     latitude,
+		Longitude:    longitude,
+		CalibratedAt: time.Now().UTC(),
+		Samples:      len(samples),
+		RmseLux:      rmse,
+		Calibration:  calibration,
+	}, nil
+}
+
+func (c Calibrator) altitude(latitude, longitude float64) (float64, error) {
+	if c.Meteorology == nil {
+		return 0, nil
+	}
+	data, err := c.Meteorology.GetCurrent(latitude, longitude)
+	if err != nil {
+		return 0, fmt.Errorf("error getting the elevation: %w", err)
+	}
+	return data.Elevation, nil
+}
+
+func (c Calibrator) history(latitude, longitude float64, measurements []LuxMeasurement) ([]HourlyMeteorology, error) {
+	from, to := measurements[0].Time, measurements[0].Time
+	needed := false
+	for _, m := range measurements {
+		if m.Time.Before(from) {
+			from = m.Time
+		}
+		if m.Time.After(to) {
+			to = m.Time
+		}
+		needed = needed || m.CloudCover == nil
+	}
+
+	if !needed {
+		return nil, nil
+	}
+	if c.History == nil {
+		return nil, errors.New("measurements have no cloud cover and no meteorology history is configured")
+	}
+
+	hourly, err := c.History.GetHourly(latitude, longitude, from, to)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(hourly, func(i, j int) bool { return hourly[i].Time.Before(hourly[j].Time) })
+	return hourly, nil
+}
+
+func nearestHour(hourly []HourlyMeteorology, when time.Time) (HourlyMeteorology, bool) {
+	i := sort.Search(len(hourly), func(i int) bool { return !hourly[i].Time.Before(when) })
+
+	best := -1
+	for _, candidate := range []int{i - 1, i} {
+		if candidate < 0 || candidate >= len(hourly) {
+			continue
+		}
+		if best < 0 || absDuration(hourly[candidate].Time.Sub(when)) < absDuration(hourly[best].Time.Sub(when)) {
+			best = candidate
+		}
+	}
+
+	if best < 0 || absDuration(hourly[best].Time.Sub(when)) > time.Hour {
+		return HourlyMeteorology{}, false
+	}
+	return hourly[best], true
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// calibrationSample keeps the parts of the model inputs that do not depend on
+// the coefficients being fitted.
+type calibrationSample struct {
+	solarElevationDeg float64
+	airMass           float64
+	eccentricity      float64
+	ghiClear          float64
+	dniClear          float64
+	cloudCover        float64
+	lux               float64
+}
+
+func (s calibrationSample) predict(lossCoefficient, exponent float64) float64 {
+	kc := cloudClearSkyIndex(s.cloudCover, lossCoefficient, exponent)
+	irradiance := splitIrradiance(s.ghiClear*kc, s.dniClear, s.cloudCover/100.0, s.solarElevationDeg)
+	efficacy := perezEfficacy(irradiance, s.solarElevationDeg, s.airMass, s.eccentricity)
+	return irradiance.directHorizontal*efficacy.direct + irradiance.diffuse*efficacy.diffuse
+}
+
+// fitCalibration minimizes the squared error of the daytime model over the
+// cloud loss coefficient, the cloud exponent and the efficacy scale. For given
+// cloud coefficients the model is linear in the efficacy scale, so only the
+// first two are searched, first on a coarse grid and then around its best
+// point.
+func fitCalibration(samples []calibrationSample) (Calibration, float64) {
+	defaults := DefaultCalibration()
+
+	if !hasCloudVariety(samples) {
+		// Without cloud cover variety only the efficacy can be identified.
+		scale, sse := fitEfficacyScale(samples, defaults.CloudLossCoefficient, defaults.CloudExponent)
+		defaults.EfficacyScale = scale
+		return defaults, math.Sqrt(sse / float64(len(samples)))
+	}
+
+	best := defaults
+	bestSse := math.Inf(1)
+	search := func(lossFrom, lossTo, lossStep, expFrom, expTo, expStep float64) {
+		for loss := lossFrom; loss <= lossTo+1e-9; loss += lossStep {
+			if loss < 0 || loss > 1 {
+				continue
+			}
+			for exponent := expFrom; exponent <= expTo+1e-9; exponent += expStep {
+				if exponent < CalibrationMinExponent || exponent > CalibrationMaxExponent {
+					continue
+				}
+				scale, sse := fitEfficacyScale(samples, loss, exponent)
+				if sse < bestSse {
+					bestSse = sse
+					best = Calibration{
+						CloudLossCoefficient: loss,
+						CloudExponent:        exponent,
+						EfficacyScale:        scale,
+					}
+				}
+			}
+		}
+	}
+
+	search(0, 1, CalibrationCoarseLossStep, CalibrationMinExponent, CalibrationMaxExponent, CalibrationCoarseExponentStep)
+	loss, exponent := best.CloudLossCoefficient, best.CloudExponent
+	search(loss-CalibrationCoarseLossStep, loss+CalibrationCoarseLossStep, CalibrationFineLossStep,
+		exponent-CalibrationCoarseExponentStep, exponent+CalibrationCoarseExponentStep, CalibrationFineExponentStep)
+
+	return best, math.Sqrt(bestSse / float64(len(samples)))
+}
+
+func hasCloudVariety(samples []calibrationSample) bool {
+	lowest, highest := samples[0].cloudCover, samples[0].cloudCover
+	for _, s := range samples {
+		lowest = math.Min(lowest, s.cloudCover)
+		highest = math.Max(highest, s.cloudCover)
+	}
+	return highest-lowest >= CalibrationMinCloudCoverRange
+}
+
+func fitEfficacyScale(samples []calibrationSample, lossCoefficient, exponent float64) (float64, float64) {
+	predictions := make([]float64, len(samples))
+	var sxx, sxy float64
+	for i, s := range samples {
+		predictions[i] = s.predict(lossCoefficient, exponent)
+		sxx += predictions[i] * predictions[i]
+		sxy += predictions[i] * s.lux
+	}
+
+	scale := 1.0
+	if sxx > 0 {
+		scale = sxy / sxx
+	}
+
+	sse := 0.0
+	for i, s := range samples {
+		residual := scale*predictions[i] - s.lux
+		sse += residual * residual
+	}
+	return scale, sse
+}
+
+func LoadCalibrationProfiles(file string) (CalibrationProfiles, error) {
+	var profiles CalibrationProfiles
+	if file == "" {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return profiles, nil
+	}
+	if err != nil {
+		return profiles, err
+	}
+
+	if err := yaml.Unmarshal(data, &profiles); err != nil {
+		return profiles, err
+	}
+	for i := range profiles.Profiles {
+		profiles.Profiles[i].Calibration = profiles.Profiles[i].upgraded()
+	}
+	return profiles, nil
+}
+
+// legacyLuminousEfficacy_LuxPerWm2 is the efficacy the model used before
+// the Perez efficacies, which the efficacy scale of a profile that fitted a
+// single efficacy is relative to.
+const legacyLuminousEfficacy_LuxPerWm2 = 120.0
+
+// upgraded keeps the calibration of a profile fitted to a single luminous
+// efficacy, as the ratio of that efficacy to the one the model assumed.
+func (c Calibration) upgraded() Calibration {
+	if c.LegacyLuminousEfficacy > 0 && c.EfficacyScale == 0 {
+		c.EfficacyScale = c.LegacyLuminousEfficacy / legacyLuminousEfficacy_LuxPerWm2
+	}
+	c.LegacyLuminousEfficacy = 0
+	return c
+}
+
+func (p CalibrationProfiles) Save(file string) error {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// With returns the profiles with the given one added, replacing any existing
+// profile for the same location.
+func (p CalibrationProfiles) With(profile CalibrationProfile) CalibrationProfiles {
+	result := CalibrationProfiles{Profiles: make([]CalibrationProfile, 0, len(p.Profiles)+1)}
+	for _, existing := range p.Profiles {
+		if !sameLocation(existing.Latitude, existing.Longitude, profile.Latitude, profile.Longitude) {
+			result.Profiles = append(result.Profiles, existing)
+		}
+	}
+	result.Profiles = append(result.Profiles, profile)
+	return result
+}
+
+func (p CalibrationProfiles) For(latitude, longitude float64) *Calibration {
+	for _, profile := range p.Profiles {
+		if sameLocation(profile.Latitude, profile.Longitude, latitude, longitude) {
+			calibration := profile.Calibration
+			return &calibration
+		}
+	}
+	return nil
+}
+
+func sameLocation(lat1, lon1, lat2, lon2 float64) bool {
+	return math.Abs(lat1-lat2) <= CalibrationLocationToleranceDeg && math.Abs(lon1-lon2) <= CalibrationLocationToleranceDeg
+}
+
+const (
+	CalibrationMinSolarElevationDeg = 2.0
+	CalibrationMinSamples           = 3
+	CalibrationLocationToleranceDeg = 0.01
+)
+
+const (
+	CalibrationMinExponent        = 0.5
+	CalibrationMaxExponent        = 8.0
+	CalibrationMinCloudCoverRange = 10.0
+	CalibrationCoarseLossStep     = 0.02
+	CalibrationFineLossStep       = 0.002
+	CalibrationCoarseExponentStep = 0.1
+	CalibrationFineExponentStep   = 0.005
+)
@@ -0,0 +1,133 @@
+package luminance
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalibrator_RecoversCoefficients(t *testing.T) {
+	expected := Calibration{
+		CloudLossCoefficient: 0.6,
+		CloudExponent:        2.5,
+		EfficacyScale:        0.8,
+	}
+	latitude, longitude := -34.60734, -58.44329
+
+	start := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	var hourly []HourlyMeteorology
+	var measurements []LuxMeasurement
+	for i := 0; i < 24*14; i++ {
+		when := start.Add(time.Duration(i) * time.Hour)
+		cloudCover := float64((i * 37) % 101)
+		hourly = append(hourly, HourlyMeteorology{Time: when, CloudCover: cloudCover})
+
+		input := ModelInput{
+			SolarElevationDeg:    SolarElevation(latitude, longitude, when),
+			CloudCoverPercentage: cloudCover,
+			AltitudeMeters:       25,
+			DayOfYear:            when.YearDay(),
+			LinkeTurbidity:       LinkeTurbidityDefault,
+			Calibration:          &expected,
+		}
+		if input.SolarElevationDeg <= 0 {
+			continue
+		}
+		measurements = append(measurements, LuxMeasurement{Time: when, Lux: EstimateLux(input).Lux})
+	}
+
+	calibrator := Calibrator{History: fakeHistory{hourly: hourly}, Meteorology: &fakeMeteorology{data: []MeteorologyData{{Elevation: 25}}}}
+	profile, err := calibrator.Calibrate(latitude, longitude, measurements)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if math.Abs(profile.CloudLossCoefficient-expected.CloudLossCoefficient) > 0.02 ||
+		math.Abs(profile.CloudExponent-expected.CloudExponent) > 0.1 ||
+		math.Abs(profile.EfficacyScale-expected.EfficacyScale) > 0.005 {
+		t.Fatalf("got %+v; expected %+v", profile.Calibration, expected)
+	}
+	if profile.RmseLux > 1 {
+		t.Fatalf("got RMSE %f; expected a near perfect fit", profile.RmseLux)
+	}
+}
+
+func TestCalibrator_NotEnoughDaylight(t *testing.T) {
+	cloudCover := 0.0
+	measurements := []LuxMeasurement{
+		{Time: time.Date(2025, time.March, 1, 5, 0, 0, 0, time.UTC), Lux: 0, CloudCover: &cloudCover},
+	}
+
+	_, err := Calibrator{}.Calibrate(-34.60734, -58.44329, measurements)
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestCalibrationProfiles_SaveAndLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "calibration.yaml")
+
+	profiles := CalibrationProfiles{}.
+		With(CalibrationProfile{Latitude: 10, Longitude: 20, Calibration: Calibration{EfficacyScale: 1.0}}).
+		With(CalibrationProfile{Latitude: 30, Longitude: 40, Calibration: Calibration{EfficacyScale: 1.1}}).
+		With(CalibrationProfile{Latitude: 10, Longitude: 20, Calibration: Calibration{EfficacyScale: 1.05}})
+	if err := profiles.Save(file); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := LoadCalibrationProfiles(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(loaded.Profiles) != 2 {
+		t.Fatalf("got %d profiles; expected 2", len(loaded.Profiles))
+	}
+	if got := loaded.For(10.001, 20); got == nil || got.EfficacyScale != 1.05 {
+		t.Fatalf("got %+v; expected the replaced profile", got)
+	}
+	if got := loaded.For(50, 60); got != nil {
+		t.Fatalf("got %+v; expected no profile", got)
+	}
+}
+
+func TestLoadCalibrationProfiles_ReadsTheLuminousEfficacy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "calibration.yaml")
+	legacy := `profiles:
+  - latitude: 10
+    longitude: 20
+    cloudLossCoefficient: 0.7
+    cloudExponent: 3.2
+    luminousEfficacy: 132
+`
+	if err := os.WriteFile(file, []byte(legacy), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := LoadCalibrationProfiles(file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := loaded.For(10, 20)
+	if got == nil || math.Abs(got.EfficacyScale-1.1) > 1e-9 || got.CloudExponent != 3.2 || got.LegacyLuminousEfficacy != 0 {
+		t.Fatalf("got %+v; expected an efficacy scale of 1.1", got)
+	}
+
+	if err := loaded.Save(file); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	saved, _ := os.ReadFile(file)
+	if strings.Contains(string(saved), "luminousEfficacy") || !strings.Contains(string(saved), "efficacyScale: 1.1") {
+		t.Fatalf("got %s; expected the profile saved with its efficacy scale", saved)
+	}
+}
+
+type fakeHistory struct {
+	hourly []HourlyMeteorology
+}
+
+func (f fakeHistory) GetHourly(latitude, longitude float64, from, to time.Time) ([]HourlyMeteorology, error) {
+	return f.hourly, nil
+}
@@ -0,0 +1,40 @@
+package luminance
+
+import "math"
+
+// estimateCCT returns the correlated color temperature of daylight in kelvin.
+// Direct sunlight goes from a warm glow at the horizon to neutral white at
+// high elevations, while an overcast sky stays bluish all day. Both are blended
+// by cloud fraction in mired space, where equal steps look equally different.
+// Below the horizon the horizon value is kept so evenings stay warm.
+func estimateCCT(solarElevationDeg, cloudCoverPercentage float64) float64 {
+	elevation := math.Max(0, solarElevationDeg)
+	cloudFraction := math.Max(0, math.Min(1, cloudCoverPercentage/100.0))
+
+	clear := CCTHorizonK + (CCTClearNoonK-CCTHorizonK)*(1-math.Exp(-elevation/CCTClearElevationScaleDeg))
+	overcast := CCTHorizonK + (CCTOvercastK-CCTHorizonK)*(1-math.Exp(-elevation/CCTOvercastElevationScaleDeg))
+
+	mired := (1-cloudFraction)*kelvinToMired(clear) + cloudFraction*kelvinToMired(overcast)
+	return kelvinToMired(mired)
+}
+
+// kelvinToMired converts in both directions, as the mired is 10^6 / K.
+func kelvinToMired(value float64) float64 {
+	return 1e6 / value
+}
+
+// ScaleCCT maps a daylight color temperature from the model range onto the
+// [minK, maxK] range of a light, linearly in mired space.
+func ScaleCCT(cctKelvin, minK, maxK float64) float64 {
+	position := (kelvinToMired(CCTHorizonK) - kelvinToMired(cctKelvin)) / (kelvinToMired(CCTHorizonK) - kelvinToMired(CCTOvercastK))
+	position = math.Max(0, math.Min(1, position))
+	return kelvinToMired(kelvinToMired(minK) + position*(kelvinToMired(maxK)-kelvinToMired(minK)))
+}
+
+const (
+	CCTHorizonK                  = 2000.0
+	CCTClearNoonK                = 5800.0
+	CCTOvercastK                 = 7000.0
+	CCTClearElevationScaleDeg    = 12.0
+	CCTOvercastElevationScaleDeg = 6.0
+)
@@ -0,0 +1,48 @@
+package luminance
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimateLux_CCT(t *testing.T) {
+	horizon := EstimateLux(dayInput(1, 0, 0, 3, 100)).CCTKelvin
+	noon := EstimateLux(dayInput(70, 0, 0, 3, 100)).CCTKelvin
+	overcast := EstimateLux(dayInput(70, 100, 0, 3, 100)).CCTKelvin
+	night := EstimateLux(dayInput(-20, 0, 0, 3, 100)).CCTKelvin
+
+	if horizon > 2500 {
+		t.Fatalf("got %f at the horizon; expected a warm color", horizon)
+	}
+	if noon < 5500 || noon > 6000 {
+		t.Fatalf("got %f at noon; expected neutral daylight", noon)
+	}
+	if overcast <= noon {
+		t.Fatalf("got %f under overcast and %f in clear sky; expected overcast to be cooler", overcast, noon)
+	}
+	if night != CCTHorizonK {
+		t.Fatalf("got %f at night; expected the horizon value", night)
+	}
+}
+
+func TestScaleCCT(t *testing.T) {
+	tests := []struct {
+		name     string
+		cct      float64
+		expected float64
+	}{
+		{name: "Horizon maps to the warmest", cct: CCTHorizonK, expected: 2200},
+		{name: "Overcast maps to the coolest", cct: CCTOvercastK, expected: 6500},
+		{name: "Warmer than the model clamps", cct: 1500, expected: 2200},
+		{name: "Cooler than the model clamps", cct: 9000, expected: 6500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ScaleCCT(tt.cct, 2200, 6500)
+			if math.Abs(got-tt.expected) > 1e-6 {
+				t.Fatalf("got %f; expected %f", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package luminance
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSplitIrradiance(t *testing.T) {
+	tests := []struct {
+		name          string
+		ghi           float64
+		dniClear      float64
+		cloudFraction float64
+		elevation     float64
+		expectDirect  bool
+	}{
+		{name: "Clear sky keeps the beam", ghi: 700, dniClear: 850, cloudFraction: 0, elevation: 45, expectDirect: true},
+		{name: "Overcast sky is all diffuse", ghi: 200, dniClear: 850, cloudFraction: 1, elevation: 45, expectDirect: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitIrradiance(tt.ghi, tt.dniClear, tt.cloudFraction, tt.elevation)
+			if math.Abs(got.directHorizontal+got.diffuse-tt.ghi) > 1e-9 {
+				t.Fatalf("got %f + %f; expected the components to add up to %f", got.directHorizontal, got.diffuse, tt.ghi)
+			}
+			if (got.directHorizontal > 0) != tt.expectDirect {
+				t.Fatalf("got direct %f; expected direct component: %v", got.directHorizontal, tt.expectDirect)
+			}
+		})
+	}
+}
+
+func TestPerezEfficacy_LowSun(t *testing.T) {
+	efficacyAt := func(elevation float64) luminousEfficacy {
+		airMass := airmassKastenYoung(elevation)
+		e0 := eccentricityFactor(172)
+		ghi := clearSkyGHI(0, 3, elevation, airMass, e0)
+		dni := clearSkyDNI(0, 3, airMass, e0)
+		return perezEfficacy(splitIrradiance(ghi, dni, 0, elevation), elevation, airMass, e0)
+	}
+
+	high := efficacyAt(60)
+	low := efficacyAt(5)
+	if low.direct >= high.direct {
+		t.Fatalf("got direct efficacy %f at 5 degrees and %f at 60 degrees; expected it to drop at low sun", low.direct, high.direct)
+	}
+	if high.direct < 80 || high.direct > 120 || high.diffuse < 80 || high.diffuse > 160 {
+		t.Fatalf("got %+v; expected efficacies in the usual daylight range", high)
+	}
+}
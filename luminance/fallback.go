@@ -0,0 +1,124 @@
+package luminance
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+type FallbackConfig struct {
+	Astronomy   []string `yaml:"astronomy"`
+	Meteorology []string `yaml:"meteorology"`
+}
+
+const (
+	FallbackLastKnown       = "lastKnown"
+	FallbackSolarPosition   = "solarPosition"
+	FallbackSeasonalAverage = "seasonalAverage"
+)
+
+// NewAstronomy wraps the primary provider in a cache and appends the
+// configured fallbacks, tried in order when the primary provider fails.
+func NewAstronomy(primary Astronomy, cacheConfig CacheConfig, fallbacks []string) (Astronomy, error) {
+	cached := NewCachedAstronomy(primary, cacheConfig)
+	chain := AstronomyChain{cached}
+
+	for _, f := range fallbacks {
+		switch f {
+		case FallbackLastKnown:
+			chain = append(chain, cached.LastKnown())
+		case FallbackSolarPosition:
+			chain = append(chain, SolarPosition{})
+		default:
+			return nil, fmt.Errorf("unknown astronomy fallback %q", f)
+		}
+	}
+
+	return chain, nil
+}
+
+// NewMeteorology wraps the primary provider in a cache and appends the
+// configured fallbacks, tried in order when the primary provider fails.
+func NewMeteorology(primary Meteorology, cacheConfig CacheConfig, fallbacks []string) (Meteorology, error) {
+	cached := NewCachedMeteorology(primary, cacheConfig)
+	chain := MeteorologyChain{cached}
+
+	for _, f := range fallbacks {
+		switch f {
+		case FallbackLastKnown:
+			chain = append(chain, cached.LastKnown())
+		case FallbackSeasonalAverage:
+			chain = append(chain, SeasonalAverage{})
+		default:
+			return nil, fmt.Errorf("unknown meteorology fallback %q", f)
+		}
+	}
+
+	return chain, nil
+}
+
+type AstronomyChain []Astronomy
+
+func (a AstronomyChain) GetSolarElevation(latitude, longitude float64) (*AstronomyData, error) {
+	var errs []error
+	for _, provider := range a {
+		data, err := provider.GetSolarElevation(latitude, longitude)
+		if err == nil {
+			return data, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+type MeteorologyChain []Meteorology
+
+func (m MeteorologyChain) GetCurrent(latitude, longitude float64) (*MeteorologyData, error) {
+	var errs []error
+	for _, provider := range m {
+		data, err := provider.GetCurrent(latitude, longitude)
+		if err == nil {
+			return data, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// SeasonalAverage answers with a climatological cloud cover for the latitude
+// and month, interpolated from zonal mean values.
+type SeasonalAverage struct {
+}
+
+func (s SeasonalAverage) GetCurrent(latitude, longitude float64) (*MeteorologyData, error) {
+	return &MeteorologyData{
+		CloudCover: SeasonalCloudCover(latitude, time.Now()),
+	}, nil
+}
+
+func SeasonalCloudCover(latitude float64, when time.Time) float64 {
+	latitude = math.Max(-90, math.Min(90, latitude))
+	position := (latitude + 90) / 15
+	i := min(int(math.Floor(position)), len(zonalCloudCover)-2)
+	f := position - float64(i)
+	annual := zonalCloudCover[i]*(1-f) + zonalCloudCover[i+1]*f
+
+	// Mid latitudes are cloudier in winter, which peaks in January in the
+	// northern hemisphere and in July in the southern one.
+	winterPeak := 0.0
+	if latitude < 0 {
+		winterPeak = 6.0
+	}
+	month := float64(when.Month() - 1)
+	amplitude := SeasonalCloudCoverAmplitude * math.Sin(radians(math.Min(math.Abs(latitude), 90))*2)
+	seasonal := amplitude * math.Cos(2*math.Pi*(month-winterPeak)/12)
+
+	return math.Max(0, math.Min(100, annual+seasonal))
+}
+
+// zonalCloudCover holds the annual mean cloud cover percentage every 15
+// degrees of latitude, from the South Pole to the North Pole.
+var zonalCloudCover = []float64{60, 70, 85, 75, 55, 55, 60, 50, 45, 65, 70, 70, 65}
+
+const SeasonalCloudCoverAmplitude = 8.0
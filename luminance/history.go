@@ -0,0 +1,93 @@
+package luminance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type MeteorologyHistory interface {
+	GetHourly(latitude, longitude float64, from, to time.Time) ([]HourlyMeteorology, error)
+}
+
+type HourlyMeteorology struct {
+	Time       time.Time
+	CloudCover float64
+}
+
+type OpenMeteoArchiveConfig struct {
+	Url          string `yaml:"url"`
+	QueryTimeout int    `yaml:"queryTimeout"`
+}
+
+// OpenMeteoArchive reads hourly cloud cover from the Open-Meteo historical
+// weather API, in UTC.
+type OpenMeteoArchive struct {
+	Config OpenMeteoArchiveConfig
+}
+
+func (m OpenMeteoArchive) GetHourly(latitude, longitude float64, from, to time.Time) ([]HourlyMeteorology, error) {
+	q := url.Values{}
+	q.Set("latitude", fmt.Sprintf("%v", latitude))
+	q.Set("longitude", fmt.Sprintf("%v", longitude))
+	q.Set("start_date", from.UTC().Format(time.DateOnly))
+	q.Set("end_date", to.UTC().Format(time.DateOnly))
+	q.Set("hourly", "cloud_cover")
+	q.Set("timezone", "GMT")
+
+	url := fmt.Sprintf("%s?%s", m.Config.Url, q.Encode())
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("accept", "application/json")
+
+	client := http.Client{Timeout: time.Duration(m.Config.QueryTimeout) * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error getting meteorology history: %d", res.StatusCode)
+	}
+
+	var out omArchiveResponse
+	err = json.NewDecoder(res.Body).Decode(&out)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.Hourly.Time) != len(out.Hourly.CloudCover) {
+		return nil, fmt.Errorf("meteorology history has %d times but %d cloud cover values", len(out.Hourly.Time), len(out.Hourly.CloudCover))
+	}
+
+	result := make([]HourlyMeteorology, 0, len(out.Hourly.Time))
+	for i, t := range out.Hourly.Time {
+		parsed, err := time.Parse(omHourlyTimeLayout, t)
+		if err != nil {
+			return nil, err
+		}
+		if out.Hourly.CloudCover[i] == nil {
+			continue
+		}
+		result = append(result, HourlyMeteorology{
+			Time:       parsed,
+			CloudCover: *out.Hourly.CloudCover[i],
+		})
+	}
+
+	return result, nil
+}
+
+const omHourlyTimeLayout = "2006-01-02T15:04"
+
+type omArchiveResponse struct {
+	Hourly struct {
+		Time       []string   `json:"time"`
+		CloudCover []*float64 `json:"cloud_cover"`
+	} `json:"hourly"`
+}
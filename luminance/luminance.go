@@ -3,29 +3,54 @@ package luminance
 import "time"
 
 type Luminance struct {
-	Astronomy   Astronomy
-	Meteorology Meteorology
+	Astronomy    Astronomy
+	Meteorology  Meteorology
+	Turbidity    Turbidity
+	Calibrations CalibrationProfiles
 }
 
 func (l Luminance) GetCurrent(latitude, longitude float64) (float64, error) {
-	astronomyData, err := l.Astronomy.GetSolarElevation(latitude, longitude)
+	output, err := l.Estimate(latitude, longitude)
 	if err != nil {
 		return -1.0, err
 	}
+	return output.Lux, nil
+}
+
+func (l Luminance) Estimate(latitude, longitude float64) (*ModelOutput, error) {
+	astronomyData, err := l.Astronomy.GetSolarElevation(latitude, longitude)
+	if err != nil {
+		return nil, err
+	}
 
 	meteorologyData, err := l.Meteorology.GetCurrent(latitude, longitude)
 	if err != nil {
-		return -1.0, err
+		return nil, err
 	}
 
+	now := time.Now()
 	modelInput := ModelInput{
 		SolarElevationDeg:    astronomyData.SunAltitude,
 		CloudCoverPercentage: meteorologyData.CloudCover,
 		AltitudeMeters:       meteorologyData.Elevation,
-		DayOfYear:            time.Time.YearDay(time.Now()),
-		LinkeTurbidity:       LinkeTurbidityDefault,
+		DayOfYear:            time.Time.YearDay(now),
+		LinkeTurbidity:       l.linkeTurbidity(latitude, longitude, now),
+		Calibration:          l.Calibrations.For(latitude, longitude),
+		Moon:                 MoonPosition(latitude, longitude, now),
 	}
 	luminance := EstimateLux(modelInput)
 
-	return luminance.Lux, nil
+	return &luminance, nil
+}
+
+func (l Luminance) linkeTurbidity(latitude, longitude float64, when time.Time) float64 {
+	if l.Turbidity == nil {
+		return LinkeTurbidityDefault
+	}
+
+	linkeTurbidity, err := l.Turbidity.GetLinkeTurbidity(latitude, longitude, when)
+	if err != nil {
+		return LinkeTurbidityDefault
+	}
+	return linkeTurbidity
 }
@@ -84,3 +84,9 @@ type omApiResponse struct {
 	Elevation float64   `json:"elevation"`
 	Current   omCurrent `json:"current"`
 }
+
+const (
+	ProviderOpenMeteo      = "openMeteo"
+	ProviderMetNorway      = "metNorway"
+	ProviderOpenWeatherMap = "openWeatherMap"
+)
@@ -0,0 +1,117 @@
+package luminance
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type MetNorwayConfig struct {
+	Url          string `yaml:"url"`
+	UserAgent    string `yaml:"userAgent"`
+	QueryTimeout int    `yaml:"queryTimeout"`
+}
+
+// MetNorway reads the first step of the MET Norway Locationforecast compact
+// product. MET Norway rejects requests without an identifying User-Agent.
+type MetNorway struct {
+	Config MetNorwayConfig
+}
+
+func (m MetNorway) GetCurrent(latitude, longitude float64) (*MeteorologyData, error) {
+	q := url.Values{}
+	q.Set("lat", fmt.Sprintf("%.4f", latitude))
+	q.Set("lon", fmt.Sprintf("%.4f", longitude))
+
+	url := fmt.Sprintf("%s?%s", m.Config.Url, q.Encode())
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("accept", "application/json")
+	req.Header.Set("user-agent", m.Config.UserAgent)
+
+	client := http.Client{Timeout: time.Duration(m.Config.QueryTimeout) * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error getting data from met norway: %d", res.StatusCode)
+	}
+
+	var out metApiResponse
+	err = json.NewDecoder(res.Body).Decode(&out)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(out.Properties.Timeseries) == 0 {
+		return nil, fmt.Errorf("met norway returned no forecast steps")
+	}
+	current := out.Properties.Timeseries[0].Data
+
+	elevation := 0.0
+	if len(out.Geometry.Coordinates) > 2 {
+		elevation = out.Geometry.Coordinates[2]
+	}
+
+	return &MeteorologyData{
+		CloudCover:    current.Instant.Details.CloudAreaFraction,
+		Precipitation: current.Next1Hours.Details.PrecipitationAmount,
+		Visibility:    metVisibility(current.Instant.Details.FogAreaFraction),
+		Thunderstorm:  strings.Contains(current.Next1Hours.Summary.SymbolCode, "thunder"),
+		Elevation:     elevation,
+	}, nil
+}
+
+// metVisibility approximates visibility in meters from the fog fraction, which
+// is all the Locationforecast product reports.
+func metVisibility(fogAreaFraction *float64) float64 {
+	if fogAreaFraction == nil {
+		return MetNorwayClearVisibility_m
+	}
+	if *fogAreaFraction > 0 {
+		return MetNorwayFogVisibility_m
+	}
+	return MetNorwayClearVisibility_m
+}
+
+const (
+	MetNorwayClearVisibility_m = 10000.0
+	MetNorwayFogVisibility_m   = 1000.0
+)
+
+type metApiResponse struct {
+	Geometry struct {
+		Coordinates []float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties struct {
+		Timeseries []metTimestep `json:"timeseries"`
+	} `json:"properties"`
+}
+
+type metTimestep struct {
+	Time string `json:"time"`
+	Data struct {
+		Instant struct {
+			Details struct {
+				CloudAreaFraction float64  `json:"cloud_area_fraction"`
+				FogAreaFraction   *float64 `json:"fog_area_fraction"`
+			} `json:"details"`
+		} `json:"instant"`
+		Next1Hours struct {
+			Summary struct {
+				SymbolCode string `json:"symbol_code"`
+			} `json:"summary"`
+			Details struct {
+				PrecipitationAmount float64 `json:"precipitation_amount"`
+			} `json:"details"`
+		} `json:"next_1_hours"`
+	} `json:"data"`
+}
@@ -10,13 +10,62 @@ type ModelInput struct {
 	AltitudeMeters       float64
 	DayOfYear            int
 	LinkeTurbidity       float64
+	Calibration          *Calibration
+	Moon                 MoonData
+}
+
+type Calibration struct {
+	CloudLossCoefficient float64 `yaml:"cloudLossCoefficient"`
+	CloudExponent        float64 `yaml:"cloudExponent"`
+	EfficacyScale        float64 `yaml:"efficacyScale"`
+	// LegacyLuminousEfficacy is the single efficacy, in lux per W/m², that
+	// profiles calibrated before the efficacy scale carry. It is read only,
+	// and turned into a scale when the profiles are loaded.
+	LegacyLuminousEfficacy float64 `yaml:"luminousEfficacy,omitempty"`
+}
+
+func DefaultCalibration() Calibration {
+	return Calibration{
+		CloudLossCoefficient: CloudClearSkyLossCoefficient,
+		CloudExponent:        CloudClearSkyExponent,
+		EfficacyScale:        1.0,
+	}
+}
+
+func (m ModelInput) calibration() Calibration {
+	if m.Calibration == nil {
+		return DefaultCalibration()
+	}
+	calibration := *m.Calibration
+	if calibration.EfficacyScale <= 0 {
+		calibration.EfficacyScale = 1.0
+	}
+	return calibration
 }
 
 type ModelOutput struct {
-	Lux float64
+	Lux        float64
+	SolarLux   float64
+	MoonLux    float64
+	SkyglowLux float64
+	CCTKelvin  float64
 }
 
 func EstimateLux(input ModelInput) ModelOutput {
+	solar := solarLux(input)
+	moon := luxForMoon(input)
+	skyglow := luxForSkyglow(input)
+
+	return ModelOutput{
+		Lux:        solar.Lux + moon + skyglow,
+		SolarLux:   solar.Lux,
+		MoonLux:    moon,
+		SkyglowLux: skyglow,
+		CCTKelvin:  estimateCCT(input.SolarElevationDeg, input.CloudCoverPercentage),
+	}
+}
+
+func solarLux(input ModelInput) ModelOutput {
 	if isDaytime(input.SolarElevationDeg) {
 		return luxForDaytime(input)
 	}
@@ -43,9 +92,14 @@ func luxForDaytime(input ModelInput) ModelOutput {
 	airMass := airmassKastenYoung(input.SolarElevationDeg)
 	e0 := eccentricityFactor(input.DayOfYear)
 	ghiClear := clearSkyGHI(input.AltitudeMeters, input.LinkeTurbidity, input.SolarElevationDeg, airMass, e0)
-	kc := cloudClearSkyIndex(input.CloudCoverPercentage)
+	dniClear := clearSkyDNI(input.AltitudeMeters, input.LinkeTurbidity, airMass, e0)
+	calibration := input.calibration()
+	kc := cloudClearSkyIndex(input.CloudCoverPercentage, calibration.CloudLossCoefficient, calibration.CloudExponent)
 
-	lux := ghiClear * kc * LuminousEfficacy_LuxPerWm2
+	irradiance := splitIrradiance(ghiClear*kc, dniClear, input.CloudCoverPercentage/100.0, input.SolarElevationDeg)
+	efficacy := perezEfficacy(irradiance, input.SolarElevationDeg, airMass, e0)
+
+	lux := (irradiance.directHorizontal*efficacy.direct + irradiance.diffuse*efficacy.diffuse) * calibration.EfficacyScale
 	return ModelOutput{
 		Lux: lux,
 	}
@@ -59,6 +113,38 @@ func luxForTwilight(solarElevationDeg, referenceLuxAtHorizon float64) ModelOutpu
 	}
 }
 
+// luxForMoon follows Krisciunas & Schaefer (1991): the Moon's magnitude grows
+// with the phase angle, and its light is extinguished along the air mass and
+// attenuated by clouds like sunlight is.
+func luxForMoon(input ModelInput) float64 {
+	if input.Moon.ElevationDeg <= 0 {
+		return 0
+	}
+
+	phaseAngle := math.Abs(input.Moon.PhaseAngleDeg)
+	magnitude := MoonMagnitudeFull + MoonMagnitudeLinear*phaseAngle + MoonMagnitudeQuartic*math.Pow(phaseAngle, 4)
+	footCandles := math.Pow(10, -0.4*(magnitude+MoonFootCandleMagnitudeOffset))
+	normalLux := footCandles * LuxPerFootCandle
+
+	if input.Moon.DistanceKm > 0 {
+		normalLux *= math.Pow(MoonMeanDistanceKm/input.Moon.DistanceKm, 2)
+	}
+
+	airMass := airmassKastenYoung(input.Moon.ElevationDeg)
+	extinction := math.Pow(10, -0.4*MoonExtinctionCoefficient*airMass)
+	calibration := input.calibration()
+	kc := cloudClearSkyIndex(input.CloudCoverPercentage, calibration.CloudLossCoefficient, calibration.CloudExponent)
+
+	return normalLux * math.Sin(radians(input.Moon.ElevationDeg)) * extinction * kc
+}
+
+// luxForSkyglow is the floor set by starlight and airglow on a moonless night.
+func luxForSkyglow(input ModelInput) float64 {
+	calibration := input.calibration()
+	kc := cloudClearSkyIndex(input.CloudCoverPercentage, calibration.CloudLossCoefficient, calibration.CloudExponent)
+	return NightSkyClearLux * kc
+}
+
 func airmassKastenYoung(solarElevationDeg float64) float64 {
 	zenithDeg := 90.0 - solarElevationDeg
 	cosZenith := math.Cos(radians(zenithDeg))
@@ -81,16 +167,26 @@ func clearSkyGHI(altitudeM, linkeTurbidity, solarElevationDeg, airMass, eccentri
 	return ClearSkyModelPrefactor_IneichenKasten * io * math.Sin(solarElevationRad) * math.Exp(-ClearSkyOpticalDepthCoeff*airMass*(fh1+fh2*(linkeTurbidity-1.0)))
 }
 
-func cloudClearSkyIndex(cloudCoverPercentage float64) float64 {
+// clearSkyDNI is the beam normal irradiance of the Ineichen-Perez clear sky
+// model.
+func clearSkyDNI(altitudeM, linkeTurbidity, airMass, eccentricityFactor float64) float64 {
+	io := SolarIrradianceExtraterrestrial_Wm2 * eccentricityFactor
+	fh1 := math.Exp(-altitudeM / ClearSkyBeamScaleHeight_m)
+	b := ClearSkyBeamBase + ClearSkyBeamAltitudeCoeff/fh1
+
+	return b * io * math.Exp(-ClearSkyBeamTurbidityCoeff*airMass*(linkeTurbidity-1.0))
+}
+
+func cloudClearSkyIndex(cloudCoverPercentage, lossCoefficient, exponent float64) float64 {
 	cloudFraction := cloudCoverPercentage / 100.0
 	if cloudFraction <= 0.0 {
 		return 1.0
 	}
 	if cloudFraction >= 1.0 {
-		return 1.0 - CloudClearSkyLossCoefficient
+		return 1.0 - lossCoefficient
 	}
 
-	return 1.0 - CloudClearSkyLossCoefficient*math.Pow(cloudFraction, CloudClearSkyExponent)
+	return 1.0 - lossCoefficient*math.Pow(cloudFraction, exponent)
 }
 
 func radians(degrees float64) float64 {
@@ -120,7 +216,12 @@ const (
 
 const ClearSkyModelPrefactor_IneichenKasten = 0.84
 
-const LuminousEfficacy_LuxPerWm2 = 120.0
+const (
+	ClearSkyBeamBase           = 0.664
+	ClearSkyBeamAltitudeCoeff  = 0.163
+	ClearSkyBeamScaleHeight_m  = 8000.0
+	ClearSkyBeamTurbidityCoeff = 0.09
+)
 
 const (
 	TwilightLowerBoundDeg  = -6.0
@@ -131,3 +232,14 @@ const (
 const (
 	LinkeTurbidityDefault = 3.0
 )
+
+const (
+	MoonMagnitudeFull             = -12.73
+	MoonMagnitudeLinear           = 0.026
+	MoonMagnitudeQuartic          = 4e-9
+	MoonFootCandleMagnitudeOffset = 16.57
+	MoonExtinctionCoefficient     = 0.172
+	LuxPerFootCandle              = 10.764
+)
+
+const NightSkyClearLux = 0.002
@@ -0,0 +1,74 @@
+package luminance
+
+import (
+	"math"
+	"time"
+)
+
+type MoonData struct {
+	ElevationDeg        float64
+	PhaseAngleDeg       float64
+	IlluminatedFraction float64
+	DistanceKm          float64
+}
+
+// MoonPosition computes the Moon's topocentric elevation and phase with the
+// low precision lunar and solar series, good to a fraction of a degree.
+func MoonPosition(latitude, longitude float64, when time.Time) MoonData {
+	d := julianDay(when) - 2451545.0
+
+	moonRa, moonDec, moonDistance := moonCoordinates(d)
+	sunRa, sunDec := sunCoordinates(d)
+
+	siderealTime := radians(280.16+360.9856235*d) + radians(longitude)
+	hourAngle := siderealTime - moonRa
+	latRad := radians(latitude)
+	altitude := math.Asin(math.Sin(latRad)*math.Sin(moonDec) + math.Cos(latRad)*math.Cos(moonDec)*math.Cos(hourAngle))
+	parallax := math.Asin(EarthRadiusKm / moonDistance)
+	altitude -= parallax * math.Cos(altitude)
+
+	elongation := math.Acos(math.Sin(sunDec)*math.Sin(moonDec) + math.Cos(sunDec)*math.Cos(moonDec)*math.Cos(sunRa-moonRa))
+	phaseAngle := math.Atan2(SunDistanceKm*math.Sin(elongation), moonDistance-SunDistanceKm*math.Cos(elongation))
+
+	return MoonData{
+		ElevationDeg:        degrees(altitude),
+		PhaseAngleDeg:       degrees(phaseAngle),
+		IlluminatedFraction: (1 + math.Cos(phaseAngle)) / 2,
+		DistanceKm:          moonDistance,
+	}
+}
+
+func moonCoordinates(d float64) (float64, float64, float64) {
+	meanLongitude := radians(218.316 + 13.176396*d)
+	meanAnomaly := radians(134.963 + 13.064993*d)
+	meanDistance := radians(93.272 + 13.229350*d)
+
+	eclipticLongitude := meanLongitude + radians(6.289)*math.Sin(meanAnomaly)
+	eclipticLatitude := radians(5.128) * math.Sin(meanDistance)
+	distance := 385001.0 - 20905.0*math.Cos(meanAnomaly)
+
+	ra, dec := equatorialCoordinates(eclipticLongitude, eclipticLatitude)
+	return ra, dec, distance
+}
+
+func sunCoordinates(d float64) (float64, float64) {
+	meanAnomaly := radians(357.5291 + 0.98560028*d)
+	centre := radians(1.9148*math.Sin(meanAnomaly) + 0.02*math.Sin(2*meanAnomaly) + 0.0003*math.Sin(3*meanAnomaly))
+	eclipticLongitude := meanAnomaly + centre + radians(102.9372) + math.Pi
+
+	return equatorialCoordinates(eclipticLongitude, 0)
+}
+
+func equatorialCoordinates(eclipticLongitude, eclipticLatitude float64) (float64, float64) {
+	obliquity := radians(EarthObliquityDeg)
+	ra := math.Atan2(math.Sin(eclipticLongitude)*math.Cos(obliquity)-math.Tan(eclipticLatitude)*math.Sin(obliquity), math.Cos(eclipticLongitude))
+	dec := math.Asin(math.Sin(eclipticLatitude)*math.Cos(obliquity) + math.Cos(eclipticLatitude)*math.Sin(obliquity)*math.Sin(eclipticLongitude))
+	return ra, dec
+}
+
+const (
+	EarthRadiusKm      = 6378.14
+	SunDistanceKm      = 149598000.0
+	MoonMeanDistanceKm = 384400.0
+	EarthObliquityDeg  = 23.4397
+)
@@ -0,0 +1,117 @@
+package luminance
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMoonPosition_Phase(t *testing.T) {
+	tests := []struct {
+		name        string
+		when        time.Time
+		minFraction float64
+		maxFraction float64
+	}{
+		{
+			name:        "Full moon of October 2025",
+			when:        time.Date(2025, time.October, 7, 3, 47, 0, 0, time.UTC),
+			minFraction: 0.98,
+			maxFraction: 1.0,
+		},
+		{
+			name:        "New moon of October 2025",
+			when:        time.Date(2025, time.October, 21, 12, 25, 0, 0, time.UTC),
+			minFraction: 0.0,
+			maxFraction: 0.02,
+		},
+		{
+			name:        "First quarter of October 2025",
+			when:        time.Date(2025, time.October, 29, 16, 21, 0, 0, time.UTC),
+			minFraction: 0.45,
+			maxFraction: 0.55,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MoonPosition(0, 0, tt.when)
+			if got.IlluminatedFraction < tt.minFraction || got.IlluminatedFraction > tt.maxFraction {
+				t.Fatalf("got %f; expected between %f and %f", got.IlluminatedFraction, tt.minFraction, tt.maxFraction)
+			}
+		})
+	}
+}
+
+func TestMoonPosition_FullMoonIsHighAtMidnight(t *testing.T) {
+	got := MoonPosition(0, 0, time.Date(2025, time.October, 7, 0, 0, 0, 0, time.UTC))
+	if got.ElevationDeg < 60 {
+		t.Fatalf("got %f; expected the full moon high in the sky", got.ElevationDeg)
+	}
+	if got.DistanceKm < 356000 || got.DistanceKm > 407000 {
+		t.Fatalf("got %f km; expected a distance between perigee and apogee", got.DistanceKm)
+	}
+}
+
+func TestEstimateLux_Night(t *testing.T) {
+	tests := []struct {
+		name       string
+		moon       MoonData
+		cloudCover float64
+		minMoonLux float64
+		maxMoonLux float64
+	}{
+		{
+			name:       "Full moon at 60 degrees, clear sky",
+			moon:       MoonData{ElevationDeg: 60, PhaseAngleDeg: 0, DistanceKm: MoonMeanDistanceKm},
+			minMoonLux: 0.2,
+			maxMoonLux: 0.25,
+		},
+		{
+			name:       "Full moon at 60 degrees, overcast",
+			moon:       MoonData{ElevationDeg: 60, PhaseAngleDeg: 0, DistanceKm: MoonMeanDistanceKm},
+			cloudCover: 100,
+			minMoonLux: 0.05,
+			maxMoonLux: 0.06,
+		},
+		{
+			name:       "Quarter moon at 60 degrees, clear sky",
+			moon:       MoonData{ElevationDeg: 60, PhaseAngleDeg: 90, DistanceKm: MoonMeanDistanceKm},
+			minMoonLux: 0.02,
+			maxMoonLux: 0.03,
+		},
+		{
+			name:       "New moon",
+			moon:       MoonData{ElevationDeg: 60, PhaseAngleDeg: 180, DistanceKm: MoonMeanDistanceKm},
+			minMoonLux: 0,
+			maxMoonLux: 0.001,
+		},
+		{
+			name:       "Moon below the horizon",
+			moon:       MoonData{ElevationDeg: -10, PhaseAngleDeg: 0, DistanceKm: MoonMeanDistanceKm},
+			minMoonLux: 0,
+			maxMoonLux: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := dayInput(-20, tt.cloudCover, 0, 3, 100)
+			in.Moon = tt.moon
+
+			out := EstimateLux(in)
+			if out.SolarLux != 0 {
+				t.Fatalf("got solar %f; expected 0", out.SolarLux)
+			}
+			if out.MoonLux < tt.minMoonLux || out.MoonLux > tt.maxMoonLux {
+				t.Fatalf("got moon %f; expected between %f and %f", out.MoonLux, tt.minMoonLux, tt.maxMoonLux)
+			}
+			if out.SkyglowLux <= 0 {
+				t.Fatalf("got skyglow %f; expected a positive floor", out.SkyglowLux)
+			}
+			if math.Abs(out.Lux-(out.SolarLux+out.MoonLux+out.SkyglowLux)) > 1e-12 {
+				t.Fatalf("got total %f; expected the sum of the components", out.Lux)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package luminance
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type OpenWeatherMapConfig struct {
+	ApiKey       string `yaml:"apiKey" envconfig:"OPENWEATHERMAP_APIKEY"`
+	Url          string `yaml:"url"`
+	QueryTimeout int    `yaml:"queryTimeout"`
+	// Elevation is the height of the location in meters. OpenWeatherMap does
+	// not report it, so when not set it is derived from the pressures at sea
+	// and ground level the response carries.
+	Elevation float64 `yaml:"elevation"`
+}
+
+type OpenWeatherMap struct {
+	Config OpenWeatherMapConfig
+}
+
+func (o OpenWeatherMap) GetCurrent(latitude, longitude float64) (*MeteorologyData, error) {
+	q := url.Values{}
+	q.Set("lat", fmt.Sprintf("%v", latitude))
+	q.Set("lon", fmt.Sprintf("%v", longitude))
+	q.Set("appid", o.Config.ApiKey)
+	q.Set("units", "metric")
+
+	url := fmt.Sprintf("%s?%s", o.Config.Url, q.Encode())
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("accept", "application/json")
+
+	client := http.Client{Timeout: time.Duration(o.Config.QueryTimeout) * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error getting data from openweathermap: %d", res.StatusCode)
+	}
+
+	var out owmApiResponse
+	err = json.NewDecoder(res.Body).Decode(&out)
+	if err != nil {
+		return nil, err
+	}
+
+	thunderstorm := false
+	for _, w := range out.Weather {
+		if isOwmThunderstorm(w.Id) {
+			thunderstorm = true
+		}
+	}
+
+	return &MeteorologyData{
+		CloudCover:    out.Clouds.All,
+		Precipitation: out.Rain.OneHour + out.Snow.OneHour,
+		Visibility:    out.Visibility,
+		Thunderstorm:  thunderstorm,
+		Elevation:     o.elevation(out),
+	}, nil
+}
+
+func (o OpenWeatherMap) elevation(out owmApiResponse) float64 {
+	if o.Config.Elevation != 0 {
+		return o.Config.Elevation
+	}
+	if out.Main.SeaLevel <= 0 || out.Main.GroundLevel <= 0 {
+		return 0
+	}
+	return math.Round(barometricHeight_m * (1 - math.Pow(out.Main.GroundLevel/out.Main.SeaLevel, 1/barometricExponent)))
+}
+
+// The international barometric formula, giving the height from the ratio of
+// the pressure there to that at sea level.
+const (
+	barometricHeight_m = 44330.0
+	barometricExponent = 5.255
+)
+
+func isOwmThunderstorm(id int) bool {
+	return id >= 200 && id < 300
+}
+
+type owmPrecipitation struct {
+	OneHour float64 `json:"1h"`
+}
+
+type owmApiResponse struct {
+	Weather []struct {
+		Id   int    `json:"id"`
+		Main string `json:"main"`
+	} `json:"weather"`
+	Main struct {
+		SeaLevel    float64 `json:"sea_level"`
+		GroundLevel float64 `json:"grnd_level"`
+	} `json:"main"`
+	Visibility float64 `json:"visibility"`
+	Clouds     struct {
+		All float64 `json:"all"`
+	} `json:"clouds"`
+	Rain owmPrecipitation `json:"rain"`
+	Snow owmPrecipitation `json:"snow"`
+}
@@ -0,0 +1,160 @@
+package luminance
+
+import (
+	"math"
+	"time"
+)
+
+// SolarPosition computes the Sun's elevation locally with the NOAA solar
+// position equations, so it needs no network access.
+type SolarPosition struct {
+}
+
+func (s SolarPosition) GetSolarElevation(latitude, longitude float64) (*AstronomyData, error) {
+	return &AstronomyData{
+		SunAltitude: SolarElevation(latitude, longitude, time.Now()),
+	}, nil
+}
+
+func SolarElevation(latitude, longitude float64, when time.Time) float64 {
+	declination, equationOfTime := solarDeclinationAndEquationOfTime(when)
+
+	utc := when.UTC()
+	minutes := float64(utc.Hour()*60+utc.Minute()) + float64(utc.Second())/60.0
+	trueSolarTime := math.Mod(minutes+equationOfTime+4.0*longitude, 1440)
+	if trueSolarTime < 0 {
+		trueSolarTime += 1440
+	}
+
+	hourAngle := trueSolarTime/4.0 - 180.0
+	latRad := radians(latitude)
+	declRad := radians(declination)
+	cosZenith := math.Sin(latRad)*math.Sin(declRad) + math.Cos(latRad)*math.Cos(declRad)*math.Cos(radians(hourAngle))
+	cosZenith = math.Max(-1, math.Min(1, cosZenith))
+
+	return 90.0 - degrees(math.Acos(cosZenith))
+}
+
+// solarDeclinationAndEquationOfTime returns the declination of the Sun in
+// degrees and the equation of time in minutes.
+func solarDeclinationAndEquationOfTime(when time.Time) (float64, float64) {
+	jc := julianCentury(when)
+
+	meanLongitude := math.Mod(280.46646+jc*(36000.76983+jc*0.0003032), 360)
+	meanAnomaly := 357.52911 + jc*(35999.05029-0.0001537*jc)
+	eccentricity := 0.016708634 - jc*(0.000042037+0.0000001267*jc)
+
+	centre := math.Sin(radians(meanAnomaly))*(1.914602-jc*(0.004817+0.000014*jc)) +
+		math.Sin(radians(2*meanAnomaly))*(0.019993-0.000101*jc) +
+		math.Sin(radians(3*meanAnomaly))*0.000289
+	trueLongitude := meanLongitude + centre
+	omega := 125.04 - 1934.136*jc
+	apparentLongitude := trueLongitude - 0.00569 - 0.00478*math.Sin(radians(omega))
+
+	meanObliquity := 23.0 + (26.0+(21.448-jc*(46.815+jc*(0.00059-jc*0.001813)))/60.0)/60.0
+	obliquity := meanObliquity + 0.00256*math.Cos(radians(omega))
+
+	declination := degrees(math.Asin(math.Sin(radians(obliquity)) * math.Sin(radians(apparentLongitude))))
+
+	y := math.Pow(math.Tan(radians(obliquity/2)), 2)
+	l0 := radians(meanLongitude)
+	m := radians(meanAnomaly)
+	equationOfTime := 4.0 * degrees(y*math.Sin(2*l0)-
+		2*eccentricity*math.Sin(m)+
+		4*eccentricity*y*math.Sin(m)*math.Cos(2*l0)-
+		0.5*y*y*math.Sin(4*l0)-
+		1.25*eccentricity*eccentricity*math.Sin(2*m))
+
+	return declination, equationOfTime
+}
+
+func julianDay(when time.Time) float64 {
+	return float64(when.UTC().UnixNano())/float64(24*time.Hour) + 2440587.5
+}
+
+func julianCentury(when time.Time) float64 {
+	return (julianDay(when) - 2451545.0) / 36525.0
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+// SolarEvent is a moment of the day defined by the elevation of the Sun.
+type SolarEvent string
+
+const (
+	Sunrise          SolarEvent = "sunrise"
+	Sunset           SolarEvent = "sunset"
+	SolarNoon        SolarEvent = "noon"
+	CivilDawn        SolarEvent = "civil dawn"
+	CivilDusk        SolarEvent = "civil dusk"
+	NauticalDawn     SolarEvent = "nautical dawn"
+	NauticalDusk     SolarEvent = "nautical dusk"
+	AstronomicalDawn SolarEvent = "astronomical dawn"
+	AstronomicalDusk SolarEvent = "astronomical dusk"
+)
+
+// Zenith angles of the Sun at the events, in degrees. Sunrise allows for the
+// refraction and the radius of the Sun.
+const (
+	sunriseZenith      = 90.833
+	civilZenith        = 96.0
+	nauticalZenith     = 102.0
+	astronomicalZenith = 108.0
+)
+
+// SolarEvents lists the events SolarEventTime knows.
+var SolarEvents = []SolarEvent{AstronomicalDawn, NauticalDawn, CivilDawn, Sunrise, SolarNoon, Sunset, CivilDusk, NauticalDusk, AstronomicalDusk}
+
+// SolarEventTime returns when an event happens on the day of date, in the
+// location of date, with the NOAA equations. It returns false on the days the
+// event does not happen, as the sunset of a polar day.
+func SolarEventTime(latitude, longitude float64, date time.Time, event SolarEvent) (time.Time, bool) {
+	var zenith float64
+	rising := false
+	switch event {
+	case SolarNoon:
+	case Sunrise, Sunset:
+		zenith = sunriseZenith
+	case CivilDawn, CivilDusk:
+		zenith = civilZenith
+	case NauticalDawn, NauticalDusk:
+		zenith = nauticalZenith
+	case AstronomicalDawn, AstronomicalDusk:
+		zenith = astronomicalZenith
+	default:
+		return time.Time{}, false
+	}
+	switch event {
+	case Sunrise, CivilDawn, NauticalDawn, AstronomicalDawn:
+		rising = true
+	}
+
+	midnight := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	// The declination and equation of time are taken at the event itself,
+	// starting from noon and refined once.
+	minutes := 720 - 4*longitude
+	for range 2 {
+		declination, equationOfTime := solarDeclinationAndEquationOfTime(midnight.Add(time.Duration(minutes * float64(time.Minute))))
+		minutes = 720 - 4*longitude - equationOfTime
+		if zenith == 0 {
+			continue
+		}
+
+		latRad := radians(latitude)
+		declRad := radians(declination)
+		cosHourAngle := math.Cos(radians(zenith))/(math.Cos(latRad)*math.Cos(declRad)) - math.Tan(latRad)*math.Tan(declRad)
+		if cosHourAngle < -1 || cosHourAngle > 1 {
+			return time.Time{}, false
+		}
+		hourAngle := degrees(math.Acos(cosHourAngle))
+		if rising {
+			minutes -= 4 * hourAngle
+		} else {
+			minutes += 4 * hourAngle
+		}
+	}
+
+	return midnight.Add(time.Duration(minutes * float64(time.Minute))).Round(time.Second).In(date.Location()), true
+}
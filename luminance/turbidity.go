@@ -0,0 +1,54 @@
+package luminance
+
+import (
+	"fmt"
+	"time"
+)
+
+type Turbidity interface {
+	GetLinkeTurbidity(latitude, longitude float64, when time.Time) (float64, error)
+}
+
+// LinkeTurbidityConfig holds the turbidity of the location, as read on the
+// SoDa/Meteotest maps. Monthly lists the values of January to December and
+// takes precedence over Value, the value all year round.
+type LinkeTurbidityConfig struct {
+	Value   float64   `yaml:"value"`
+	Monthly []float64 `yaml:"monthly"`
+}
+
+// LinkeTurbidity returns the configured turbidity, interpolated between the
+// monthly values when given, and LinkeTurbidityDefault otherwise.
+type LinkeTurbidity struct {
+	Config LinkeTurbidityConfig
+}
+
+func (l LinkeTurbidity) GetLinkeTurbidity(latitude, longitude float64, when time.Time) (float64, error) {
+	if len(l.Config.Monthly) > 0 {
+		if len(l.Config.Monthly) != 12 {
+			return LinkeTurbidityDefault, fmt.Errorf("invalid monthly turbidity: expected 12 values, got %d", len(l.Config.Monthly))
+		}
+		month0, month1, fm := monthWeights(when)
+		return l.Config.Monthly[month0]*(1-fm) + l.Config.Monthly[month1]*fm, nil
+	}
+	if l.Config.Value > 0 {
+		return l.Config.Value, nil
+	}
+	return LinkeTurbidityDefault, nil
+}
+
+// monthWeights returns the indexes of the two months whose mid points surround
+// the given time, and the interpolation weight of the second one.
+func monthWeights(when time.Time) (int, int, float64) {
+	year, month, _ := when.Date()
+	daysInMonth := float64(time.Date(year, month+1, 0, 0, 0, 0, 0, when.Location()).Day())
+	dayFraction := (float64(when.Day()-1) + float64(when.Hour())/24.0) / daysInMonth
+
+	current := int(month) - 1
+	if dayFraction < 0.5 {
+		previous := (current + 11) % 12
+		return previous, current, dayFraction + 0.5
+	}
+	next := (current + 1) % 12
+	return current, next, dayFraction - 0.5
+}
@@ -0,0 +1,38 @@
+package luminance
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLinkeTurbidity(t *testing.T) {
+	monthly := []float64{4.0, 5.0, 3.0, 3.0, 3.0, 3.0, 3.2, 3.0, 3.0, 3.0, 3.0, 3.0}
+
+	tests := []struct {
+		name     string
+		config   LinkeTurbidityConfig
+		when     time.Time
+		expected float64
+		fails    bool
+	}{
+		{"Nothing configured uses the default", LinkeTurbidityConfig{}, time.Date(2025, time.June, 15, 12, 0, 0, 0, time.UTC), LinkeTurbidityDefault, false},
+		{"A value applies all year round", LinkeTurbidityConfig{Value: 4.2}, time.Date(2025, time.June, 15, 12, 0, 0, 0, time.UTC), 4.2, false},
+		{"Mid January uses the January value", LinkeTurbidityConfig{Value: 4.2, Monthly: monthly}, time.Date(2025, time.January, 16, 12, 0, 0, 0, time.UTC), 4.0, false},
+		{"Mid July uses the July value", LinkeTurbidityConfig{Monthly: monthly}, time.Date(2025, time.July, 16, 12, 0, 0, 0, time.UTC), 3.2, false},
+		{"The first of February is between January and February", LinkeTurbidityConfig{Monthly: monthly}, time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC), 4.5, false},
+		{"Too few monthly values", LinkeTurbidityConfig{Monthly: monthly[:6]}, time.Date(2025, time.June, 15, 12, 0, 0, 0, time.UTC), LinkeTurbidityDefault, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LinkeTurbidity{Config: tt.config}.GetLinkeTurbidity(-34.6, -58.4, tt.when)
+			if (err != nil) != tt.fails {
+				t.Fatalf("got %v; expected it to fail: %v", err, tt.fails)
+			}
+			if math.Abs(got-tt.expected) > 0.05 {
+				t.Fatalf("got %f; expected %f", got, tt.expected)
+			}
+		})
+	}
+}
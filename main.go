@@ -2,11 +2,19 @@ package main
 
 import (
 	"fmt"
+	"gowizcli/api"
+	"gowizcli/cli"
 	"gowizcli/client"
+	"gowizcli/daemon"
 	"gowizcli/db"
 	"gowizcli/luminance"
+	"gowizcli/rules"
 	"gowizcli/ui"
 	"gowizcli/wiz"
+	"os"
+	// Jobs read their schedule in any time zone, even where the system has
+	// no time zone database.
+	_ "time/tzdata"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -16,7 +24,7 @@ func main() {
 	readConfigFile(&config)
 	readConfigEnvironment(&config)
 
-	db, err := db.NewSQLiteDB(config.Database.File)
+	lightsDb, err := storage(&config)
 	if err != nil {
 		panic(err)
 	}
@@ -26,23 +34,137 @@ func main() {
 		NetConfig:  config.Network,
 	}
 
-	luminance := luminance.Luminance{
-		Astronomy: luminance.IpGeolocation{
+	astronomy, err := luminance.NewAstronomy(
+		luminance.IpGeolocation{
 			Config: config.Luminance.IpGeolocation,
 		},
-		Meteorology: luminance.OpenMeteo{
-			Config: config.Luminance.OpenMeteo,
-		},
+		config.Luminance.Cache.Astronomy,
+		config.Luminance.Fallback.Astronomy,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	meteorologyProvider, err := meteorologyProvider(&config)
+	if err != nil {
+		panic(err)
+	}
+
+	meteorology, err := luminance.NewMeteorology(
+		meteorologyProvider,
+		config.Luminance.Cache.Meteorology,
+		config.Luminance.Fallback.Meteorology,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	calibrations, err := luminance.LoadCalibrationProfiles(config.Luminance.Calibration.File)
+	if err != nil {
+		panic(err)
+	}
+
+	turbidity := luminance.LinkeTurbidity{
+		Config: config.Luminance.Turbidity,
+	}
+
+	lum := luminance.Luminance{
+		Astronomy:    astronomy,
+		Meteorology:  meteorology,
+		Turbidity:    turbidity,
+		Calibrations: calibrations,
+	}
+
+	retention, err := eventRetention(&config)
+	if err != nil {
+		panic(err)
+	}
+
+	transitions, err := client.NewTransitions(config.Transitions)
+	if err != nil {
+		panic(err)
+	}
+	transition, err := defaultTransition(&config)
+	if err != nil {
+		panic(err)
 	}
 
 	c := client.Client{
-		LightsDb:  db,
-		WizClient: wiz,
-		Luminance: luminance,
-		Location:  config.Location,
+		LightsDb:       lightsDb,
+		WizClient:      wiz,
+		Luminance:      lum,
+		Location:       config.Location,
+		Energy:         config.Energy,
+		Source:         db.SourceTUI,
+		EventRetention: retention,
+		Transitions:    transitions,
+		Transition:     transition,
+	}
+
+	// The commands run in the daemon when one is running, which alone talks
+	// to the lights then, and prunes the events.
+	var functions client.Functions = c
+	runDaemon := len(os.Args) > 1 && os.Args[1] == "daemon"
+	if !runDaemon {
+		if remote, err := daemon.Attach(config.Daemon.Socket); err == nil {
+			defer remote.Close()
+			remote.Location = config.Location
+			functions = remote
+		} else if _, err := c.PruneEvents(); err != nil {
+			panic(err)
+		}
+	}
+
+	engine := rules.Engine{
+		Client:   functions,
+		Lux:      lum,
+		Location: config.Location,
+		Poll:     config.Rules.Poll,
+	}
+
+	if len(os.Args) > 1 {
+		cli := cli.Cli{
+			Client: functions.WithSource(db.SourceCLI),
+			Calibrator: luminance.Calibrator{
+				History:     luminance.OpenMeteoArchive{Config: config.Luminance.OpenMeteoArchive},
+				Meteorology: meteorology,
+				Turbidity:   turbidity,
+			},
+			CalibrationFile: config.Luminance.Calibration.File,
+			Location:        config.Location,
+			Rules:           engine,
+			RulesFile:       config.Rules.File,
+			Out:             os.Stdout,
+		}
+		if runDaemon {
+			log, err := daemon.NewLogger(config.Daemon, os.Stderr)
+			if err != nil {
+				panic(err)
+			}
+			c.Source = db.SourceDaemon
+			engine.Client = c
+			cli.Daemon = daemon.Daemon{
+				Config:    config.Daemon,
+				Client:    c,
+				Rules:     engine,
+				RulesFile: config.Rules.File,
+				Api:       api.Server{Config: config.Api, Client: c},
+				Log:       log,
+			}
+		}
+		if err := cli.Run(os.Args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	stale, err := staleAfter(&config)
+	if err != nil {
+		panic(err)
 	}
 
-	p := tea.NewProgram(ui.NewModel(c), tea.WithAltScreen())
+	p := tea.NewProgram(ui.NewModel(functions.WithSource(db.SourceTUI), stale), tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error %v\n", err)
 	}
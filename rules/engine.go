@@ -0,0 +1,477 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultPoll is how often the engine looks at the world when Poll is not
+// set.
+const defaultPoll = 30 * time.Second
+
+// LuxEstimator estimates the outdoor illuminance at a place, as
+// luminance.Luminance does.
+type LuxEstimator interface {
+	GetCurrent(latitude, longitude float64) (float64, error)
+}
+
+type Config struct {
+	File string        `yaml:"file"`
+	Poll time.Duration `yaml:"poll"`
+}
+
+// Engine runs rules on the lights of Client, estimating the lux at Location.
+// It looks at the world every Poll, so triggers fire up to that late.
+type Engine struct {
+	Client   Client
+	Lux      LuxEstimator
+	Location client.Location
+	Poll     time.Duration
+
+	// now is the clock of the engine, time.Now when nil.
+	now func() time.Time
+}
+
+// Client is what the engine needs of a client: to look at and command the
+// lights, and to apply snapshots and parse schedules, as automation.
+type Client interface {
+	client.Lights
+	client.Automation
+	WithSource(source string) client.Functions
+}
+
+// Check tells how a trigger or a condition stands.
+type Check struct {
+	What   string
+	Holds  bool
+	Detail string
+}
+
+// Result tells what a rule did when one of its triggers fired: Ran tells
+// whether its conditions held, so that its actions ran, or would have in a
+// dry run.
+type Result struct {
+	Rule       string
+	At         time.Time
+	Fired      []string
+	Conditions []Check
+	Actions    []string
+	Ran        bool
+	DryRun     bool
+	Lights     []wiz.Light
+	Err        error
+}
+
+// Explanation tells how a rule stands now: which of its triggers are in the
+// state they fire on, whether its conditions hold and what its actions would
+// change. WouldRun tells whether the rule would run if a trigger fired now.
+type Explanation struct {
+	Rule       string
+	Triggers   []Check
+	Conditions []Check
+	Actions    []string
+	WouldRun   bool
+}
+
+// world is what the engine saw at a time. The lux and the lights are only
+// looked at when a rule needs them.
+type world struct {
+	at        time.Time
+	lux       float64
+	luxErr    error
+	lights    map[string]wiz.Light
+	lightsErr error
+}
+
+// Run looks at the world every poll and runs the rules a change fires, until
+// stop is closed, calling report with what each rule fired did. In a dry run
+// the actions are reported but not run.
+func (e Engine) Run(rules []Rule, dryRun bool, stop <-chan struct{}, report func(Result)) error {
+	poll := e.Poll
+	if poll <= 0 {
+		poll = defaultPoll
+	}
+
+	last := e.look(rules)
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(poll):
+		}
+
+		now := e.look(rules)
+		for _, result := range e.step(rules, last, now, dryRun) {
+			report(result)
+		}
+		last = now
+	}
+}
+
+// Explain tells how every rule stands now.
+func (e Engine) Explain(rules []Rule) []Explanation {
+	w := e.look(rules)
+	result := make([]Explanation, len(rules))
+	for i, rule := range rules {
+		explanation := Explanation{Rule: rule.Name, WouldRun: true}
+		for _, t := range rule.Triggers {
+			explanation.Triggers = append(explanation.Triggers, e.explainTrigger(t, w))
+		}
+		for _, c := range rule.Conditions {
+			check := e.checkCondition(c, w)
+			explanation.Conditions = append(explanation.Conditions, check)
+			explanation.WouldRun = explanation.WouldRun && check.Holds
+		}
+		for _, a := range rule.Actions {
+			explanation.Actions = append(explanation.Actions, e.explainAction(a))
+		}
+		result[i] = explanation
+	}
+	return result
+}
+
+func (e Engine) clock() time.Time {
+	if e.now == nil {
+		return time.Now()
+	}
+	return e.now()
+}
+
+// client returns the client with the commands recorded as automation.
+func (e Engine) client() client.Functions {
+	return e.Client.WithSource(db.SourceAutomation)
+}
+
+func (e Engine) look(rules []Rule) world {
+	w := world{at: e.clock()}
+
+	var needsLux, needsLights bool
+	for _, r := range rules {
+		for _, t := range r.Triggers {
+			needsLux = needsLux || t.Lux != nil
+			needsLights = needsLights || t.State != nil || t.Offline != nil
+		}
+		for _, c := range r.Conditions {
+			needsLux = needsLux || c.Lux != nil
+			needsLights = needsLights || c.State != nil
+		}
+	}
+
+	if needsLux {
+		if e.Lux == nil {
+			w.luxErr = errors.New("no lux estimator")
+		} else {
+			w.lux, w.luxErr = e.Lux.GetCurrent(e.Location.Latitude, e.Location.Longitude)
+		}
+	}
+	if needsLights {
+		lights, err := e.client().ShowAll()
+		w.lights, w.lightsErr = make(map[string]wiz.Light, len(lights)), err
+		for _, l := range lights {
+			w.lights[l.Id] = l
+		}
+	}
+	return w
+}
+
+// step runs the rules fired by the changes from last to now.
+func (e Engine) step(rules []Rule, last, now world, dryRun bool) []Result {
+	var results []Result
+	for _, rule := range rules {
+		result := Result{Rule: rule.Name, At: now.at, DryRun: dryRun}
+		var errs []error
+		for _, t := range rule.Triggers {
+			fired, err := e.fired(t, last, now)
+			errs = append(errs, err)
+			if fired != "" {
+				result.Fired = append(result.Fired, fired)
+			}
+		}
+		if len(result.Fired) == 0 {
+			if err := errors.Join(errs...); err != nil {
+				result.Err = err
+				results = append(results, result)
+			}
+			continue
+		}
+
+		result.Ran = true
+		for _, c := range rule.Conditions {
+			check := e.checkCondition(c, now)
+			result.Conditions = append(result.Conditions, check)
+			result.Ran = result.Ran && check.Holds
+		}
+		if result.Ran {
+			for _, a := range rule.Actions {
+				result.Actions = append(result.Actions, a.String())
+				if !dryRun {
+					lights, err := e.act(a)
+					result.Lights = append(result.Lights, lights...)
+					errs = append(errs, err)
+				}
+			}
+		}
+		result.Err = errors.Join(errs...)
+		results = append(results, result)
+	}
+	return results
+}
+
+// fired tells how a trigger fired from last to now, empty when it did not.
+func (e Engine) fired(t Trigger, last, now world) (string, error) {
+	switch {
+	case t.schedule != nil:
+		due := t.schedule.Next(last.at)
+		if due.IsZero() || due.After(now.at) {
+			return "", nil
+		}
+		return fmt.Sprintf("%s, due %s", t, due.Format(time.DateTime)), nil
+	case t.Lux != nil:
+		if last.luxErr != nil || now.luxErr != nil || t.Lux.holds(last.lux) || !t.Lux.holds(now.lux) {
+			return "", nil
+		}
+		return fmt.Sprintf("lux went from %.0f to %.0f, %s", last.lux, now.lux, t.Lux), nil
+	}
+
+	var selected db.LightSelection
+	if t.State != nil {
+		selected = t.State.Lights
+	} else {
+		selected = t.Offline.Lights
+	}
+	lights, err := e.selected(selected, now)
+	if err != nil {
+		return "", err
+	}
+
+	var changes []string
+	for _, light := range lights {
+		before, ok := last.lights[light.Id]
+		if !ok {
+			continue
+		}
+		switch {
+		case t.State != nil:
+			if before.IsOn == nil || light.IsOn == nil || *before.IsOn == *light.IsOn || (t.State.Is != "" && onOff(light) != t.State.Is) {
+				continue
+			}
+			changes = append(changes, fmt.Sprintf("%s turned %s", name(light), onOff(light)))
+		case !offline(before, last.at, t.Offline.For) && offline(light, now.at, t.Offline.For):
+			changes = append(changes, fmt.Sprintf("%s is offline since %s", name(light), light.LastSeen.Format(time.DateTime)))
+		}
+	}
+	return strings.Join(changes, ", "), nil
+}
+
+// explainTrigger tells whether the world is as a trigger fires on.
+func (e Engine) explainTrigger(t Trigger, w world) Check {
+	check := Check{What: t.String()}
+	switch {
+	case t.schedule != nil:
+		if next := t.schedule.Next(w.at); !next.IsZero() {
+			check.Detail = "next due " + next.Format(time.DateTime)
+		} else {
+			check.Detail = "never due"
+		}
+	case t.Lux != nil:
+		check.Holds, check.Detail = luxHolds(*t.Lux, w)
+	case t.State != nil && t.State.Is == "":
+		check.Detail = "fires on any change"
+	case t.State != nil:
+		check = e.checkState(*t.State, w)
+	case t.Offline != nil:
+		lights, err := e.selected(t.Offline.Lights, w)
+		if err != nil {
+			check.Detail = err.Error()
+			break
+		}
+		var down []string
+		for _, l := range lights {
+			if offline(l, w.at, t.Offline.For) {
+				down = append(down, name(l))
+			}
+		}
+		check.Holds = len(down) > 0
+		check.Detail = fmt.Sprintf("%d of %d lights offline", len(down), len(lights))
+		if len(down) > 0 {
+			check.Detail += ": " + strings.Join(down, ", ")
+		}
+	}
+	return check
+}
+
+func (e Engine) checkCondition(c Condition, w world) Check {
+	check := Check{What: c.String(), Holds: true}
+	var details []string
+	add := func(holds bool, detail string) {
+		check.Holds = check.Holds && holds
+		details = append(details, detail)
+	}
+
+	at := w.at.In(time.Local)
+	if c.after != nil || c.before != nil {
+		minutes := at.Hour()*60 + at.Minute()
+		holds := true
+		switch {
+		case c.after != nil && c.before != nil && *c.after > *c.before:
+			holds = minutes >= *c.after || minutes < *c.before
+		case c.after != nil && c.before != nil:
+			holds = minutes >= *c.after && minutes < *c.before
+		case c.after != nil:
+			holds = minutes >= *c.after
+		default:
+			holds = minutes < *c.before
+		}
+		add(holds, "it is "+at.Format("15:04"))
+	}
+	if c.days != nil {
+		add(slices.Contains(c.days, at.Weekday()), "it is "+at.Weekday().String())
+	}
+	if c.Lux != nil {
+		add(luxHolds(*c.Lux, w))
+	}
+	if c.State != nil {
+		state := e.checkState(*c.State, w)
+		add(state.Holds, state.Detail)
+	}
+
+	check.Detail = strings.Join(details, ", ")
+	return check
+}
+
+func luxHolds(t Threshold, w world) (bool, string) {
+	if w.luxErr != nil {
+		return false, "lux unknown: " + w.luxErr.Error()
+	}
+	return t.holds(w.lux), fmt.Sprintf("lux is %.0f", w.lux)
+}
+
+// checkState tells whether any or all the lights of a state are as it tells.
+// Unreachable lights are neither on nor off.
+func (e Engine) checkState(s State, w world) Check {
+	check := Check{What: s.String()}
+	lights, err := e.selected(s.Lights, w)
+	if err != nil {
+		check.Detail = err.Error()
+		return check
+	}
+
+	matching := 0
+	for _, l := range lights {
+		if l.IsOn != nil && onOff(l) == s.Is {
+			matching++
+		}
+	}
+	if s.All {
+		check.Holds = matching == len(lights)
+	} else {
+		check.Holds = matching > 0
+	}
+	check.Detail = fmt.Sprintf("%d of %d lights %s", matching, len(lights), s.Is)
+	return check
+}
+
+func (e Engine) explainAction(a Action) string {
+	if a.Do == client.CommandSnapshot {
+		return a.String()
+	}
+	lights, err := e.Client.Select(client.SelectorOf(a.Lights))
+	if err != nil {
+		return fmt.Sprintf("%s: %v", a, err)
+	}
+	if len(lights) == 0 {
+		return fmt.Sprintf("%s: no lights", a)
+	}
+	names := make([]string, len(lights))
+	for i, l := range lights {
+		names[i] = name(l)
+	}
+	return fmt.Sprintf("%s: %s", a, strings.Join(names, ", "))
+}
+
+// act runs an action on all its lights at once.
+func (e Engine) act(a Action) ([]wiz.Light, error) {
+	c := e.client()
+	if a.Transition > 0 {
+		c = c.WithTransition(a.Transition)
+	}
+
+	var command func(lightId string) (*wiz.Light, error)
+	switch {
+	case a.Do == client.CommandSnapshot:
+		return c.ApplySnapshot(a.Snapshot)
+	case a.Do == client.CommandOn && (a.Brightness != 0 || a.Temperature != 0):
+		command = func(lightId string) (*wiz.Light, error) {
+			return c.SetPilot(lightId, wiz.Pilot{IsOn: true, Dimming: a.Brightness, Temp: a.Temperature})
+		}
+	case a.Do == client.CommandOn:
+		command = c.TurnOn
+	case a.Do == client.CommandOff:
+		command = c.TurnOff
+	default:
+		command = c.MatchDaylight
+	}
+
+	lights, err := c.Select(client.SelectorOf(a.Lights))
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*wiz.Light, len(lights))
+	errs := make([]error, len(lights))
+	var wg sync.WaitGroup
+	for i, l := range lights {
+		wg.Go(func() { results[i], errs[i] = command(l.Id) })
+	}
+	wg.Wait()
+
+	var result []wiz.Light
+	for _, l := range results {
+		if l != nil {
+			result = append(result, *l)
+		}
+	}
+	return result, errors.Join(errs...)
+}
+
+// selected returns the lights of a selection as seen in a world.
+func (e Engine) selected(s db.LightSelection, w world) ([]wiz.Light, error) {
+	if w.lightsErr != nil {
+		return nil, w.lightsErr
+	}
+	lights, err := e.Client.Select(client.SelectorOf(s))
+	if err != nil {
+		return nil, err
+	}
+	for i, l := range lights {
+		if seen, ok := w.lights[l.Id]; ok {
+			lights[i] = seen
+		}
+	}
+	return lights, nil
+}
+
+// offline tells whether a light has not answered for d at a time.
+func offline(light wiz.Light, at time.Time, d time.Duration) bool {
+	return light.IsOn == nil && at.Sub(light.LastSeen) >= d
+}
+
+func onOff(light wiz.Light) string {
+	if light.IsOn != nil && *light.IsOn {
+		return "on"
+	}
+	return "off"
+}
+
+func name(light wiz.Light) string {
+	if light.Name != "" {
+		return light.Name
+	}
+	return light.Id
+}
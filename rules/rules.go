@@ -0,0 +1,366 @@
+// Package rules runs the automations declared in a YAML file: when one of
+// the triggers of a rule fires and all its conditions hold, its actions run.
+// A file of rules reads as:
+//
+//	rules:
+//	  - name: living room at dusk
+//	    when:
+//	      - lux: {below: 2000}
+//	    if:
+//	      - after: "16:00"
+//	      - state: {lights: {tags: living}, is: off}
+//	    then:
+//	      - do: on
+//	        lights: {tags: living}
+//	        brightness: 60
+//
+// Triggers fire on a change seen between two looks at the world: a schedule
+// coming due, the estimated outdoor lux crossing a threshold, a light turning
+// on or off, or a light unreachable for a while.
+package rules
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Rule struct {
+	Name       string      `yaml:"name"`
+	Triggers   []Trigger   `yaml:"when"`
+	Conditions []Condition `yaml:"if"`
+	Actions    []Action    `yaml:"then"`
+}
+
+// Trigger fires a rule. Exactly one of its fields is set: At is a schedule
+// as jobs take it, Lux fires when the estimate enters the threshold, State
+// when a selected light turns on or off and Offline when one has been
+// unreachable for a while.
+type Trigger struct {
+	At      string     `yaml:"at"`
+	Lux     *Threshold `yaml:"lux"`
+	State   *State     `yaml:"state"`
+	Offline *Offline   `yaml:"offline"`
+
+	schedule client.Schedule
+}
+
+// Threshold holds for the values below Below and above Above, whichever are
+// set.
+type Threshold struct {
+	Below *float64 `yaml:"below"`
+	Above *float64 `yaml:"above"`
+}
+
+// State is about the selected lights being on or off. As a trigger, an empty
+// Is fires on any change. As a condition, it holds when any of the lights is
+// as Is tells, or all of them with All.
+type State struct {
+	Lights db.LightSelection `yaml:"lights"`
+	Is     string            `yaml:"is"`
+	All    bool              `yaml:"all"`
+}
+
+type Offline struct {
+	Lights db.LightSelection `yaml:"lights"`
+	For    time.Duration     `yaml:"for"`
+}
+
+// Condition must hold for a rule to run. Every field set must hold: After
+// and Before are times of the day, as 16:00, together a window that may span
+// midnight, and Days are days as alarms take them.
+type Condition struct {
+	After  string     `yaml:"after"`
+	Before string     `yaml:"before"`
+	Days   string     `yaml:"days"`
+	Lux    *Threshold `yaml:"lux"`
+	State  *State     `yaml:"state"`
+
+	after, before *int
+	days          []time.Weekday
+}
+
+// Action is a command a rule runs: on, off or daylight on the selected
+// lights, or snapshot to apply Snapshot. On sets Brightness, in percent, and
+// Temperature, in kelvins, when given.
+type Action struct {
+	Do          string            `yaml:"do"`
+	Lights      db.LightSelection `yaml:"lights"`
+	Brightness  int               `yaml:"brightness"`
+	Temperature int               `yaml:"temperature"`
+	Snapshot    string            `yaml:"snapshot"`
+	Transition  time.Duration     `yaml:"transition"`
+}
+
+type file struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Load reads the rules of a file.
+func (e Engine) Load(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return e.Parse(data)
+}
+
+// Parse reads rules from YAML and checks them.
+func (e Engine) Parse(data []byte) ([]Rule, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var f file
+	if err := decoder.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	for i := range f.Rules {
+		rule := &f.Rules[i]
+		if err := e.check(rule); err != nil {
+			if rule.Name == "" {
+				return nil, fmt.Errorf("rule %d: %w", i+1, err)
+			}
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		if slices.ContainsFunc(f.Rules[:i], func(r Rule) bool { return r.Name == rule.Name }) {
+			return nil, fmt.Errorf("rule %s is declared twice", rule.Name)
+		}
+	}
+	return f.Rules, nil
+}
+
+func (e Engine) check(rule *Rule) error {
+	switch {
+	case rule.Name == "":
+		return errors.New("the name is missing")
+	case len(rule.Triggers) == 0:
+		return errors.New("no trigger under when")
+	case len(rule.Actions) == 0:
+		return errors.New("no action under then")
+	}
+
+	for i := range rule.Triggers {
+		if err := e.checkTrigger(&rule.Triggers[i]); err != nil {
+			return err
+		}
+	}
+	for i := range rule.Conditions {
+		if err := checkCondition(&rule.Conditions[i]); err != nil {
+			return err
+		}
+	}
+	for _, a := range rule.Actions {
+		if err := checkAction(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e Engine) checkTrigger(t *Trigger) error {
+	set := 0
+	for _, isSet := range []bool{t.At != "", t.Lux != nil, t.State != nil, t.Offline != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return errors.New("a trigger takes one of at, lux, state or offline")
+	}
+
+	switch {
+	case t.At != "":
+		schedule, err := e.Client.ParseSchedule(t.At, time.Local)
+		if err != nil {
+			return err
+		}
+		t.schedule = schedule
+	case t.Lux != nil:
+		return t.Lux.check()
+	case t.State != nil:
+		return t.State.check(false)
+	case t.Offline != nil:
+		if client.SelectorOf(t.Offline.Lights).IsEmpty() {
+			return errors.New("offline: no lights selected")
+		}
+		if t.Offline.For < 0 {
+			return errors.New("offline: for must not be negative")
+		}
+	}
+	return nil
+}
+
+func (t Threshold) check() error {
+	if t.Below == nil && t.Above == nil {
+		return errors.New("lux: below or above is missing")
+	}
+	return nil
+}
+
+func (t Threshold) holds(value float64) bool {
+	return (t.Below == nil || value < *t.Below) && (t.Above == nil || value > *t.Above)
+}
+
+func (s State) check(condition bool) error {
+	if client.SelectorOf(s.Lights).IsEmpty() {
+		return errors.New("state: no lights selected")
+	}
+	switch {
+	case s.Is == "on" || s.Is == "off":
+	case s.Is == "" && !condition:
+	default:
+		return fmt.Errorf("state: is must be on or off, not %q", s.Is)
+	}
+	return nil
+}
+
+func checkCondition(c *Condition) error {
+	if c.After == "" && c.Before == "" && c.Days == "" && c.Lux == nil && c.State == nil {
+		return errors.New("a condition takes after, before, days, lux or state")
+	}
+
+	for _, bound := range []struct {
+		value string
+		into  **int
+	}{{c.After, &c.after}, {c.Before, &c.before}} {
+		if bound.value == "" {
+			continue
+		}
+		at, err := time.Parse("15:04", bound.value)
+		if err != nil {
+			return fmt.Errorf("invalid time %q, expected HH:MM", bound.value)
+		}
+		minutes := at.Hour()*60 + at.Minute()
+		*bound.into = &minutes
+	}
+
+	if c.Days != "" {
+		days, err := client.ParseDays(c.Days)
+		if err != nil {
+			return err
+		}
+		c.days = days
+	}
+	if c.Lux != nil {
+		if err := c.Lux.check(); err != nil {
+			return err
+		}
+	}
+	if c.State != nil {
+		return c.State.check(true)
+	}
+	return nil
+}
+
+func checkAction(a Action) error {
+	switch a.Do {
+	case client.CommandOn, client.CommandOff, client.CommandDaylight:
+		if client.SelectorOf(a.Lights).IsEmpty() {
+			return fmt.Errorf("%s: no lights selected", a.Do)
+		}
+	case client.CommandSnapshot:
+		if a.Snapshot == "" {
+			return errors.New("snapshot: the snapshot to apply is missing")
+		}
+	default:
+		return fmt.Errorf("unknown action %q, expected on, off, daylight or snapshot", a.Do)
+	}
+
+	switch {
+	case (a.Brightness != 0 || a.Temperature != 0) && a.Do != client.CommandOn:
+		return fmt.Errorf("%s: brightness and temperature only go with on", a.Do)
+	case a.Brightness != 0 && (a.Brightness < wiz.MinDimming || a.Brightness > 100):
+		return fmt.Errorf("brightness must be from %d to 100", wiz.MinDimming)
+	case a.Temperature != 0 && (a.Temperature < wiz.MinTemperatureK || a.Temperature > wiz.MaxTemperatureK):
+		return fmt.Errorf("temperature must be from %d to %d", wiz.MinTemperatureK, wiz.MaxTemperatureK)
+	case a.Transition < 0:
+		return errors.New("the transition must not be negative")
+	}
+	return nil
+}
+
+func (t Trigger) String() string {
+	switch {
+	case t.At != "":
+		return "at " + t.At
+	case t.Lux != nil:
+		return "lux " + t.Lux.String()
+	case t.State != nil:
+		return t.State.String()
+	case t.Offline != nil:
+		return fmt.Sprintf("%s offline for %s", selection(t.Offline.Lights), t.Offline.For)
+	}
+	return ""
+}
+
+func (t Threshold) String() string {
+	var parts []string
+	if t.Below != nil {
+		parts = append(parts, fmt.Sprintf("below %g", *t.Below))
+	}
+	if t.Above != nil {
+		parts = append(parts, fmt.Sprintf("above %g", *t.Above))
+	}
+	return strings.Join(parts, " and ")
+}
+
+func (s State) String() string {
+	switch {
+	case s.Is == "":
+		return selection(s.Lights) + " turn on or off"
+	case s.All:
+		return fmt.Sprintf("all of %s %s", selection(s.Lights), s.Is)
+	}
+	return fmt.Sprintf("any of %s %s", selection(s.Lights), s.Is)
+}
+
+func (c Condition) String() string {
+	var parts []string
+	if c.After != "" {
+		parts = append(parts, "after "+c.After)
+	}
+	if c.Before != "" {
+		parts = append(parts, "before "+c.Before)
+	}
+	if c.Days != "" {
+		parts = append(parts, "on "+c.Days)
+	}
+	if c.Lux != nil {
+		parts = append(parts, "lux "+c.Lux.String())
+	}
+	if c.State != nil {
+		parts = append(parts, c.State.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (a Action) String() string {
+	if a.Do == client.CommandSnapshot {
+		return "apply snapshot " + a.Snapshot
+	}
+	s := a.Do + " " + selection(a.Lights)
+	if a.Brightness != 0 {
+		s += fmt.Sprintf(" at %d%%", a.Brightness)
+	}
+	if a.Temperature != 0 {
+		s += fmt.Sprintf(" at %dK", a.Temperature)
+	}
+	if a.Transition != 0 {
+		s += " over " + a.Transition.String()
+	}
+	return s
+}
+
+func selection(s db.LightSelection) string {
+	return "lights " + client.SelectorOf(s).String()
+}
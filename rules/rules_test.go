@@ -0,0 +1,255 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"gowizcli/wiz/wiztest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const livingRoomAtDusk = `
+rules:
+  - name: living room at dusk
+    when:
+      - lux: {below: 2000}
+    if:
+      - after: "16:00"
+      - state: {lights: {tags: living}, is: off}
+    then:
+      - do: on
+        lights: {tags: living}
+        brightness: 60
+`
+
+func TestEngine_Parse(t *testing.T) {
+	e, _ := newTestEngine()
+	rules, err := e.Parse([]byte(livingRoomAtDusk))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Name != "living room at dusk" || len(rules[0].Conditions) != 2 || rules[0].Actions[0].Brightness != 60 {
+		t.Fatalf("got %+v; expected the living room rule", rules)
+	}
+
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{"no name", "rules: [{when: [{at: sunset}], then: [{do: off, lights: {all: true}}]}]"},
+		{"no trigger", "rules: [{name: r, then: [{do: off, lights: {all: true}}]}]"},
+		{"no action", "rules: [{name: r, when: [{at: sunset}]}]"},
+		{"two triggers in one", "rules: [{name: r, when: [{at: sunset, lux: {below: 10}}], then: [{do: off, lights: {all: true}}]}]"},
+		{"bad schedule", "rules: [{name: r, when: [{at: sometimes}], then: [{do: off, lights: {all: true}}]}]"},
+		{"empty threshold", "rules: [{name: r, when: [{lux: {}}], then: [{do: off, lights: {all: true}}]}]"},
+		{"bad state", "rules: [{name: r, when: [{state: {lights: {all: true}, is: dim}}], then: [{do: off, lights: {all: true}}]}]"},
+		{"bad time", "rules: [{name: r, when: [{at: sunset}], if: [{after: 4pm}], then: [{do: off, lights: {all: true}}]}]"},
+		{"unknown action", "rules: [{name: r, when: [{at: sunset}], then: [{do: dance, lights: {all: true}}]}]"},
+		{"no lights", "rules: [{name: r, when: [{at: sunset}], then: [{do: off}]}]"},
+		{"brightness off", "rules: [{name: r, when: [{at: sunset}], then: [{do: off, lights: {all: true}, brightness: 50}]}]"},
+		{"brightness too high", "rules: [{name: r, when: [{at: sunset}], then: [{do: on, lights: {all: true}, brightness: 150}]}]"},
+		{"unknown field", "rules: [{name: r, when: [{at: sunset}], then: [{do: on, lights: {all: true}, colour: red}]}]"},
+		{"twice", "rules: [{name: r, when: [{at: sunset}], then: [{do: off, lights: {all: true}}]}, {name: r, when: [{at: sunrise}], then: [{do: on, lights: {all: true}}]}]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := e.Parse([]byte(tt.yaml)); err == nil {
+				t.Fatalf("expected an error")
+			}
+		})
+	}
+}
+
+func TestEngine_LuxRule(t *testing.T) {
+	e, wizClient := newTestEngine()
+	lux := &fakeLux{lux: 2500}
+	e.Lux = lux
+	run := newTestRun(t, e, livingRoomAtDusk, time.Date(2025, time.June, 20, 15, 50, 0, 0, time.Local))
+
+	// The lux drops before 16:00: the rule fires but does not run.
+	lux.lux = 1900
+	results := run.step(5*time.Minute, false)
+	if len(results) != 1 || results[0].Ran || results[0].Conditions[0].Holds || !results[0].Conditions[1].Holds {
+		t.Fatalf("got %+v; expected the rule fired but held back by the time", results)
+	}
+
+	lux.lux = 2500
+	run.step(5*time.Minute, false)
+	lux.lux = 1800
+	results = run.step(5*time.Minute, false)
+	if len(results) != 1 || !results[0].Ran || results[0].Err != nil {
+		t.Fatalf("got %+v; expected the rule to run", results)
+	}
+	expected := wiz.Pilot{IsOn: true, Dimming: 60}
+	if got := wizClient.Pilot("10.0.0.1"); got != expected {
+		t.Fatalf("got %+v; expected %+v", got, expected)
+	}
+	if got := wizClient.Pilot("10.0.0.2"); got.IsOn {
+		t.Fatalf("got %+v; expected the kitchen left off", got)
+	}
+
+	// The lux stays below the threshold, which does not fire again.
+	lux.lux = 1500
+	if results := run.step(time.Minute, false); len(results) != 0 {
+		t.Fatalf("got %+v; expected nothing to fire", results)
+	}
+
+	events, _ := e.Client.(client.Client).History(db.EventFilter{LightId: "1", Limit: 1})
+	if len(events) != 1 || events[0].Command != client.CommandSet || events[0].Source != db.SourceAutomation {
+		t.Fatalf("got %+v; expected a set event from automation", events)
+	}
+}
+
+func TestEngine_StateAndOfflineTriggers(t *testing.T) {
+	e, wizClient := newTestEngine()
+	start := time.Date(2025, time.June, 20, 20, 0, 0, 0, time.Local)
+	e.Client.(client.Client).LightsDb.MarkSeen("3", start.Add(-5*time.Minute))
+	wizClient.Unreachable["10.0.0.3"] = true
+	run := newTestRun(t, e, `
+rules:
+  - name: follow
+    when:
+      - state: {lights: {ids: ["1"]}, is: on}
+    then:
+      - {do: on, lights: {ids: ["2"]}}
+  - name: porch down
+    when:
+      - offline: {lights: {ids: ["3"]}, for: 10m}
+    then:
+      - {do: off, lights: {ids: ["1", "2"]}}
+`, start)
+
+	wizClient.Pilots["10.0.0.1"] = wiz.Pilot{IsOn: true}
+	results := run.step(time.Minute, false)
+	if len(results) != 1 || results[0].Rule != "follow" || !results[0].Ran || !strings.Contains(results[0].Fired[0], "1 turned on") {
+		t.Fatalf("got %+v; expected follow to run", results)
+	}
+	if !wizClient.Pilot("10.0.0.2").IsOn {
+		t.Fatalf("expected light 2 on")
+	}
+
+	// Light 3 was last seen 8 minutes ago, then 11.
+	if results := run.step(2*time.Minute, false); len(results) != 0 {
+		t.Fatalf("got %+v; expected nothing to fire", results)
+	}
+	results = run.step(3*time.Minute, false)
+	if len(results) != 1 || results[0].Rule != "porch down" || !results[0].Ran {
+		t.Fatalf("got %+v; expected porch down to run", results)
+	}
+	if wizClient.Pilot("10.0.0.1").IsOn || wizClient.Pilot("10.0.0.2").IsOn {
+		t.Fatalf("expected lights 1 and 2 off")
+	}
+	if results := run.step(time.Minute, false); len(results) != 0 {
+		t.Fatalf("got %+v; expected the offline light to fire once", results)
+	}
+}
+
+func TestEngine_ScheduleDryRun(t *testing.T) {
+	e, wizClient := newTestEngine()
+	run := newTestRun(t, e, `
+rules:
+  - name: morning
+    when:
+      - at: every day 07:00
+    if:
+      - days: weekdays
+    then:
+      - {do: on, lights: {all: true}, temperature: 5000, transition: 10s}
+`, time.Date(2025, time.June, 20, 6, 59, 40, 0, time.Local))
+
+	results := run.step(30*time.Second, true)
+	if len(results) != 1 || !results[0].Ran || !results[0].DryRun || results[0].Actions[0] != "on lights -all at 5000K over 10s" {
+		t.Fatalf("got %+v; expected morning to run dry", results)
+	}
+	if wizClient.Pilot("10.0.0.1").IsOn {
+		t.Fatalf("expected a dry run to leave the lights alone")
+	}
+	if results := run.step(30*time.Second, true); len(results) != 0 {
+		t.Fatalf("got %+v; expected the schedule to fire once", results)
+	}
+}
+
+func TestEngine_Explain(t *testing.T) {
+	e, _ := newTestEngine()
+	e.Lux = &fakeLux{lux: 1800}
+	e.now = func() time.Time { return time.Date(2025, time.June, 20, 16, 5, 0, 0, time.Local) }
+	rules, err := e.Parse([]byte(livingRoomAtDusk))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	explanations := e.Explain(rules)
+	if len(explanations) != 1 || !explanations[0].WouldRun {
+		t.Fatalf("got %+v; expected the rule would run", explanations)
+	}
+	explanation := explanations[0]
+	if !explanation.Triggers[0].Holds || explanation.Triggers[0].Detail != "lux is 1800" {
+		t.Fatalf("got %+v; expected the lux below the threshold", explanation.Triggers)
+	}
+	if explanation.Conditions[1].Detail != "1 of 1 lights off" {
+		t.Fatalf("got %+v; expected the living room light off", explanation.Conditions)
+	}
+	if explanation.Actions[0] != "on lights -tag 'living' at 60%: 1" {
+		t.Fatalf("got %q; expected the action on light 1", explanation.Actions[0])
+	}
+
+	e.Lux = &fakeLux{err: errors.New("offline")}
+	if explanation := e.Explain(rules)[0]; explanation.Triggers[0].Holds {
+		t.Fatalf("got %+v; expected an unknown lux not to hold", explanation.Triggers)
+	}
+}
+
+// newTestEngine runs on three lights, off: 1 in the living room, 2 in the
+// kitchen and 3 on the porch.
+func newTestEngine() (Engine, *wiztest.Client) {
+	storage := wiztest.Inventory(3)
+	for i, tag := range []string{"living", "kitchen", "porch"} {
+		light, _ := storage.FindById(fmt.Sprint(i + 1))
+		storage.AddTags([]wiz.Light{*light}, []string{tag})
+	}
+	wizClient := wiztest.NewClient()
+	return Engine{Client: client.Client{LightsDb: storage, WizClient: wizClient}}, wizClient
+}
+
+// testRun steps an engine through a world the test changes, on a clock it
+// moves forward.
+type testRun struct {
+	engine Engine
+	rules  []Rule
+	clock  time.Time
+	last   world
+}
+
+func newTestRun(t *testing.T, e Engine, rules string, start time.Time) *testRun {
+	run := &testRun{clock: start}
+	e.now = func() time.Time { return run.clock }
+	parsed, err := e.Parse([]byte(rules))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	run.engine, run.rules = e, parsed
+	run.last = e.look(parsed)
+	return run
+}
+
+func (r *testRun) step(d time.Duration, dryRun bool) []Result {
+	r.clock = r.clock.Add(d)
+	now := r.engine.look(r.rules)
+	results := r.engine.step(r.rules, r.last, now, dryRun)
+	r.last = now
+	return results
+}
+
+type fakeLux struct {
+	lux float64
+	err error
+}
+
+func (f *fakeLux) GetCurrent(latitude, longitude float64) (float64, error) {
+	return f.lux, f.err
+}
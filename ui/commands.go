@@ -1,8 +1,11 @@
 package ui
 
 import (
+	"errors"
 	"gowizcli/client"
+	"gowizcli/db"
 	"gowizcli/wiz"
+	"sync"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -96,30 +99,103 @@ func (c CmdDiscover) Run() ([]wiz.Light, error) {
 
 type CmdSwitch struct {
 	client client.Functions
-	light  wiz.Light
+	lights []wiz.Light
 }
 
-func NewCmdSwitch(client client.Functions, light wiz.Light) CmdSwitch {
+// NewCmdSwitch switches lights off when all of them are on, and on otherwise.
+func NewCmdSwitch(client client.Functions, lights []wiz.Light) CmdSwitch {
 	return CmdSwitch{
 		client: client,
-		light:  light,
+		lights: lights,
 	}
 }
 
 func (c CmdSwitch) Run() ([]wiz.Light, error) {
-	if c.light.IsOn != nil && *c.light.IsOn {
-		result, err := c.client.TurnOff(c.light.Id)
-		if err != nil {
-			return nil, err
+	allOn := true
+	for _, l := range c.lights {
+		allOn = allOn && l.IsOn != nil && *l.IsOn
+	}
+
+	if allOn {
+		return forEach(c.lights, c.client.TurnOff)
+	}
+	return forEach(c.lights, c.client.TurnOn)
+}
+
+type CmdMatchDaylight struct {
+	client client.Functions
+	lights []wiz.Light
+}
+
+func NewCmdMatchDaylight(client client.Functions, lights []wiz.Light) CmdMatchDaylight {
+	return CmdMatchDaylight{
+		client: client,
+		lights: lights,
+	}
+}
+
+func (c CmdMatchDaylight) Run() ([]wiz.Light, error) {
+	return forEach(c.lights, c.client.MatchDaylight)
+}
+
+// forEach applies a light command to every light at once, so that they fade
+// together, returning the lights it succeeded on along with the errors of the
+// others.
+func forEach(lights []wiz.Light, apply func(lightId string) (*wiz.Light, error)) ([]wiz.Light, error) {
+	updated := make([]*wiz.Light, len(lights))
+	errs := make([]error, len(lights))
+	var wg sync.WaitGroup
+	for i, l := range lights {
+		wg.Go(func() { updated[i], errs[i] = apply(l.Id) })
+	}
+	wg.Wait()
+
+	result := make([]wiz.Light, 0, len(lights))
+	for _, l := range updated {
+		if l != nil {
+			result = append(result, *l)
 		}
-		return []wiz.Light{*result}, nil
 	}
+	return result, errors.Join(errs...)
+}
+
+type CmdFan struct {
+	client  client.Functions
+	lightId string
+	apply   func(client client.Functions, lightId string) (*wiz.Light, error)
+}
+
+// NewCmdFan runs one of the fan operations of the client on a fan.
+func NewCmdFan(client client.Functions, lightId string, apply func(client client.Functions, lightId string) (*wiz.Light, error)) CmdFan {
+	return CmdFan{
+		client:  client,
+		lightId: lightId,
+		apply:   apply,
+	}
+}
 
-	result, err := c.client.TurnOn(c.light.Id)
+func (c CmdFan) Run() ([]wiz.Light, error) {
+	light, err := c.apply(c.client, c.lightId)
 	if err != nil {
 		return nil, err
 	}
-	return []wiz.Light{*result}, nil
+	return []wiz.Light{*light}, nil
+}
+
+type CmdDelete struct {
+	client client.Functions
+	light  wiz.Light
+}
+
+func NewCmdDelete(client client.Functions, light wiz.Light) CmdDelete {
+	return CmdDelete{
+		client: client,
+		light:  light,
+	}
+}
+
+func (c CmdDelete) Run() ([]wiz.Light, error) {
+	return nil, c.client.Delete(c.light.Id)
 }
 
 type CmdEraseAll struct {
@@ -133,8 +209,24 @@ func NewCmdEraseAll(client client.Functions) CmdEraseAll {
 }
 
 func (c CmdEraseAll) Run() ([]wiz.Light, error) {
-	c.client.EraseAll()
-	return nil, nil
+	return nil, c.client.EraseAll()
+}
+
+type CmdRestore struct {
+	client client.Functions
+}
+
+func NewCmdRestore(client client.Functions) CmdRestore {
+	return CmdRestore{
+		client: client,
+	}
+}
+
+func (c CmdRestore) Run() ([]wiz.Light, error) {
+	if _, err := c.client.RestoreBackup(""); err != nil {
+		return nil, err
+	}
+	return c.client.ShowAll()
 }
 
 type CmdRefresh struct {
@@ -150,3 +242,20 @@ func NewCmdRefresh(client client.Functions) CmdRefresh {
 func (c CmdRefresh) Run() ([]wiz.Light, error) {
 	return c.client.ShowAll()
 }
+
+type roomsLoaded struct {
+	rooms  []db.Room
+	groups []db.Group
+	err    error
+}
+
+func loadRooms(client client.Functions) tea.Cmd {
+	return func() tea.Msg {
+		rooms, err := client.ListRooms()
+		if err != nil {
+			return roomsLoaded{err: err}
+		}
+		groups, err := client.ListGroups()
+		return roomsLoaded{rooms: rooms, groups: groups, err: err}
+	}
+}
@@ -0,0 +1,148 @@
+package ui
+
+import (
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/wiz"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// detailKeys apply while the details of a light are shown; the fan ones only
+// to fans.
+var detailKeys = struct {
+	Close        key.Binding
+	FanPower     key.Binding
+	FanFaster    key.Binding
+	FanSlower    key.Binding
+	FanMode      key.Binding
+	FanDirection key.Binding
+}{
+	Close:        key.NewBinding(key.WithKeys("esc", "enter"), key.WithHelp("esc", "close")),
+	FanPower:     key.NewBinding(key.WithKeys("f"), key.WithHelp("f", "fan on/off")),
+	FanFaster:    key.NewBinding(key.WithKeys("+", "="), key.WithHelp("+", "faster")),
+	FanSlower:    key.NewBinding(key.WithKeys("-"), key.WithHelp("-", "slower")),
+	FanMode:      key.NewBinding(key.WithKeys("m"), key.WithHelp("m", "normal/breeze")),
+	FanDirection: key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "reverse")),
+}
+
+func (m Model) updateDetail(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	light, ok := m.findLight(m.detail)
+	if !ok || key.Matches(msg, detailKeys.Close) {
+		m.detail = ""
+		return m, nil
+	}
+	if key.Matches(msg, keys.Quit.binding) {
+		return m, tea.Quit
+	}
+	if light.Kind() != wiz.KindFan {
+		return m, nil
+	}
+
+	fan := wiz.Fan{Speed: 1, Mode: wiz.FanNormal}
+	if light.Fan != nil {
+		fan = *light.Fan
+	}
+
+	var apply func(c client.Functions, lightId string) (*wiz.Light, error)
+	switch {
+	case key.Matches(msg, detailKeys.FanPower):
+		apply = func(c client.Functions, id string) (*wiz.Light, error) { return c.SetFan(id, !fan.IsOn) }
+	case key.Matches(msg, detailKeys.FanFaster) && fan.Speed < wiz.MaxFanSpeed:
+		apply = func(c client.Functions, id string) (*wiz.Light, error) { return c.SetFanSpeed(id, fan.Speed+1) }
+	case key.Matches(msg, detailKeys.FanSlower) && fan.Speed > 1:
+		apply = func(c client.Functions, id string) (*wiz.Light, error) { return c.SetFanSpeed(id, fan.Speed-1) }
+	case key.Matches(msg, detailKeys.FanMode):
+		mode := wiz.FanBreeze
+		if fan.Mode == wiz.FanBreeze {
+			mode = wiz.FanNormal
+		}
+		apply = func(c client.Functions, id string) (*wiz.Light, error) { return c.SetFanMode(id, mode) }
+	case key.Matches(msg, detailKeys.FanDirection):
+		apply = func(c client.Functions, id string) (*wiz.Light, error) { return c.SetFanDirection(id, !fan.Reverse) }
+	}
+	if apply == nil {
+		return m, nil
+	}
+
+	cr, t := m.cmdRunner.Run(NewCmdFan(m.cmdRunner.client, light.Id, apply))
+	m.cmdRunner = cr
+	return m, t
+}
+
+func (m Model) findLight(id string) (wiz.Light, bool) {
+	for _, l := range m.tableData.lights {
+		if l.Id == id {
+			return l, true
+		}
+	}
+	return wiz.Light{}, false
+}
+
+func detailView(l wiz.Light) string {
+	var b strings.Builder
+	line := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%-12s %s\n", label, value)
+		}
+	}
+
+	status := "Unknown"
+	if l.IsOn != nil && *l.IsOn {
+		status = "On"
+	} else if l.IsOn != nil {
+		status = "Off"
+	}
+
+	line("Name", lightTitle(l))
+	line("Kind", string(l.Kind()))
+	line("Model", l.Model)
+	line("IP Address", l.IpAddress)
+	line("MAC Address", parseMacAddress(l.MacAddress))
+	line("Status", status)
+	if l.Dimming > 0 {
+		line("Dimming", fmt.Sprintf("%d%%", l.Dimming))
+	}
+	if l.Watts != nil {
+		line("Power", fmt.Sprintf("%.1f W", *l.Watts))
+	}
+	if !l.LastSeen.IsZero() {
+		line("Last seen", l.LastSeen.Local().Format(time.DateTime))
+	}
+	line("Tags", strings.Join(l.Tags, ", "))
+
+	help := []key.Binding{detailKeys.Close}
+	if l.Kind() == wiz.KindFan {
+		b.WriteString("\n")
+		line("Fan", fanView(l.Fan))
+		help = append(help, detailKeys.FanPower, detailKeys.FanFaster, detailKeys.FanSlower, detailKeys.FanMode, detailKeys.FanDirection)
+	}
+
+	hints := make([]string, len(help))
+	for i, h := range help {
+		hints[i] = h.Help().Key + " " + h.Help().Desc
+	}
+	b.WriteString("\n" + strings.Join(hints, " • "))
+	return b.String()
+}
+
+func fanView(fan *wiz.Fan) string {
+	if fan == nil {
+		return "Unknown"
+	}
+	if !fan.IsOn {
+		return "Off"
+	}
+	mode := "normal"
+	if fan.Mode == wiz.FanBreeze {
+		mode = "breeze"
+	}
+	direction := "forward"
+	if fan.Reverse {
+		direction = "reverse"
+	}
+	return fmt.Sprintf("On, speed %d/%d, %s, %s", fan.Speed, wiz.MaxFanSpeed, mode, direction)
+}
@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"fmt"
+	"gowizcli/client"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// energyPeriod is how far back the energy panel reports.
+const energyPeriod = 7 * 24 * time.Hour
+
+// energyPanel shows the energy the lights took by room, in place of the
+// lights table.
+type energyPanel struct {
+	report *client.EnergyReport
+	err    error
+}
+
+type energyLoaded struct {
+	report *client.EnergyReport
+	err    error
+}
+
+func loadEnergy(client client.Functions, period time.Duration) tea.Cmd {
+	return func() tea.Msg {
+		now := time.Now()
+		report, err := client.EnergyReport(now.Add(-period), now)
+		return energyLoaded{report: report, err: err}
+	}
+}
+
+func (p energyPanel) View() string {
+	if p.err != nil {
+		return p.err.Error()
+	}
+	if p.report == nil {
+		return "Loading energy report..."
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Energy over the last %d days\n\n", int(energyPeriod.Hours()/24))
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Room\tOn time\tkWh\tSaved kWh\tBy automations")
+	for _, r := range p.report.Rooms {
+		name := r.Name
+		if name == "" {
+			name = "No room"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, usageCells(r.Usage))
+	}
+	fmt.Fprintf(w, "Total\t%s\n", usageCells(p.report.Total))
+	w.Flush()
+	return b.String()
+}
+
+func usageCells(u client.Usage) string {
+	return fmt.Sprintf("%s\t%.2f\t%.2f\t%.2f", u.OnTime.Round(time.Minute), u.KWh, u.SavedKWh(), u.AutomationSavedKWh)
+}
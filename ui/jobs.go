@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// jobKeys apply while the jobs panel is shown.
+var jobKeys = struct {
+	Close  key.Binding
+	Up     key.Binding
+	Down   key.Binding
+	Run    key.Binding
+	Toggle key.Binding
+	Delete key.Binding
+}{
+	Close:  key.NewBinding(key.WithKeys("esc", "c"), key.WithHelp("esc", "close")),
+	Up:     key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑", "up")),
+	Down:   key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓", "down")),
+	Run:    key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "run now")),
+	Toggle: key.NewBinding(key.WithKeys(" "), key.WithHelp("space", "enable or disable")),
+	Delete: key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "delete")),
+}
+
+// jobPanel lists the scheduled jobs in place of the lights table.
+type jobPanel struct {
+	jobs   []db.Job
+	cursor int
+	err    error
+}
+
+type jobsLoaded struct {
+	jobs []db.Job
+	err  error
+}
+
+func loadJobs(client client.Functions) tea.Cmd {
+	return func() tea.Msg {
+		jobs, err := client.ListJobs()
+		return jobsLoaded{jobs: jobs, err: err}
+	}
+}
+
+func (m Model) updateJobs(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.jobs
+
+	var cmd Command
+	switch {
+	case key.Matches(msg, keys.Quit.binding):
+		return m, tea.Quit
+	case key.Matches(msg, jobKeys.Close):
+		m.jobs = nil
+	case key.Matches(msg, jobKeys.Up):
+		p.cursor = max(0, p.cursor-1)
+	case key.Matches(msg, jobKeys.Down):
+		p.cursor = max(0, min(len(p.jobs)-1, p.cursor+1))
+	case p.cursor >= len(p.jobs):
+	case key.Matches(msg, jobKeys.Run):
+		cmd = NewCmdRunJob(m.cmdRunner.client, p.jobs[p.cursor].Name)
+	case key.Matches(msg, jobKeys.Toggle):
+		job := p.jobs[p.cursor]
+		cmd = NewCmdSetJobEnabled(m.cmdRunner.client, job.Name, !job.Enabled)
+	case key.Matches(msg, jobKeys.Delete):
+		job := p.jobs[p.cursor]
+		m.confirm = &confirmation{
+			prompt: fmt.Sprintf("Delete job %s?", job.Name),
+			cmd:    NewCmdDeleteJob(m.cmdRunner.client, job.Name),
+		}
+	}
+
+	if cmd == nil {
+		return m, nil
+	}
+	cr, t := m.cmdRunner.Run(cmd)
+	m.cmdRunner = cr
+	return m, t
+}
+
+func (p jobPanel) View(client client.Functions) string {
+	var b strings.Builder
+	b.WriteString("Scheduled jobs\n\n")
+	if len(p.jobs) == 0 {
+		b.WriteString("No jobs yet, add them with gowizcli job add\n")
+	}
+	now := time.Now()
+	for i, j := range p.jobs {
+		marker := "  "
+		if i == p.cursor {
+			marker = "▸ "
+		}
+		next := "disabled"
+		if at := client.NextRun(j, now); j.Enabled && !at.IsZero() {
+			next = "next " + at.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(&b, "%s%s: %s at %s (%s)\n", marker, j.Name, j.Command, j.Schedule, next)
+		if j.LastError != "" {
+			fmt.Fprintf(&b, "    last run failed: %s\n", j.LastError)
+		}
+	}
+
+	b.WriteString("\n")
+	if p.err != nil {
+		b.WriteString(p.err.Error() + "\n\n")
+	}
+	keys := []key.Binding{jobKeys.Run, jobKeys.Toggle, jobKeys.Delete, jobKeys.Close}
+	help := make([]string, len(keys))
+	for i, k := range keys {
+		help[i] = k.Help().Key + " " + k.Help().Desc
+	}
+	b.WriteString(strings.Join(help, " • "))
+	return b.String()
+}
+
+type CmdRunJob struct {
+	client client.Functions
+	name   string
+}
+
+func NewCmdRunJob(client client.Functions, name string) CmdRunJob {
+	return CmdRunJob{
+		client: client,
+		name:   name,
+	}
+}
+
+func (c CmdRunJob) Run() ([]wiz.Light, error) {
+	return c.client.RunJob(c.name)
+}
+
+type CmdSetJobEnabled struct {
+	client  client.Functions
+	name    string
+	enabled bool
+}
+
+func NewCmdSetJobEnabled(client client.Functions, name string, enabled bool) CmdSetJobEnabled {
+	return CmdSetJobEnabled{
+		client:  client,
+		name:    name,
+		enabled: enabled,
+	}
+}
+
+func (c CmdSetJobEnabled) Run() ([]wiz.Light, error) {
+	_, err := c.client.SetJobEnabled(c.name, c.enabled)
+	return nil, err
+}
+
+type CmdDeleteJob struct {
+	client client.Functions
+	name   string
+}
+
+func NewCmdDeleteJob(client client.Functions, name string) CmdDeleteJob {
+	return CmdDeleteJob{
+		client: client,
+		name:   name,
+	}
+}
+
+func (c CmdDeleteJob) Run() ([]wiz.Light, error) {
+	return nil, c.client.DeleteJob(c.name)
+}
@@ -0,0 +1,165 @@
+package ui
+
+import (
+	"fmt"
+	"gowizcli/client"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// snapshotKeys apply while the snapshot panel is shown.
+var snapshotKeys = struct {
+	Close key.Binding
+	Up    key.Binding
+	Down  key.Binding
+	Apply key.Binding
+	Save  key.Binding
+}{
+	Close: key.NewBinding(key.WithKeys("esc", "p"), key.WithHelp("esc", "close")),
+	Up:    key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑", "up")),
+	Down:  key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓", "down")),
+	Apply: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "apply")),
+	Save:  key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "save all lights")),
+}
+
+// snapshotPanel lists the saved snapshots in place of the lights table. While
+// name is set, it prompts for the name to save the lights under.
+type snapshotPanel struct {
+	snapshots []db.Snapshot
+	cursor    int
+	name      *textinput.Model
+	err       error
+}
+
+type snapshotsLoaded struct {
+	snapshots []db.Snapshot
+	err       error
+}
+
+func loadSnapshots(client client.Functions) tea.Cmd {
+	return func() tea.Msg {
+		snapshots, err := client.ListSnapshots()
+		return snapshotsLoaded{snapshots: snapshots, err: err}
+	}
+}
+
+func (m Model) updateSnapshots(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	p := m.snapshots
+
+	if p.name != nil {
+		switch msg.Type {
+		case tea.KeyEsc:
+			p.name = nil
+			return m, nil
+		case tea.KeyEnter:
+			name := strings.TrimSpace(p.name.Value())
+			p.name = nil
+			if name == "" {
+				return m, nil
+			}
+			cr, t := m.cmdRunner.Run(NewCmdSaveSnapshot(m.cmdRunner.client, name))
+			m.cmdRunner = cr
+			return m, t
+		}
+		input, cmd := p.name.Update(msg)
+		p.name = &input
+		return m, cmd
+	}
+
+	switch {
+	case key.Matches(msg, keys.Quit.binding):
+		return m, tea.Quit
+	case key.Matches(msg, snapshotKeys.Close):
+		m.snapshots = nil
+	case key.Matches(msg, snapshotKeys.Up):
+		p.cursor = max(0, p.cursor-1)
+	case key.Matches(msg, snapshotKeys.Down):
+		p.cursor = max(0, min(len(p.snapshots)-1, p.cursor+1))
+	case key.Matches(msg, snapshotKeys.Save):
+		input := textinput.New()
+		input.Placeholder = "movie-night"
+		input.Prompt = "Name: "
+		input.Focus()
+		p.name = &input
+		return m, textinput.Blink
+	case key.Matches(msg, snapshotKeys.Apply):
+		if p.cursor >= len(p.snapshots) {
+			return m, nil
+		}
+		cr, t := m.cmdRunner.Run(NewCmdApplySnapshot(m.cmdRunner.client, p.snapshots[p.cursor].Name))
+		m.cmdRunner = cr
+		return m, t
+	}
+	return m, nil
+}
+
+func (p snapshotPanel) View() string {
+	var b strings.Builder
+	b.WriteString("Snapshots\n\n")
+	if len(p.snapshots) == 0 {
+		b.WriteString("No snapshots yet\n")
+	}
+	for i, s := range p.snapshots {
+		marker := "  "
+		if i == p.cursor {
+			marker = "▸ "
+		}
+		fmt.Fprintf(&b, "%s%s (%d lights, %s)\n", marker, s.Name, len(s.Lights), s.CreatedAt.Local().Format(time.DateTime))
+	}
+
+	b.WriteString("\n")
+	switch {
+	case p.name != nil:
+		b.WriteString(p.name.View() + "\n\nenter save • esc cancel")
+	default:
+		if p.err != nil {
+			b.WriteString(p.err.Error() + "\n\n")
+		}
+		keys := []key.Binding{snapshotKeys.Apply, snapshotKeys.Save, snapshotKeys.Close}
+		help := make([]string, len(keys))
+		for i, k := range keys {
+			help[i] = k.Help().Key + " " + k.Help().Desc
+		}
+		b.WriteString(strings.Join(help, " • "))
+	}
+	return b.String()
+}
+
+type CmdSaveSnapshot struct {
+	client client.Functions
+	name   string
+}
+
+func NewCmdSaveSnapshot(client client.Functions, name string) CmdSaveSnapshot {
+	return CmdSaveSnapshot{
+		client: client,
+		name:   name,
+	}
+}
+
+func (c CmdSaveSnapshot) Run() ([]wiz.Light, error) {
+	_, err := c.client.SaveSnapshot(c.name, client.Selector{All: true})
+	return nil, err
+}
+
+type CmdApplySnapshot struct {
+	client client.Functions
+	name   string
+}
+
+func NewCmdApplySnapshot(client client.Functions, name string) CmdApplySnapshot {
+	return CmdApplySnapshot{
+		client: client,
+		name:   name,
+	}
+}
+
+func (c CmdApplySnapshot) Run() ([]wiz.Light, error) {
+	return c.client.ApplySnapshot(c.name)
+}
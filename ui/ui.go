@@ -1,9 +1,13 @@
 package ui
 
 import (
+	"fmt"
 	"gowizcli/client"
+	"gowizcli/db"
 	"gowizcli/wiz"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
@@ -17,14 +21,34 @@ type Model struct {
 	help       help.Model
 	dimensions dimensions
 	tableData  tableData
+	rooms      []db.Room
+	groups     []db.Group
+	targets    [][]wiz.Light
+	headers    []bool
+	confirm    *confirmation
 	cmdRunner  CmdRunner
+	staleAfter time.Duration
+	energy     *energyPanel
+	snapshots  *snapshotPanel
+	jobs       *jobPanel
+	detail     string
 }
 
-func NewModel(client client.Functions) Model {
+// confirmation holds back a command until the user agrees to the prompt.
+type confirmation struct {
+	prompt string
+	cmd    Command
+}
+
+// NewModel builds the lights table. Lights unseen for longer than staleAfter
+// are marked stale; zero never marks them.
+func NewModel(client client.Functions, staleAfter time.Duration) Model {
 	columns := []table.Column{
+		{Title: "Name", Width: 20},
 		{Title: "IP Address", Width: 20},
 		{Title: "MAC Address", Width: 20},
 		{Title: "Status", Width: 10},
+		{Title: "Groups", Width: 10},
 		{Title: "Tags", Width: 10},
 	}
 
@@ -40,17 +64,18 @@ func NewModel(client client.Functions) Model {
 	initialStatus = initialStatus.Start()
 
 	return Model{
-		table:     t,
-		help:      help.New(),
-		tableData: tableData{},
-		cmdRunner: NewCmdRunner(client),
+		table:      t,
+		help:       help.New(),
+		tableData:  tableData{},
+		cmdRunner:  NewCmdRunner(client),
+		staleAfter: staleAfter,
 	}
 }
 
 func (m Model) Init() tea.Cmd {
 	cmd := NewCmdRefresh(m.cmdRunner.client)
 	_, t := m.cmdRunner.Run(cmd)
-	return t
+	return tea.Batch(t, loadRooms(m.cmdRunner.client))
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -59,23 +84,124 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case CmdDone:
 		m.cmdRunner = m.cmdRunner.Finalize(msg)
-		return m.handleCmdFinish(msg), nil
+		m = m.handleCmdFinish(msg)
+		if _, saved := msg.cmd.(CmdSaveSnapshot); saved && m.snapshots != nil {
+			return m, tea.Batch(loadRooms(m.cmdRunner.client), loadSnapshots(m.cmdRunner.client))
+		}
+		if m.jobs != nil {
+			return m, tea.Batch(loadRooms(m.cmdRunner.client), loadJobs(m.cmdRunner.client))
+		}
+		return m, loadRooms(m.cmdRunner.client)
+	case energyLoaded:
+		if m.energy != nil {
+			m.energy.report = msg.report
+			m.energy.err = msg.err
+		}
+		return m, nil
+	case snapshotsLoaded:
+		if m.snapshots != nil {
+			m.snapshots.snapshots = msg.snapshots
+			m.snapshots.err = msg.err
+			m.snapshots.cursor = min(m.snapshots.cursor, max(0, len(msg.snapshots)-1))
+		}
+		return m, nil
+	case jobsLoaded:
+		if m.jobs != nil {
+			m.jobs.jobs = msg.jobs
+			m.jobs.err = msg.err
+			m.jobs.cursor = min(m.jobs.cursor, max(0, len(msg.jobs)-1))
+		}
+		return m, nil
+	case roomsLoaded:
+		if msg.err == nil {
+			m.rooms = msg.rooms
+			m.groups = msg.groups
+			m = m.setRows()
+		}
+		return m, nil
 	case tea.KeyMsg:
 		var cmd Command
 
+		if m.confirm != nil {
+			if key.Matches(msg, confirmKey) {
+				cmd = m.confirm.cmd
+			}
+			m.confirm = nil
+			if cmd == nil {
+				return m, nil
+			}
+			cr, t := m.cmdRunner.Run(cmd)
+			m.cmdRunner = cr
+			return m, t
+		}
+
+		if m.detail != "" {
+			return m.updateDetail(msg)
+		}
+		if m.snapshots != nil {
+			return m.updateSnapshots(msg)
+		}
+		if m.jobs != nil {
+			return m.updateJobs(msg)
+		}
+
 		switch {
 		case key.Matches(msg, keys.Refresh.binding):
 			cmd = NewCmdRefresh(m.cmdRunner.client)
 		case key.Matches(msg, keys.Switch.binding):
-			if len(m.tableData.lights) == 0 {
+			selected := m.selected()
+			if len(selected) == 0 {
+				return m, nil
+			}
+			cmd = NewCmdSwitch(m.cmdRunner.client, selected)
+		case key.Matches(msg, keys.MatchDaylight.binding):
+			selected := m.selected()
+			if len(selected) == 0 {
 				return m, nil
 			}
-			selected := m.table.Cursor()
-			cmd = NewCmdSwitch(m.cmdRunner.client, m.tableData.lights[selected])
+			cmd = NewCmdMatchDaylight(m.cmdRunner.client, selected)
 		case key.Matches(msg, keys.Discover.binding):
 			cmd = NewCmdDiscover(m.cmdRunner.client)
+		case key.Matches(msg, keys.Details.binding):
+			if light, ok := m.selectedLight(); ok {
+				m.detail = light.Id
+			}
+			return m, nil
+		case key.Matches(msg, keys.Delete.binding):
+			light, ok := m.selectedLight()
+			if !ok {
+				return m, nil
+			}
+			m.confirm = &confirmation{
+				prompt: fmt.Sprintf("Delete %s (%s)? A backup is taken first.", lightTitle(light), light.IpAddress),
+				cmd:    NewCmdDelete(m.cmdRunner.client, light),
+			}
+			return m, nil
 		case key.Matches(msg, keys.EraseAll.binding):
-			cmd = NewCmdEraseAll(m.cmdRunner.client)
+			m.confirm = &confirmation{
+				prompt: "Erase all lights? A backup is taken first.",
+				cmd:    NewCmdEraseAll(m.cmdRunner.client),
+			}
+			return m, nil
+		case key.Matches(msg, keys.Restore.binding):
+			m.confirm = &confirmation{
+				prompt: "Replace the lights with the last backup?",
+				cmd:    NewCmdRestore(m.cmdRunner.client),
+			}
+			return m, nil
+		case key.Matches(msg, keys.Energy.binding):
+			if m.energy != nil {
+				m.energy = nil
+				return m, nil
+			}
+			m.energy = &energyPanel{}
+			return m, loadEnergy(m.cmdRunner.client, energyPeriod)
+		case key.Matches(msg, keys.Snapshots.binding):
+			m.snapshots = &snapshotPanel{}
+			return m, loadSnapshots(m.cmdRunner.client)
+		case key.Matches(msg, keys.Jobs.binding):
+			m.jobs = &jobPanel{}
+			return m, loadJobs(m.cmdRunner.client)
 		case key.Matches(msg, keys.Quit.binding):
 			return m, tea.Quit
 		}
@@ -99,6 +225,18 @@ func (m Model) View() string {
 		return lipgloss.Place(m.dimensions.window.width, m.dimensions.window.height, lipgloss.Center, lipgloss.Center, message)
 	}
 
+	if m.confirm != nil {
+		message := boxStyle.Render(m.confirm.prompt + "\n\n" + "y to confirm, any other key to cancel")
+		return lipgloss.Place(m.dimensions.window.width, m.dimensions.window.height, lipgloss.Center, lipgloss.Center, message)
+	}
+
+	if m.detail != "" {
+		if light, ok := m.findLight(m.detail); ok {
+			message := boxStyle.Render(detailView(light))
+			return lipgloss.Place(m.dimensions.window.width, m.dimensions.window.height, lipgloss.Center, lipgloss.Center, message)
+		}
+	}
+
 	if m.tableData.err != nil {
 		// TODO: better handle error display
 		return m.tableData.err.Error()
@@ -119,30 +257,70 @@ func (m Model) View() string {
 	}
 	m.table.SetColumns(cols)
 
+	tableView := m.table.View()
+	if m.energy != nil {
+		tableView = m.energy.View()
+	}
+	if m.snapshots != nil {
+		tableView = m.snapshots.View()
+	}
+	if m.jobs != nil {
+		tableView = m.jobs.View(m.cmdRunner.client)
+	}
 	tableBody := tableStyle.
 		Width(m.dimensions.table.width).
 		Height(m.dimensions.table.height).
-		Render(m.table.View())
+		Render(tableView)
 	body := lipgloss.JoinVertical(lipgloss.Left, title, tableBody, helpline)
 	return docStyle.Render(body)
 }
 
 func (m Model) handleCmdFinish(cmd CmdDone) Model {
-	switch cmd.cmd.(type) {
+	switch c := cmd.cmd.(type) {
 	case CmdDiscover:
 		m.tableData = tableData{
 			err:    cmd.err,
 			lights: merge(m.tableData.lights, cmd.lights),
 		}
-	case CmdSwitch:
+	case CmdSwitch, CmdMatchDaylight, CmdFan, CmdApplySnapshot, CmdRunJob:
 		m.tableData = tableData{
 			err:    cmd.err,
 			lights: merge(m.tableData.lights, cmd.lights),
 		}
+	case CmdDelete:
+		lights := m.tableData.lights
+		if cmd.err == nil {
+			lights = slices.DeleteFunc(slices.Clone(lights), func(l wiz.Light) bool { return l.Id == c.light.Id })
+		}
+		m.tableData = tableData{
+			err:    cmd.err,
+			lights: lights,
+		}
 	case CmdEraseAll:
+		lights := []wiz.Light{}
+		if cmd.err != nil {
+			lights = m.tableData.lights
+		}
+		m.tableData = tableData{
+			err:    cmd.err,
+			lights: lights,
+		}
+	case CmdRestore:
+		lights := cmd.lights
+		if cmd.err != nil {
+			lights = m.tableData.lights
+		}
 		m.tableData = tableData{
 			err:    cmd.err,
-			lights: []wiz.Light{},
+			lights: lights,
+		}
+	case CmdSaveSnapshot:
+		if m.snapshots != nil {
+			m.snapshots.err = cmd.err
+		}
+	case CmdSetJobEnabled, CmdDeleteJob:
+		if m.jobs != nil {
+			m.jobs.err = cmd.err
 		}
 	case CmdRefresh:
 		m.tableData = tableData{
@@ -151,15 +329,104 @@ func (m Model) handleCmdFinish(cmd CmdDone) Model {
 		}
 	}
 
-	rows := make([]table.Row, len(m.tableData.lights))
-	for i, l := range m.tableData.lights {
-		rows[i] = lightToRow(l)
+	return m.setRows()
+}
+
+// selected returns the lights under the cursor: one light, or every light of
+// a room when the cursor is on its header.
+func (m Model) selected() []wiz.Light {
+	cursor := m.table.Cursor()
+	if cursor < 0 || cursor >= len(m.targets) {
+		return nil
+	}
+	return m.targets[cursor]
+}
+
+// selectedLight returns the light under the cursor, if the cursor is on a
+// light rather than a room header.
+func (m Model) selectedLight() (wiz.Light, bool) {
+	cursor := m.table.Cursor()
+	if cursor < 0 || cursor >= len(m.targets) || m.headers[cursor] {
+		return wiz.Light{}, false
+	}
+	return m.targets[cursor][0], true
+}
+
+// setRows lays the lights out under a header per room, in the order the rooms
+// are listed, with the lights outside any room last. Without rooms the lights
+// are listed as they are.
+func (m Model) setRows() Model {
+	groupNames := make(map[string]string, len(m.groups))
+	for _, g := range m.groups {
+		groupNames[g.Id] = g.Name
+	}
+
+	var rows []table.Row
+	var targets [][]wiz.Light
+	var headers []bool
+	now := time.Now()
+	addLights := func(lights []wiz.Light, indent string) {
+		for _, l := range lights {
+			row := lightToRow(l, groupNames, m.staleAfter, now)
+			row[0] = indent + row[0]
+			rows = append(rows, row)
+			targets = append(targets, []wiz.Light{l})
+			headers = append(headers, false)
+		}
+	}
+
+	if len(m.rooms) == 0 {
+		addLights(m.tableData.lights, "")
+	} else {
+		byRoom := make(map[string][]wiz.Light, len(m.rooms))
+		known := make(map[string]bool, len(m.rooms))
+		for _, r := range m.rooms {
+			known[r.Id] = true
+		}
+		var unassigned []wiz.Light
+		for _, l := range m.tableData.lights {
+			if known[l.Room] {
+				byRoom[l.Room] = append(byRoom[l.Room], l)
+			} else {
+				unassigned = append(unassigned, l)
+			}
+		}
+
+		for _, r := range m.rooms {
+			if len(byRoom[r.Id]) == 0 {
+				continue
+			}
+			rows = append(rows, roomToRow(roomTitle(r)))
+			targets = append(targets, byRoom[r.Id])
+			headers = append(headers, true)
+			addLights(byRoom[r.Id], "  ")
+		}
+		if len(unassigned) > 0 {
+			rows = append(rows, roomToRow("No room"))
+			targets = append(targets, unassigned)
+			headers = append(headers, true)
+			addLights(unassigned, "  ")
+		}
 	}
-	m.table.SetRows(rows)
 
+	m.targets = targets
+	m.headers = headers
+	m.table.SetRows(rows)
 	return m
 }
 
+func roomTitle(r db.Room) string {
+	title := fmt.Sprintf("%s (floor %d", r.Name, r.Floor)
+	if r.Zone != "" {
+		title += ", " + r.Zone
+	}
+	return title + ")"
+}
+
+func roomToRow(title string) table.Row {
+	return table.Row{"▸ " + title, "", "", "", "", ""}
+}
+
 func merge(existing []wiz.Light, incoming []wiz.Light) []wiz.Light {
 	var existingIds = make(map[string]wiz.Light, len(existing))
 	for _, l := range existing {
@@ -182,32 +449,55 @@ func merge(existing []wiz.Light, incoming []wiz.Light) []wiz.Light {
 	return result
 }
 
-func lightToRow(l wiz.Light) table.Row {
+// lightToRow renders a light. A light that did not answer and has not been
+// seen for longer than staleAfter is flagged as stale, with how long ago it
+// was last seen.
+func lightToRow(l wiz.Light, groupNames map[string]string, staleAfter time.Duration, now time.Time) table.Row {
 	tagLine := strings.Join(l.Tags, ", ")
-	if l.IsOn != nil {
-		if *l.IsOn {
-			return table.Row{
-				l.IpAddress,
-				parseMacAddress(l.MacAddress),
-				"On",
-				tagLine,
-			}
-		} else {
-			return table.Row{
-				l.IpAddress,
-				parseMacAddress(l.MacAddress),
-				"Off",
-				tagLine,
-			}
-		}
-	} else {
-		return table.Row{
-			l.IpAddress,
-			parseMacAddress(l.MacAddress),
-			"Unknown",
-			tagLine,
-		}
+	groups := make([]string, len(l.Groups))
+	for i, g := range l.Groups {
+		groups[i] = groupNames[g]
+	}
+	groupLine := strings.Join(groups, ", ")
+
+	name := lightTitle(l)
+
+	status := "Unknown"
+	if l.IsOn != nil && *l.IsOn {
+		status = "On"
+	} else if l.IsOn != nil {
+		status = "Off"
+	} else if client.IsStale(l, staleAfter, now) {
+		name = "⚠ " + name
+		status = "Stale, " + formatAge(now.Sub(l.LastSeen))
+	}
+	if l.Watts != nil {
+		status += fmt.Sprintf(", %.0f W", *l.Watts)
+	}
+
+	return table.Row{
+		name,
+		l.IpAddress,
+		parseMacAddress(l.MacAddress),
+		status,
+		groupLine,
+		tagLine,
+	}
+}
+
+func lightTitle(l wiz.Light) string {
+	if l.Name == "" {
+		return "-"
+	}
+	return l.Name
+}
+
+// formatAge rounds an age to whole days, or hours below a day.
+func formatAge(age time.Duration) string {
+	if age >= 24*time.Hour {
+		return fmt.Sprintf("%dd", int(age/(24*time.Hour)))
 	}
+	return fmt.Sprintf("%dh", int(age/time.Hour))
 }
 
 type keyAction struct {
@@ -216,31 +506,47 @@ type keyAction struct {
 }
 
 type keyMap struct {
-	Refresh  keyAction
-	Switch   keyAction
-	Discover keyAction
-	EraseAll keyAction
-	Quit     keyAction
+	Refresh       keyAction
+	Details       keyAction
+	Switch        keyAction
+	MatchDaylight keyAction
+	Discover      keyAction
+	Delete        keyAction
+	EraseAll      keyAction
+	Restore       keyAction
+	Energy        keyAction
+	Snapshots     keyAction
+	Jobs          keyAction
+	Quit          keyAction
 }
 
 func (k keyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.Refresh.binding, k.Switch.binding, k.Discover.binding, k.EraseAll.binding, k.Quit.binding}
+	return []key.Binding{k.Refresh.binding, k.Details.binding, k.Switch.binding, k.MatchDaylight.binding, k.Discover.binding, k.Delete.binding, k.EraseAll.binding, k.Restore.binding, k.Energy.binding, k.Snapshots.binding, k.Jobs.binding, k.Quit.binding}
 }
 
 func (k keyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.Refresh.binding, k.Switch.binding, k.Discover.binding, k.EraseAll.binding, k.Quit.binding},
+		{k.Refresh.binding, k.Details.binding, k.Switch.binding, k.MatchDaylight.binding, k.Discover.binding, k.Delete.binding, k.EraseAll.binding, k.Restore.binding, k.Energy.binding, k.Snapshots.binding, k.Jobs.binding, k.Quit.binding},
 	}
 }
 
 var keys = keyMap{
-	Refresh:  keyAction{binding: key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "Refresh")), run: nil},
-	Switch:   keyAction{binding: key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "Switch light")), run: nil},
-	Discover: keyAction{binding: key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "Discover lights in network")), run: nil},
-	EraseAll: keyAction{binding: key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "Erase all lights"))},
-	Quit:     keyAction{binding: key.NewBinding(key.WithKeys("ctrl+q"), key.WithHelp("ctrl+q", "Quit program")), run: nil},
+	Refresh:       keyAction{binding: key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "Refresh")), run: nil},
+	Details:       keyAction{binding: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "Light details"))},
+	Switch:        keyAction{binding: key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "Switch light or room")), run: nil},
+	MatchDaylight: keyAction{binding: key.NewBinding(key.WithKeys("t"), key.WithHelp("t", "Match daylight temperature")), run: nil},
+	Discover:      keyAction{binding: key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "Discover lights in network")), run: nil},
+	Delete:        keyAction{binding: key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "Delete light"))},
+	EraseAll:      keyAction{binding: key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "Erase all lights"))},
+	Restore:       keyAction{binding: key.NewBinding(key.WithKeys("u"), key.WithHelp("u", "Restore last backup"))},
+	Energy:        keyAction{binding: key.NewBinding(key.WithKeys("w"), key.WithHelp("w", "Toggle energy panel"))},
+	Snapshots:     keyAction{binding: key.NewBinding(key.WithKeys("p"), key.WithHelp("p", "Snapshots"))},
+	Jobs:          keyAction{binding: key.NewBinding(key.WithKeys("c"), key.WithHelp("c", "Scheduled jobs"))},
+	Quit:          keyAction{binding: key.NewBinding(key.WithKeys("ctrl+q"), key.WithHelp("ctrl+q", "Quit program")), run: nil},
 }
 
+var confirmKey = key.NewBinding(key.WithKeys("y"))
+
 type dimensions struct {
 	window   size
 	title    size
@@ -0,0 +1,75 @@
+package wiz
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+)
+
+// PushPort is where the lights push their state to the hosts registered with
+// them.
+const PushPort = 38900
+
+// pushMac is the MAC address the lights are registered with. They only use
+// the IP address to push to.
+const pushMac = "000000000000"
+
+// Push is the state a light pushed, on a change and every few seconds.
+type Push struct {
+	MacAddress string
+	IpAddress  string
+	IsOn       bool
+	Dimming    int
+}
+
+// Register asks a light to push its state to the host at hostIp. Lights
+// forget the hosts registered with them after a while, so it is renewed.
+func (w Wiz) Register(light *Light, hostIp string) error {
+	_, err := w.query(light, &Request{
+		Id:     1,
+		Method: "registration",
+		Params: map[string]any{"phoneIp": hostIp, "phoneMac": pushMac, "register": true, "id": "1"},
+	})
+	return err
+}
+
+// HostAddress returns the address of this host on the way to a light, the
+// one to register with it.
+func HostAddress(light *Light) (string, error) {
+	conn, err := net.Dial("udp4", net.JoinHostPort(light.IpAddress, bulbPort))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
+
+// ListenPush passes push the states the lights send to conn, until conn is
+// closed. Messages other than states are ignored.
+func ListenPush(conn net.PacketConn, push func(Push)) error {
+	buffer := make([]byte, 1024)
+	for {
+		n, source, err := conn.ReadFrom(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if p, ok := parsePush(buffer[:n]); ok {
+			p.IpAddress = source.(*net.UDPAddr).IP.String()
+			push(p)
+		}
+	}
+}
+
+func parsePush(message []byte) (Push, bool) {
+	var sync struct {
+		Method string         `json:"method"`
+		Params ResponseResult `json:"params"`
+	}
+	if err := json.Unmarshal(message, &sync); err != nil || sync.Method != "syncPilot" || sync.Params.Mac == "" {
+		return Push{}, false
+	}
+	return Push{MacAddress: sync.Params.Mac, IsOn: sync.Params.State, Dimming: sync.Params.Dimming}, true
+}
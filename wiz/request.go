@@ -14,6 +14,10 @@ type RequestBuilder interface {
 	WithSpeed(speed int) RequestBuilder
 	WithScene(scene Scene) RequestBuilder
 	WithState(state bool) RequestBuilder
+	WithFanState(on bool) RequestBuilder
+	WithFanSpeed(speed int) RequestBuilder
+	WithFanMode(mode FanMode) RequestBuilder
+	WithFanReverse(reverse bool) RequestBuilder
 	Build() *Request
 }
 
@@ -67,6 +71,33 @@ func (w requestBuilder) WithState(state bool) RequestBuilder {
 	return w
 }
 
+func (w requestBuilder) WithFanState(on bool) RequestBuilder {
+	w.request.Params["fanState"] = boolToInt(on)
+	return w
+}
+
+func (w requestBuilder) WithFanSpeed(speed int) RequestBuilder {
+	w.request.Params["fanSpeed"] = speed
+	return w
+}
+
+func (w requestBuilder) WithFanMode(mode FanMode) RequestBuilder {
+	w.request.Params["fanMode"] = mode
+	return w
+}
+
+func (w requestBuilder) WithFanReverse(reverse bool) RequestBuilder {
+	w.request.Params["fanRevrs"] = boolToInt(reverse)
+	return w
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func (w requestBuilder) Build() *Request {
 	return w.request
 }
@@ -75,13 +106,30 @@ type Response struct {
 	Method string         `json:"method"`
 	Env    string         `json:"env"`
 	Result ResponseResult `json:"result"`
+	Error  *ResponseError `json:"error"`
 }
 
 type ResponseResult struct {
-	Mac     string `json:"mac"`
-	Rssi    int    `json:"rssi"`
-	State   bool   `json:"state"`
-	SceneId int    `json:"sceneId"`
-	Temp    int    `json:"temp"`
-	Dimming int    `json:"dimming"`
+	Mac        string `json:"mac"`
+	Rssi       int    `json:"rssi"`
+	State      bool   `json:"state"`
+	SceneId    int    `json:"sceneId"`
+	Temp       int    `json:"temp"`
+	Dimming    int    `json:"dimming"`
+	Speed      int    `json:"speed"`
+	R          *int   `json:"r"`
+	G          *int   `json:"g"`
+	B          *int   `json:"b"`
+	ModuleName string `json:"moduleName"`
+	Power      int    `json:"power"`
+	// The fan fields are only reported by fans.
+	FanState *int    `json:"fanState"`
+	FanSpeed int     `json:"fanSpeed"`
+	FanMode  FanMode `json:"fanMode"`
+	FanRevrs int     `json:"fanRevrs"`
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
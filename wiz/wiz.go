@@ -3,6 +3,8 @@ package wiz
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -45,20 +47,72 @@ const (
 	Rhythm       Scene = 1000
 )
 
+// sceneNames are the names of the scenes as the WiZ app shows them.
+var sceneNames = map[Scene]string{
+	Ocean: "Ocean", Romance: "Romance", Sunset: "Sunset", Party: "Party",
+	Fireplace: "Fireplace", Cozy: "Cozy", Forest: "Forest", PastelColors: "Pastel colors",
+	WakeUp: "Wake up", Bedtime: "Bedtime", WarmWhite: "Warm white", Daylight: "Daylight",
+	CoolWhite: "Cool white", NightLight: "Night light", Focus: "Focus", Relax: "Relax",
+	TrueColors: "True colors", TVTime: "TV time", PlantGrowth: "Plant growth", Spring: "Spring",
+	Summer: "Summer", Fall: "Fall", DeepDive: "Deep dive", Jungle: "Jungle",
+	Mojito: "Mojito", Club: "Club", Christmas: "Christmas", Halloween: "Halloween",
+	Candlelight: "Candlelight", GoldenWhite: "Golden white", Pulse: "Pulse", Steampunk: "Steampunk",
+	Rhythm: "Rhythm",
+}
+
+// ParseScene finds a scene by name, ignoring case, spaces, dashes and
+// underscores, so that "TV time", "tv-time" and "TVTime" all name TVTime.
+func ParseScene(name string) (Scene, error) {
+	key := sceneKey(name)
+	for scene, sceneName := range sceneNames {
+		if sceneKey(sceneName) == key {
+			return scene, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown scene %q", name)
+}
+
+func sceneKey(name string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "", "_", "").Replace(name))
+}
+
 type Client interface {
 	Discover() ([]Light, error)
 	TurnOn(light *Light) (*Light, error)
 	TurnOff(light *Light) (*Light, error)
 	Status(light *Light) (*Light, error)
 	SetScene(light *Light, scene Scene) (*Light, error)
+	SetTemperature(light *Light, kelvin int) (*Light, error)
+	Model(light *Light) (string, error)
+	Power(light *Light) (float64, error)
+	SetFan(light *Light, on bool) (*Light, error)
+	SetFanSpeed(light *Light, speed int) (*Light, error)
+	SetFanMode(light *Light, mode FanMode) (*Light, error)
+	SetFanDirection(light *Light, reverse bool) (*Light, error)
+	GetPilot(light *Light) (*Pilot, error)
+	SetPilot(light *Light, pilot Pilot) (*Light, error)
+	SendPilot(light *Light, pilot Pilot) error
 }
 
 type Light struct {
 	Id         string
+	Name       string
 	MacAddress string
 	IpAddress  string
 	IsOn       *bool
-	Tags       []string
+	// Dimming is the brightness in percent, 0 when unknown.
+	Dimming int
+	// Model is the module name the device reports, such as ESP01_SHRGB1C_31,
+	// which tells its Kind.
+	Model string
+	// Watts is the power drawn, only known for devices that measure it.
+	Watts *float64
+	// Fan is the state of the fan, only known for fans.
+	Fan      *Fan
+	Tags     []string
+	Room     string
+	Groups   []string
+	LastSeen time.Time
 }
 
 type Wiz struct {
@@ -97,6 +151,7 @@ func (w Wiz) Discover() ([]Light, error) {
 				Id:         uuid.New().String(),
 				MacAddress: getPilotResult.Result.Mac,
 				IpAddress:  r.Source,
+				Fan:        getPilotResult.Result.fan(),
 			})
 		}
 	}
@@ -181,12 +236,182 @@ func (w Wiz) Status(light *Light) (*Light, error) {
 			MacAddress: light.MacAddress,
 			IpAddress:  light.IpAddress,
 			IsOn:       &getPilotResult.Result.State,
+			Dimming:    getPilotResult.Result.Dimming,
+			Fan:        getPilotResult.Result.fan(),
 		}, nil
 	}
 
 	return nil, fmt.Errorf("device on address %s did not respond", light.IpAddress)
 }
 
+// Model asks a device for its module name, which tells its kind and model.
+func (w Wiz) Model(light *Light) (string, error) {
+	response, err := w.query(light, NewRequestBuilder().WithMethod("getSystemConfig").Build())
+	if err != nil {
+		return "", err
+	}
+	return response.Result.ModuleName, nil
+}
+
+// Power asks a device for the watts it draws. Only the devices that
+// MeasuresPower answer it; others answer with an error.
+func (w Wiz) Power(light *Light) (float64, error) {
+	response, err := w.query(light, NewRequestBuilder().WithMethod("getPower").Build())
+	if err != nil {
+		return 0, err
+	}
+	return float64(response.Result.Power) / 1000, nil
+}
+
+func (w Wiz) SetFan(light *Light, on bool) (*Light, error) {
+	return w.setPilot(light, NewRequestBuilder().WithFanState(on))
+}
+
+// SetFanSpeed sets the speed of a fan, from 1 to MaxFanSpeed.
+func (w Wiz) SetFanSpeed(light *Light, speed int) (*Light, error) {
+	speed = max(1, min(MaxFanSpeed, speed))
+	return w.setPilot(light, NewRequestBuilder().WithFanSpeed(speed))
+}
+
+func (w Wiz) SetFanMode(light *Light, mode FanMode) (*Light, error) {
+	return w.setPilot(light, NewRequestBuilder().WithFanMode(mode))
+}
+
+// SetFanDirection makes a fan turn forward, pushing air down, or in reverse.
+func (w Wiz) SetFanDirection(light *Light, reverse bool) (*Light, error) {
+	return w.setPilot(light, NewRequestBuilder().WithFanReverse(reverse))
+}
+
+// GetPilot reads the full state of a light, to be set back with SetPilot.
+func (w Wiz) GetPilot(light *Light) (*Pilot, error) {
+	response, err := w.query(light, NewRequestBuilder().WithMethod("getPilot").Build())
+	if err != nil {
+		return nil, err
+	}
+
+	r := response.Result
+	pilot := Pilot{IsOn: r.State, Dimming: r.Dimming}
+	switch {
+	case r.SceneId != 0:
+		pilot.Scene, pilot.Speed = Scene(r.SceneId), r.Speed
+	case r.Temp != 0:
+		pilot.Temp = r.Temp
+	case r.R != nil && r.G != nil && r.B != nil:
+		pilot.Color = &Rgb{R: *r.R, G: *r.G, B: *r.B}
+	}
+	return &pilot, nil
+}
+
+// SetPilot sets the state of a light as GetPilot read it.
+func (w Wiz) SetPilot(light *Light, pilot Pilot) (*Light, error) {
+	return w.setPilot(light, pilotRequest(pilot))
+}
+
+// SendPilot sets the state of a light without asking for its status after,
+// for the many steps of a transition.
+func (w Wiz) SendPilot(light *Light, pilot Pilot) error {
+	_, err := w.query(light, pilotRequest(pilot).WithMethod("setPilot").Build())
+	return err
+}
+
+// pilotRequest builds the setPilot of a state. A light turned off keeps the
+// dimming it is sent, so that a fade out does not leave it at its lowest.
+func pilotRequest(pilot Pilot) RequestBuilder {
+	request := NewRequestBuilder().WithState(pilot.IsOn)
+	if pilot.Dimming > 0 {
+		request = request.WithDimming(pilot.Dimming)
+	}
+	if !pilot.IsOn {
+		return request
+	}
+
+	switch {
+	case pilot.Scene != 0:
+		request = request.WithScene(pilot.Scene)
+		if pilot.Speed > 0 {
+			request = request.WithSpeed(pilot.Speed)
+		}
+	case pilot.Temp != 0:
+		request = request.WithTemp(max(MinTemperatureK, min(MaxTemperatureK, pilot.Temp)))
+	case pilot.Color != nil:
+		request = request.WithRgb(pilot.Color.R, pilot.Color.G, pilot.Color.B)
+	}
+	return request
+}
+
+func (w Wiz) setPilot(light *Light, request RequestBuilder) (*Light, error) {
+	if _, err := w.query(light, request.WithMethod("setPilot").Build()); err != nil {
+		return nil, err
+	}
+	return w.Status(light)
+}
+
+// query sends a request to a single device and decodes its answer.
+func (w Wiz) query(light *Light, request *Request) (*Response, error) {
+	message, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	query := BulbQuery{
+		Destination: light.IpAddress,
+		Message:     message,
+		TimeoutSecs: w.NetConfig.QueryTimeoutSec,
+	}
+	queryResponse, err := w.BulbClient.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(queryResponse) == 0 {
+		return nil, fmt.Errorf("device on address %s did not respond", light.IpAddress)
+	}
+
+	response := Response{}
+	if err := json.Unmarshal(queryResponse[0].Response, &response); err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, fmt.Errorf("device on address %s: %s", light.IpAddress, response.Error.Message)
+	}
+	return &response, nil
+}
+
+// Kind is the sort of device, which tells the commands it takes.
+type Kind string
+
+const (
+	KindBulb Kind = "bulb"
+	KindPlug Kind = "plug"
+	KindFan  Kind = "fan"
+)
+
+// KindOf tells the kind of a device by its model. Devices of an unknown
+// model are taken as bulbs, the most common kind.
+func KindOf(model string) Kind {
+	switch {
+	case strings.Contains(model, "SOCKET"):
+		return KindPlug
+	case strings.Contains(model, "FANDIMS"):
+		return KindFan
+	default:
+		return KindBulb
+	}
+}
+
+// Kind tells the kind of a device by its model or, before its model is
+// known, by whether it reported the state of a fan.
+func (l Light) Kind() Kind {
+	if l.Fan != nil {
+		return KindFan
+	}
+	return KindOf(l.Model)
+}
+
+// MeasuresPower tells whether a device answers Power.
+func (l Light) MeasuresPower() bool {
+	return l.Kind() == KindPlug
+}
+
 func (w Wiz) SetScene(light *Light, scene Scene) (*Light, error) {
 	setScene := NewRequestBuilder().
 		WithMethod("setPilot").
@@ -209,3 +434,89 @@ func (w Wiz) SetScene(light *Light, scene Scene) (*Light, error) {
 
 	return w.Status(light)
 }
+
+func (w Wiz) SetTemperature(light *Light, kelvin int) (*Light, error) {
+	kelvin = max(MinTemperatureK, min(MaxTemperatureK, kelvin))
+	return w.setPilot(light, NewRequestBuilder().WithTemp(kelvin))
+}
+
+const (
+	MinTemperatureK = 2200
+	MaxTemperatureK = 6500
+)
+
+// MinDimming is the lowest dimming the lights take.
+const MinDimming = 10
+
+// Pilot is the full state of a light: whether it is on, its dimming and
+// either a scene, a white temperature or a color.
+type Pilot struct {
+	IsOn    bool  `json:"isOn" yaml:"isOn"`
+	Dimming int   `json:"dimming,omitempty" yaml:"dimming,omitempty"`
+	Scene   Scene `json:"scene,omitempty" yaml:"scene,omitempty"`
+	Speed   int   `json:"speed,omitempty" yaml:"speed,omitempty"`
+	Temp    int   `json:"temp,omitempty" yaml:"temp,omitempty"`
+	Color   *Rgb  `json:"color,omitempty" yaml:"color,omitempty"`
+}
+
+type Rgb struct {
+	R int `json:"r" yaml:"r"`
+	G int `json:"g" yaml:"g"`
+	B int `json:"b" yaml:"b"`
+}
+
+func (p Pilot) String() string {
+	if !p.IsOn {
+		return "off"
+	}
+	s := "on"
+	if p.Dimming > 0 {
+		s += fmt.Sprintf(", %d%%", p.Dimming)
+	}
+	switch {
+	case p.Scene != 0:
+		s += fmt.Sprintf(", scene %d", p.Scene)
+	case p.Temp != 0:
+		s += fmt.Sprintf(", %dK", p.Temp)
+	case p.Color != nil:
+		s += fmt.Sprintf(", #%02x%02x%02x", p.Color.R, p.Color.G, p.Color.B)
+	}
+	return s
+}
+
+// Equal compares pilots by value, Color included.
+func (p Pilot) Equal(other Pilot) bool {
+	if (p.Color == nil) != (other.Color == nil) || (p.Color != nil && *p.Color != *other.Color) {
+		return false
+	}
+	p.Color, other.Color = nil, nil
+	return p == other
+}
+
+type FanMode int
+
+const (
+	FanNormal FanMode = 1
+	FanBreeze FanMode = 2
+)
+
+const MaxFanSpeed = 6
+
+type Fan struct {
+	IsOn    bool
+	Speed   int
+	Mode    FanMode
+	Reverse bool
+}
+
+func (r ResponseResult) fan() *Fan {
+	if r.FanState == nil {
+		return nil
+	}
+	return &Fan{
+		IsOn:    *r.FanState == 1,
+		Speed:   r.FanSpeed,
+		Mode:    r.FanMode,
+		Reverse: r.FanRevrs == 1,
+	}
+}
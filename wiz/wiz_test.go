@@ -2,6 +2,7 @@ package wiz
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -33,6 +34,246 @@ func TestWizDiscover(t *testing.T) {
 	}
 }
 
+func TestWizPower(t *testing.T) {
+	var tests = []struct {
+		response string
+		want     float64
+		wantErr  bool
+	}{
+		{"{\"method\":\"getPower\",\"env\":\"pro\",\"result\":{\"power\":12345}}", 12.345, false},
+		{"{\"method\":\"getPower\",\"env\":\"pro\",\"error\":{\"code\":-32601,\"message\":\"Method not found\"}}", 0, true},
+	}
+
+	for i, tt := range tests {
+		wiz := Wiz{
+			BulbClient: MockBulbClient{MockResponse: BulbResponse{Source: "192.168.1.174", Response: []byte(tt.response)}},
+			NetConfig:  NetworkConfig{QueryTimeoutSec: 1},
+		}
+		t.Run(fmt.Sprintf("Test %d", i+1), func(t *testing.T) {
+			got, err := wiz.Power(&Light{IpAddress: "192.168.1.174"})
+
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Got %v, %v but want %v\n", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWizModel(t *testing.T) {
+	wiz := Wiz{
+		BulbClient: MockBulbClient{MockResponse: BulbResponse{
+			Source:   "192.168.1.174",
+			Response: []byte("{\"method\":\"getSystemConfig\",\"env\":\"pro\",\"result\":{\"mac\":\"cc40857ce53c\",\"moduleName\":\"ESP10_SOCKET_06\"}}"),
+		}},
+		NetConfig: NetworkConfig{QueryTimeoutSec: 1},
+	}
+
+	got, err := wiz.Model(&Light{IpAddress: "192.168.1.174"})
+	if err != nil || got != "ESP10_SOCKET_06" || KindOf(got) != KindPlug {
+		t.Errorf("Got %s, %v but want a smart plug model\n", got, err)
+	}
+}
+
+func TestWizStatusOfFan(t *testing.T) {
+	wiz := Wiz{
+		BulbClient: MockBulbClient{MockResponse: BulbResponse{
+			Source:   "192.168.1.174",
+			Response: []byte("{\"method\":\"getPilot\",\"env\":\"pro\",\"result\":{\"mac\":\"cc40857ce53c\",\"state\":true,\"dimming\":50,\"fanState\":1,\"fanSpeed\":3,\"fanMode\":2,\"fanRevrs\":1}}"),
+		}},
+		NetConfig: NetworkConfig{QueryTimeoutSec: 1},
+	}
+
+	got, err := wiz.Status(&Light{IpAddress: "192.168.1.174"})
+	if err != nil {
+		t.Fatalf("Unexpected error %v\n", err)
+	}
+	want := Fan{IsOn: true, Speed: 3, Mode: FanBreeze, Reverse: true}
+	if got.Fan == nil || *got.Fan != want || got.Kind() != KindFan || got.Dimming != 50 {
+		t.Errorf("Got %+v but want fan %+v\n", got, want)
+	}
+}
+
+func TestRequestBuilderFan(t *testing.T) {
+	request := NewRequestBuilder().
+		WithMethod("setPilot").
+		WithFanState(true).
+		WithFanSpeed(4).
+		WithFanMode(FanNormal).
+		WithFanReverse(false).
+		Build()
+
+	want := map[string]any{"fanState": 1, "fanSpeed": 4, "fanMode": FanNormal, "fanRevrs": 0}
+	for k, v := range want {
+		if request.Params[k] != v {
+			t.Errorf("Got %s = %v but want %v\n", k, request.Params[k], v)
+		}
+	}
+}
+
+func TestWizGetPilot(t *testing.T) {
+	var tests = []struct {
+		response string
+		want     Pilot
+	}{
+		{"{\"result\":{\"state\":true,\"sceneId\":8,\"speed\":100,\"dimming\":40}}", Pilot{IsOn: true, Dimming: 40, Scene: PastelColors, Speed: 100}},
+		{"{\"result\":{\"state\":true,\"temp\":2700,\"dimming\":100}}", Pilot{IsOn: true, Dimming: 100, Temp: 2700}},
+		{"{\"result\":{\"state\":true,\"r\":255,\"g\":0,\"b\":64,\"dimming\":10}}", Pilot{IsOn: true, Dimming: 10, Color: &Rgb{R: 255, G: 0, B: 64}}},
+		{"{\"result\":{\"state\":false,\"temp\":2700,\"dimming\":100}}", Pilot{IsOn: false, Dimming: 100, Temp: 2700}},
+	}
+
+	for i, tt := range tests {
+		wiz := Wiz{
+			BulbClient: MockBulbClient{MockResponse: BulbResponse{Source: "192.168.1.174", Response: []byte(tt.response)}},
+			NetConfig:  NetworkConfig{QueryTimeoutSec: 1},
+		}
+		t.Run(fmt.Sprintf("Test %d", i+1), func(t *testing.T) {
+			got, err := wiz.GetPilot(&Light{IpAddress: "192.168.1.174"})
+
+			if err != nil || !got.Equal(tt.want) {
+				t.Errorf("Got %+v, %v but want %+v\n", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWizSetPilot(t *testing.T) {
+	var tests = []struct {
+		pilot Pilot
+		want  string
+	}{
+		{Pilot{IsOn: true, Dimming: 40, Scene: PastelColors, Speed: 100}, `{"id":1,"method":"setPilot","params":{"dimming":40,"sceneId":8,"speed":100,"state":true}}`},
+		{Pilot{IsOn: true, Dimming: 100, Temp: 9000}, `{"id":1,"method":"setPilot","params":{"dimming":100,"state":true,"temp":6500}}`},
+		{Pilot{IsOn: true, Color: &Rgb{R: 255, G: 0, B: 64}}, `{"id":1,"method":"setPilot","params":{"b":64,"g":0,"r":255,"state":true}}`},
+		{Pilot{IsOn: false, Dimming: 100, Temp: 2700}, `{"id":1,"method":"setPilot","params":{"dimming":100,"state":false}}`},
+		{Pilot{IsOn: false, Temp: 2700}, `{"id":1,"method":"setPilot","params":{"state":false}}`},
+	}
+
+	for i, tt := range tests {
+		bulbClient := &RecordingBulbClient{}
+		wiz := Wiz{BulbClient: bulbClient, NetConfig: NetworkConfig{QueryTimeoutSec: 1}}
+		t.Run(fmt.Sprintf("Test %d", i+1), func(t *testing.T) {
+			wiz.SetPilot(&Light{IpAddress: "192.168.1.174"}, tt.pilot)
+
+			if len(bulbClient.Messages) == 0 || bulbClient.Messages[0] != tt.want {
+				t.Errorf("Got %v but want %s\n", bulbClient.Messages, tt.want)
+			}
+		})
+	}
+}
+
+func TestWizSetTemperature(t *testing.T) {
+	bulbClient := &RecordingBulbClient{}
+	wiz := Wiz{BulbClient: bulbClient, NetConfig: NetworkConfig{QueryTimeoutSec: 1}}
+	wiz.SetTemperature(&Light{IpAddress: "192.168.1.174"}, 9000)
+	want := `{"id":1,"method":"setPilot","params":{"temp":6500}}`
+	if len(bulbClient.Messages) == 0 || bulbClient.Messages[0] != want {
+		t.Errorf("Got %v but want %s\n", bulbClient.Messages, want)
+	}
+
+	wiz = Wiz{
+		BulbClient: MockBulbClient{MockResponse: BulbResponse{
+			Source:   "192.168.1.174",
+			Response: []byte("{\"method\":\"setPilot\",\"env\":\"pro\",\"error\":{\"code\":-32600,\"message\":\"Invalid Request\"}}"),
+		}},
+		NetConfig: NetworkConfig{QueryTimeoutSec: 1},
+	}
+	if _, err := wiz.SetTemperature(&Light{IpAddress: "192.168.1.174"}, 2700); err == nil || !strings.Contains(err.Error(), "Invalid Request") {
+		t.Errorf("Got %v but want the error of the bulb\n", err)
+	}
+}
+
+func TestWizSendPilot(t *testing.T) {
+	bulbClient := &RecordingBulbClient{}
+	wiz := Wiz{BulbClient: bulbClient, NetConfig: NetworkConfig{QueryTimeoutSec: 1}}
+
+	err := wiz.SendPilot(&Light{IpAddress: "192.168.1.174"}, Pilot{IsOn: true, Dimming: 55, Temp: 3100})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"id":1,"method":"setPilot","params":{"dimming":55,"state":true,"temp":3100}}`
+	if len(bulbClient.Messages) != 1 || bulbClient.Messages[0] != want {
+		t.Errorf("Got %v but want only %s\n", bulbClient.Messages, want)
+	}
+}
+
+func TestWizRegister(t *testing.T) {
+	bulbClient := &RecordingBulbClient{}
+	wiz := Wiz{BulbClient: bulbClient, NetConfig: NetworkConfig{QueryTimeoutSec: 1}}
+
+	if err := wiz.Register(&Light{IpAddress: "192.168.1.174"}, "192.168.1.10"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"id":1,"method":"registration","params":{"id":"1","phoneIp":"192.168.1.10","phoneMac":"000000000000","register":true}}`
+	if len(bulbClient.Messages) != 1 || bulbClient.Messages[0] != want {
+		t.Errorf("Got %v but want only %s\n", bulbClient.Messages, want)
+	}
+}
+
+func TestParsePush(t *testing.T) {
+	var tests = []struct {
+		message string
+		want    Push
+		ok      bool
+	}{
+		{`{"method":"syncPilot","env":"pro","params":{"mac":"cc40857ce53c","rssi":-60,"src":"udp","state":true,"sceneId":0,"temp":2700,"dimming":45}}`, Push{MacAddress: "cc40857ce53c", IsOn: true, Dimming: 45}, true},
+		{`{"method":"syncPilot","params":{"mac":"cc40857ce53c","state":false}}`, Push{MacAddress: "cc40857ce53c"}, true},
+		{`{"method":"firstBeat","params":{"mac":"cc40857ce53c"}}`, Push{}, false},
+		{`not json`, Push{}, false},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("Test %d", i+1), func(t *testing.T) {
+			got, ok := parsePush([]byte(tt.message))
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("Got %+v, %v but want %+v, %v\n", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	var tests = []struct {
+		model string
+		want  Kind
+	}{
+		{"ESP01_SHRGB1C_31", KindBulb},
+		{"ESP10_SOCKET_06", KindPlug},
+		{"ESP20_FANDIMS_01", KindFan},
+		{"", KindBulb},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			if got := KindOf(tt.model); got != tt.want {
+				t.Errorf("Got %s but want %s\n", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScene(t *testing.T) {
+	var tests = []struct {
+		name  string
+		want  Scene
+		fails bool
+	}{
+		{"Cozy", Cozy, false},
+		{"tv time", TVTime, false},
+		{"TVTime", TVTime, false},
+		{"warm-white", WarmWhite, false},
+		{"disco", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScene(tt.name)
+			if got != tt.want || (err != nil) != tt.fails {
+				t.Errorf("Got %d, %v but want %d\n", got, err, tt.want)
+			}
+		})
+	}
+}
+
 type MockBulbClient struct {
 	MockResponse BulbResponse
 }
@@ -43,3 +284,14 @@ func (m MockBulbClient) Query(query BulbQuery) ([]BulbResponse, error) {
 	response = append(response, m.MockResponse)
 	return response, nil
 }
+
+// RecordingBulbClient keeps the messages it is sent and answers them with an
+// empty result.
+type RecordingBulbClient struct {
+	Messages []string
+}
+
+func (r *RecordingBulbClient) Query(query BulbQuery) ([]BulbResponse, error) {
+	r.Messages = append(r.Messages, string(query.Message))
+	return []BulbResponse{{Source: query.Destination, Response: []byte("{\"result\":{}}")}}, nil
+}
@@ -0,0 +1,219 @@
+// Package wiztest provides a wiz.Client that keeps the state of the lights in
+// memory, and an inventory of lights to drive with it, for the tests of the
+// packages built on wiz.
+package wiztest
+
+import (
+	"fmt"
+	"gowizcli/db"
+	"gowizcli/wiz"
+	"strings"
+	"sync"
+)
+
+// Client keeps the state of each light by IP address. Its maps may be set up
+// before use, and read through Pilot and IsOn meanwhile. Sent keeps every
+// pilot sent to a light, as the steps of its transitions, and Discovered is
+// what Discover finds. Lights without a model, watts or a fan answer as the
+// lights that do not have them.
+type Client struct {
+	Discovered  []wiz.Light
+	Pilots      map[string]wiz.Pilot
+	Sent        map[string][]wiz.Pilot
+	Unreachable map[string]bool
+	Models      map[string]string
+	Watts       map[string]float64
+	Fans        map[string]*wiz.Fan
+
+	mu sync.Mutex
+}
+
+func NewClient(discovered ...wiz.Light) *Client {
+	return &Client{
+		Discovered:  discovered,
+		Pilots:      make(map[string]wiz.Pilot),
+		Sent:        make(map[string][]wiz.Pilot),
+		Unreachable: make(map[string]bool),
+		Models:      make(map[string]string),
+		Watts:       make(map[string]float64),
+		Fans:        make(map[string]*wiz.Fan),
+	}
+}
+
+// Inventory stores n lights in memory, with ids 1 to n, MAC addresses aa, bb
+// and so on, and IP addresses 10.0.0.1 to 10.0.0.n.
+func Inventory(n int) *db.MemoryDB {
+	storage := db.NewMemoryDB()
+	for i := range n {
+		storage.Upsert(wiz.Light{
+			Id:         fmt.Sprint(i + 1),
+			MacAddress: strings.Repeat(string(rune('a'+i)), 2),
+			IpAddress:  fmt.Sprintf("10.0.0.%d", i+1),
+		})
+	}
+	return storage
+}
+
+// Pilot returns the state of a light.
+func (c *Client) Pilot(ip string) wiz.Pilot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Pilots[ip]
+}
+
+func (c *Client) IsOn(ip string) bool {
+	return c.Pilot(ip).IsOn
+}
+
+// update changes the state of a light as a command does.
+func (c *Client) update(light *wiz.Light, change func(*wiz.Pilot)) (*wiz.Light, error) {
+	c.mu.Lock()
+	if c.Unreachable[light.IpAddress] {
+		c.mu.Unlock()
+		return nil, unreachable(light)
+	}
+	pilot := c.Pilots[light.IpAddress]
+	change(&pilot)
+	c.Pilots[light.IpAddress] = pilot
+	c.mu.Unlock()
+	return c.Status(light)
+}
+
+func unreachable(light *wiz.Light) error {
+	return fmt.Errorf("device on address %s did not respond", light.IpAddress)
+}
+
+func (c *Client) Discover() ([]wiz.Light, error) {
+	return c.Discovered, nil
+}
+
+func (c *Client) TurnOn(light *wiz.Light) (*wiz.Light, error) {
+	return c.update(light, func(p *wiz.Pilot) { p.IsOn = true })
+}
+
+func (c *Client) TurnOff(light *wiz.Light) (*wiz.Light, error) {
+	return c.update(light, func(p *wiz.Pilot) { p.IsOn = false })
+}
+
+func (c *Client) Status(light *wiz.Light) (*wiz.Light, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Unreachable[light.IpAddress] {
+		return nil, unreachable(light)
+	}
+	pilot := c.Pilots[light.IpAddress]
+	var fan *wiz.Fan
+	if c.Fans[light.IpAddress] != nil {
+		state := *c.Fans[light.IpAddress]
+		fan = &state
+	}
+	return &wiz.Light{
+		Id:         light.Id,
+		MacAddress: light.MacAddress,
+		IpAddress:  light.IpAddress,
+		IsOn:       &pilot.IsOn,
+		Dimming:    pilot.Dimming,
+		Fan:        fan,
+	}, nil
+}
+
+func (c *Client) SetScene(light *wiz.Light, scene wiz.Scene) (*wiz.Light, error) {
+	return c.update(light, func(p *wiz.Pilot) {
+		*p = wiz.Pilot{IsOn: true, Dimming: p.Dimming, Scene: scene}
+	})
+}
+
+func (c *Client) SetTemperature(light *wiz.Light, kelvin int) (*wiz.Light, error) {
+	return c.update(light, func(p *wiz.Pilot) {
+		*p = wiz.Pilot{IsOn: true, Dimming: p.Dimming, Temp: kelvin}
+	})
+}
+
+func (c *Client) Model(light *wiz.Light) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Unreachable[light.IpAddress] {
+		return "", unreachable(light)
+	}
+	model, ok := c.Models[light.IpAddress]
+	if !ok {
+		return "", fmt.Errorf("device on address %s: Method not found", light.IpAddress)
+	}
+	return model, nil
+}
+
+func (c *Client) Power(light *wiz.Light) (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	watts, ok := c.Watts[light.IpAddress]
+	if !ok {
+		return 0, fmt.Errorf("device on address %s: Method not found", light.IpAddress)
+	}
+	return watts, nil
+}
+
+func (c *Client) GetPilot(light *wiz.Light) (*wiz.Pilot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Unreachable[light.IpAddress] {
+		return nil, unreachable(light)
+	}
+	pilot := c.Pilots[light.IpAddress]
+	return &pilot, nil
+}
+
+// SetPilot keeps the dimming when not given, as the lights do.
+func (c *Client) SetPilot(light *wiz.Light, pilot wiz.Pilot) (*wiz.Light, error) {
+	return c.update(light, func(p *wiz.Pilot) { *p = withDimming(pilot, p.Dimming) })
+}
+
+func (c *Client) SendPilot(light *wiz.Light, pilot wiz.Pilot) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Unreachable[light.IpAddress] {
+		return unreachable(light)
+	}
+	c.Pilots[light.IpAddress] = withDimming(pilot, c.Pilots[light.IpAddress].Dimming)
+	c.Sent[light.IpAddress] = append(c.Sent[light.IpAddress], pilot)
+	return nil
+}
+
+func withDimming(pilot wiz.Pilot, dimming int) wiz.Pilot {
+	if pilot.Dimming == 0 {
+		pilot.Dimming = dimming
+	}
+	return pilot
+}
+
+func (c *Client) SetFan(light *wiz.Light, on bool) (*wiz.Light, error) {
+	return c.updateFan(light, func(f *wiz.Fan) { f.IsOn = on })
+}
+
+func (c *Client) SetFanSpeed(light *wiz.Light, speed int) (*wiz.Light, error) {
+	return c.updateFan(light, func(f *wiz.Fan) { f.Speed = speed })
+}
+
+func (c *Client) SetFanMode(light *wiz.Light, mode wiz.FanMode) (*wiz.Light, error) {
+	return c.updateFan(light, func(f *wiz.Fan) { f.Mode = mode })
+}
+
+func (c *Client) SetFanDirection(light *wiz.Light, reverse bool) (*wiz.Light, error) {
+	return c.updateFan(light, func(f *wiz.Fan) { f.Reverse = reverse })
+}
+
+func (c *Client) updateFan(light *wiz.Light, change func(*wiz.Fan)) (*wiz.Light, error) {
+	c.mu.Lock()
+	fan := c.Fans[light.IpAddress]
+	if fan == nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("device on address %s is not a fan", light.IpAddress)
+	}
+	change(fan)
+	c.mu.Unlock()
+	return c.Status(light)
+}